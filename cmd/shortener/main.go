@@ -2,17 +2,42 @@ package main
 
 import (
 	"context"
+	"errors"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"net/url"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+
+	"github.com/Erlast/short-url.git/internal/app/accounts"
+	"github.com/Erlast/short-url.git/internal/app/analytics"
+	"github.com/Erlast/short-url.git/internal/app/certs"
 	"github.com/Erlast/short-url.git/internal/app/components"
 	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/deletion"
+	"github.com/Erlast/short-url.git/internal/app/grpcserver"
 	"github.com/Erlast/short-url.git/internal/app/logger"
+	"github.com/Erlast/short-url.git/internal/app/metrics"
+	"github.com/Erlast/short-url.git/internal/app/middlewares"
 	"github.com/Erlast/short-url.git/internal/app/routes"
+	"github.com/Erlast/short-url.git/internal/app/schedule"
 	"github.com/Erlast/short-url.git/internal/app/storages"
 )
 
+const readHeaderTimeout = 10 * time.Second // readHeaderTimeout время ожидания заголовков запроса
+
 // main настройка приложения.
 func main() {
 	// Вспомогательная функция для профилирования
@@ -23,8 +48,9 @@ func main() {
 	// Задаем конфигурацию сервера
 	conf := config.ParseFlags()
 
-	// Контекст
-	ctx := context.Background()
+	// Контекст, отменяемый по сигналам SIGINT и SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// Иницциализация логгирования
 	newLogger, err := logger.NewLogger("info")
@@ -38,19 +64,228 @@ func main() {
 		newLogger.Fatalf("Unable to create storage %v: ", err)
 	}
 
-	// Запуск компонента удаления записей, которые ранее были мягко удалены
-	go components.DeleteSoftDeletedRecords(ctx, store)
+	// Инициализация хранилища статистики переходов, для postgres и Redis используются соединения
+	// хранилища ссылок, чтобы переходы и учетные записи были общими для всех реплик
+	var pool *pgxpool.Pool
+	var redisClient *redis.Client
+	switch backend := store.(type) {
+	case *storages.PgStorage:
+		pool = backend.Conn
+	case *storages.RedisStorage:
+		redisClient = backend.Client
+	}
+	clicks, err := analytics.NewStore(ctx, conf, pool, redisClient, newLogger)
+	if err != nil {
+		newLogger.Fatalf("Unable to create analytics storage %v: ", err)
+	}
+
+	// Инициализация хранилища учетных записей
+	users, err := accounts.NewStore(ctx, conf, pool, redisClient, newLogger)
+	if err != nil {
+		newLogger.Fatalf("Unable to create accounts storage %v: ", err)
+	}
+
+	// Инициализация метрик, хранилище ссылок оборачивается для замера времени операций
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	appMetrics := metrics.New(registry)
+	if pool != nil {
+		if err := appMetrics.RegisterPool(pool); err != nil {
+			newLogger.Fatalf("Unable to register pool metrics %v: ", err)
+		}
+	}
+	store = storages.NewInstrumentedStorage(store, appMetrics)
+
+	// Кэш переходов по коротким ссылкам поверх хранилища, время операций хранилища замеряется без учета попаданий
+	if conf.CacheSize > 0 {
+		cachedStore := storages.NewCachedStorage(store, conf.CacheSize, conf.CacheTTL)
+		if err := appMetrics.RegisterCache(cachedStore); err != nil {
+			newLogger.Fatalf("Unable to register cache metrics %v: ", err)
+		}
+		store = cachedStore
+	}
+
+	// Запуск асинхронной очереди сохранения переходов
+	clickQueue := analytics.NewQueue(clicks, analytics.QueueConfig{
+		DropPolicy:    analytics.DropPolicy(conf.ClickDropPolicy),
+		Size:          conf.ClickQueueSize,
+		Workers:       conf.ClickWorkers,
+		BatchSize:     conf.ClickBatchSize,
+		FlushInterval: conf.ClickFlushInterval,
+	}, newLogger)
+
+	// Запуск очереди удаления ссылок пользователей
+	deletionQueue := deletion.NewQueue(store, deletion.Config{
+		Size:          conf.DeleteQueueSize,
+		BatchSize:     conf.DeleteBatchSize,
+		MaxRetries:    conf.DeleteMaxRetries,
+		FlushInterval: conf.DeleteFlushInterval,
+	}, newLogger)
+	if err := appMetrics.RegisterClickQueue(clickQueue); err != nil {
+		newLogger.Fatalf("Unable to register click queue metrics %v: ", err)
+	}
+	if err := appMetrics.RegisterDeletionQueue(deletionQueue); err != nil {
+		newLogger.Fatalf("Unable to register deletion queue metrics %v: ", err)
+	}
+
+	// Запуск очистки хранилища от давно удаленных и истекших записей, для postgres очистку выполняет
+	// одна реплика, захватившая блокировку
+	retentionSchedule, err := schedule.Parse(conf.RetentionCron, conf.RetentionInterval)
+	if err != nil {
+		newLogger.Fatalf("Unable to parse retention schedule %v: ", err)
+	}
+	var retentionLocker components.Locker
+	if pool != nil {
+		retentionLocker = components.NewPgLocker(pool, components.RetentionLockName)
+	}
+	// Для postgres переходы удаляются вместе со ссылками, отдельное хранилище переходов очищается после ссылок
+	var clickPurger components.ClickPurger
+	if pool == nil {
+		clickPurger, _ = clicks.(components.ClickPurger)
+	}
+	retention := components.NewRetention(store, components.RetentionConfig{
+		Schedule:   retentionSchedule,
+		Locker:     retentionLocker,
+		Clicks:     clickPurger,
+		Window:     conf.RetentionWindow,
+		Jitter:     conf.RetentionJitter,
+		RunOnStart: conf.RetentionCron == "",
+	}, newLogger)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		retention.Run(ctx)
+	}()
 
 	// Инициализация роутов
-	r := routes.NewRouter(ctx, store, conf, newLogger)
+	// Лимиты частоты запросов общие для HTTP и gRPC API
+	limiters := middlewares.NewRateLimiters(conf)
+	r := routes.NewRouter(ctx, store, clicks, users, deletionQueue, clickQueue, limiters, conf, newLogger, appMetrics)
+
+	server := &http.Server{
+		Addr:              conf.FlagRunAddr,
+		Handler:           r,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	// Настройка TLS, без файлов сертификата и ключа используется самоподписанный сертификат
+	if conf.EnableHTTPS {
+		server.TLSConfig, err = certs.NewTLSConfig(conf.TLSCertFile, conf.TLSKeyFile, tlsHosts(conf.FlagBaseURL))
+		if err != nil {
+			newLogger.Fatalf("Unable to configure TLS %v: ", err)
+		}
+	}
+
+	// Инициализация gRPC сервера, использует те же настройки TLS, что и HTTP сервер
+	grpcServer := grpcserver.NewServer(store, clickQueue, users, deletionQueue, limiters, conf, newLogger,
+		server.TLSConfig)
+	grpcListener, err := net.Listen("tcp", conf.GRPCAddr)
+	if err != nil {
+		newLogger.Fatalf("Unable to listen gRPC address %v: ", err)
+	}
 
 	// Вывод информации в лог о старте сервера
-	newLogger.Info("Running server address ", conf.FlagRunAddr)
+	newLogger.Info("Running server address ", conf.FlagRunAddr, " HTTPS ", conf.EnableHTTPS)
+	newLogger.Info("Running gRPC server address ", conf.GRPCAddr)
 
 	// Запуск сервера
-	err = http.ListenAndServe(conf.FlagRunAddr, r)
+	go func() {
+		var err error
+		if conf.EnableHTTPS {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			newLogger.Fatal("Running server fail")
+		}
+	}()
 
-	if err != nil {
-		newLogger.Fatal("Running server fail")
+	// Запуск gRPC сервера
+	go func() {
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			newLogger.Fatal("Running gRPC server fail")
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	newLogger.Info("Shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+
+	// Ожидание завершения обрабатываемых запросов
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		newLogger.Errorf("Server shutdown failed: %v", err)
+	}
+
+	// Ожидание завершения gRPC вызовов, по истечении времени соединения закрываются принудительно
+	stopGRPC(shutdownCtx, grpcServer)
+
+	// Сохранение оставшихся в очереди переходов
+	if err := clickQueue.Close(shutdownCtx); err != nil {
+		newLogger.Errorf("Click queue shutdown failed: %v", err)
+	}
+
+	// Удаление оставшихся в очереди ссылок
+	if err := deletionQueue.Close(shutdownCtx); err != nil {
+		newLogger.Errorf("Deletion queue shutdown failed: %v", err)
+	}
+
+	// Ожидание завершения фоновых компонентов
+	wg.Wait()
+
+	// Закрытие хранилища
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			newLogger.Errorf("Unable to close storage: %v", err)
+		}
+	}
+
+	// Закрытие хранилища переходов после сохранения очереди переходов и остановки очистки
+	if closer, ok := clicks.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			newLogger.Errorf("Unable to close analytics storage: %v", err)
+		}
+	}
+
+	// Закрытие хранилища учетных записей
+	if closer, ok := users.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			newLogger.Errorf("Unable to close accounts storage: %v", err)
+		}
+	}
+
+	newLogger.Info("Server stopped")
+	_ = newLogger.Sync()
+}
+
+// tlsHosts список имен для самоподписанного сертификата: хост базового URL и локальные адреса.
+func tlsHosts(baseURL string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+
+	u, err := url.Parse(baseURL)
+	if err == nil && u.Hostname() != "" && !slices.Contains(hosts, u.Hostname()) {
+		hosts = append(hosts, u.Hostname())
+	}
+
+	return hosts
+}
+
+// stopGRPC плавная остановка gRPC сервера с ограничением по времени контекста.
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
 	}
 }
@@ -0,0 +1,293 @@
+// Package accounts учетные записи пользователей с входом по логину и паролю.
+//
+// Пароли хранятся в виде bcrypt хэша. Refresh токены и API ключи - случайные строки, в хранилище попадает
+// только их SHA-256 хэш. Каждый refresh токен одноразовый: при обновлении он удаляется и выдается новый.
+//
+// Идентификатор учетной записи используется как идентификатор пользователя коротких ссылок. При регистрации
+// учетная запись может занять идентификатор анонимного пользователя, тогда его ссылки переходят к ней.
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Erlast/short-url.git/internal/app/config"
+)
+
+const minPasswordLength = 8  // minPasswordLength минимальная длина пароля
+const maxPasswordLength = 72 // maxPasswordLength максимальная длина пароля в байтах, ограничение bcrypt
+const maxLoginLength = 255   // maxLoginLength максимальная длина логина
+const refreshTokenBytes = 32 // refreshTokenBytes количество случайных байт refresh токена
+
+var (
+	// ErrLoginTaken логин занят другой учетной записью.
+	ErrLoginTaken = errors.New("login is already taken")
+	// ErrUserExists учетная запись с таким идентификатором уже существует.
+	ErrUserExists = errors.New("user already exists")
+	// ErrUserNotFound учетная запись не найдена.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidCredentials неверный логин или пароль.
+	ErrInvalidCredentials = errors.New("invalid login or password")
+	// ErrInvalidRefreshToken refresh токен не найден, использован или истек.
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid")
+	// ErrInvalidLogin недопустимый логин.
+	ErrInvalidLogin = errors.New("login is invalid")
+	// ErrInvalidPassword недопустимый пароль.
+	ErrInvalidPassword = errors.New("password is invalid")
+)
+
+// passwordCost стоимость bcrypt хэша паролей.
+var passwordCost = bcrypt.DefaultCost
+
+// dummyHash хэш для сравнения пароля при входе с несуществующим логином, чтобы время ответа не выдавало логины.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), passwordCost)
+	return hash
+})
+
+// User учетная запись пользователя.
+type User struct {
+	CreatedAt    time.Time `json:"created_at"`
+	ID           string    `json:"id"`
+	Login        string    `json:"login"`
+	PasswordHash string    `json:"password_hash"`
+}
+
+// RefreshToken сохраненный refresh токен.
+type RefreshToken struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Hash      string    `json:"hash"`
+	UserID    string    `json:"user_id"`
+}
+
+// Store интерфейс хранилища учетных записей.
+type Store interface {
+	// CreateUser сохраняет учетную запись, ErrLoginTaken или ErrUserExists если логин или идентификатор заняты.
+	CreateUser(ctx context.Context, user User) error
+	// GetUserByLogin поиск учетной записи по логину, ErrUserNotFound если ее нет.
+	GetUserByLogin(ctx context.Context, login string) (*User, error)
+	// UserExists проверка существования учетной записи с идентификатором.
+	UserExists(ctx context.Context, id string) (bool, error)
+	// SaveRefreshToken сохраняет refresh токен.
+	SaveRefreshToken(ctx context.Context, token RefreshToken) error
+	// TakeRefreshToken удаляет и возвращает refresh токен по хэшу, ErrInvalidRefreshToken если его нет.
+	TakeRefreshToken(ctx context.Context, hash string) (*RefreshToken, error)
+	// CreateAPIKey сохраняет API ключ.
+	CreateAPIKey(ctx context.Context, key APIKey) error
+	// ListAPIKeys API ключи пользователя в порядке создания.
+	ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error)
+	// DeleteAPIKey отзыв API ключа пользователя, ErrAPIKeyNotFound если у пользователя нет такого ключа.
+	DeleteAPIKey(ctx context.Context, userID, id string) error
+	// GetAPIKeyByHash поиск API ключа по хэшу, ErrAPIKeyNotFound если его нет.
+	GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error)
+	// TouchAPIKey обновление времени последнего использования API ключа.
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+}
+
+// NewStore инициализация хранилища учетных записей в зависимости от настроек приложения
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - cfg: настройки приложения
+//   - pool: пул соединений postgres хранилища ссылок, nil если ссылки хранятся не в postgres
+//   - client: клиент Redis хранилища ссылок, nil если ссылки хранятся не в Redis
+//   - logger: логгер
+//
+// Возвращает
+//   - Store: хранилище учетных записей, общее для всех реплик при хранении ссылок в postgres или Redis
+//   - error: ошибка выполнения
+func NewStore(
+	_ context.Context,
+	cfg *config.Cfg,
+	pool *pgxpool.Pool,
+	client *redis.Client,
+	logger *zap.SugaredLogger,
+) (Store, error) {
+	switch {
+	case pool != nil:
+		return NewPgStore(pool), nil
+	case client != nil:
+		return NewRedisStore(client), nil
+	case cfg.RedisAddr != "":
+		return nil, errors.New("redis client is required for redis backend")
+	case cfg.FileStorage != "":
+		return NewFileStore(accountsFilePath(cfg.FileStorage), logger)
+	default:
+		return NewMemoryStore(), nil
+	}
+}
+
+// Register регистрация учетной записи
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - store: хранилище учетных записей
+//   - login: логин
+//   - password: пароль
+//   - anonymousID: идентификатор анонимного пользователя, ссылки которого переходят к учетной записи,
+//     пустая строка - учетная запись получает новый идентификатор
+//
+// Возвращает
+//   - *User: учетная запись
+//   - error: ошибка выполнения, ErrInvalidLogin, ErrInvalidPassword, ErrLoginTaken
+func Register(ctx context.Context, store Store, login, password, anonymousID string) (*User, error) {
+	login = normalizeLogin(login)
+	if login == "" || utf8.RuneCountInString(login) > maxLoginLength {
+		return nil, ErrInvalidLogin
+	}
+	if utf8.RuneCountInString(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return nil, ErrInvalidPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return nil, fmt.Errorf("unable to hash password: %w", err)
+	}
+
+	user := User{ID: uuid.NewString(), Login: login, PasswordHash: string(hash), CreatedAt: time.Now().UTC()}
+
+	// идентификатор учетной записи не занимается повторно, иначе ее ссылки перешли бы к новой учетной записи
+	if anonymousID != "" {
+		exists, err := store.UserExists(ctx, anonymousID)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			user.ID = anonymousID
+		}
+	}
+
+	if err := store.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Authenticate проверка логина и пароля
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - store: хранилище учетных записей
+//   - login: логин
+//   - password: пароль
+//
+// Возвращает
+//   - *User: учетная запись
+//   - error: ошибка выполнения, ErrInvalidCredentials при неверном логине или пароле
+func Authenticate(ctx context.Context, store Store, login, password string) (*User, error) {
+	user, err := store.GetUserByLogin(ctx, normalizeLogin(login))
+	if errors.Is(err, ErrUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// IssueRefreshToken выдача refresh токена пользователю
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - store: хранилище учетных записей
+//   - userID: идентификатор учетной записи
+//   - ttl: время жизни токена
+//
+// Возвращает
+//   - string: refresh токен
+//   - error: ошибка выполнения
+func IssueRefreshToken(ctx context.Context, store Store, userID string, ttl time.Duration) (string, error) {
+	buf := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("unable to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	err := store.SaveRefreshToken(ctx, RefreshToken{
+		Hash:      hashToken(token),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken обмен refresh токена на новый
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - store: хранилище учетных записей
+//   - token: предъявленный refresh токен
+//   - ttl: время жизни нового токена
+//
+// Возвращает
+//   - string: идентификатор учетной записи
+//   - string: новый refresh токен
+//   - error: ошибка выполнения, ErrInvalidRefreshToken если токен не найден, использован или истек
+func RotateRefreshToken(ctx context.Context, store Store, token string, ttl time.Duration) (string, string, error) {
+	stored, err := store.TakeRefreshToken(ctx, hashToken(token))
+	if err != nil {
+		return "", "", err
+	}
+	if !stored.ExpiresAt.After(time.Now()) {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	next, err := IssueRefreshToken(ctx, store, stored.UserID, ttl)
+	if err != nil {
+		return "", "", err
+	}
+
+	return stored.UserID, next, nil
+}
+
+// RevokeRefreshToken отзыв refresh токена, неизвестный токен не считается ошибкой.
+func RevokeRefreshToken(ctx context.Context, store Store, token string) error {
+	if _, err := store.TakeRefreshToken(ctx, hashToken(token)); err != nil && !errors.Is(err, ErrInvalidRefreshToken) {
+		return err
+	}
+
+	return nil
+}
+
+// accountsFilePath путь к файлу учетных записей рядом с файлом хранилища ссылок.
+func accountsFilePath(fileStorage string) string {
+	return strings.TrimSuffix(fileStorage, filepath.Ext(fileStorage)) + ".users.jsonl"
+}
+
+// normalizeLogin приведение логина к виду, в котором он хранится.
+func normalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
+
+// hashToken хэш refresh токена для хранения.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
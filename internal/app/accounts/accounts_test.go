@@ -0,0 +1,256 @@
+package accounts
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	passwordCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
+func TestRegister(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	user, err := Register(ctx, store, " Alice ", "password1", "")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Login)
+	assert.NotEmpty(t, user.ID)
+	assert.NotEqual(t, "password1", user.PasswordHash)
+
+	_, err = Register(ctx, store, "ALICE", "password2", "")
+	assert.ErrorIs(t, err, ErrLoginTaken)
+
+	_, err = Register(ctx, store, " ", "password1", "")
+	assert.ErrorIs(t, err, ErrInvalidLogin)
+
+	_, err = Register(ctx, store, "bob", "short", "")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+
+	// учетная запись занимает идентификатор анонимного пользователя
+	claimed, err := Register(ctx, store, "bob", "password1", "anonymous-1")
+	require.NoError(t, err)
+	assert.Equal(t, "anonymous-1", claimed.ID)
+
+	// идентификатор существующей учетной записи не занимается повторно
+	other, err := Register(ctx, store, "carol", "password1", "anonymous-1")
+	require.NoError(t, err)
+	assert.NotEqual(t, "anonymous-1", other.ID)
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	registered, err := Register(ctx, store, "alice", "password1", "")
+	require.NoError(t, err)
+
+	user, err := Authenticate(ctx, store, "Alice", "password1")
+	require.NoError(t, err)
+	assert.Equal(t, registered.ID, user.ID)
+
+	_, err = Authenticate(ctx, store, "alice", "wrong password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = Authenticate(ctx, store, "nobody", "password1")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	token, err := IssueRefreshToken(ctx, store, "user1", time.Hour)
+	require.NoError(t, err)
+
+	userID, next, err := RotateRefreshToken(ctx, store, token, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", userID)
+	assert.NotEqual(t, token, next)
+
+	// использованный токен одноразовый
+	_, _, err = RotateRefreshToken(ctx, store, token, time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	require.NoError(t, RevokeRefreshToken(ctx, store, next))
+	_, _, err = RotateRefreshToken(ctx, store, next, time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	require.NoError(t, RevokeRefreshToken(ctx, store, next))
+
+	expired, err := IssueRefreshToken(ctx, store, "user1", -time.Second)
+	require.NoError(t, err)
+	_, _, err = RotateRefreshToken(ctx, store, expired, time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	_, _, err := CreateAPIKey(ctx, store, "anonymous-1", "ci")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	user, err := Register(ctx, store, "alice", "password1", "")
+	require.NoError(t, err)
+
+	secret, key, err := CreateAPIKey(ctx, store, user.ID, " ci ")
+	require.NoError(t, err)
+	assert.True(t, IsAPIKey(secret))
+	assert.Equal(t, "ci", key.Name)
+	assert.NotContains(t, key.Hash, secret)
+	assert.True(t, strings.HasPrefix(secret, key.Hint))
+
+	resolved, err := ResolveAPIKey(ctx, store, secret)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, resolved.UserID)
+	require.NotNil(t, resolved.LastUsedAt)
+
+	keys, err := store.ListAPIKeys(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, resolved.LastUsedAt, keys[0].LastUsedAt)
+
+	_, err = ResolveAPIKey(ctx, store, secret+"x")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	// ключ может отозвать только его владелец
+	assert.ErrorIs(t, store.DeleteAPIKey(ctx, "other", key.ID), ErrAPIKeyNotFound)
+	require.NoError(t, store.DeleteAPIKey(ctx, user.ID, key.ID))
+	_, err = ResolveAPIKey(ctx, store, secret)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	fileName := t.TempDir() + "/storage.users.jsonl"
+	logger := zap.NewNop().Sugar()
+
+	store, err := NewFileStore(fileName, logger)
+	require.NoError(t, err)
+
+	user, err := Register(ctx, store, "alice", "password1", "anonymous-1")
+	require.NoError(t, err)
+	used, err := IssueRefreshToken(ctx, store, user.ID, time.Hour)
+	require.NoError(t, err)
+	_, kept, err := RotateRefreshToken(ctx, store, used, time.Hour)
+	require.NoError(t, err)
+	revoked, revokedKey, err := CreateAPIKey(ctx, store, user.ID, "revoked")
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteAPIKey(ctx, user.ID, revokedKey.ID))
+	secret, _, err := CreateAPIKey(ctx, store, user.ID, "ci")
+	require.NoError(t, err)
+	_, err = ResolveAPIKey(ctx, store, secret)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	reloaded, err := NewFileStore(fileName, logger)
+	require.NoError(t, err)
+	defer func() { _ = reloaded.Close() }()
+
+	authenticated, err := Authenticate(ctx, reloaded, "alice", "password1")
+	require.NoError(t, err)
+	assert.Equal(t, "anonymous-1", authenticated.ID)
+
+	_, err = Register(ctx, reloaded, "alice", "password1", "")
+	assert.ErrorIs(t, err, ErrLoginTaken)
+
+	_, _, err = RotateRefreshToken(ctx, reloaded, used, time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	userID, _, err := RotateRefreshToken(ctx, reloaded, kept, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "anonymous-1", userID)
+
+	_, err = ResolveAPIKey(ctx, reloaded, revoked)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	key, err := ResolveAPIKey(ctx, reloaded, secret)
+	require.NoError(t, err)
+	assert.Equal(t, "anonymous-1", key.UserID)
+	assert.NotNil(t, key.LastUsedAt)
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	store := NewRedisStore(client)
+
+	user, err := Register(ctx, store, "alice", "password1", "anonymous-1")
+	require.NoError(t, err)
+	assert.Equal(t, "anonymous-1", user.ID)
+
+	// хранилище общее для реплик: вторая реплика видит учетную запись первой
+	replica := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	t.Cleanup(func() { _ = replica.Client.Close() })
+
+	_, err = Register(ctx, replica, "alice", "password1", "")
+	assert.ErrorIs(t, err, ErrLoginTaken)
+	assert.ErrorIs(t, replica.CreateUser(ctx, User{ID: user.ID, Login: "bob"}), ErrUserExists)
+	authenticated, err := Authenticate(ctx, replica, "alice", "password1")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, authenticated.ID)
+	assert.WithinDuration(t, user.CreatedAt, authenticated.CreatedAt, time.Millisecond)
+
+	exists, err := replica.UserExists(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = replica.UserExists(ctx, "anonymous-2")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	token, err := IssueRefreshToken(ctx, store, user.ID, time.Hour)
+	require.NoError(t, err)
+	userID, next, err := RotateRefreshToken(ctx, replica, token, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+	_, _, err = RotateRefreshToken(ctx, store, token, time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// Redis удаляет истекший токен
+	server.FastForward(2 * time.Hour)
+	_, _, err = RotateRefreshToken(ctx, store, next, time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	first, firstKey, err := CreateAPIKey(ctx, store, user.ID, "first")
+	require.NoError(t, err)
+	_, secondKey, err := CreateAPIKey(ctx, store, user.ID, "second")
+	require.NoError(t, err)
+
+	resolved, err := ResolveAPIKey(ctx, replica, first)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, resolved.UserID)
+
+	keys, err := replica.ListAPIKeys(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, []string{firstKey.ID, secondKey.ID}, []string{keys[0].ID, keys[1].ID})
+	require.NotNil(t, keys[0].LastUsedAt)
+	assert.WithinDuration(t, *resolved.LastUsedAt, *keys[0].LastUsedAt, time.Millisecond)
+	assert.Nil(t, keys[1].LastUsedAt)
+
+	assert.ErrorIs(t, replica.DeleteAPIKey(ctx, "other", firstKey.ID), ErrAPIKeyNotFound)
+	require.NoError(t, replica.DeleteAPIKey(ctx, user.ID, firstKey.ID))
+	assert.ErrorIs(t, replica.DeleteAPIKey(ctx, user.ID, firstKey.ID), ErrAPIKeyNotFound)
+	_, err = ResolveAPIKey(ctx, store, first)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	// отметка использования не восстанавливает удаленный ключ
+	require.NoError(t, store.TouchAPIKey(ctx, firstKey.ID, time.Now()))
+	assert.False(t, server.Exists("shortener:apikey:"+firstKey.ID))
+
+	keys, err = store.ListAPIKeys(ctx, "other")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
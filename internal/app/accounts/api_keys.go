@@ -0,0 +1,125 @@
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const apiKeyPrefix = "shk_"             // apiKeyPrefix префикс API ключей, отличает их от jwt токенов
+const apiKeyBytes = 32                  // apiKeyBytes количество случайных байт API ключа
+const apiKeyHintLength = 8              // apiKeyHintLength количество символов ключа, сохраняемых для отображения
+const maxAPIKeyNameLength = 255         // maxAPIKeyNameLength максимальная длина названия API ключа
+const apiKeyTouchInterval = time.Minute // apiKeyTouchInterval точность времени последнего использования API ключа
+
+var (
+	// ErrAPIKeyNotFound API ключ не найден.
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrInvalidAPIKey API ключ не найден или отозван.
+	ErrInvalidAPIKey = errors.New("api key is invalid")
+	// ErrInvalidAPIKeyName недопустимое название API ключа.
+	ErrInvalidAPIKeyName = errors.New("api key name is invalid")
+)
+
+// APIKey API ключ пользователя. Сам ключ не хранится, Hint - его начало для отображения в списке.
+type APIKey struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	Hash       string     `json:"hash"`
+}
+
+// IsAPIKey проверка, что строка из заголовка Authorization - API ключ, а не jwt токен.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// CreateAPIKey создание API ключа
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - store: хранилище учетных записей
+//   - userID: идентификатор учетной записи
+//   - name: название ключа
+//
+// Возвращает
+//   - string: API ключ, показывается пользователю один раз
+//   - *APIKey: сохраненный ключ
+//   - error: ошибка выполнения, ErrInvalidAPIKeyName, ErrUserNotFound если пользователь не зарегистрирован
+func CreateAPIKey(ctx context.Context, store Store, userID, name string) (string, *APIKey, error) {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > maxAPIKeyNameLength {
+		return "", nil, ErrInvalidAPIKeyName
+	}
+
+	exists, err := store.UserExists(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if !exists {
+		return "", nil, fmt.Errorf("user %s: %w", userID, ErrUserNotFound)
+	}
+
+	buf := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("unable to generate api key: %w", err)
+	}
+	secret := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	key := APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      name,
+		Hint:      secret[:len(apiKeyPrefix)+apiKeyHintLength],
+		Hash:      hashToken(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := store.CreateAPIKey(ctx, key); err != nil {
+		return "", nil, err
+	}
+
+	return secret, &key, nil
+}
+
+// ResolveAPIKey поиск API ключа с обновлением времени последнего использования
+//
+// Время последнего использования обновляется не чаще раза в apiKeyTouchInterval, чтобы не писать
+// в хранилище на каждый запрос.
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - store: хранилище учетных записей
+//   - secret: предъявленный API ключ
+//
+// Возвращает
+//   - *APIKey: API ключ
+//   - error: ошибка выполнения, ErrInvalidAPIKey если ключ не найден или отозван
+func ResolveAPIKey(ctx context.Context, store Store, secret string) (*APIKey, error) {
+	key, err := store.GetAPIKeyByHash(ctx, hashToken(secret))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := store.TouchAPIKey(ctx, key.ID, now); err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = &now
+	}
+
+	return key, nil
+}
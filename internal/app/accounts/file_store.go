@@ -0,0 +1,307 @@
+package accounts
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/fileutil"
+)
+
+const perm600 = 0o600 // perm600 код доступа к файлу
+const perm700 = 0o700 // perm700 код доступа к директории
+
+// fileOp тип события файла учетных записей.
+type fileOp string
+
+const (
+	fileUser   fileOp = "user"   // fileUser создание учетной записи
+	fileToken  fileOp = "token"  // fileToken выдача refresh токена
+	fileTake   fileOp = "take"   // fileTake использование или отзыв refresh токена
+	fileKey    fileOp = "key"    // fileKey создание API ключа
+	fileRevoke fileOp = "revoke" // fileRevoke отзыв API ключа
+	fileTouch  fileOp = "touch"  // fileTouch использование API ключа
+)
+
+// fileEvent событие файла учетных записей, одна строка JSON.
+type fileEvent struct {
+	At    time.Time     `json:"at,omitempty"`
+	User  *User         `json:"user,omitempty"`
+	Token *RefreshToken `json:"token,omitempty"`
+	Key   *APIKey       `json:"key,omitempty"`
+	Op    fileOp        `json:"op"`
+	Hash  string        `json:"hash,omitempty"`
+	ID    string        `json:"id,omitempty"`
+}
+
+// FileStore хранилище учетных записей в файле формата JSON lines.
+//
+// Изменения дописываются в конец файла. При загрузке файл перезаписывается без использованных
+// и истекших refresh токенов, отозванных API ключей и промежуточных отметок использования ключей.
+type FileStore struct {
+	*MemoryStore
+	logger   *zap.SugaredLogger
+	file     *os.File
+	fileName string
+}
+
+// NewFileStore инициализация файлового хранилища учетных записей.
+func NewFileStore(fileName string, logger *zap.SugaredLogger) (*FileStore, error) {
+	store := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		logger:      logger,
+		fileName:    fileName,
+	}
+
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("unable to load accounts: %w", err)
+	}
+
+	return store, nil
+}
+
+// CreateUser сохраняет учетную запись
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - user: учетная запись
+//
+// Возвращает
+//   - error: ошибка выполнения, ErrLoginTaken или ErrUserExists если логин или идентификатор заняты
+func (s *FileStore) CreateUser(ctx context.Context, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.logins[user.Login]; ok {
+		return fmt.Errorf("login %s: %w", user.Login, ErrLoginTaken)
+	}
+	if _, ok := s.users[user.ID]; ok {
+		return fmt.Errorf("user %s: %w", user.ID, ErrUserExists)
+	}
+
+	if err := s.append(fileEvent{Op: fileUser, User: &user}); err != nil {
+		return err
+	}
+	s.users[user.ID] = user
+	s.logins[user.Login] = user.ID
+
+	return nil
+}
+
+// SaveRefreshToken сохраняет refresh токен.
+func (s *FileStore) SaveRefreshToken(_ context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(fileEvent{Op: fileToken, Token: &token}); err != nil {
+		return err
+	}
+	s.saveRefreshToken(token, time.Now())
+
+	return nil
+}
+
+// TakeRefreshToken удаляет и возвращает refresh токен по хэшу.
+func (s *FileStore) TakeRefreshToken(_ context.Context, hash string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.refresh[hash]; !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// токен удаляется из файла до выдачи, чтобы после сбоя его нельзя было использовать повторно
+	if err := s.append(fileEvent{Op: fileTake, Hash: hash}); err != nil {
+		return nil, err
+	}
+	token, _ := s.takeRefreshToken(hash)
+
+	return &token, nil
+}
+
+// CreateAPIKey сохраняет API ключ.
+func (s *FileStore) CreateAPIKey(_ context.Context, key APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(fileEvent{Op: fileKey, Key: &key}); err != nil {
+		return err
+	}
+	s.createAPIKey(key)
+
+	return nil
+}
+
+// DeleteAPIKey отзыв API ключа пользователя.
+func (s *FileStore) DeleteAPIKey(_ context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[id]; !ok || key.UserID != userID {
+		return fmt.Errorf("api key %s: %w", id, ErrAPIKeyNotFound)
+	}
+
+	if err := s.append(fileEvent{Op: fileRevoke, ID: id}); err != nil {
+		return err
+	}
+	s.deleteAPIKey(id)
+
+	return nil
+}
+
+// TouchAPIKey обновление времени последнего использования API ключа.
+func (s *FileStore) TouchAPIKey(_ context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(fileEvent{Op: fileTouch, ID: id, At: at}); err != nil {
+		return err
+	}
+	s.touchAPIKey(id, at)
+
+	return nil
+}
+
+// Close закрытие файла учетных записей.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return fmt.Errorf("unable to close accounts file: %w", err)
+	}
+
+	return nil
+}
+
+// append дозапись события в файл со сбросом на диск, вызывается под s.mu.
+func (s *FileStore) append(event fileEvent) error {
+	if s.file == nil {
+		return errors.New("accounts file is closed")
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to marshal accounts event: %w", err)
+	}
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("unable to write accounts file: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("unable to sync accounts file: %w", err)
+	}
+
+	return nil
+}
+
+// load чтение событий из файла, перезапись файла текущим состоянием и открытие его на дозапись.
+func (s *FileStore) load() error {
+	if err := os.MkdirAll(filepath.Dir(s.fileName), perm700); err != nil {
+		return errors.New("can't create directory")
+	}
+
+	if err := s.read(); err != nil {
+		return err
+	}
+
+	if err := s.rewrite(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, perm600)
+	if err != nil {
+		return fmt.Errorf("unable to open accounts file: %w", err)
+	}
+	s.file = file
+
+	return nil
+}
+
+// read применение событий файла к хранилищу в памяти.
+func (s *FileStore) read() error {
+	file, err := os.Open(s.fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open accounts file: %w", err)
+	}
+
+	defer func(file *os.File) {
+		if err := file.Close(); err != nil {
+			s.logger.Error("unable to close accounts file: ", err)
+		}
+	}(file)
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event fileEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			s.logger.Warnf("skip malformed accounts record: %v", err)
+			continue
+		}
+
+		switch {
+		case event.Op == fileUser && event.User != nil:
+			s.users[event.User.ID] = *event.User
+			s.logins[event.User.Login] = event.User.ID
+		case event.Op == fileToken && event.Token != nil:
+			s.saveRefreshToken(*event.Token, now)
+		case event.Op == fileTake:
+			s.takeRefreshToken(event.Hash)
+		case event.Op == fileKey && event.Key != nil:
+			s.createAPIKey(*event.Key)
+		case event.Op == fileRevoke:
+			s.deleteAPIKey(event.ID)
+		case event.Op == fileTouch:
+			s.touchAPIKey(event.ID, event.At)
+		default:
+			s.logger.Warnf("skip unknown accounts record %q", event.Op)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read accounts file: %w", err)
+	}
+
+	return nil
+}
+
+// rewrite атомарная перезапись файла событиями, воссоздающими текущее состояние хранилища.
+func (s *FileStore) rewrite() error {
+	return fileutil.WriteFileAtomic(s.fileName, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		for _, user := range s.users {
+			if err := encoder.Encode(fileEvent{Op: fileUser, User: &user}); err != nil {
+				return fmt.Errorf("unable to write accounts file: %w", err)
+			}
+		}
+		for _, token := range s.refresh {
+			if err := encoder.Encode(fileEvent{Op: fileToken, Token: &token}); err != nil {
+				return fmt.Errorf("unable to write accounts file: %w", err)
+			}
+		}
+		for _, key := range s.keys {
+			if err := encoder.Encode(fileEvent{Op: fileKey, Key: &key}); err != nil {
+				return fmt.Errorf("unable to write accounts file: %w", err)
+			}
+		}
+		return nil
+	})
+}
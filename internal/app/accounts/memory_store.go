@@ -0,0 +1,204 @@
+package accounts
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStore хранилище учетных записей в памяти.
+type MemoryStore struct {
+	users   map[string]User
+	logins  map[string]string
+	refresh map[string]RefreshToken
+	keys    map[string]APIKey
+	hashes  map[string]string
+	mu      sync.RWMutex
+}
+
+// NewMemoryStore инициализация хранилища учетных записей в памяти.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:   map[string]User{},
+		logins:  map[string]string{},
+		refresh: map[string]RefreshToken{},
+		keys:    map[string]APIKey{},
+		hashes:  map[string]string{},
+	}
+}
+
+// CreateUser сохраняет учетную запись
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - user: учетная запись
+//
+// Возвращает
+//   - error: ошибка выполнения, ErrLoginTaken или ErrUserExists если логин или идентификатор заняты
+func (s *MemoryStore) CreateUser(_ context.Context, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.logins[user.Login]; ok {
+		return fmt.Errorf("login %s: %w", user.Login, ErrLoginTaken)
+	}
+	if _, ok := s.users[user.ID]; ok {
+		return fmt.Errorf("user %s: %w", user.ID, ErrUserExists)
+	}
+
+	s.users[user.ID] = user
+	s.logins[user.Login] = user.ID
+
+	return nil
+}
+
+// GetUserByLogin поиск учетной записи по логину.
+func (s *MemoryStore) GetUserByLogin(_ context.Context, login string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.logins[login]
+	if !ok {
+		return nil, fmt.Errorf("login %s: %w", login, ErrUserNotFound)
+	}
+
+	user := s.users[id]
+	return &user, nil
+}
+
+// UserExists проверка существования учетной записи с идентификатором.
+func (s *MemoryStore) UserExists(_ context.Context, id string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.users[id]
+	return ok, nil
+}
+
+// SaveRefreshToken сохраняет refresh токен, истекшие токены при этом удаляются.
+func (s *MemoryStore) SaveRefreshToken(_ context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveRefreshToken(token, time.Now())
+
+	return nil
+}
+
+// TakeRefreshToken удаляет и возвращает refresh токен по хэшу.
+func (s *MemoryStore) TakeRefreshToken(_ context.Context, hash string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.takeRefreshToken(hash)
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return &token, nil
+}
+
+// CreateAPIKey сохраняет API ключ.
+func (s *MemoryStore) CreateAPIKey(_ context.Context, key APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.createAPIKey(key)
+
+	return nil
+}
+
+// ListAPIKeys API ключи пользователя в порядке создания.
+func (s *MemoryStore) ListAPIKeys(_ context.Context, userID string) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]APIKey, 0)
+	for _, key := range s.keys {
+		if key.UserID == userID {
+			result = append(result, key)
+		}
+	}
+	slices.SortFunc(result, func(a, b APIKey) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	return result, nil
+}
+
+// DeleteAPIKey отзыв API ключа пользователя.
+func (s *MemoryStore) DeleteAPIKey(_ context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[id]; !ok || key.UserID != userID {
+		return fmt.Errorf("api key %s: %w", id, ErrAPIKeyNotFound)
+	}
+	s.deleteAPIKey(id)
+
+	return nil
+}
+
+// GetAPIKeyByHash поиск API ключа по хэшу.
+func (s *MemoryStore) GetAPIKeyByHash(_ context.Context, hash string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.hashes[hash]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	key := s.keys[id]
+	return &key, nil
+}
+
+// TouchAPIKey обновление времени последнего использования API ключа.
+func (s *MemoryStore) TouchAPIKey(_ context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.touchAPIKey(id, at)
+
+	return nil
+}
+
+// saveRefreshToken сохранение токена с удалением истекших на момент now, вызывается под s.mu.
+func (s *MemoryStore) saveRefreshToken(token RefreshToken, now time.Time) {
+	for hash, stored := range s.refresh {
+		if !stored.ExpiresAt.After(now) {
+			delete(s.refresh, hash)
+		}
+	}
+	s.refresh[token.Hash] = token
+}
+
+// takeRefreshToken удаление токена, вызывается под s.mu.
+func (s *MemoryStore) takeRefreshToken(hash string) (RefreshToken, bool) {
+	token, ok := s.refresh[hash]
+	delete(s.refresh, hash)
+
+	return token, ok
+}
+
+// createAPIKey сохранение API ключа, вызывается под s.mu.
+func (s *MemoryStore) createAPIKey(key APIKey) {
+	s.keys[key.ID] = key
+	s.hashes[key.Hash] = key.ID
+}
+
+// deleteAPIKey удаление API ключа, вызывается под s.mu.
+func (s *MemoryStore) deleteAPIKey(id string) {
+	if key, ok := s.keys[id]; ok {
+		delete(s.hashes, key.Hash)
+		delete(s.keys, id)
+	}
+}
+
+// touchAPIKey обновление времени последнего использования, вызывается под s.mu.
+func (s *MemoryStore) touchAPIKey(id string, at time.Time) {
+	if key, ok := s.keys[id]; ok {
+		key.LastUsedAt = &at
+		s.keys[id] = key
+	}
+}
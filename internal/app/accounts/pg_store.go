@@ -0,0 +1,215 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const uniqueLoginIndex = "idx_unique_login" // uniqueLoginIndex индекс уникальности логинов
+
+// apiKeyColumns колонки API ключа в порядке чтения scanAPIKey.
+const apiKeyColumns = "id, user_id, name, hint, key_hash, created_at, last_used_at"
+
+// PgStore хранилище учетных записей в БД postgres.
+type PgStore struct {
+	Conn *pgxpool.Pool
+}
+
+// NewPgStore инициализация хранилища учетных записей postgres, таблицы создаются миграциями хранилища ссылок.
+func NewPgStore(conn *pgxpool.Pool) *PgStore {
+	return &PgStore{Conn: conn}
+}
+
+// CreateUser сохраняет учетную запись
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - user: учетная запись
+//
+// Возвращает
+//   - error: ошибка выполнения, ErrLoginTaken или ErrUserExists если логин или идентификатор заняты
+func (pgs *PgStore) CreateUser(ctx context.Context, user User) error {
+	_, err := pgs.Conn.Exec(
+		ctx,
+		"INSERT INTO users(id, login, password_hash, created_at) VALUES ($1, $2, $3, $4)",
+		user.ID, user.Login, user.PasswordHash, user.CreatedAt,
+	)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		if pgErr.ConstraintName == uniqueLoginIndex {
+			return fmt.Errorf("login %s: %w", user.Login, ErrLoginTaken)
+		}
+		return fmt.Errorf("user %s: %w", user.ID, ErrUserExists)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserByLogin поиск учетной записи по логину.
+func (pgs *PgStore) GetUserByLogin(ctx context.Context, login string) (*User, error) {
+	var user User
+
+	err := pgs.Conn.QueryRow(
+		ctx,
+		"SELECT id, login, password_hash, created_at FROM users WHERE login = $1",
+		login,
+	).Scan(&user.ID, &user.Login, &user.PasswordHash, &user.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("login %s: %w", login, ErrUserNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// UserExists проверка существования учетной записи с идентификатором.
+func (pgs *PgStore) UserExists(ctx context.Context, id string) (bool, error) {
+	var exists bool
+
+	err := pgs.Conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check user: %w", err)
+	}
+
+	return exists, nil
+}
+
+// SaveRefreshToken сохраняет refresh токен, истекшие токены пользователя при этом удаляются.
+func (pgs *PgStore) SaveRefreshToken(ctx context.Context, token RefreshToken) error {
+	batch := &pgx.Batch{}
+	batch.Queue("DELETE FROM refresh_tokens WHERE user_id = $1 AND expires_at <= now()", token.UserID)
+	batch.Queue(
+		"INSERT INTO refresh_tokens(token_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+		token.Hash, token.UserID, token.ExpiresAt,
+	)
+
+	if err := pgs.Conn.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// TakeRefreshToken удаляет и возвращает refresh токен по хэшу.
+func (pgs *PgStore) TakeRefreshToken(ctx context.Context, hash string) (*RefreshToken, error) {
+	token := RefreshToken{Hash: hash}
+
+	err := pgs.Conn.QueryRow(
+		ctx,
+		"DELETE FROM refresh_tokens WHERE token_hash = $1 RETURNING user_id, expires_at",
+		hash,
+	).Scan(&token.UserID, &token.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to take refresh token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// CreateAPIKey сохраняет API ключ.
+func (pgs *PgStore) CreateAPIKey(ctx context.Context, key APIKey) error {
+	_, err := pgs.Conn.Exec(
+		ctx,
+		"INSERT INTO api_keys(id, user_id, name, hint, key_hash, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		key.ID, key.UserID, key.Name, key.Hint, key.Hash, key.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return nil
+}
+
+// ListAPIKeys API ключи пользователя в порядке создания.
+func (pgs *PgStore) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	rows, err := pgs.Conn.Query(
+		ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = $1 ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		result = append(result, *key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	return result, nil
+}
+
+// DeleteAPIKey отзыв API ключа пользователя.
+func (pgs *PgStore) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	tag, err := pgs.Conn.Exec(ctx, "DELETE FROM api_keys WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("api key %s: %w", id, ErrAPIKeyNotFound)
+	}
+
+	return nil
+}
+
+// GetAPIKeyByHash поиск API ключа по хэшу.
+func (pgs *PgStore) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	key, err := scanAPIKey(pgs.Conn.QueryRow(
+		ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1",
+		hash,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	return key, nil
+}
+
+// TouchAPIKey обновление времени последнего использования API ключа.
+func (pgs *PgStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	if _, err := pgs.Conn.Exec(ctx, "UPDATE api_keys SET last_used_at = $2 WHERE id = $1", id, at); err != nil {
+		return fmt.Errorf("failed to touch api key: %w", err)
+	}
+
+	return nil
+}
+
+// scanAPIKey чтение API ключа из строки результата, колонки перечислены в apiKeyColumns.
+func scanAPIKey(row pgx.Row) (*APIKey, error) {
+	var key APIKey
+
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Hint, &key.Hash, &key.CreatedAt, &key.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
@@ -0,0 +1,320 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisPrefix префикс ключей хранилища, общий с хранилищем ссылок, имена ключей с ним не пересекаются.
+//
+// Структура данных:
+//   - account:<id> - hash с полями login, password_hash и created_at
+//   - login:<login> - string, идентификатор учетной записи
+//   - refresh:<hash> - hash с полями user_id и expires_at, удаляется Redis по истечении токена
+//   - apikey:<id> - hash с полями user_id, name, hint, hash, created_at и last_used_at
+//   - apikey_hash:<hash> - string, идентификатор API ключа
+//   - apikeys:<user_id> - sorted set API ключей пользователя, score - момент создания
+//
+// Моменты времени хранятся в unix микросекундах.
+const redisPrefix = "shortener:"
+
+// Результаты скрипта создания учетной записи.
+const (
+	redisUserCreated = 0 // redisUserCreated учетная запись сохранена
+	redisLoginTaken  = 1 // redisLoginTaken логин занят
+	redisUserTaken   = 2 // redisUserTaken идентификатор занят
+)
+
+// createUserScript атомарное сохранение учетной записи.
+//
+// ARGV: префикс, идентификатор, логин, хэш пароля, момент создания.
+var createUserScript = redis.NewScript(`
+local prefix, id, login = ARGV[1], ARGV[2], ARGV[3]
+if redis.call('EXISTS', prefix .. 'login:' .. login) == 1 then
+	return 1
+end
+if redis.call('EXISTS', prefix .. 'account:' .. id) == 1 then
+	return 2
+end
+redis.call('HSET', prefix .. 'account:' .. id, 'login', login, 'password_hash', ARGV[4], 'created_at', ARGV[5])
+redis.call('SET', prefix .. 'login:' .. login, id)
+return 0
+`)
+
+// deleteAPIKeyScript атомарное удаление API ключа пользователя.
+//
+// ARGV: префикс, пользователь, идентификатор ключа. Возвращает 0 если ключ удален, 1 если у пользователя его нет.
+var deleteAPIKeyScript = redis.NewScript(`
+local prefix, user, id = ARGV[1], ARGV[2], ARGV[3]
+local key = prefix .. 'apikey:' .. id
+local fields = redis.call('HMGET', key, 'user_id', 'hash')
+if fields[1] ~= user then
+	return 1
+end
+redis.call('DEL', key, prefix .. 'apikey_hash:' .. fields[2])
+redis.call('ZREM', prefix .. 'apikeys:' .. user, id)
+return 0
+`)
+
+// touchAPIKeyScript обновление времени последнего использования существующего API ключа.
+//
+// ARGV: префикс, идентификатор ключа, момент использования.
+var touchAPIKeyScript = redis.NewScript(`
+local key = ARGV[1] .. 'apikey:' .. ARGV[2]
+if redis.call('EXISTS', key) == 1 then
+	redis.call('HSET', key, 'last_used_at', ARGV[3])
+end
+return 0
+`)
+
+// RedisStore хранилище учетных записей в Redis, используется клиент хранилища ссылок.
+type RedisStore struct {
+	Client *redis.Client
+}
+
+// NewRedisStore инициализация хранилища учетных записей Redis.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{Client: client}
+}
+
+// CreateUser сохраняет учетную запись
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - user: учетная запись
+//
+// Возвращает
+//   - error: ошибка выполнения, ErrLoginTaken или ErrUserExists если логин или идентификатор заняты
+func (rs *RedisStore) CreateUser(ctx context.Context, user User) error {
+	result, err := createUserScript.Run(
+		ctx, rs.Client, nil,
+		redisPrefix, user.ID, user.Login, user.PasswordHash, user.CreatedAt.UnixMicro(),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	switch result {
+	case redisLoginTaken:
+		return fmt.Errorf("login %s: %w", user.Login, ErrLoginTaken)
+	case redisUserTaken:
+		return fmt.Errorf("user %s: %w", user.ID, ErrUserExists)
+	case redisUserCreated:
+		return nil
+	default:
+		return fmt.Errorf("unexpected create user result %d", result)
+	}
+}
+
+// GetUserByLogin поиск учетной записи по логину.
+func (rs *RedisStore) GetUserByLogin(ctx context.Context, login string) (*User, error) {
+	id, err := rs.Client.Get(ctx, redisPrefix+"login:"+login).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("login %s: %w", login, ErrUserNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	fields, err := rs.Client.HGetAll(ctx, redisPrefix+"account:"+id).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("login %s: %w", login, ErrUserNotFound)
+	}
+
+	user := User{ID: id, Login: fields["login"], PasswordHash: fields["password_hash"]}
+	if user.CreatedAt, err = redisTime(fields["created_at"]); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UserExists проверка существования учетной записи с идентификатором.
+func (rs *RedisStore) UserExists(ctx context.Context, id string) (bool, error) {
+	count, err := rs.Client.Exists(ctx, redisPrefix+"account:"+id).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check user: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// SaveRefreshToken сохраняет refresh токен, Redis удаляет его по истечении срока действия.
+func (rs *RedisStore) SaveRefreshToken(ctx context.Context, token RefreshToken) error {
+	key := redisPrefix + "refresh:" + token.Hash
+	_, err := rs.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "user_id", token.UserID, "expires_at", token.ExpiresAt.UnixMicro())
+		pipe.ExpireAt(ctx, key, token.ExpiresAt)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// TakeRefreshToken удаляет и возвращает refresh токен по хэшу.
+func (rs *RedisStore) TakeRefreshToken(ctx context.Context, hash string) (*RefreshToken, error) {
+	key := redisPrefix + "refresh:" + hash
+
+	var fields *redis.MapStringStringCmd
+	_, err := rs.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		fields = pipe.HGetAll(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to take refresh token: %w", err)
+	}
+	if len(fields.Val()) == 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	token := RefreshToken{Hash: hash, UserID: fields.Val()["user_id"]}
+	if token.ExpiresAt, err = redisTime(fields.Val()["expires_at"]); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// CreateAPIKey сохраняет API ключ.
+func (rs *RedisStore) CreateAPIKey(ctx context.Context, key APIKey) error {
+	_, err := rs.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, redisPrefix+"apikey:"+key.ID,
+			"user_id", key.UserID, "name", key.Name, "hint", key.Hint, "hash", key.Hash,
+			"created_at", key.CreatedAt.UnixMicro())
+		pipe.Set(ctx, redisPrefix+"apikey_hash:"+key.Hash, key.ID, 0)
+		pipe.ZAdd(ctx, redisPrefix+"apikeys:"+key.UserID, redis.Z{
+			Score:  float64(key.CreatedAt.UnixMicro()),
+			Member: key.ID,
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return nil
+}
+
+// ListAPIKeys API ключи пользователя в порядке создания.
+func (rs *RedisStore) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	ids, err := rs.Client.ZRange(ctx, redisPrefix+"apikeys:"+userID, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	_, err = rs.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, redisPrefix+"apikey:"+id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	result := make([]APIKey, 0, len(ids))
+	for i, id := range ids {
+		// ключ мог быть удален между чтением списка и чтением ключа
+		if len(cmds[i].Val()) == 0 {
+			continue
+		}
+		key, err := redisAPIKey(id, cmds[i].Val())
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *key)
+	}
+
+	return result, nil
+}
+
+// DeleteAPIKey отзыв API ключа пользователя.
+func (rs *RedisStore) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	result, err := deleteAPIKeyScript.Run(ctx, rs.Client, nil, redisPrefix, userID, id).Int()
+	if err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+	if result != 0 {
+		return fmt.Errorf("api key %s: %w", id, ErrAPIKeyNotFound)
+	}
+
+	return nil
+}
+
+// GetAPIKeyByHash поиск API ключа по хэшу.
+func (rs *RedisStore) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	id, err := rs.Client.Get(ctx, redisPrefix+"apikey_hash:"+hash).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	fields, err := rs.Client.HGetAll(ctx, redisPrefix+"apikey:"+id).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return redisAPIKey(id, fields)
+}
+
+// TouchAPIKey обновление времени последнего использования API ключа.
+func (rs *RedisStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	if err := touchAPIKeyScript.Run(ctx, rs.Client, nil, redisPrefix, id, at.UnixMicro()).Err(); err != nil {
+		return fmt.Errorf("failed to touch api key: %w", err)
+	}
+
+	return nil
+}
+
+// redisAPIKey разбор полей API ключа.
+func redisAPIKey(id string, fields map[string]string) (*APIKey, error) {
+	key := APIKey{
+		ID:     id,
+		UserID: fields["user_id"],
+		Name:   fields["name"],
+		Hint:   fields["hint"],
+		Hash:   fields["hash"],
+	}
+
+	var err error
+	if key.CreatedAt, err = redisTime(fields["created_at"]); err != nil {
+		return nil, err
+	}
+	if value, ok := fields["last_used_at"]; ok {
+		lastUsedAt, err := redisTime(value)
+		if err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = &lastUsedAt
+	}
+
+	return &key, nil
+}
+
+// redisTime разбор момента времени в unix микросекундах.
+func redisTime(value string) (time.Time, error) {
+	micros, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %w", value, err)
+	}
+
+	return time.UnixMicro(micros).UTC(), nil
+}
@@ -0,0 +1,116 @@
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/helpers"
+)
+
+const dateLayout = "2006-01-02" // dateLayout формат даты в гистограмме переходов
+
+// Click структура перехода по короткой ссылке.
+type Click struct {
+	Timestamp time.Time `json:"timestamp"`
+	ShortURL  string    `json:"short_url"`
+	Referrer  string    `json:"referrer"`
+	UserAgent string    `json:"user_agent"`
+	IPHash    string    `json:"ip_hash"`
+}
+
+// DailyClicks количество переходов за день.
+type DailyClicks struct {
+	Date   string `json:"date"`
+	Clicks int64  `json:"clicks"`
+}
+
+// Stats статистика переходов по короткой ссылке.
+type Stats struct {
+	ShortURL       string        `json:"short_url"`
+	Daily          []DailyClicks `json:"daily"`
+	TotalClicks    int64         `json:"total_clicks"`
+	UniqueVisitors int64         `json:"unique_visitors"`
+}
+
+// Store интерфейс хранилища переходов.
+type Store interface {
+	SaveClicks(ctx context.Context, clicks []Click) error
+	GetStats(ctx context.Context, shortURL string) (*Stats, error)
+	CountClicks(ctx context.Context, shortURLs []string) (map[string]int64, error)
+}
+
+// NewStore инициализация хранилища переходов в зависимости от настроек приложения
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - cfg: настройки приложения
+//   - pool: пул соединений postgres хранилища ссылок, nil если ссылки хранятся не в postgres
+//   - client: клиент Redis хранилища ссылок, nil если ссылки хранятся не в Redis
+//   - logger: логгер
+//
+// Возвращает
+//   - Store: хранилище переходов
+//   - error: ошибка выполнения
+func NewStore(
+	_ context.Context,
+	cfg *config.Cfg,
+	pool *pgxpool.Pool,
+	client *redis.Client,
+	logger *zap.SugaredLogger,
+) (Store, error) {
+	switch {
+	case pool != nil:
+		return NewPgStore(pool), nil
+	case client != nil:
+		return NewRedisStore(client), nil
+	case cfg.RedisAddr != "":
+		return nil, errors.New("redis client is required for redis backend")
+	case cfg.FileStorage != "":
+		return NewFileStore(clicksFilePath(cfg.FileStorage), logger)
+	default:
+		return NewMemoryStore(), nil
+	}
+}
+
+// NewClick формирование перехода по короткой ссылке из http запроса
+//
+// Аргументы
+//   - req: http запрос
+//   - shortURL: короткая ссылка
+//   - secret: ключ хеширования IP адреса
+//
+// Возвращает
+//   - Click: переход по ссылке
+func NewClick(req *http.Request, shortURL string, secret string) Click {
+	return Click{
+		Timestamp: time.Now().UTC(),
+		ShortURL:  shortURL,
+		Referrer:  req.Referer(),
+		UserAgent: req.UserAgent(),
+		IPHash:    HashIP(helpers.ClientIP(req), secret),
+	}
+}
+
+// HashIP хеширование IP адреса посетителя, исходный адрес не сохраняется.
+func HashIP(ip string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// clicksFilePath путь к файлу переходов рядом с файлом хранилища ссылок.
+func clicksFilePath(fileStorage string) string {
+	return strings.TrimSuffix(fileStorage, filepath.Ext(fileStorage)) + ".clicks.jsonl"
+}
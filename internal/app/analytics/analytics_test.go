@@ -0,0 +1,261 @@
+package analytics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/config"
+)
+
+func TestMemoryStore_GetStats(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	err := store.SaveClicks(ctx, []Click{
+		{ShortURL: "abc", IPHash: "a", Timestamp: time.Date(2024, time.July, 2, 10, 0, 0, 0, time.UTC)},
+		{ShortURL: "abc", IPHash: "b", Timestamp: time.Date(2024, time.July, 1, 10, 0, 0, 0, time.UTC)},
+		{ShortURL: "abc", IPHash: "a", Timestamp: time.Date(2024, time.July, 1, 23, 59, 0, 0, time.UTC)},
+		{ShortURL: "def", IPHash: "a", Timestamp: time.Date(2024, time.July, 1, 10, 0, 0, 0, time.UTC)},
+	})
+	assert.NoError(t, err)
+
+	stats, err := store.GetStats(ctx, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stats.TotalClicks)
+	assert.Equal(t, int64(2), stats.UniqueVisitors)
+	assert.Equal(t, []DailyClicks{{Date: "2024-07-01", Clicks: 2}, {Date: "2024-07-02", Clicks: 1}}, stats.Daily)
+
+	stats, err = store.GetStats(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), stats.TotalClicks)
+	assert.Empty(t, stats.Daily)
+
+	counts, err := store.CountClicks(ctx, []string{"abc", "def", "unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"abc": 3, "def": 1}, counts)
+}
+
+func TestFileStore_Persistence(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop().Sugar()
+	fileName := filepath.Join(t.TempDir(), "clicks.jsonl")
+
+	store, err := NewFileStore(fileName, logger)
+	assert.NoError(t, err)
+
+	err = store.SaveClicks(ctx, []Click{{ShortURL: "abc", IPHash: "a", Timestamp: time.Now()}})
+	assert.NoError(t, err)
+	err = store.SaveClicks(ctx, []Click{{ShortURL: "abc", IPHash: "b", Timestamp: time.Now()}})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+	assert.Error(t, store.SaveClicks(ctx, []Click{{ShortURL: "abc", IPHash: "c", Timestamp: time.Now()}}))
+
+	store, err = NewFileStore(fileName, logger)
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, store.Close()) }()
+
+	stats, err := store.GetStats(ctx, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stats.TotalClicks)
+	assert.Equal(t, int64(2), stats.UniqueVisitors)
+}
+
+func TestFileStore_PurgeClicks(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop().Sugar()
+	fileName := filepath.Join(t.TempDir(), "clicks.jsonl")
+
+	store, err := NewFileStore(fileName, logger)
+	assert.NoError(t, err)
+
+	err = store.SaveClicks(ctx, []Click{
+		{ShortURL: "purged", IPHash: "a", Timestamp: time.Now()},
+		{ShortURL: "kept", IPHash: "b", Timestamp: time.Now()},
+	})
+	assert.NoError(t, err)
+
+	removed, err := store.PurgeClicks(ctx, func(shortURL string) bool { return shortURL == "kept" })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	// после перезаписи переходы дописываются в новый файл
+	err = store.SaveClicks(ctx, []Click{{ShortURL: "kept", IPHash: "c", Timestamp: time.Now()}})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+
+	// удаленные переходы не возвращаются после перезапуска
+	store, err = NewFileStore(fileName, logger)
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, store.Close()) }()
+
+	counts, err := store.CountClicks(ctx, []string{"purged", "kept"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"kept": 2}, counts)
+}
+
+func TestNewClick(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/abc", http.NoBody)
+	req.Header.Set("Referer", "https://referrer.com")
+	req.Header.Set("User-Agent", "test-agent")
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	click := NewClick(req, "abc", "secret")
+
+	assert.Equal(t, "abc", click.ShortURL)
+	assert.Equal(t, "https://referrer.com", click.Referrer)
+	assert.Equal(t, "test-agent", click.UserAgent)
+	assert.Equal(t, HashIP("10.0.0.1", "secret"), click.IPHash)
+	assert.NotContains(t, click.IPHash, "10.0.0.1")
+	assert.NotEqual(t, HashIP("10.0.0.1", "another"), click.IPHash)
+}
+
+type blockingStore struct {
+	*MemoryStore
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) SaveClicks(ctx context.Context, clicks []Click) error {
+	select {
+	case s.entered <- struct{}{}:
+	default:
+	}
+	<-s.release
+	return s.MemoryStore.SaveClicks(ctx, clicks)
+}
+
+func TestQueue_Batching(t *testing.T) {
+	store := NewMemoryStore()
+	queue := NewQueue(store, QueueConfig{Size: 100, Workers: 3, BatchSize: 10, FlushInterval: time.Hour},
+		zap.NewNop().Sugar())
+
+	for range 25 {
+		queue.Record(Click{ShortURL: "abc", IPHash: "a", Timestamp: time.Now()})
+	}
+
+	err := queue.Close(context.Background())
+	assert.NoError(t, err)
+
+	stats, err := store.GetStats(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(25), stats.TotalClicks)
+	assert.Equal(t, QueueStats{Enqueued: 25, Flushed: 25, Capacity: 100}, queue.Stats())
+
+	assert.ErrorIs(t, queue.Close(context.Background()), ErrQueueClosed)
+
+	queue.Record(Click{ShortURL: "abc"})
+	assert.Equal(t, uint64(1), queue.Stats().Dropped)
+}
+
+func TestQueue_DropPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   DropPolicy
+		expected []string
+	}{
+		{name: "Drop newest", policy: DropNewest, expected: []string{"c1", "c2", "c3"}},
+		{name: "Drop oldest", policy: DropOldest, expected: []string{"c1", "c3", "c4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &blockingStore{
+				MemoryStore: NewMemoryStore(),
+				entered:     make(chan struct{}, 1),
+				release:     make(chan struct{}),
+			}
+			queue := NewQueue(store, QueueConfig{
+				DropPolicy:    tt.policy,
+				Size:          2,
+				Workers:       1,
+				BatchSize:     1,
+				FlushInterval: time.Hour,
+			}, zap.NewNop().Sugar())
+
+			queue.Record(Click{ShortURL: "c1"})
+			<-store.entered
+
+			queue.Record(Click{ShortURL: "c2"})
+			queue.Record(Click{ShortURL: "c3"})
+			queue.Record(Click{ShortURL: "c4"})
+
+			stats := queue.Stats()
+			assert.Equal(t, uint64(1), stats.Dropped)
+			assert.Equal(t, 2, stats.Pending)
+
+			close(store.release)
+			assert.NoError(t, queue.Close(context.Background()))
+
+			var saved []string
+			for _, shortURL := range []string{"c1", "c2", "c3", "c4"} {
+				result, err := store.GetStats(context.Background(), shortURL)
+				assert.NoError(t, err)
+				if result.TotalClicks > 0 {
+					saved = append(saved, shortURL)
+				}
+			}
+			assert.Equal(t, tt.expected, saved)
+		})
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	store := NewRedisStore(client)
+
+	err := store.SaveClicks(ctx, []Click{
+		{ShortURL: "abc", IPHash: "a", Timestamp: time.Date(2024, time.July, 2, 10, 0, 0, 0, time.UTC)},
+		{ShortURL: "abc", IPHash: "b", Timestamp: time.Date(2024, time.July, 1, 10, 0, 0, 0, time.UTC)},
+		{ShortURL: "def", IPHash: "a", Timestamp: time.Date(2024, time.July, 1, 10, 0, 0, 0, time.UTC)},
+	})
+	assert.NoError(t, err)
+
+	// переходы, сохраненные другой репликой, попадают в общую статистику
+	replica := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	t.Cleanup(func() { _ = replica.Client.Close() })
+	err = replica.SaveClicks(ctx, []Click{
+		{ShortURL: "abc", IPHash: "a", Timestamp: time.Date(2024, time.July, 1, 23, 59, 0, 0, time.UTC)},
+	})
+	assert.NoError(t, err)
+
+	stats, err := store.GetStats(ctx, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stats.TotalClicks)
+	assert.Equal(t, int64(2), stats.UniqueVisitors)
+	assert.Equal(t, []DailyClicks{{Date: "2024-07-01", Clicks: 2}, {Date: "2024-07-02", Clicks: 1}}, stats.Daily)
+
+	stats, err = store.GetStats(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), stats.TotalClicks)
+	assert.Empty(t, stats.Daily)
+
+	counts, err := store.CountClicks(ctx, []string{"abc", "def", "unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"abc": 3, "def": 1}, counts)
+
+	removed, err := store.PurgeClicks(ctx, func(shortURL string) bool { return shortURL == "abc" })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.False(t, server.Exists("shortener:clicks:def:total"))
+
+	counts, err = replica.CountClicks(ctx, []string{"abc", "def"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"abc": 3}, counts)
+}
+
+func TestNewStore_RedisWithoutClient(t *testing.T) {
+	_, err := NewStore(context.Background(), &config.Cfg{RedisAddr: "localhost:6379"}, nil, nil, zap.NewNop().Sugar())
+	assert.Error(t, err)
+}
@@ -0,0 +1,230 @@
+package analytics
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/fileutil"
+)
+
+const perm600 = 0o600 // perm600 код доступа к файлу
+const perm700 = 0o700 // perm700 код доступа к директории
+
+const loadBatchSize = 1000 // loadBatchSize количество переходов, передаваемых в память за раз при загрузке файла
+
+// FileStore хранилище переходов в файле формата JSON lines.
+//
+// Переходы дописываются в конец файла, в памяти хранится только накопленная по ним статистика.
+type FileStore struct {
+	*MemoryStore
+	logger   *zap.SugaredLogger
+	file     *os.File
+	fileName string
+	mu       sync.Mutex
+}
+
+// NewFileStore инициализация файлового хранилища переходов.
+func NewFileStore(fileName string, logger *zap.SugaredLogger) (*FileStore, error) {
+	store := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		logger:      logger,
+		fileName:    fileName,
+	}
+
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("unable to load clicks: %w", err)
+	}
+
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, perm600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open clicks file: %w", err)
+	}
+	store.file = file
+
+	return store, nil
+}
+
+// SaveClicks дописывает список переходов в конец файла
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - clicks[]: список переходов
+//
+// Возвращает
+//   - error: ошибка выполнения
+func (s *FileStore) SaveClicks(ctx context.Context, clicks []Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("clicks file is closed")
+	}
+
+	writer := bufio.NewWriter(s.file)
+	encoder := json.NewEncoder(writer)
+	for i := range clicks {
+		if err := encoder.Encode(&clicks[i]); err != nil {
+			return fmt.Errorf("unable to encode click: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("unable to write clicks: %w", err)
+	}
+
+	return s.MemoryStore.SaveClicks(ctx, clicks)
+}
+
+// PurgeClicks удаление переходов по коротким ссылкам, которых нет в хранилище ссылок, с перезаписью файла
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - exists: проверка наличия короткой ссылки
+//
+// Возвращает
+//   - int: количество удаленных переходов
+//   - error: ошибка выполнения
+func (s *FileStore) PurgeClicks(_ context.Context, exists func(shortURL string) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed, purged := s.MemoryStore.purge(exists)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	// Если перезапись не удалась, переходы вернутся из файла после перезапуска и удалятся при следующей очистке
+	if err := s.rewrite(purged); err != nil {
+		return removed, err
+	}
+
+	return removed, nil
+}
+
+// Close закрытие файла переходов.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return fmt.Errorf("unable to close clicks file: %w", err)
+	}
+
+	return nil
+}
+
+// rewrite атомарная перезапись файла без переходов по ссылкам purged, вызывается под s.mu.
+func (s *FileStore) rewrite(purged map[string]struct{}) error {
+	source, err := os.Open(s.fileName)
+	if err != nil {
+		return fmt.Errorf("unable to open clicks file: %w", err)
+	}
+	defer func() { _ = source.Close() }()
+
+	err = fileutil.WriteFileAtomic(s.fileName, func(w io.Writer) error {
+		return s.scan(source, func(line []byte, click *Click) error {
+			if _, ok := purged[click.ShortURL]; ok {
+				return nil
+			}
+			if _, err := w.Write(line); err != nil {
+				return fmt.Errorf("unable to write clicks file: %w", err)
+			}
+			if _, err := w.Write([]byte{'\n'}); err != nil {
+				return fmt.Errorf("unable to write clicks file: %w", err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.reopen()
+}
+
+// reopen открытие файла переходов для дозаписи после его замены, вызывается под s.mu.
+func (s *FileStore) reopen() error {
+	file, err := os.OpenFile(s.fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, perm600)
+	if err != nil {
+		return fmt.Errorf("unable to open clicks file: %w", err)
+	}
+
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+	s.file = file
+
+	return nil
+}
+
+func (s *FileStore) load() error {
+	if err := os.MkdirAll(filepath.Dir(s.fileName), perm700); err != nil {
+		return errors.New("can't create directory")
+	}
+
+	file, err := os.Open(s.fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open clicks file: %w", err)
+	}
+
+	defer func(file *os.File) {
+		if err := file.Close(); err != nil {
+			s.logger.Error("unable to close clicks file: ", err)
+		}
+	}(file)
+
+	clicks := make([]Click, 0, loadBatchSize)
+	err = s.scan(file, func(_ []byte, click *Click) error {
+		clicks = append(clicks, *click)
+		if len(clicks) < loadBatchSize {
+			return nil
+		}
+		err := s.MemoryStore.SaveClicks(context.Background(), clicks)
+		clicks = clicks[:0]
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.MemoryStore.SaveClicks(context.Background(), clicks)
+}
+
+// scan чтение переходов из файла, поврежденные строки пропускаются.
+func (s *FileStore) scan(r io.Reader, fn func(line []byte, click *Click) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var click Click
+		if err := json.Unmarshal(scanner.Bytes(), &click); err != nil {
+			s.logger.Warnf("skip malformed click record: %v", err)
+			continue
+		}
+		if err := fn(scanner.Bytes(), &click); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read clicks file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package analytics
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore хранилище переходов в памяти.
+//
+// Переходы не хранятся по отдельности: для каждой ссылки накапливаются количество переходов по дням
+// и хэши посетителей, поэтому объем памяти не растет с каждым переходом.
+type MemoryStore struct {
+	links map[string]*linkClicks
+	mu    sync.RWMutex
+}
+
+// linkClicks накопленная статистика переходов по короткой ссылке.
+type linkClicks struct {
+	daily    map[string]int64
+	visitors map[string]struct{}
+	total    int64
+}
+
+// NewMemoryStore инициализация хранилища переходов в памяти.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{links: map[string]*linkClicks{}}
+}
+
+// SaveClicks сохраняет список переходов
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - clicks[]: список переходов
+//
+// Возвращает
+//   - error: ошибка выполнения
+func (s *MemoryStore) SaveClicks(_ context.Context, clicks []Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range clicks {
+		link, ok := s.links[clicks[i].ShortURL]
+		if !ok {
+			link = &linkClicks{daily: map[string]int64{}, visitors: map[string]struct{}{}}
+			s.links[clicks[i].ShortURL] = link
+		}
+		link.daily[clicks[i].Timestamp.UTC().Format(dateLayout)]++
+		link.visitors[clicks[i].IPHash] = struct{}{}
+		link.total++
+	}
+
+	return nil
+}
+
+// GetStats получение статистики переходов по короткой ссылке
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - shortURL: короткая ссылка
+//
+// Возвращает
+//   - *Stats: статистика переходов
+//   - error: ошибка выполнения
+func (s *MemoryStore) GetStats(_ context.Context, shortURL string) (*Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := &Stats{ShortURL: shortURL, Daily: []DailyClicks{}}
+	link, ok := s.links[shortURL]
+	if !ok {
+		return stats, nil
+	}
+
+	for date, count := range link.daily {
+		stats.Daily = append(stats.Daily, DailyClicks{Date: date, Clicks: count})
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool { return stats.Daily[i].Date < stats.Daily[j].Date })
+	stats.TotalClicks = link.total
+	stats.UniqueVisitors = int64(len(link.visitors))
+
+	return stats, nil
+}
+
+// CountClicks подсчет переходов по списку коротких ссылок
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - shortURLs[]: короткие ссылки
+//
+// Возвращает
+//   - map[string]int64: количество переходов по каждой ссылке, ссылки без переходов отсутствуют
+//   - error: ошибка выполнения
+func (s *MemoryStore) CountClicks(_ context.Context, shortURLs []string) (map[string]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]int64, len(shortURLs))
+	for _, shortURL := range shortURLs {
+		if link, ok := s.links[shortURL]; ok {
+			result[shortURL] = link.total
+		}
+	}
+
+	return result, nil
+}
+
+// PurgeClicks удаление переходов по коротким ссылкам, которых нет в хранилище ссылок
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - exists: проверка наличия короткой ссылки, вызывается без блокировки хранилища переходов
+//
+// Возвращает
+//   - int: количество удаленных переходов
+//   - error: ошибка выполнения
+func (s *MemoryStore) PurgeClicks(_ context.Context, exists func(shortURL string) bool) (int, error) {
+	removed, _ := s.purge(exists)
+	return removed, nil
+}
+
+// purge удаление переходов по коротким ссылкам, для которых exists возвращает false,
+// возвращает количество удаленных переходов и ссылки, по которым они удалены.
+func (s *MemoryStore) purge(exists func(shortURL string) bool) (int, map[string]struct{}) {
+	s.mu.RLock()
+	shortURLs := make([]string, 0, len(s.links))
+	for shortURL := range s.links {
+		shortURLs = append(shortURLs, shortURL)
+	}
+	s.mu.RUnlock()
+
+	removed := 0
+	purged := make(map[string]struct{})
+	for _, shortURL := range shortURLs {
+		if exists(shortURL) {
+			continue
+		}
+
+		s.mu.Lock()
+		if link, ok := s.links[shortURL]; ok {
+			removed += int(link.total)
+			purged[shortURL] = struct{}{}
+			delete(s.links, shortURL)
+		}
+		s.mu.Unlock()
+	}
+
+	return removed, purged
+}
@@ -0,0 +1,138 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgStore хранилище переходов в БД postgres.
+type PgStore struct {
+	Conn *pgxpool.Pool
+}
+
+// NewPgStore инициализация хранилища переходов postgres, таблица создается миграциями хранилища ссылок.
+func NewPgStore(conn *pgxpool.Pool) *PgStore {
+	return &PgStore{Conn: conn}
+}
+
+// SaveClicks сохраняет список переходов одним пакетом
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - clicks[]: список переходов
+//
+// Возвращает
+//   - error: ошибка выполнения
+func (pgs *PgStore) SaveClicks(ctx context.Context, clicks []Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	stmt := `INSERT INTO clicks(short, clicked_at, referrer, user_agent, ip_hash)
+		VALUES (@short, @clicked_at, @referrer, @user_agent, @ip_hash)`
+
+	for i := range clicks {
+		batch.Queue(stmt, pgx.NamedArgs{
+			"short":      clicks[i].ShortURL,
+			"clicked_at": clicks[i].Timestamp,
+			"referrer":   clicks[i].Referrer,
+			"user_agent": clicks[i].UserAgent,
+			"ip_hash":    clicks[i].IPHash,
+		})
+	}
+
+	if err := pgs.Conn.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("unable to save clicks: %w", err)
+	}
+
+	return nil
+}
+
+// GetStats получение статистики переходов по короткой ссылке
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - shortURL: короткая ссылка
+//
+// Возвращает
+//   - *Stats: статистика переходов
+//   - error: ошибка выполнения
+func (pgs *PgStore) GetStats(ctx context.Context, shortURL string) (*Stats, error) {
+	stats := &Stats{ShortURL: shortURL, Daily: []DailyClicks{}}
+
+	err := pgs.Conn.QueryRow(
+		ctx,
+		"SELECT count(*), count(DISTINCT ip_hash) FROM clicks WHERE short = $1",
+		shortURL,
+	).Scan(&stats.TotalClicks, &stats.UniqueVisitors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count clicks: %w", err)
+	}
+
+	rows, err := pgs.Conn.Query(ctx, `
+		SELECT (clicked_at AT TIME ZONE 'UTC')::date AS day, count(*)
+		FROM clicks WHERE short = $1
+		GROUP BY day ORDER BY day`, shortURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch daily clicks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day time.Time
+		var clicks int64
+		if err := rows.Scan(&day, &clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		stats.Daily = append(stats.Daily, DailyClicks{Date: day.Format(dateLayout), Clicks: clicks})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return stats, nil
+}
+
+// CountClicks подсчет переходов по списку коротких ссылок
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - shortURLs[]: короткие ссылки
+//
+// Возвращает
+//   - map[string]int64: количество переходов по каждой ссылке, ссылки без переходов отсутствуют
+//   - error: ошибка выполнения
+func (pgs *PgStore) CountClicks(ctx context.Context, shortURLs []string) (map[string]int64, error) {
+	result := make(map[string]int64, len(shortURLs))
+	if len(shortURLs) == 0 {
+		return result, nil
+	}
+
+	rows, err := pgs.Conn.Query(ctx,
+		"SELECT short, count(*) FROM clicks WHERE short = ANY($1) GROUP BY short", shortURLs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count clicks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shortURL string
+		var clicks int64
+		if err := rows.Scan(&shortURL, &clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		result[shortURL] = clicks
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,224 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DropPolicy политика обработки переходов при переполнении очереди.
+type DropPolicy string
+
+const (
+	// DropNewest отбрасывать новый переход, если очередь заполнена.
+	DropNewest DropPolicy = "newest"
+	// DropOldest вытеснять самый старый переход из очереди в пользу нового.
+	DropOldest DropPolicy = "oldest"
+)
+
+const flushTimeout = 5 * time.Second // flushTimeout максимальное время сохранения одного пакета
+
+// ErrQueueClosed ошибка повторного закрытия очереди.
+var ErrQueueClosed = errors.New("click queue is closed")
+
+// Recorder интерфейс регистрации переходов по коротким ссылкам.
+type Recorder interface {
+	Record(click Click)
+}
+
+// QueueConfig параметры асинхронной очереди переходов.
+type QueueConfig struct {
+	DropPolicy    DropPolicy
+	Size          int
+	Workers       int
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// QueueStats метрики заполненности очереди переходов.
+type QueueStats struct {
+	Enqueued uint64 `json:"enqueued"`
+	Dropped  uint64 `json:"dropped"`
+	Flushed  uint64 `json:"flushed"`
+	Failed   uint64 `json:"failed"`
+	Pending  int    `json:"pending"`
+	Capacity int    `json:"capacity"`
+}
+
+// Queue ограниченная очередь переходов, которая пакетами сохраняет их в хранилище пулом обработчиков.
+type Queue struct {
+	store    Store
+	logger   *zap.SugaredLogger
+	events   chan Click
+	cfg      QueueConfig
+	wg       sync.WaitGroup
+	mu       sync.RWMutex
+	enqueued atomic.Uint64
+	dropped  atomic.Uint64
+	flushed  atomic.Uint64
+	failed   atomic.Uint64
+	closed   bool
+}
+
+// NewQueue инициализация очереди переходов и запуск обработчиков.
+func NewQueue(store Store, cfg QueueConfig, logger *zap.SugaredLogger) *Queue {
+	if cfg.Size <= 0 {
+		cfg.Size = 1
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+
+	q := &Queue{
+		store:  store,
+		logger: logger,
+		events: make(chan Click, cfg.Size),
+		cfg:    cfg,
+	}
+
+	for range cfg.Workers {
+		q.wg.Add(1)
+		go q.worker()
+	}
+
+	return q
+}
+
+// Record ставит переход в очередь без блокировки, при переполнении применяется политика DropPolicy.
+func (q *Queue) Record(click Click) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		q.dropped.Add(1)
+		return
+	}
+
+	select {
+	case q.events <- click:
+		q.enqueued.Add(1)
+		return
+	default:
+	}
+
+	if q.cfg.DropPolicy == DropOldest {
+		select {
+		case <-q.events:
+			q.dropped.Add(1)
+		default:
+		}
+
+		select {
+		case q.events <- click:
+			q.enqueued.Add(1)
+			return
+		default:
+		}
+	}
+
+	q.dropped.Add(1)
+}
+
+// Stats получение метрик очереди.
+func (q *Queue) Stats() QueueStats {
+	return QueueStats{
+		Enqueued: q.enqueued.Load(),
+		Dropped:  q.dropped.Load(),
+		Flushed:  q.flushed.Load(),
+		Failed:   q.failed.Load(),
+		Pending:  len(q.events),
+		Capacity: cap(q.events),
+	}
+}
+
+// Close прекращает прием переходов и ожидает сохранения оставшихся в очереди
+//
+// Аргументы
+//   - ctx: контекст выполнения, ограничивает время ожидания обработчиков
+//
+// Возвращает
+//   - error: ошибка выполнения
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrQueueClosed
+	}
+	q.closed = true
+	close(q.events)
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		stats := q.Stats()
+		q.logger.Infow("click queue stopped",
+			"enqueued", stats.Enqueued,
+			"flushed", stats.Flushed,
+			"dropped", stats.Dropped,
+			"failed", stats.Failed,
+		)
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("click queue drain interrupted: %w", ctx.Err())
+	}
+}
+
+func (q *Queue) worker() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Click, 0, q.cfg.BatchSize)
+	for {
+		select {
+		case click, ok := <-q.events:
+			if !ok {
+				q.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= q.cfg.BatchSize {
+				q.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			q.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (q *Queue) flush(batch []Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	if err := q.store.SaveClicks(ctx, batch); err != nil {
+		q.failed.Add(uint64(len(batch)))
+		q.logger.Errorf("failed to flush %d clicks: %v", len(batch), err)
+		return
+	}
+
+	q.flushed.Add(uint64(len(batch)))
+}
@@ -0,0 +1,200 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisPrefix префикс ключей хранилища, общий с хранилищем ссылок.
+//
+// Переходы не хранятся по отдельности, для каждой ссылки накапливается статистика:
+//   - clicks:<short>:daily - hash количества переходов по дням
+//   - clicks:<short>:visitors - set хэшей IP адресов посетителей
+//   - clicks:<short>:total - string, общее количество переходов
+//   - clicks - set коротких ссылок, по которым есть переходы
+const redisPrefix = "shortener:"
+
+// RedisStore хранилище переходов в Redis, используется клиент хранилища ссылок.
+type RedisStore struct {
+	Client *redis.Client
+}
+
+// NewRedisStore инициализация хранилища переходов Redis.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{Client: client}
+}
+
+// SaveClicks сохраняет список переходов
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - clicks[]: список переходов
+//
+// Возвращает
+//   - error: ошибка выполнения
+func (rs *RedisStore) SaveClicks(ctx context.Context, clicks []Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	_, err := rs.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := range clicks {
+			key := redisClicksKey(clicks[i].ShortURL)
+			pipe.HIncrBy(ctx, key+":daily", clicks[i].Timestamp.UTC().Format(dateLayout), 1)
+			pipe.SAdd(ctx, key+":visitors", clicks[i].IPHash)
+			pipe.Incr(ctx, key+":total")
+			pipe.SAdd(ctx, redisPrefix+"clicks", clicks[i].ShortURL)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save clicks: %w", err)
+	}
+
+	return nil
+}
+
+// GetStats получение статистики переходов по короткой ссылке
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - shortURL: короткая ссылка
+//
+// Возвращает
+//   - *Stats: статистика переходов
+//   - error: ошибка выполнения
+func (rs *RedisStore) GetStats(ctx context.Context, shortURL string) (*Stats, error) {
+	key := redisClicksKey(shortURL)
+
+	var daily *redis.MapStringStringCmd
+	var visitors *redis.IntCmd
+	var total *redis.StringCmd
+	_, err := rs.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		daily = pipe.HGetAll(ctx, key+":daily")
+		visitors = pipe.SCard(ctx, key+":visitors")
+		total = pipe.Get(ctx, key+":total")
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+
+	stats := &Stats{ShortURL: shortURL, Daily: []DailyClicks{}, UniqueVisitors: visitors.Val()}
+	for date, value := range daily.Val() {
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid clicks count %q: %w", value, err)
+		}
+		stats.Daily = append(stats.Daily, DailyClicks{Date: date, Clicks: count})
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool { return stats.Daily[i].Date < stats.Daily[j].Date })
+
+	if stats.TotalClicks, err = redisCount(total); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// CountClicks подсчет переходов по списку коротких ссылок
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - shortURLs[]: короткие ссылки
+//
+// Возвращает
+//   - map[string]int64: количество переходов по каждой ссылке, ссылки без переходов отсутствуют
+//   - error: ошибка выполнения
+func (rs *RedisStore) CountClicks(ctx context.Context, shortURLs []string) (map[string]int64, error) {
+	cmds := make([]*redis.StringCmd, len(shortURLs))
+	_, err := rs.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, shortURL := range shortURLs {
+			cmds[i] = pipe.Get(ctx, redisClicksKey(shortURL)+":total")
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to count clicks: %w", err)
+	}
+
+	result := make(map[string]int64, len(shortURLs))
+	for i, shortURL := range shortURLs {
+		count, err := redisCount(cmds[i])
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			result[shortURL] = count
+		}
+	}
+
+	return result, nil
+}
+
+// PurgeClicks удаление переходов по коротким ссылкам, которых нет в хранилище ссылок
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - exists: проверка наличия короткой ссылки
+//
+// Возвращает
+//   - int: количество удаленных переходов
+//   - error: ошибка выполнения
+func (rs *RedisStore) PurgeClicks(ctx context.Context, exists func(shortURL string) bool) (int, error) {
+	removed := 0
+
+	iter := rs.Client.SScan(ctx, redisPrefix+"clicks", 0, "", 0).Iterator()
+	for iter.Next(ctx) {
+		shortURL := iter.Val()
+		if exists(shortURL) {
+			continue
+		}
+
+		key := redisClicksKey(shortURL)
+		var total *redis.StringCmd
+		_, err := rs.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			total = pipe.Get(ctx, key+":total")
+			pipe.Del(ctx, key+":daily", key+":visitors", key+":total")
+			pipe.SRem(ctx, redisPrefix+"clicks", shortURL)
+			return nil
+		})
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return removed, fmt.Errorf("failed to purge clicks: %w", err)
+		}
+
+		count, err := redisCount(total)
+		if err != nil {
+			return removed, err
+		}
+		removed += int(count)
+	}
+	if err := iter.Err(); err != nil {
+		return removed, fmt.Errorf("failed to scan clicks: %w", err)
+	}
+
+	return removed, nil
+}
+
+// redisClicksKey префикс ключей статистики переходов по короткой ссылке.
+func redisClicksKey(shortURL string) string {
+	return redisPrefix + "clicks:" + shortURL
+}
+
+// redisCount разбор счетчика переходов, отсутствующий счетчик - ноль.
+func redisCount(cmd *redis.StringCmd) (int64, error) {
+	if errors.Is(cmd.Err(), redis.Nil) {
+		return 0, nil
+	}
+
+	count, err := cmd.Int64()
+	if err != nil {
+		return 0, fmt.Errorf("invalid clicks count: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,113 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+const validFor = 365 * 24 * time.Hour // validFor срок действия самоподписанного сертификата
+const serialBits = 128                // serialBits разрядность серийного номера сертификата
+
+// NewTLSConfig инициализация настроек TLS
+//
+// Аргументы
+//   - certFile: путь к файлу сертификата
+//   - keyFile: путь к файлу приватного ключа
+//   - hosts[]: имена и адреса для самоподписанного сертификата
+//
+// Возвращает
+//   - *tls.Config: настройки TLS, если файлы не заданы - с самоподписанным сертификатом
+//   - error: ошибка выполнения
+func NewTLSConfig(certFile string, keyFile string, hosts []string) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+
+	switch {
+	case certFile != "" && keyFile != "":
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load certificate: %w", err)
+		}
+	case certFile != "" || keyFile != "":
+		return nil, errors.New("both certificate and key files must be set")
+	default:
+		certPEM, keyPEM, err := GenerateSelfSigned(hosts)
+		if err != nil {
+			return nil, err
+		}
+		cert, err = tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse self-signed certificate: %w", err)
+		}
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// GenerateSelfSigned генерация самоподписанного сертификата в памяти
+//
+// Аргументы
+//   - hosts[]: DNS имена и IP адреса, для которых выпускается сертификат
+//
+// Возвращает
+//   - certPEM: сертификат в формате PEM
+//   - keyPEM: приватный ключ в формате PEM
+//   - error: ошибка выполнения
+func GenerateSelfSigned(hosts []string) (certPEM []byte, keyPEM []byte, err error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to generate key: %w", err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialBits))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"short-url"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+			continue
+		}
+		template.DNSNames = append(template.DNSNames, host)
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to marshal key: %w", err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,51 @@
+package certs
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSelfSigned(t *testing.T) {
+	certPEM, keyPEM, err := GenerateSelfSigned([]string{"localhost", "127.0.0.1"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, keyPEM)
+
+	cfg, err := NewTLSConfig("", "", []string{"localhost", "127.0.0.1"})
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Certificates, 1)
+
+	cert, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"localhost"}, cert.DNSNames)
+	assert.Len(t, cert.IPAddresses, 1)
+	assert.NoError(t, cert.VerifyHostname("localhost"))
+	assert.NotEmpty(t, certPEM)
+}
+
+func TestNewTLSConfigFromFiles(t *testing.T) {
+	certPEM, keyPEM, err := GenerateSelfSigned([]string{"example.com"})
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	cfg, err := NewTLSConfig(certFile, keyFile, nil)
+	assert.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com"}, cert.DNSNames)
+
+	_, err = NewTLSConfig(certFile, "", nil)
+	assert.Error(t, err)
+
+	_, err = NewTLSConfig(filepath.Join(dir, "missing.pem"), keyFile, nil)
+	assert.Error(t, err)
+}
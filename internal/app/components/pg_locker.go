@@ -0,0 +1,77 @@
+package components
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RetentionLockName имя блокировки очистки хранилища.
+const RetentionLockName = "short-url:retention"
+
+// PgLocker распределенная блокировка на advisory lock PostgreSQL.
+//
+// Блокировка принадлежит сессии, поэтому на время работы соединение забирается из пула.
+type PgLocker struct {
+	pool *pgxpool.Pool
+	name string
+}
+
+// NewPgLocker инициализация блокировки
+//
+// Аргументы
+//   - pool: пул соединений с базой данных
+//   - name: имя блокировки, реплики с одинаковым именем исключают друг друга
+//
+// Возвращает
+//   - *PgLocker: блокировка
+func NewPgLocker(pool *pgxpool.Pool, name string) *PgLocker {
+	return &PgLocker{pool: pool, name: name}
+}
+
+// TryLock захват блокировки без ожидания
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//
+// Возвращает
+//   - func(ctx context.Context) error: снятие блокировки и возврат соединения в пул
+//   - bool: блокировка захвачена
+//   - error: ошибка выполнения
+func (l *PgLocker) TryLock(ctx context.Context) (func(ctx context.Context) error, bool, error) {
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	var acquired bool
+	err = conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, l.name).Scan(&acquired)
+	if err != nil || !acquired {
+		conn.Release()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to try advisory lock: %w", err)
+		}
+		return nil, false, nil
+	}
+
+	unlock := func(ctx context.Context) error {
+		defer conn.Release()
+
+		var released bool
+		err := conn.QueryRow(ctx, `SELECT pg_advisory_unlock(hashtext($1))`, l.name).Scan(&released)
+		if err == nil && !released {
+			err = errors.New("advisory lock is not held")
+		}
+		if err != nil {
+			// Соединение с возможно не снятой блокировкой не должно вернуться в пул
+			_ = conn.Conn().Close(ctx)
+			return fmt.Errorf("failed to release advisory lock: %w", err)
+		}
+
+		return nil
+	}
+
+	return unlock, true, nil
+}
@@ -0,0 +1,186 @@
+package components
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/schedule"
+)
+
+const unlockTimeout = 5 * time.Second // unlockTimeout максимальное время снятия блокировки
+
+// Purger хранилище с окончательным удалением ссылок.
+type Purger interface {
+	DeleteHard(ctx context.Context, deletedBefore time.Time) (int, error)
+	IsExists(ctx context.Context, id string) bool
+}
+
+// ClickPurger хранилище переходов, отдельное от хранилища ссылок.
+type ClickPurger interface {
+	// PurgeClicks удаление переходов по коротким ссылкам, для которых exists возвращает false,
+	// возвращает количество удаленных переходов.
+	PurgeClicks(ctx context.Context, exists func(shortURL string) bool) (int, error)
+}
+
+// Locker распределенная блокировка, которую в каждый момент держит не больше одной реплики.
+type Locker interface {
+	// TryLock захват блокировки без ожидания, acquired false - блокировку держит другая реплика.
+	// После выполнения работы блокировку снимают вызовом unlock.
+	TryLock(ctx context.Context) (unlock func(ctx context.Context) error, acquired bool, err error)
+}
+
+// RetentionConfig параметры очистки хранилища.
+//
+// Очистка окончательно удаляет ссылки, мягко удаленные или истекшие раньше чем Window назад. Запуск
+// по расписанию Schedule сдвигается на случайную паузу до Jitter, чтобы реплики не обращались
+// к хранилищу одновременно. Если задан Locker, очистку выполняет только реплика, захватившая
+// блокировку. Если задан Clicks, после очистки из него удаляются переходы по окончательно удаленным
+// ссылкам.
+type RetentionConfig struct {
+	Schedule   schedule.Schedule
+	Locker     Locker
+	Clicks     ClickPurger
+	Window     time.Duration
+	Jitter     time.Duration
+	RunOnStart bool
+}
+
+// Retention очистка хранилища по расписанию.
+type Retention struct {
+	store  Purger
+	logger *zap.SugaredLogger
+	cfg    RetentionConfig
+}
+
+// NewRetention инициализация очистки хранилища
+//
+// Аргументы
+//   - store: хранилище
+//   - cfg: параметры очистки
+//   - logger: логгер
+//
+// Возвращает
+//   - *Retention: очистка хранилища
+func NewRetention(store Purger, cfg RetentionConfig, logger *zap.SugaredLogger) *Retention {
+	if cfg.Window < 0 {
+		cfg.Window = 0
+	}
+	if cfg.Jitter < 0 {
+		cfg.Jitter = 0
+	}
+
+	return &Retention{store: store, logger: logger, cfg: cfg}
+}
+
+// Run выполнение очистки по расписанию до отмены контекста
+//
+// Аргументы
+//   - ctx: контекст выполнения
+func (r *Retention) Run(ctx context.Context) {
+	if r.cfg.RunOnStart {
+		_ = r.RunOnce(ctx)
+	}
+
+	for {
+		now := time.Now()
+		next := r.cfg.Schedule.Next(now)
+		if next.IsZero() {
+			r.logger.Warnw("retention schedule has no next run", "schedule", r.cfg.Schedule)
+			return
+		}
+
+		timer := time.NewTimer(next.Sub(now) + r.jitter())
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		_ = r.RunOnce(ctx)
+	}
+}
+
+// RunOnce однократная очистка хранилища, результат записывается в лог
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//
+// Возвращает
+//   - error: ошибка блокировки или хранилища
+func (r *Retention) RunOnce(ctx context.Context) error {
+	start := time.Now()
+
+	if r.cfg.Locker != nil {
+		unlock, acquired, err := r.cfg.Locker.TryLock(ctx)
+		if err != nil {
+			r.logger.Errorw("retention lock failed", "error", err)
+			return fmt.Errorf("failed to acquire retention lock: %w", err)
+		}
+		if !acquired {
+			r.logger.Infow("retention run skipped, lock is held by another replica")
+			return nil
+		}
+
+		defer func() {
+			// Блокировка снимается и после отмены контекста, иначе она останется на соединении пула
+			unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), unlockTimeout)
+			defer cancel()
+
+			if err := unlock(unlockCtx); err != nil {
+				r.logger.Errorw("retention unlock failed", "error", err)
+			}
+		}()
+	}
+
+	deletedBefore := start.Add(-r.cfg.Window)
+	removed, err := r.store.DeleteHard(ctx, deletedBefore)
+	if err != nil {
+		r.logger.Errorw("retention run failed",
+			"error", err,
+			"removed", removed,
+			"deleted_before", deletedBefore,
+			"duration", time.Since(start),
+		)
+		return fmt.Errorf("failed to purge storage: %w", err)
+	}
+
+	clicksRemoved := 0
+	if r.cfg.Clicks != nil {
+		clicksRemoved, err = r.cfg.Clicks.PurgeClicks(ctx, func(shortURL string) bool {
+			return r.store.IsExists(ctx, shortURL)
+		})
+		if err != nil {
+			r.logger.Errorw("retention clicks purge failed",
+				"error", err,
+				"removed", removed,
+				"duration", time.Since(start),
+			)
+			return fmt.Errorf("failed to purge clicks: %w", err)
+		}
+	}
+
+	r.logger.Infow("retention run finished",
+		"removed", removed,
+		"clicks_removed", clicksRemoved,
+		"deleted_before", deletedBefore,
+		"window", r.cfg.Window,
+		"duration", time.Since(start),
+	)
+
+	return nil
+}
+
+// jitter случайная пауза перед запуском от 0 до Jitter.
+func (r *Retention) jitter() time.Duration {
+	if r.cfg.Jitter <= 0 {
+		return 0
+	}
+
+	return rand.N(r.cfg.Jitter)
+}
@@ -0,0 +1,219 @@
+package components
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/Erlast/short-url.git/internal/app/analytics"
+	"github.com/Erlast/short-url.git/internal/app/schedule"
+	"github.com/Erlast/short-url.git/internal/app/storages"
+)
+
+// fakeLocker блокировка в памяти, общая для нескольких экземпляров очистки.
+type fakeLocker struct {
+	err      error
+	mu       sync.Mutex
+	held     bool
+	unlocked int
+}
+
+func (l *fakeLocker) TryLock(context.Context) (func(ctx context.Context) error, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return nil, false, l.err
+	}
+	if l.held {
+		return nil, false, nil
+	}
+	l.held = true
+
+	return func(context.Context) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.held = false
+		l.unlocked++
+		return nil
+	}, true, nil
+}
+
+func TestRetention_RunOnce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := storages.NewMockURLStorage(ctrl)
+	core, logs := observer.New(zapcore.InfoLevel)
+	locker := &fakeLocker{}
+
+	retention := NewRetention(store, RetentionConfig{
+		Schedule: schedule.Interval(time.Hour),
+		Locker:   locker,
+		Window:   30 * 24 * time.Hour,
+	}, zap.New(core).Sugar())
+
+	var deletedBefore time.Time
+	store.EXPECT().DeleteHard(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, before time.Time) (int, error) {
+			deletedBefore = before
+			return 3, nil
+		})
+
+	start := time.Now()
+	require.NoError(t, retention.RunOnce(context.Background()))
+
+	assert.WithinDuration(t, start.Add(-30*24*time.Hour), deletedBefore, time.Second)
+	assert.False(t, locker.held)
+	assert.Equal(t, 1, locker.unlocked)
+
+	entries := logs.FilterMessage("retention run finished").All()
+	require.Len(t, entries, 1)
+	assert.EqualValues(t, 3, entries[0].ContextMap()["removed"])
+}
+
+func TestRetention_RunOncePurgesClicks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := storages.NewMockURLStorage(ctrl)
+	core, logs := observer.New(zapcore.InfoLevel)
+	clicks := analytics.NewMemoryStore()
+
+	require.NoError(t, clicks.SaveClicks(context.Background(), []analytics.Click{
+		{ShortURL: "purged", IPHash: "a"},
+		{ShortURL: "purged", IPHash: "b"},
+		{ShortURL: "kept", IPHash: "a"},
+	}))
+
+	retention := NewRetention(store, RetentionConfig{
+		Schedule: schedule.Interval(time.Hour),
+		Clicks:   clicks,
+	}, zap.New(core).Sugar())
+
+	store.EXPECT().DeleteHard(gomock.Any(), gomock.Any()).Return(1, nil)
+	store.EXPECT().IsExists(gomock.Any(), "purged").Return(false)
+	store.EXPECT().IsExists(gomock.Any(), "kept").Return(true)
+
+	require.NoError(t, retention.RunOnce(context.Background()))
+
+	counts, err := clicks.CountClicks(context.Background(), []string{"purged", "kept"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"kept": 1}, counts)
+
+	entries := logs.FilterMessage("retention run finished").All()
+	require.Len(t, entries, 1)
+	assert.EqualValues(t, 2, entries[0].ContextMap()["clicks_removed"])
+}
+
+func TestRetention_RunOnceLockHeld(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := storages.NewMockURLStorage(ctrl)
+	core, logs := observer.New(zapcore.InfoLevel)
+	locker := &fakeLocker{held: true}
+
+	retention := NewRetention(store, RetentionConfig{
+		Schedule: schedule.Interval(time.Hour),
+		Locker:   locker,
+	}, zap.New(core).Sugar())
+
+	// Другая реплика держит блокировку, хранилище не вызывается
+	require.NoError(t, retention.RunOnce(context.Background()))
+
+	assert.Equal(t, 1, logs.FilterMessage("retention run skipped, lock is held by another replica").Len())
+	assert.Zero(t, locker.unlocked)
+}
+
+func TestRetention_RunOnceError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := storages.NewMockURLStorage(ctrl)
+	core, logs := observer.New(zapcore.InfoLevel)
+	locker := &fakeLocker{}
+
+	retention := NewRetention(store, RetentionConfig{
+		Schedule: schedule.Interval(time.Hour),
+		Locker:   locker,
+	}, zap.New(core).Sugar())
+
+	store.EXPECT().DeleteHard(gomock.Any(), gomock.Any()).Return(0, errors.New("mock error"))
+
+	assert.Error(t, retention.RunOnce(context.Background()))
+	assert.Equal(t, 1, logs.FilterMessage("retention run failed").Len())
+	// Блокировка снимается и после ошибки
+	assert.False(t, locker.held)
+
+	locker.err = errors.New("connection refused")
+	assert.Error(t, retention.RunOnce(context.Background()))
+	assert.Equal(t, 1, logs.FilterMessage("retention lock failed").Len())
+}
+
+func TestRetention_Run(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := storages.NewMockURLStorage(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := make(chan struct{}, 10)
+	store.EXPECT().DeleteHard(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(context.Context, time.Time) (int, error) {
+			runs <- struct{}{}
+			return 0, nil
+		}).MinTimes(3)
+
+	retention := NewRetention(store, RetentionConfig{
+		Schedule:   schedule.Interval(5 * time.Millisecond),
+		Jitter:     time.Millisecond,
+		RunOnStart: true,
+	}, zap.NewNop().Sugar())
+
+	done := make(chan struct{})
+	go func() {
+		retention.Run(ctx)
+		close(done)
+	}()
+
+	for range 3 {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatal("очистка не запускается по расписанию")
+		}
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run не завершилась после отмены контекста")
+	}
+}
+
+func TestRetention_RunWithoutNextRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := storages.NewMockURLStorage(ctrl)
+
+	cron, err := schedule.ParseCron("0 0 31 2 *")
+	require.NoError(t, err)
+
+	retention := NewRetention(store, RetentionConfig{Schedule: cron}, zap.NewNop().Sugar())
+
+	done := make(chan struct{})
+	go func() {
+		retention.Run(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run не завершилась для расписания без запусков")
+	}
+}
@@ -1,72 +1,649 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v11"
+
+	"github.com/Erlast/short-url.git/internal/app/helpers"
+	"github.com/Erlast/short-url.git/internal/app/schedule"
+	"github.com/Erlast/short-url.git/internal/app/shortcode"
 )
 
 // Cfg структура конфигурации.
 type Cfg struct {
-	FlagRunAddr string
-	FlagBaseURL string
-	FileStorage string
-	DatabaseDSN string
-	SecretKey   string
+	FlagRunAddr         string
+	GRPCAddr            string
+	FlagBaseURL         string
+	FileStorage         string
+	DatabaseDSN         string
+	RedisAddr           string
+	SecretKey           string
+	TLSCertFile         string
+	TLSKeyFile          string
+	TrustedSubnet       string
+	TrustedProxies      string
+	ClickDropPolicy     string
+	FileSync            string
+	CodeStrategy        string
+	CodeAlphabet        string
+	CodeKey             string
+	RetentionCron       string
+	ClickQueueSize      int
+	ClickWorkers        int
+	ClickBatchSize      int
+	CacheSize           int
+	CodeLength          int
+	ShortenRateLimit    int
+	ShortenBurst        int
+	RedirectRateLimit   int
+	RedirectBurst       int
+	DeleteQueueSize     int
+	DeleteBatchSize     int
+	DeleteMaxRetries    int
+	CodeNodeID          int64
+	ClickFlushInterval  time.Duration
+	ShutdownTimeout     time.Duration
+	CacheTTL            time.Duration
+	FileSyncInterval    time.Duration
+	FileCompactInterval time.Duration
+	RefreshTokenTTL     time.Duration
+	DeleteFlushInterval time.Duration
+	RetentionInterval   time.Duration
+	RetentionWindow     time.Duration
+	RetentionJitter     time.Duration
+	EnableHTTPS         bool
 }
 
+// envCfg переменные окружения, nil - переменная не задана.
 type envCfg struct {
-	RunAddr     string `env:"SERVER_ADDRESS"`
-	BaseURL     string `env:"BASE_URL"`
-	FileStorage string `env:"FILE_STORAGE_PATH"`
-	DatabaseDSN string `env:"DATABASE_DSN"`
-	SecretKey   string `env:"SECRET_KEY"`
+	RunAddr             *string        `env:"SERVER_ADDRESS"`
+	GRPCAddr            *string        `env:"GRPC_ADDRESS"`
+	BaseURL             *string        `env:"BASE_URL"`
+	FileStorage         *string        `env:"FILE_STORAGE_PATH"`
+	DatabaseDSN         *string        `env:"DATABASE_DSN"`
+	RedisAddr           *string        `env:"REDIS_ADDR"`
+	SecretKey           *string        `env:"SECRET_KEY"`
+	TLSCertFile         *string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile          *string        `env:"TLS_KEY_FILE"`
+	TrustedSubnet       *string        `env:"TRUSTED_SUBNET"`
+	TrustedProxies      *string        `env:"TRUSTED_PROXIES"`
+	ClickDropPolicy     *string        `env:"CLICK_DROP_POLICY"`
+	FileSync            *string        `env:"FILE_SYNC"`
+	CodeStrategy        *string        `env:"SHORT_CODE_STRATEGY"`
+	CodeAlphabet        *string        `env:"SHORT_CODE_ALPHABET"`
+	CodeKey             *string        `env:"SHORT_CODE_KEY"`
+	RetentionCron       *string        `env:"RETENTION_CRON"`
+	ClickQueueSize      *int           `env:"CLICK_QUEUE_SIZE"`
+	ClickWorkers        *int           `env:"CLICK_WORKERS"`
+	ClickBatchSize      *int           `env:"CLICK_BATCH_SIZE"`
+	CacheSize           *int           `env:"CACHE_SIZE"`
+	CodeLength          *int           `env:"SHORT_CODE_LENGTH"`
+	ShortenRateLimit    *int           `env:"RATE_LIMIT_SHORTEN"`
+	ShortenBurst        *int           `env:"RATE_LIMIT_SHORTEN_BURST"`
+	RedirectRateLimit   *int           `env:"RATE_LIMIT_REDIRECT"`
+	RedirectBurst       *int           `env:"RATE_LIMIT_REDIRECT_BURST"`
+	DeleteQueueSize     *int           `env:"DELETE_QUEUE_SIZE"`
+	DeleteBatchSize     *int           `env:"DELETE_BATCH_SIZE"`
+	DeleteMaxRetries    *int           `env:"DELETE_MAX_RETRIES"`
+	CodeNodeID          *int64         `env:"SHORT_CODE_NODE_ID"`
+	ClickFlushInterval  *time.Duration `env:"CLICK_FLUSH_INTERVAL"`
+	ShutdownTimeout     *time.Duration `env:"SHUTDOWN_TIMEOUT"`
+	CacheTTL            *time.Duration `env:"CACHE_TTL"`
+	FileSyncInterval    *time.Duration `env:"FILE_SYNC_INTERVAL"`
+	FileCompactInterval *time.Duration `env:"FILE_COMPACT_INTERVAL"`
+	RefreshTokenTTL     *time.Duration `env:"REFRESH_TOKEN_TTL"`
+	DeleteFlushInterval *time.Duration `env:"DELETE_FLUSH_INTERVAL"`
+	RetentionInterval   *time.Duration `env:"RETENTION_INTERVAL"`
+	RetentionWindow     *time.Duration `env:"RETENTION_WINDOW"`
+	RetentionJitter     *time.Duration `env:"RETENTION_JITTER"`
+	EnableHTTPS         *bool          `env:"ENABLE_HTTPS"`
+	Config              string         `env:"CONFIG"`
+}
+
+// fileCfg JSON файл конфигурации, nil - параметр не задан.
+type fileCfg struct {
+	RunAddr             *string   `json:"server_address"`
+	GRPCAddr            *string   `json:"grpc_address"`
+	BaseURL             *string   `json:"base_url"`
+	FileStorage         *string   `json:"file_storage_path"`
+	DatabaseDSN         *string   `json:"database_dsn"`
+	RedisAddr           *string   `json:"redis_addr"`
+	SecretKey           *string   `json:"secret_key"`
+	TLSCertFile         *string   `json:"tls_cert_file"`
+	TLSKeyFile          *string   `json:"tls_key_file"`
+	TrustedSubnet       *string   `json:"trusted_subnet"`
+	TrustedProxies      *string   `json:"trusted_proxies"`
+	ClickDropPolicy     *string   `json:"click_drop_policy"`
+	FileSync            *string   `json:"file_sync"`
+	CodeStrategy        *string   `json:"code_strategy"`
+	CodeAlphabet        *string   `json:"code_alphabet"`
+	CodeKey             *string   `json:"code_key"`
+	RetentionCron       *string   `json:"retention_cron"`
+	ClickQueueSize      *int      `json:"click_queue_size"`
+	ClickWorkers        *int      `json:"click_workers"`
+	ClickBatchSize      *int      `json:"click_batch_size"`
+	CacheSize           *int      `json:"cache_size"`
+	CodeLength          *int      `json:"code_length"`
+	ShortenRateLimit    *int      `json:"rate_limit_shorten"`
+	ShortenBurst        *int      `json:"rate_limit_shorten_burst"`
+	RedirectRateLimit   *int      `json:"rate_limit_redirect"`
+	RedirectBurst       *int      `json:"rate_limit_redirect_burst"`
+	DeleteQueueSize     *int      `json:"delete_queue_size"`
+	DeleteBatchSize     *int      `json:"delete_batch_size"`
+	DeleteMaxRetries    *int      `json:"delete_max_retries"`
+	CodeNodeID          *int64    `json:"code_node_id"`
+	ClickFlushInterval  *duration `json:"click_flush_interval"`
+	ShutdownTimeout     *duration `json:"shutdown_timeout"`
+	CacheTTL            *duration `json:"cache_ttl"`
+	FileSyncInterval    *duration `json:"file_sync_interval"`
+	FileCompactInterval *duration `json:"file_compact_interval"`
+	RefreshTokenTTL     *duration `json:"refresh_token_ttl"`
+	DeleteFlushInterval *duration `json:"delete_flush_interval"`
+	RetentionInterval   *duration `json:"retention_interval"`
+	RetentionWindow     *duration `json:"retention_window"`
+	RetentionJitter     *duration `json:"retention_jitter"`
+	EnableHTTPS         *bool     `json:"enable_https"`
+}
+
+// duration длительность в JSON файле конфигурации в формате time.ParseDuration, например "10s".
+type duration time.Duration
+
+// UnmarshalJSON разбор длительности из строки.
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", value, err)
+	}
+
+	*d = duration(parsed)
+	return nil
 }
 
 const defaultRunAddr = ":8080"                          // defaultRunAddr порт по умолчанию
+const defaultGRPCAddr = ":3200"                         // defaultGRPCAddr адрес gRPC сервера
 const defaultBaseURL = "http://localhost:8080"          // defaultBaseURL базовый URL приложения
 const defaultFileStoragePath = "/tmp/short-url-db.json" // defaultFileStoragePath файл хранилище
 const secretKey = "supersecretkey"                      // secretKey  секретный ключ для формирования jwt токенов
+const defaultClickDropPolicy = "newest"                 // defaultClickDropPolicy политика переполнения очереди переходов
+const defaultClickQueueSize = 10000                     // defaultClickQueueSize размер очереди переходов
+const defaultClickWorkers = 2                           // defaultClickWorkers количество обработчиков очереди переходов
+const defaultClickBatchSize = 100                       // defaultClickBatchSize размер пакета сохранения переходов
+const defaultClickFlushInterval = time.Second           // defaultClickFlushInterval период сохранения переходов
+const defaultShutdownTimeout = 10 * time.Second         // defaultShutdownTimeout время ожидания остановки сервера
+const defaultCacheSize = 10000                          // defaultCacheSize размер кэша коротких ссылок
+const defaultCacheTTL = 5 * time.Minute                 // defaultCacheTTL время жизни записи кэша
+const maxCodeNodeID = 1023                              // maxCodeNodeID максимальный номер узла генератора snowflake
+const defaultFileSync = "interval"                      // defaultFileSync политика fsync журнала файлового хранилища
+const defaultFileSyncInterval = time.Second             // defaultFileSyncInterval период fsync журнала
+const defaultFileCompactInterval = 10 * time.Minute     // defaultFileCompactInterval период компактизации журнала
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour      // defaultRefreshTokenTTL время жизни refresh токена
+const defaultShortenRateLimit = 60                      // defaultShortenRateLimit запросов создания ссылок в минуту
+const defaultShortenBurst = 20                          // defaultShortenBurst запас запросов создания ссылок
+const defaultRedirectRateLimit = 1200                   // defaultRedirectRateLimit переходов в минуту
+const defaultRedirectBurst = 200                        // defaultRedirectBurst запас переходов
+
+const defaultDeleteQueueSize = 1000                       // defaultDeleteQueueSize размер очереди запросов удаления
+const defaultDeleteBatchSize = 1000                       // defaultDeleteBatchSize количество ссылок в пакете удаления
+const defaultDeleteMaxRetries = 5                         // defaultDeleteMaxRetries количество повторов удаления пакета
+const defaultDeleteFlushInterval = 100 * time.Millisecond // defaultDeleteFlushInterval период удаления пакета
+
+const defaultRetentionInterval = 24 * time.Hour    // defaultRetentionInterval период очистки хранилища
+const defaultRetentionWindow = 30 * 24 * time.Hour // defaultRetentionWindow срок хранения мягко удаленных ссылок
+const defaultRetentionJitter = 10 * time.Minute    // defaultRetentionJitter случайная задержка очистки
+
+// codeStrategies стратегии генерации коротких ссылок.
+var codeStrategies = []string{
+	shortcode.StrategyRandom,
+	shortcode.StrategySequence,
+	shortcode.StrategySnowflake,
+	shortcode.StrategyHash,
+}
 
 // ParseFlags функция разбора заданных параметров приложения.
+//
+// Приоритет источников: флаги командной строки, переменные окружения, JSON файл конфигурации
+// (флаг -c/-config или переменная CONFIG), значения по умолчанию.
 func ParseFlags() *Cfg {
-	config := &Cfg{
+	config, err := Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("can't load config: %v", err)
+	}
+
+	return config
+}
+
+// Load загрузка и проверка конфигурации
+//
+// Аргументы
+//   - fs: набор флагов, в котором регистрируются параметры приложения
+//   - args[]: аргументы командной строки
+//
+// Возвращает
+//   - *Cfg: конфигурация приложения
+//   - error: ошибка выполнения
+func Load(fs *flag.FlagSet, args []string) (*Cfg, error) {
+	var configFile string
+
+	// Флаги разбираются в отдельную структуру, чтобы применить их поверх остальных источников
+	registerFlags(fs, defaultConfig(), &configFile)
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("can't parse flags: %w", err)
+	}
+
+	setFlags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = f.Value.String()
+	})
+
+	envs := envCfg{}
+	if err := env.Parse(&envs); err != nil {
+		return nil, fmt.Errorf("can't parse env: %w", err)
+	}
+
+	if configFile == "" {
+		configFile = envs.Config
+	}
+
+	config := defaultConfig()
+
+	if configFile != "" {
+		if err := applyFile(config, configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	applyEnv(config, &envs)
+
+	overrides := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	registerFlags(overrides, config, &configFile)
+	for name, value := range setFlags {
+		if err := overrides.Set(name, value); err != nil {
+			return nil, fmt.Errorf("can't apply flag %s: %w", name, err)
+		}
+	}
+
+	if config.EnableHTTPS {
+		config.FlagBaseURL = httpsBaseURL(config.FlagBaseURL)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Validate проверка значений конфигурации.
+func (c *Cfg) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.FlagRunAddr); err != nil {
+		errs = append(errs, fmt.Errorf("invalid server address %q: %w", c.FlagRunAddr, err))
+	}
+
+	if _, _, err := net.SplitHostPort(c.GRPCAddr); err != nil {
+		errs = append(errs, fmt.Errorf("invalid gRPC address %q: %w", c.GRPCAddr, err))
+	}
+
+	if u, err := url.Parse(c.FlagBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("invalid base URL %q", c.FlagBaseURL))
+	}
+
+	if c.SecretKey == "" {
+		errs = append(errs, errors.New("secret key must not be empty"))
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("both TLS certificate and key files must be set"))
+	}
+
+	if c.TrustedSubnet != "" {
+		if _, _, err := net.ParseCIDR(c.TrustedSubnet); err != nil {
+			errs = append(errs, fmt.Errorf("invalid trusted subnet %q: %w", c.TrustedSubnet, err))
+		}
+	}
+
+	if _, err := helpers.ParseSubnets(c.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("invalid trusted proxies: %w", err))
+	}
+
+	if c.ClickDropPolicy != "newest" && c.ClickDropPolicy != "oldest" {
+		errs = append(errs, fmt.Errorf("invalid click drop policy %q", c.ClickDropPolicy))
+	}
+
+	if c.ClickQueueSize <= 0 || c.ClickWorkers <= 0 || c.ClickBatchSize <= 0 {
+		errs = append(errs, errors.New("click queue size, workers and batch size must be positive"))
+	}
+
+	if c.ClickFlushInterval <= 0 {
+		errs = append(errs, errors.New("click flush interval must be positive"))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown timeout must be positive"))
+	}
+
+	if c.CacheSize < 0 {
+		errs = append(errs, errors.New("cache size must not be negative"))
+	}
+
+	if c.CacheSize > 0 && c.CacheTTL <= 0 {
+		errs = append(errs, errors.New("cache TTL must be positive"))
+	}
+
+	if !slices.Contains(codeStrategies, c.CodeStrategy) {
+		errs = append(errs, fmt.Errorf("invalid short code strategy %q", c.CodeStrategy))
+	}
+
+	if err := shortcode.Validate(c.CodeAlphabet, c.CodeLength); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.CodeNodeID < 0 || c.CodeNodeID > maxCodeNodeID {
+		errs = append(errs, fmt.Errorf("short code node id must be between 0 and %d", maxCodeNodeID))
+	}
+
+	if c.FileSync != "always" && c.FileSync != "interval" && c.FileSync != "never" {
+		errs = append(errs, fmt.Errorf("invalid file sync policy %q", c.FileSync))
+	}
+
+	if c.FileSync == "interval" && c.FileSyncInterval <= 0 {
+		errs = append(errs, errors.New("file sync interval must be positive"))
+	}
+
+	if c.FileCompactInterval < 0 {
+		errs = append(errs, errors.New("file compact interval must not be negative"))
+	}
+
+	if c.RefreshTokenTTL <= 0 {
+		errs = append(errs, errors.New("refresh token TTL must be positive"))
+	}
+
+	if c.DeleteQueueSize <= 0 || c.DeleteBatchSize <= 0 {
+		errs = append(errs, errors.New("delete queue size and batch size must be positive"))
+	}
+
+	if c.DeleteMaxRetries < 0 {
+		errs = append(errs, errors.New("delete max retries must not be negative"))
+	}
+
+	if c.DeleteFlushInterval <= 0 {
+		errs = append(errs, errors.New("delete flush interval must be positive"))
+	}
+
+	if _, err := schedule.Parse(c.RetentionCron, c.RetentionInterval); err != nil {
+		errs = append(errs, fmt.Errorf("invalid retention schedule: %w", err))
+	}
+
+	if c.RetentionWindow < 0 || c.RetentionJitter < 0 {
+		errs = append(errs, errors.New("retention window and jitter must not be negative"))
+	}
+
+	if c.ShortenRateLimit < 0 || c.RedirectRateLimit < 0 {
+		errs = append(errs, errors.New("rate limits must not be negative"))
+	}
+
+	if (c.ShortenRateLimit > 0 && c.ShortenBurst <= 0) ||
+		(c.RedirectRateLimit > 0 && c.RedirectBurst <= 0) {
+		errs = append(errs, errors.New("rate limit burst must be positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func defaultConfig() *Cfg {
+	return &Cfg{
 		FlagRunAddr: defaultRunAddr,
+		GRPCAddr:    defaultGRPCAddr,
 		FlagBaseURL: defaultBaseURL,
 		FileStorage: defaultFileStoragePath,
 		DatabaseDSN: "",
 		SecretKey:   secretKey,
-	}
 
-	flag.StringVar(&config.FlagRunAddr, "a", config.FlagRunAddr, "port to run server")
-	flag.StringVar(&config.FlagBaseURL, "b", config.FlagBaseURL, "base URL")
-	flag.StringVar(&config.FileStorage, "f", config.FileStorage, "file storage path")
-	flag.StringVar(&config.DatabaseDSN, "d", config.DatabaseDSN, "database DSN")
-	flag.StringVar(&config.SecretKey, "k", config.DatabaseDSN, "secret key")
+		ClickDropPolicy:    defaultClickDropPolicy,
+		ClickQueueSize:     defaultClickQueueSize,
+		ClickWorkers:       defaultClickWorkers,
+		ClickBatchSize:     defaultClickBatchSize,
+		ClickFlushInterval: defaultClickFlushInterval,
+		ShutdownTimeout:    defaultShutdownTimeout,
+		CacheSize:          defaultCacheSize,
+		CacheTTL:           defaultCacheTTL,
+
+		FileSync:            defaultFileSync,
+		FileSyncInterval:    defaultFileSyncInterval,
+		FileCompactInterval: defaultFileCompactInterval,
+
+		RefreshTokenTTL: defaultRefreshTokenTTL,
 
-	flag.Parse()
-	cfg := envCfg{}
+		ShortenRateLimit:  defaultShortenRateLimit,
+		ShortenBurst:      defaultShortenBurst,
+		RedirectRateLimit: defaultRedirectRateLimit,
+		RedirectBurst:     defaultRedirectBurst,
+
+		DeleteQueueSize:     defaultDeleteQueueSize,
+		DeleteBatchSize:     defaultDeleteBatchSize,
+		DeleteMaxRetries:    defaultDeleteMaxRetries,
+		DeleteFlushInterval: defaultDeleteFlushInterval,
+
+		RetentionInterval: defaultRetentionInterval,
+		RetentionWindow:   defaultRetentionWindow,
+		RetentionJitter:   defaultRetentionJitter,
+
+		CodeStrategy: shortcode.StrategyRandom,
+		CodeAlphabet: shortcode.DefaultAlphabet,
+		CodeLength:   shortcode.DefaultLength,
+	}
+}
+
+func registerFlags(fs *flag.FlagSet, config *Cfg, configFile *string) {
+	fs.StringVar(&config.FlagRunAddr, "a", config.FlagRunAddr, "port to run server")
+	fs.StringVar(&config.GRPCAddr, "g", config.GRPCAddr, "address to run gRPC server")
+	fs.StringVar(&config.FlagBaseURL, "b", config.FlagBaseURL, "base URL")
+	fs.StringVar(&config.FileStorage, "f", config.FileStorage, "file storage path")
+	fs.StringVar(&config.DatabaseDSN, "d", config.DatabaseDSN, "database DSN")
+	fs.StringVar(&config.RedisAddr, "r", config.RedisAddr, "redis address or URL")
+	fs.StringVar(&config.SecretKey, "k", config.SecretKey, "secret key")
+	fs.BoolVar(&config.EnableHTTPS, "s", config.EnableHTTPS, "enable HTTPS")
+	fs.StringVar(&config.TLSCertFile, "tls-cert", config.TLSCertFile, "TLS certificate file")
+	fs.StringVar(&config.TLSKeyFile, "tls-key", config.TLSKeyFile, "TLS key file")
+	fs.StringVar(&config.TrustedSubnet, "t", config.TrustedSubnet, "trusted subnet CIDR for internal endpoints")
+	fs.StringVar(&config.TrustedProxies, "trusted-proxies", config.TrustedProxies,
+		"comma separated CIDRs of proxies trusted to set X-Real-IP and X-Forwarded-For")
+	fs.StringVar(&config.ClickDropPolicy, "click-drop-policy", config.ClickDropPolicy, "click queue drop policy")
+	fs.IntVar(&config.ClickQueueSize, "click-queue-size", config.ClickQueueSize, "click queue size")
+	fs.IntVar(&config.ClickWorkers, "click-workers", config.ClickWorkers, "click queue workers")
+	fs.IntVar(&config.ClickBatchSize, "click-batch-size", config.ClickBatchSize, "click flush batch size")
+	fs.DurationVar(&config.ClickFlushInterval, "click-flush-interval", config.ClickFlushInterval, "click flush interval")
+	fs.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", config.ShutdownTimeout, "graceful shutdown timeout")
+	fs.IntVar(&config.CacheSize, "cache-size", config.CacheSize, "short URL cache size, 0 disables cache")
+	fs.DurationVar(&config.CacheTTL, "cache-ttl", config.CacheTTL, "short URL cache entry TTL")
+	fs.StringVar(&config.FileSync, "file-sync", config.FileSync, "file storage fsync policy: always, interval, never")
+	fs.DurationVar(&config.FileSyncInterval, "file-sync-interval", config.FileSyncInterval, "file storage fsync interval")
+	fs.DurationVar(&config.FileCompactInterval, "file-compact-interval", config.FileCompactInterval,
+		"file storage journal compaction interval, 0 compacts only on start")
+	fs.DurationVar(&config.RefreshTokenTTL, "refresh-token-ttl", config.RefreshTokenTTL, "account refresh token TTL")
+	fs.IntVar(&config.DeleteQueueSize, "delete-queue-size", config.DeleteQueueSize, "deletion queue size")
+	fs.IntVar(&config.DeleteBatchSize, "delete-batch-size", config.DeleteBatchSize, "deletion batch size in URLs")
+	fs.IntVar(&config.DeleteMaxRetries, "delete-max-retries", config.DeleteMaxRetries, "deletion batch retries")
+	fs.DurationVar(&config.DeleteFlushInterval, "delete-flush-interval", config.DeleteFlushInterval,
+		"deletion batch flush interval")
+	fs.DurationVar(&config.RetentionInterval, "retention-interval", config.RetentionInterval,
+		"storage purge interval")
+	fs.StringVar(&config.RetentionCron, "retention-cron", config.RetentionCron,
+		"storage purge cron expression, overrides interval")
+	fs.DurationVar(&config.RetentionWindow, "retention-window", config.RetentionWindow,
+		"how long soft-deleted URLs are kept before purge")
+	fs.DurationVar(&config.RetentionJitter, "retention-jitter", config.RetentionJitter,
+		"maximum random delay of storage purge")
+	fs.IntVar(&config.ShortenRateLimit, "rate-limit-shorten", config.ShortenRateLimit,
+		"short URL creation requests per minute per user or IP, 0 disables limit")
+	fs.IntVar(&config.ShortenBurst, "rate-limit-shorten-burst", config.ShortenBurst,
+		"short URL creation burst")
+	fs.IntVar(&config.RedirectRateLimit, "rate-limit-redirect", config.RedirectRateLimit,
+		"redirects per minute per user or IP, 0 disables limit")
+	fs.IntVar(&config.RedirectBurst, "rate-limit-redirect-burst", config.RedirectBurst,
+		"redirect burst")
+	fs.StringVar(&config.CodeStrategy, "code-strategy", config.CodeStrategy,
+		"short code strategy: random, sequence, snowflake, hash")
+	fs.StringVar(&config.CodeAlphabet, "code-alphabet", config.CodeAlphabet, "short code alphabet")
+	fs.IntVar(&config.CodeLength, "code-length", config.CodeLength, "short code length")
+	fs.StringVar(&config.CodeKey, "code-key", config.CodeKey, "hash strategy key, secret key by default")
+	fs.Int64Var(&config.CodeNodeID, "code-node-id", config.CodeNodeID, "snowflake strategy node id")
+	fs.StringVar(configFile, "c", *configFile, "JSON config file")
+	fs.StringVar(configFile, "config", *configFile, "JSON config file")
+}
 
-	if err := env.Parse(&cfg); err != nil {
-		log.Fatalf("can't parse")
+func applyFile(config *Cfg, fileName string) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %w", err)
 	}
 
-	if len(cfg.RunAddr) != 0 {
-		config.FlagRunAddr = cfg.RunAddr
+	var file fileCfg
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return fmt.Errorf("unable to parse config file %s: %w", fileName, err)
 	}
 
-	if len(cfg.BaseURL) != 0 {
-		config.FlagBaseURL = cfg.BaseURL
+	setValue(&config.FlagRunAddr, file.RunAddr)
+	setValue(&config.GRPCAddr, file.GRPCAddr)
+	setValue(&config.FlagBaseURL, file.BaseURL)
+	setValue(&config.FileStorage, file.FileStorage)
+	setValue(&config.DatabaseDSN, file.DatabaseDSN)
+	setValue(&config.RedisAddr, file.RedisAddr)
+	setValue(&config.SecretKey, file.SecretKey)
+	setValue(&config.TLSCertFile, file.TLSCertFile)
+	setValue(&config.TLSKeyFile, file.TLSKeyFile)
+	setValue(&config.TrustedSubnet, file.TrustedSubnet)
+	setValue(&config.TrustedProxies, file.TrustedProxies)
+	setValue(&config.ClickDropPolicy, file.ClickDropPolicy)
+	setValue(&config.FileSync, file.FileSync)
+	setValue(&config.CodeStrategy, file.CodeStrategy)
+	setValue(&config.CodeAlphabet, file.CodeAlphabet)
+	setValue(&config.CodeKey, file.CodeKey)
+	setValue(&config.RetentionCron, file.RetentionCron)
+	setValue(&config.CodeLength, file.CodeLength)
+	setValue(&config.CodeNodeID, file.CodeNodeID)
+	setValue(&config.ClickQueueSize, file.ClickQueueSize)
+	setValue(&config.ClickWorkers, file.ClickWorkers)
+	setValue(&config.ClickBatchSize, file.ClickBatchSize)
+	setValue(&config.CacheSize, file.CacheSize)
+	setValue(&config.DeleteQueueSize, file.DeleteQueueSize)
+	setValue(&config.DeleteBatchSize, file.DeleteBatchSize)
+	setValue(&config.DeleteMaxRetries, file.DeleteMaxRetries)
+	setValue(&config.ShortenRateLimit, file.ShortenRateLimit)
+	setValue(&config.ShortenBurst, file.ShortenBurst)
+	setValue(&config.RedirectRateLimit, file.RedirectRateLimit)
+	setValue(&config.RedirectBurst, file.RedirectBurst)
+	setValue(&config.EnableHTTPS, file.EnableHTTPS)
+	if file.ClickFlushInterval != nil {
+		config.ClickFlushInterval = time.Duration(*file.ClickFlushInterval)
 	}
+	if file.ShutdownTimeout != nil {
+		config.ShutdownTimeout = time.Duration(*file.ShutdownTimeout)
+	}
+	if file.CacheTTL != nil {
+		config.CacheTTL = time.Duration(*file.CacheTTL)
+	}
+	if file.FileSyncInterval != nil {
+		config.FileSyncInterval = time.Duration(*file.FileSyncInterval)
+	}
+	if file.FileCompactInterval != nil {
+		config.FileCompactInterval = time.Duration(*file.FileCompactInterval)
+	}
+	if file.RefreshTokenTTL != nil {
+		config.RefreshTokenTTL = time.Duration(*file.RefreshTokenTTL)
+	}
+	if file.DeleteFlushInterval != nil {
+		config.DeleteFlushInterval = time.Duration(*file.DeleteFlushInterval)
+	}
+	if file.RetentionInterval != nil {
+		config.RetentionInterval = time.Duration(*file.RetentionInterval)
+	}
+	if file.RetentionWindow != nil {
+		config.RetentionWindow = time.Duration(*file.RetentionWindow)
+	}
+	if file.RetentionJitter != nil {
+		config.RetentionJitter = time.Duration(*file.RetentionJitter)
+	}
+
+	return nil
+}
 
-	if len(cfg.FileStorage) != 0 {
-		config.FileStorage = cfg.FileStorage
+func applyEnv(config *Cfg, envs *envCfg) {
+	setValue(&config.FlagRunAddr, envs.RunAddr)
+	setValue(&config.GRPCAddr, envs.GRPCAddr)
+	setValue(&config.FlagBaseURL, envs.BaseURL)
+	setValue(&config.FileStorage, envs.FileStorage)
+	setValue(&config.DatabaseDSN, envs.DatabaseDSN)
+	setValue(&config.RedisAddr, envs.RedisAddr)
+	setValue(&config.SecretKey, envs.SecretKey)
+	setValue(&config.TLSCertFile, envs.TLSCertFile)
+	setValue(&config.TLSKeyFile, envs.TLSKeyFile)
+	setValue(&config.TrustedSubnet, envs.TrustedSubnet)
+	setValue(&config.TrustedProxies, envs.TrustedProxies)
+	setValue(&config.ClickDropPolicy, envs.ClickDropPolicy)
+	setValue(&config.ClickQueueSize, envs.ClickQueueSize)
+	setValue(&config.ClickWorkers, envs.ClickWorkers)
+	setValue(&config.ClickBatchSize, envs.ClickBatchSize)
+	setValue(&config.ClickFlushInterval, envs.ClickFlushInterval)
+	setValue(&config.ShutdownTimeout, envs.ShutdownTimeout)
+	setValue(&config.CacheSize, envs.CacheSize)
+	setValue(&config.CacheTTL, envs.CacheTTL)
+	setValue(&config.FileSync, envs.FileSync)
+	setValue(&config.CodeStrategy, envs.CodeStrategy)
+	setValue(&config.CodeAlphabet, envs.CodeAlphabet)
+	setValue(&config.CodeKey, envs.CodeKey)
+	setValue(&config.CodeLength, envs.CodeLength)
+	setValue(&config.CodeNodeID, envs.CodeNodeID)
+	setValue(&config.FileSyncInterval, envs.FileSyncInterval)
+	setValue(&config.FileCompactInterval, envs.FileCompactInterval)
+	setValue(&config.RefreshTokenTTL, envs.RefreshTokenTTL)
+	setValue(&config.DeleteQueueSize, envs.DeleteQueueSize)
+	setValue(&config.DeleteBatchSize, envs.DeleteBatchSize)
+	setValue(&config.DeleteMaxRetries, envs.DeleteMaxRetries)
+	setValue(&config.DeleteFlushInterval, envs.DeleteFlushInterval)
+	setValue(&config.RetentionInterval, envs.RetentionInterval)
+	setValue(&config.RetentionCron, envs.RetentionCron)
+	setValue(&config.RetentionWindow, envs.RetentionWindow)
+	setValue(&config.RetentionJitter, envs.RetentionJitter)
+	setValue(&config.ShortenRateLimit, envs.ShortenRateLimit)
+	setValue(&config.ShortenBurst, envs.ShortenBurst)
+	setValue(&config.RedirectRateLimit, envs.RedirectRateLimit)
+	setValue(&config.RedirectBurst, envs.RedirectBurst)
+	setValue(&config.EnableHTTPS, envs.EnableHTTPS)
+}
+
+// setValue записывает значение источника, если оно задано.
+func setValue[T any](target *T, value *T) {
+	if value != nil {
+		*target = *value
 	}
+}
 
-	if len(cfg.SecretKey) != 0 {
-		config.SecretKey = cfg.SecretKey
+// httpsBaseURL переводит базовый URL со схемы http на https.
+func httpsBaseURL(baseURL string) string {
+	if rest, ok := strings.CutPrefix(baseURL, "http://"); ok {
+		return "https://" + rest
 	}
 
-	return config
+	return baseURL
 }
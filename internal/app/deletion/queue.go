@@ -0,0 +1,500 @@
+// Package deletion асинхронное мягкое удаление ссылок пользователей.
+//
+// Запросы на удаление ставятся в очередь, единственный обработчик объединяет запросы разных
+// пользователей и передает их хранилищу одним пакетом.
+package deletion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/storages"
+)
+
+const flushTimeout = 30 * time.Second  // flushTimeout максимальное время удаления одного пакета
+const maxRetryDelay = 30 * time.Second // maxRetryDelay максимальная пауза между повторами удаления пакета
+
+var (
+	// ErrQueueClosed очередь закрыта и не принимает запросы.
+	ErrQueueClosed = errors.New("deletion queue is closed")
+	// ErrQueueFull очередь заполнена.
+	ErrQueueFull = errors.New("deletion queue is full")
+)
+
+// Scheduler интерфейс постановки ссылок пользователя в очередь на удаление.
+type Scheduler interface {
+	Enqueue(userID string, shortURLs []string) error
+	Pending(userID string) []Pending
+}
+
+// Storage хранилище, удаляющее ссылки нескольких пользователей одним пакетом.
+type Storage interface {
+	DeleteURLs(ctx context.Context, requests []storages.DeleteRequest) error
+}
+
+// Config параметры очереди удаления.
+//
+// Пакет передается хранилищу каждые FlushInterval или при накоплении BatchSize ссылок. При ошибке
+// пакет удаляется повторно до MaxRetries раз, пауза между повторами начинается с FlushInterval
+// и удваивается. Пока пакет ожидает повтора, обработчик продолжает принимать запросы, пока их
+// не наберется Size ссылок.
+type Config struct {
+	Size          int
+	BatchSize     int
+	MaxRetries    int
+	FlushInterval time.Duration
+}
+
+// Pending ссылка, ожидающая удаления.
+type Pending struct {
+	RequestedAt time.Time `json:"requested_at"`
+	ShortURL    string    `json:"short_url"`
+	Attempts    int       `json:"attempts"`
+	refs        int       // refs количество запросов в очереди, содержащих ссылку
+}
+
+// Stats метрики очереди удаления.
+type Stats struct {
+	Enqueued uint64 `json:"enqueued"`
+	Deleted  uint64 `json:"deleted"`
+	Retried  uint64 `json:"retried"`
+	Failed   uint64 `json:"failed"`
+	Pending  int    `json:"pending"`
+}
+
+// Queue очередь удаления ссылок с одним обработчиком, собирающим запросы в пакеты.
+type Queue struct {
+	storage   Storage
+	logger    *zap.SugaredLogger
+	requests  chan storages.DeleteRequest
+	pending   map[string]map[string]*Pending
+	done      chan struct{}
+	stop      chan struct{}
+	cfg       Config
+	mu        sync.RWMutex
+	pendingMu sync.Mutex
+	enqueued  atomic.Uint64
+	deleted   atomic.Uint64
+	retried   atomic.Uint64
+	failed    atomic.Uint64
+	closed    bool
+}
+
+// NewQueue инициализация очереди удаления и запуск обработчика.
+func NewQueue(storage Storage, cfg Config, logger *zap.SugaredLogger) *Queue {
+	if cfg.Size <= 0 {
+		cfg.Size = 1
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+
+	q := &Queue{
+		storage:  storage,
+		logger:   logger,
+		requests: make(chan storages.DeleteRequest, cfg.Size),
+		pending:  map[string]map[string]*Pending{},
+		done:     make(chan struct{}),
+		stop:     make(chan struct{}),
+		cfg:      cfg,
+	}
+
+	go q.worker()
+
+	return q
+}
+
+// Enqueue постановка ссылок пользователя в очередь на удаление
+//
+// Аргументы
+//   - userID: идентификатор пользователя
+//   - shortURLs[]: короткие ссылки
+//
+// Возвращает
+//   - error: ошибка выполнения, ErrQueueFull если очередь заполнена, ErrQueueClosed если очередь закрыта
+func (q *Queue) Enqueue(userID string, shortURLs []string) error {
+	if len(shortURLs) == 0 {
+		return nil
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	req := storages.DeleteRequest{UserID: userID, ShortURLs: slices.Clone(shortURLs)}
+
+	// Ссылки отмечаются ожидающими до отправки, иначе обработчик может удалить их раньше отметки
+	q.track(req, time.Now().UTC())
+
+	select {
+	case q.requests <- req:
+		q.enqueued.Add(uint64(len(req.ShortURLs)))
+		return nil
+	default:
+		q.untrack([]storages.DeleteRequest{req})
+		return ErrQueueFull
+	}
+}
+
+// Pending ссылки пользователя, ожидающие удаления, в порядке поступления запросов.
+func (q *Queue) Pending(userID string) []Pending {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	result := make([]Pending, 0, len(q.pending[userID]))
+	for _, p := range q.pending[userID] {
+		result = append(result, *p)
+	}
+	slices.SortFunc(result, func(a, b Pending) int {
+		if c := a.RequestedAt.Compare(b.RequestedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ShortURL, b.ShortURL)
+	})
+
+	return result
+}
+
+// Stats получение метрик очереди.
+func (q *Queue) Stats() Stats {
+	q.pendingMu.Lock()
+	pending := 0
+	for _, codes := range q.pending {
+		pending += len(codes)
+	}
+	q.pendingMu.Unlock()
+
+	return Stats{
+		Enqueued: q.enqueued.Load(),
+		Deleted:  q.deleted.Load(),
+		Retried:  q.retried.Load(),
+		Failed:   q.failed.Load(),
+		Pending:  pending,
+	}
+}
+
+// Close прекращает прием запросов и ожидает удаления оставшихся в очереди ссылок
+//
+// Если ctx отменен раньше, обработчик прерывает повторы и текущее удаление, а не удаленные ссылки
+// учитываются как Failed. Close возвращается только после остановки обработчика, поэтому после
+// него хранилище можно закрывать.
+//
+// Аргументы
+//   - ctx: контекст выполнения, ограничивает время ожидания обработчика
+//
+// Возвращает
+//   - error: ошибка выполнения
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrQueueClosed
+	}
+	q.closed = true
+	close(q.requests)
+	q.mu.Unlock()
+
+	var err error
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		// Хранилище завершает вызов по отмене контекста удаления, поэтому ожидание обработчика недолгое
+		close(q.stop)
+		<-q.done
+		err = fmt.Errorf("deletion queue drain interrupted: %w", ctx.Err())
+	}
+
+	stats := q.Stats()
+	q.logger.Infow("deletion queue stopped",
+		"enqueued", stats.Enqueued,
+		"deleted", stats.Deleted,
+		"retried", stats.Retried,
+		"failed", stats.Failed,
+	)
+
+	return err
+}
+
+// retryBatch пакет, ожидающий повторного удаления.
+type retryBatch struct {
+	timer    *time.Timer
+	requests []storages.DeleteRequest // requests исходные запросы пакета
+	merged   []storages.DeleteRequest // merged запросы, объединенные по пользователям
+	delay    time.Duration            // delay пауза перед следующим повтором
+	count    int
+	attempt  int
+}
+
+func (q *Queue) worker() {
+	defer close(q.done)
+
+	ticker := time.NewTicker(q.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []storages.DeleteRequest
+	var retry *retryBatch
+	size := 0
+	for {
+		requests := q.requests
+		var retryC <-chan time.Time
+		if retry != nil {
+			retryC = retry.timer.C
+			// Пока пакет ожидает повтора, запросы копятся до размера очереди, дальше очередь заполняется
+			if size >= q.cfg.Size {
+				requests = nil
+			}
+		}
+
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				q.finish(retry, batch)
+				return
+			}
+			batch = append(batch, req)
+			size += len(req.ShortURLs)
+			if retry == nil && size >= q.cfg.BatchSize {
+				retry = q.flush(batch)
+				batch, size = nil, 0
+			}
+		case <-ticker.C:
+			if retry == nil {
+				retry = q.flush(batch)
+				batch, size = nil, 0
+			}
+		case <-retryC:
+			retry = q.send(retry)
+			if retry == nil && size >= q.cfg.BatchSize {
+				retry = q.flush(batch)
+				batch, size = nil, 0
+			}
+		case <-q.stop:
+			q.abandon(retry, batch)
+			return
+		}
+	}
+}
+
+// finish удаление оставшихся пакетов после закрытия очереди до завершения повторов или прерывания Close.
+func (q *Queue) finish(retry *retryBatch, batch []storages.DeleteRequest) {
+	for {
+		if retry == nil {
+			if len(batch) == 0 {
+				return
+			}
+			retry, batch = q.flush(batch), nil
+			continue
+		}
+
+		select {
+		case <-retry.timer.C:
+			retry = q.send(retry)
+		case <-q.stop:
+			q.abandon(retry, batch)
+			return
+		}
+	}
+}
+
+// flush первая попытка удаления пакета.
+//
+// Возвращает
+//   - *retryBatch: пакет, ожидающий повтора, nil если пакет удален или повторы исчерпаны
+func (q *Queue) flush(batch []storages.DeleteRequest) *retryBatch {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	merged := merge(batch)
+	count := 0
+	for _, req := range merged {
+		count += len(req.ShortURLs)
+	}
+
+	return q.send(&retryBatch{requests: batch, merged: merged, delay: q.cfg.FlushInterval, count: count})
+}
+
+// send попытка удаления пакета, после удаления или исчерпания повторов ссылки пакета перестают
+// считаться ожидающими.
+//
+// Возвращает
+//   - *retryBatch: пакет с запущенным таймером повтора, nil если пакет удален или повторы исчерпаны
+func (q *Queue) send(b *retryBatch) *retryBatch {
+	if q.stopped() {
+		q.abandon(b, nil)
+		return nil
+	}
+	q.attempt(b.merged)
+
+	ctx, cancel := q.flushContext()
+	err := q.storage.DeleteURLs(ctx, b.merged)
+	cancel()
+
+	switch {
+	case err == nil:
+		q.deleted.Add(uint64(b.count))
+	case q.stopped():
+		q.failed.Add(uint64(b.count))
+		q.logger.Errorf("deletion of %d URLs interrupted by shutdown: %v", b.count, err)
+	case b.attempt >= q.cfg.MaxRetries:
+		q.failed.Add(uint64(b.count))
+		q.logger.Errorf("failed to delete %d URLs after %d attempts: %v", b.count, b.attempt+1, err)
+	default:
+		q.retried.Add(1)
+		q.logger.Warnf("failed to delete %d URLs, retry in %s: %v", b.count, b.delay, err)
+		b.timer = time.NewTimer(b.delay)
+		b.delay = min(b.delay*2, maxRetryDelay)
+		b.attempt++
+		return b
+	}
+
+	q.untrack(b.requests)
+	return nil
+}
+
+// abandon отказ от удаления пакета, ожидающего повтора, и не отправленных запросов при прерывании Close.
+func (q *Queue) abandon(retry *retryBatch, batch []storages.DeleteRequest) {
+	// Close закрывает канал до прерывания, поэтому оставшиеся в нем запросы дочитываются без ожидания
+	for req := range q.requests {
+		batch = append(batch, req)
+	}
+	if retry != nil {
+		if retry.timer != nil {
+			retry.timer.Stop()
+		}
+		batch = append(batch, retry.requests...)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	count := 0
+	for _, req := range merge(batch) {
+		count += len(req.ShortURLs)
+	}
+	q.failed.Add(uint64(count))
+	q.logger.Errorf("deletion of %d URLs abandoned on shutdown", count)
+	q.untrack(batch)
+}
+
+// flushContext контекст удаления пакета, отменяется по истечении flushTimeout или прерыванию Close.
+func (q *Queue) flushContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	go func() {
+		select {
+		case <-q.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// stopped проверка прерывания Close.
+func (q *Queue) stopped() bool {
+	select {
+	case <-q.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// track отметка ссылок запроса ожидающими удаления.
+func (q *Queue) track(req storages.DeleteRequest, now time.Time) {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	codes, ok := q.pending[req.UserID]
+	if !ok {
+		codes = map[string]*Pending{}
+		q.pending[req.UserID] = codes
+	}
+	for _, shortURL := range req.ShortURLs {
+		p, ok := codes[shortURL]
+		if !ok {
+			p = &Pending{ShortURL: shortURL, RequestedAt: now}
+			codes[shortURL] = p
+		}
+		p.refs++
+	}
+}
+
+// untrack снятие отметки ожидания с ссылок обработанных запросов.
+func (q *Queue) untrack(batch []storages.DeleteRequest) {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	for _, req := range batch {
+		codes := q.pending[req.UserID]
+		for _, shortURL := range req.ShortURLs {
+			if p, ok := codes[shortURL]; ok {
+				p.refs--
+				if p.refs <= 0 {
+					delete(codes, shortURL)
+				}
+			}
+		}
+		if len(codes) == 0 {
+			delete(q.pending, req.UserID)
+		}
+	}
+}
+
+// attempt учет попытки удаления ссылок пакета.
+func (q *Queue) attempt(batch []storages.DeleteRequest) {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	for _, req := range batch {
+		for _, shortURL := range req.ShortURLs {
+			if p, ok := q.pending[req.UserID][shortURL]; ok {
+				p.Attempts++
+			}
+		}
+	}
+}
+
+// merge объединение запросов одного пользователя без повторяющихся ссылок.
+func merge(batch []storages.DeleteRequest) []storages.DeleteRequest {
+	index := map[string]int{}
+	seen := map[string]map[string]struct{}{}
+	result := make([]storages.DeleteRequest, 0, len(batch))
+
+	for _, req := range batch {
+		i, ok := index[req.UserID]
+		if !ok {
+			i = len(result)
+			index[req.UserID] = i
+			seen[req.UserID] = map[string]struct{}{}
+			result = append(result, storages.DeleteRequest{UserID: req.UserID})
+		}
+		for _, shortURL := range req.ShortURLs {
+			if _, ok := seen[req.UserID][shortURL]; ok {
+				continue
+			}
+			seen[req.UserID][shortURL] = struct{}{}
+			result[i].ShortURLs = append(result[i].ShortURLs, shortURL)
+		}
+	}
+
+	return result
+}
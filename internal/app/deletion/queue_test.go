@@ -0,0 +1,208 @@
+package deletion
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/storages"
+)
+
+// fakeStorage хранилище, запоминающее пакеты удаления.
+type fakeStorage struct {
+	entered  chan struct{}
+	release  chan struct{}
+	batches  [][]storages.DeleteRequest
+	failures int // failures количество ошибок до успешного удаления, отрицательное - всегда ошибка
+	attempts int
+	mu       sync.Mutex
+	hang     bool // hang удаление ожидает отмены контекста
+}
+
+func (s *fakeStorage) DeleteURLs(ctx context.Context, requests []storages.DeleteRequest) error {
+	if s.entered != nil {
+		s.entered <- struct{}{}
+		<-s.release
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts++
+	if s.hang {
+		s.mu.Unlock()
+		<-ctx.Done()
+		s.mu.Lock()
+		return ctx.Err()
+	}
+
+	if s.failures != 0 {
+		s.failures--
+		return errors.New("storage is unavailable")
+	}
+	s.batches = append(s.batches, requests)
+
+	return nil
+}
+
+func (s *fakeStorage) attempted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.attempts
+}
+
+func (s *fakeStorage) calls() [][]storages.DeleteRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.batches
+}
+
+func TestQueue_Batching(t *testing.T) {
+	storage := &fakeStorage{}
+	queue := NewQueue(storage, Config{Size: 10, BatchSize: 4, FlushInterval: time.Hour}, zap.NewNop().Sugar())
+
+	require.NoError(t, queue.Enqueue("user1", []string{"a", "b"}))
+	require.NoError(t, queue.Enqueue("user2", []string{"c"}))
+	require.NoError(t, queue.Enqueue("user1", []string{"b", "d"}))
+
+	// запросы разных пользователей удаляются одним пакетом, запросы одного пользователя объединяются
+	assert.Eventually(t, func() bool { return len(storage.calls()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []storages.DeleteRequest{
+		{UserID: "user1", ShortURLs: []string{"a", "b", "d"}},
+		{UserID: "user2", ShortURLs: []string{"c"}},
+	}, storage.calls()[0])
+
+	require.NoError(t, queue.Enqueue("user2", []string{"e"}))
+	require.NoError(t, queue.Close(context.Background()))
+	assert.Len(t, storage.calls(), 2)
+	assert.Equal(t, Stats{Enqueued: 6, Deleted: 5}, queue.Stats())
+
+	assert.ErrorIs(t, queue.Close(context.Background()), ErrQueueClosed)
+	assert.ErrorIs(t, queue.Enqueue("user1", []string{"f"}), ErrQueueClosed)
+}
+
+func TestQueue_FlushInterval(t *testing.T) {
+	storage := &fakeStorage{}
+	queue := NewQueue(storage, Config{Size: 10, BatchSize: 100, FlushInterval: 5 * time.Millisecond},
+		zap.NewNop().Sugar())
+	defer func() { _ = queue.Close(context.Background()) }()
+
+	require.NoError(t, queue.Enqueue("user1", []string{"a"}))
+	assert.Eventually(t, func() bool { return len(storage.calls()) == 1 }, time.Second, time.Millisecond)
+	assert.Empty(t, queue.Pending("user1"))
+}
+
+func TestQueue_Retry(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Stats
+		failures int
+		batches  int
+	}{
+		{name: "Recovered", failures: 2, batches: 1, expected: Stats{Enqueued: 1, Deleted: 1, Retried: 2}},
+		{name: "Exhausted", failures: -1, batches: 0, expected: Stats{Enqueued: 1, Retried: 2, Failed: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &fakeStorage{failures: tt.failures}
+			queue := NewQueue(storage, Config{Size: 10, BatchSize: 1, MaxRetries: 2, FlushInterval: time.Millisecond},
+				zap.NewNop().Sugar())
+
+			require.NoError(t, queue.Enqueue("user1", []string{"a"}))
+			require.NoError(t, queue.Close(context.Background()))
+
+			assert.Len(t, storage.calls(), tt.batches)
+			assert.Equal(t, tt.expected, queue.Stats())
+			assert.Empty(t, queue.Pending("user1"))
+		})
+	}
+}
+
+func TestQueue_Pending(t *testing.T) {
+	storage := &fakeStorage{entered: make(chan struct{}, 1), release: make(chan struct{})}
+	queue := NewQueue(storage, Config{Size: 1, BatchSize: 1, FlushInterval: time.Hour}, zap.NewNop().Sugar())
+
+	require.NoError(t, queue.Enqueue("user1", []string{"b", "a"}))
+	<-storage.entered
+
+	require.NoError(t, queue.Enqueue("user1", []string{"c"}))
+	assert.ErrorIs(t, queue.Enqueue("user1", []string{"d"}), ErrQueueFull)
+	assert.NoError(t, queue.Enqueue("user1", nil))
+
+	pending := queue.Pending("user1")
+	require.Len(t, pending, 3)
+	assert.Equal(t, "a", pending[0].ShortURL)
+	assert.Equal(t, 1, pending[0].Attempts)
+	assert.Equal(t, "b", pending[1].ShortURL)
+	assert.Equal(t, "c", pending[2].ShortURL)
+	assert.Equal(t, 0, pending[2].Attempts)
+	assert.Empty(t, queue.Pending("user2"))
+	assert.Equal(t, 3, queue.Stats().Pending)
+
+	close(storage.release)
+	require.NoError(t, queue.Close(context.Background()))
+
+	assert.Empty(t, queue.Pending("user1"))
+	assert.Len(t, storage.calls(), 2)
+}
+
+func TestQueue_EnqueueDuringRetry(t *testing.T) {
+	storage := &fakeStorage{failures: 1}
+	queue := NewQueue(storage, Config{Size: 1, BatchSize: 1, MaxRetries: 1, FlushInterval: 200 * time.Millisecond},
+		zap.NewNop().Sugar())
+
+	require.NoError(t, queue.Enqueue("user1", []string{"a"}))
+	require.Eventually(t, func() bool { return storage.attempted() == 1 }, time.Second, time.Millisecond)
+
+	// пока пакет ожидает повтора, обработчик забирает запросы из очереди до ее размера
+	require.NoError(t, queue.Enqueue("user1", []string{"b"}))
+	enqueued := func() bool { return queue.Enqueue("user1", []string{"c"}) == nil }
+	require.Eventually(t, enqueued, time.Second, time.Millisecond)
+	assert.ErrorIs(t, queue.Enqueue("user1", []string{"d"}), ErrQueueFull)
+
+	require.NoError(t, queue.Close(context.Background()))
+	assert.Equal(t, Stats{Enqueued: 3, Deleted: 3, Retried: 1}, queue.Stats())
+	assert.Empty(t, queue.Pending("user1"))
+}
+
+func TestQueue_CloseInterruptsRetry(t *testing.T) {
+	tests := []struct {
+		storage *fakeStorage
+		name    string
+	}{
+		{name: "Waiting for retry", storage: &fakeStorage{failures: -1}},
+		{name: "Deleting", storage: &fakeStorage{hang: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := NewQueue(tt.storage, Config{Size: 10, BatchSize: 1, MaxRetries: 5, FlushInterval: time.Hour},
+				zap.NewNop().Sugar())
+
+			require.NoError(t, queue.Enqueue("user1", []string{"a"}))
+			require.Eventually(t, func() bool { return tt.storage.attempted() == 1 }, time.Second, time.Millisecond)
+			require.NoError(t, queue.Enqueue("user1", []string{"b"}))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			assert.ErrorIs(t, queue.Close(ctx), context.DeadlineExceeded)
+			assert.Less(t, time.Since(start), time.Second)
+
+			// после Close обработчик не обращается к хранилищу, не удаленные ссылки учтены
+			assert.Equal(t, 1, tt.storage.attempted())
+			assert.Equal(t, uint64(2), queue.Stats().Failed)
+			assert.Empty(t, queue.Pending("user1"))
+		})
+	}
+}
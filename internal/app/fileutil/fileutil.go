@@ -0,0 +1,72 @@
+// Package fileutil вспомогательные функции файловых хранилищ.
+package fileutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const perm600 = 0o600 // perm600 код доступа к файлу
+
+// WriteFileAtomic запись файла, устойчивая к сбою посреди записи
+//
+// Данные пишутся во временный файл в том же каталоге, сбрасываются на диск и переименовываются поверх
+// name, после чего на диск сбрасывается каталог. При сбое на диске остается либо прежний, либо новый файл.
+//
+// Аргументы
+//   - name: имя файла
+//   - write: запись содержимого файла
+//
+// Возвращает
+//   - error: ошибка выполнения
+func WriteFileAtomic(name string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("unable to create temp file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	writer := bufio.NewWriter(tmp)
+	if err := write(writer); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("unable to write temp file: %w", err)
+	}
+	if err := tmp.Chmod(perm600); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("unable to chmod temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("unable to sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to close temp file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("unable to replace %s: %w", name, err)
+	}
+
+	return SyncDir(filepath.Dir(name))
+}
+
+// SyncDir сброс на диск каталога, чтобы переименование файла пережило сбой узла.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("unable to open directory: %w", err)
+	}
+	defer func() { _ = d.Close() }()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("unable to sync directory: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package fileutil
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "data.jsonl")
+	require.NoError(t, os.WriteFile(name, []byte("old\n"), 0o644))
+
+	err := WriteFileAtomic(name, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new\n")
+		return err
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "new\n", string(data))
+
+	info, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(perm600), info.Mode().Perm())
+
+	// при ошибке записи прежний файл остается, временный файл удаляется
+	failure := errors.New("write failed")
+	err = WriteFileAtomic(name, func(w io.Writer) error {
+		_, _ = io.WriteString(w, "partial")
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	data, err = os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "new\n", string(data))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestSyncDir(t *testing.T) {
+	assert.NoError(t, SyncDir(t.TempDir()))
+	assert.Error(t, SyncDir(filepath.Join(t.TempDir(), "missing")))
+}
@@ -0,0 +1,212 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/Erlast/short-url.git/internal/app/accounts"
+	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/helpers"
+	"github.com/Erlast/short-url.git/internal/app/middlewares"
+	pb "github.com/Erlast/short-url.git/internal/app/proto"
+)
+
+// TokenHeader ключ метаданных с jwt токеном пользователя.
+const TokenHeader = "token"
+
+// APIKeyHeader ключ метаданных с API ключом.
+const APIKeyHeader = "x-api-key"
+
+// protectedMethods методы, требующие переданного клиентом токена, аналог CheckAuthMiddleware.
+var protectedMethods = map[string]bool{
+	pb.Shortener_GetUserURLs_FullMethodName:    true,
+	pb.Shortener_DeleteUserURLs_FullMethodName: true,
+}
+
+// anonymousMethods методы, для которых клиенту без токена выдается новый анонимный пользователь,
+// остальные незащищенные методы выполняются без пользователя.
+var anonymousMethods = map[string]bool{
+	pb.Shortener_Shorten_FullMethodName:      true,
+	pb.Shortener_ShortenBatch_FullMethodName: true,
+}
+
+// APIKeyInterceptor перехватчик аутентификации по API ключу, аналог APIKeyMiddleware.
+//
+// Ключ передается в метаданных x-api-key или authorization в формате "Bearer <ключ>". Запрос без ключа
+// передается дальше без изменений, запрос с неизвестным или отозванным ключом отклоняется.
+func APIKeyInterceptor(users accounts.Store, logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		secret := apiKeyFromMetadata(ctx)
+		if secret == "" {
+			return handler(ctx, req)
+		}
+
+		key, err := accounts.ResolveAPIKey(ctx, users, secret)
+		if err != nil {
+			if errors.Is(err, accounts.ErrInvalidAPIKey) {
+				return nil, status.Error(codes.Unauthenticated, "access denied")
+			}
+			logger.Errorf("failed to resolve api key: %v", err)
+			return nil, status.Error(codes.Internal, "failed to resolve api key")
+		}
+
+		ctx = context.WithValue(ctx, helpers.UserID, key.UserID)
+		ctx = context.WithValue(ctx, helpers.APIKeyID, key.ID)
+
+		return handler(ctx, req)
+	}
+}
+
+// AuthInterceptor перехватчик авторизации по jwt токену из метаданных запроса.
+//
+// Токен передается в метаданных token или authorization (с префиксом Bearer или без него).
+// Если токена нет, для методов создания ссылок создается новый пользователь, токен возвращается
+// в заголовке token и должен передаваться в следующих вызовах. Запросы, аутентифицированные
+// API ключом, передаются дальше без токенов.
+func AuthInterceptor(conf *config.Cfg, logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		if _, ok := ctx.Value(helpers.APIKeyID).(string); ok {
+			return handler(ctx, req)
+		}
+
+		token := tokenFromMetadata(ctx)
+
+		if token == "" {
+			if protectedMethods[info.FullMethod] {
+				return nil, status.Error(codes.Unauthenticated, "access denied")
+			}
+			if !anonymousMethods[info.FullMethod] {
+				return handler(ctx, req)
+			}
+
+			newToken, err := middlewares.BuildJWTString(conf)
+			if err != nil {
+				logger.Errorln("Failed to build token", err)
+				return nil, status.Error(codes.Internal, "failed to build token")
+			}
+
+			if err := grpc.SetHeader(ctx, metadata.Pairs(TokenHeader, newToken)); err != nil {
+				logger.Errorln("Failed to set token header", err)
+				return nil, status.Error(codes.Internal, "failed to set token")
+			}
+
+			token = newToken
+		}
+
+		userID := middlewares.GetUserID(token, logger, conf)
+		if userID == "" {
+			return nil, status.Error(codes.Unauthenticated, "access denied")
+		}
+
+		return handler(context.WithValue(ctx, helpers.UserID, userID), req)
+	}
+}
+
+// RateLimitInterceptor перехватчик ограничения частоты запросов, аналог RateLimitMiddleware.
+//
+// Создание ссылок и получение оригинальной ссылки ограничиваются теми же лимитами, что и в HTTP API.
+// При превышении лимита возвращается ResourceExhausted с временем ожидания в секундах в заголовке
+// retry-after. Подключается после AuthInterceptor.
+func RateLimitInterceptor(limiters middlewares.RateLimiters, conf *config.Cfg) grpc.UnaryServerInterceptor {
+	methods := map[string]*middlewares.RateLimiter{
+		pb.Shortener_Shorten_FullMethodName:      limiters.Shorten,
+		pb.Shortener_ShortenBatch_FullMethodName: limiters.Shorten,
+		pb.Shortener_Resolve_FullMethodName:      limiters.Redirect,
+	}
+
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		limiter := methods[info.FullMethod]
+		if limiter == nil {
+			return handler(ctx, req)
+		}
+
+		userID, _ := ctx.Value(helpers.UserID).(string)
+		_, byAPIKey := ctx.Value(helpers.APIKeyID).(string)
+		key := middlewares.RateLimitKey(userID, byAPIKey, tokenFromMetadata(ctx), peerIP(ctx), conf)
+
+		if allowed, retryAfter := limiter.Allow(key); !allowed {
+			seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", seconds))
+			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// tokenFromMetadata получение jwt токена из входящих метаданных.
+func tokenFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if values := md.Get(TokenHeader); len(values) > 0 && values[0] != "" {
+		return values[0]
+	}
+
+	if values := md.Get("authorization"); len(values) > 0 && middlewares.APIKeyFromBearer(values[0]) == "" {
+		return strings.TrimPrefix(values[0], "Bearer ")
+	}
+
+	return ""
+}
+
+// apiKeyFromMetadata получение API ключа из входящих метаданных.
+func apiKeyFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if values := md.Get(APIKeyHeader); len(values) > 0 && values[0] != "" {
+		return values[0]
+	}
+
+	if values := md.Get("authorization"); len(values) > 0 {
+		return middlewares.APIKeyFromBearer(values[0])
+	}
+
+	return ""
+}
+
+// peerIP IP адрес клиента из адреса соединения.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
@@ -0,0 +1,300 @@
+// Package grpcserver gRPC API сервиса сокращения ссылок, повторяет HTTP эндпоинты.
+package grpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Erlast/short-url.git/internal/app/accounts"
+	"github.com/Erlast/short-url.git/internal/app/analytics"
+	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/deletion"
+	"github.com/Erlast/short-url.git/internal/app/helpers"
+	"github.com/Erlast/short-url.git/internal/app/middlewares"
+	pb "github.com/Erlast/short-url.git/internal/app/proto"
+	"github.com/Erlast/short-url.git/internal/app/storages"
+)
+
+// Pinger интерфейс для проверки состояния хранилища Postgres.
+type Pinger interface {
+	CheckPing(ctx context.Context) error
+}
+
+// ShortenerServer реализация gRPC сервиса Shortener поверх хранилища ссылок.
+//
+// Переходы и удаления проходят через те же очереди, что и в HTTP API.
+type ShortenerServer struct {
+	pb.UnimplementedShortenerServer
+	storage   storages.URLStorage
+	clicks    analytics.Recorder
+	deletions deletion.Scheduler
+	conf      *config.Cfg
+	logger    *zap.SugaredLogger
+}
+
+// NewShortenerServer создание реализации gRPC сервиса.
+func NewShortenerServer(
+	storage storages.URLStorage,
+	clicks analytics.Recorder,
+	deletions deletion.Scheduler,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+) *ShortenerServer {
+	return &ShortenerServer{storage: storage, clicks: clicks, deletions: deletions, conf: conf, logger: logger}
+}
+
+// NewServer создание gRPC сервера с авторизацией по API ключу или jwt токену и ограничением частоты запросов
+//
+// Аргументы
+//   - storage: хранилище ссылок
+//   - clicks: очередь переходов по ссылкам
+//   - users: хранилище учетных записей и API ключей
+//   - deletions: очередь удаления ссылок
+//   - limiters: ограничения частоты запросов, общие с HTTP API
+//   - conf: конфигурация приложения
+//   - logger: логгер
+//   - tlsConfig: настройки TLS, nil - сервер без шифрования
+//
+// Возвращает
+//   - *grpc.Server: сервер с зарегистрированным сервисом Shortener
+func NewServer(
+	storage storages.URLStorage,
+	clicks analytics.Recorder,
+	users accounts.Store,
+	deletions deletion.Scheduler,
+	limiters middlewares.RateLimiters,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+	tlsConfig *tls.Config,
+) *grpc.Server {
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(
+		APIKeyInterceptor(users, logger),
+		AuthInterceptor(conf, logger),
+		RateLimitInterceptor(limiters, conf),
+	)}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	server := grpc.NewServer(opts...)
+	pb.RegisterShortenerServer(server, NewShortenerServer(storage, clicks, deletions, conf, logger))
+
+	return server
+}
+
+// Shorten создание короткой ссылки, при конфликте возвращается существующая ссылка с признаком conflict.
+func (s *ShortenerServer) Shorten(ctx context.Context, req *pb.ShortenRequest) (*pb.ShortenResponse, error) {
+	if req.GetUrl() == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty url")
+	}
+
+	var expiresAt *time.Time
+	if req.GetExpiresAt() != nil {
+		value := req.GetExpiresAt().AsTime()
+		expiresAt = &value
+	}
+
+	expiresAt, err := helpers.ResolveExpiry(expiresAt, req.GetTtlSeconds(), time.Now())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid expiry")
+	}
+
+	opts := storages.SaveOptions{Alias: req.GetAlias(), ExpiresAt: expiresAt}
+
+	var shortURL string
+	if opts == (storages.SaveOptions{}) {
+		shortURL, err = s.storage.SaveURL(ctx, req.GetUrl())
+	} else {
+		shortURL, err = s.storage.SaveURLWithOptions(ctx, req.GetUrl(), opts)
+	}
+
+	conflict := false
+	if err != nil {
+		var conflictErr *helpers.ConflictError
+		switch {
+		case errors.As(err, &conflictErr):
+			shortURL = conflictErr.ShortURL
+			conflict = true
+		case errors.Is(err, helpers.ErrAliasInvalid):
+			return nil, status.Error(codes.InvalidArgument, "invalid alias")
+		case errors.Is(err, helpers.ErrAliasExists):
+			return nil, status.Error(codes.AlreadyExists, "alias already exists")
+		default:
+			s.logger.Errorf("can't generate url: %v", err)
+			return nil, status.Error(codes.Internal, "failed to save URL")
+		}
+	}
+
+	result, err := url.JoinPath(s.conf.FlagBaseURL, "/", shortURL)
+	if err != nil {
+		s.logger.Errorf("can't join path %v", err)
+		return nil, status.Error(codes.Internal, "failed to build short URL")
+	}
+
+	return &pb.ShortenResponse{Result: result, Conflict: conflict}, nil
+}
+
+// ShortenBatch массовое сохранение списка ссылок.
+func (s *ShortenerServer) ShortenBatch(
+	ctx context.Context,
+	req *pb.ShortenBatchRequest,
+) (*pb.ShortenBatchResponse, error) {
+	if len(req.GetItems()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty batch")
+	}
+
+	incoming := make([]storages.Incoming, 0, len(req.GetItems()))
+	for _, item := range req.GetItems() {
+		in := storages.Incoming{
+			CorrelationID: item.GetCorrelationId(),
+			OriginalURL:   item.GetOriginalUrl(),
+			TTLSeconds:    item.GetTtlSeconds(),
+			Alias:         item.GetAlias(),
+		}
+		if item.GetExpiresAt() != nil {
+			value := item.GetExpiresAt().AsTime()
+			in.ExpiresAt = &value
+		}
+		incoming = append(incoming, in)
+	}
+
+	result, err := s.storage.LoadURLs(ctx, incoming, s.conf.FlagBaseURL)
+	if err != nil {
+		var conflictErr *helpers.ConflictError
+		if errors.As(err, &conflictErr) {
+			return nil, status.Error(codes.AlreadyExists, "url already exists")
+		}
+
+		if errors.Is(err, helpers.ErrExpiryInvalid) {
+			return nil, status.Error(codes.InvalidArgument, "invalid expiry")
+		}
+
+		if errors.Is(err, helpers.ErrAliasInvalid) {
+			return nil, status.Error(codes.InvalidArgument, "invalid alias")
+		}
+
+		if errors.Is(err, helpers.ErrAliasExists) {
+			return nil, status.Error(codes.AlreadyExists, "alias already exists")
+		}
+
+		s.logger.Errorf("failed to save batch: %v", err)
+		return nil, status.Error(codes.Internal, "failed to save URLs")
+	}
+
+	resp := &pb.ShortenBatchResponse{Items: make([]*pb.BatchResult, 0, len(result))}
+	for _, item := range result {
+		resp.Items = append(resp.Items, &pb.BatchResult{CorrelationId: item.CorrelationID, ShortUrl: item.ShortURL})
+	}
+
+	return resp, nil
+}
+
+// Resolve получение оригинальной ссылки, удаленные и истекшие ссылки возвращают FailedPrecondition.
+//
+// Успешное получение учитывается в статистике переходов по ссылке так же, как редирект в HTTP API.
+func (s *ShortenerServer) Resolve(ctx context.Context, req *pb.ResolveRequest) (*pb.ResolveResponse, error) {
+	originalURL, err := s.storage.GetByID(ctx, req.GetId())
+	if err != nil {
+		var isDeletedErr *helpers.ConflictError
+		if errors.As(err, &isDeletedErr) || errors.Is(err, helpers.ErrExpired) {
+			return nil, status.Error(codes.FailedPrecondition, "url is gone")
+		}
+
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+
+	s.clicks.Record(newClick(ctx, req.GetId(), s.conf.SecretKey))
+
+	return &pb.ResolveResponse{OriginalUrl: originalURL}, nil
+}
+
+// GetUserURLs получение списка ссылок пользователя.
+func (s *ShortenerServer) GetUserURLs(
+	ctx context.Context,
+	_ *pb.GetUserURLsRequest,
+) (*pb.GetUserURLsResponse, error) {
+	result, err := s.storage.GetUserURLs(ctx, s.conf.FlagBaseURL)
+	if err != nil {
+		s.logger.Errorf("failed to get user URLs: %v", err)
+		return nil, status.Error(codes.Internal, "failed to get user URLs")
+	}
+
+	resp := &pb.GetUserURLsResponse{Urls: make([]*pb.UserURL, 0, len(result))}
+	for _, item := range result {
+		resp.Urls = append(resp.Urls, &pb.UserURL{ShortUrl: item.ShortURL, OriginalUrl: item.OriginalURL})
+	}
+
+	return resp, nil
+}
+
+// DeleteUserURLs постановка ссылок пользователя в очередь на мягкое удаление.
+//
+// Ссылки удаляются асинхронно, как и в HTTP API. Если очередь заполнена, возвращается ResourceExhausted
+// с временем ожидания в заголовке retry-after.
+func (s *ShortenerServer) DeleteUserURLs(
+	ctx context.Context,
+	req *pb.DeleteUserURLsRequest,
+) (*pb.DeleteUserURLsResponse, error) {
+	if len(req.GetIds()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty ids")
+	}
+
+	userID, _ := ctx.Value(helpers.UserID).(string)
+	err := s.deletions.Enqueue(userID, req.GetIds())
+
+	if errors.Is(err, deletion.ErrQueueFull) {
+		_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", "1"))
+		return nil, status.Error(codes.ResourceExhausted, "deletion queue is full")
+	}
+	if err != nil {
+		s.logger.Errorf("failed to enqueue URLs for deletion: %v", err)
+		return nil, status.Error(codes.Internal, "failed to delete URLs")
+	}
+
+	return &pb.DeleteUserURLsResponse{}, nil
+}
+
+// Ping проверка подключения к хранилищу.
+func (s *ShortenerServer) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	pinger, ok := s.storage.(Pinger)
+	if !ok {
+		return nil, status.Error(codes.Unavailable, "storage doesn't support ping")
+	}
+
+	if err := pinger.CheckPing(ctx); err != nil {
+		s.logger.Errorf("failed to ping DB: %v", err)
+		return nil, status.Error(codes.Unavailable, "storage is unavailable")
+	}
+
+	return &pb.PingResponse{}, nil
+}
+
+// newClick переход по короткой ссылке из метаданных вызова, аналог analytics.NewClick.
+func newClick(ctx context.Context, shortURL string, secret string) analytics.Click {
+	click := analytics.Click{
+		Timestamp: time.Now().UTC(),
+		ShortURL:  shortURL,
+		IPHash:    analytics.HashIP(peerIP(ctx), secret),
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("referer"); len(values) > 0 {
+			click.Referrer = values[0]
+		}
+		if values := md.Get("user-agent"); len(values) > 0 {
+			click.UserAgent = values[0]
+		}
+	}
+
+	return click
+}
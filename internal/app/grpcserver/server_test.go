@@ -0,0 +1,304 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Erlast/short-url.git/internal/app/accounts"
+	"github.com/Erlast/short-url.git/internal/app/analytics"
+	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/deletion"
+	"github.com/Erlast/short-url.git/internal/app/middlewares"
+	pb "github.com/Erlast/short-url.git/internal/app/proto"
+	"github.com/Erlast/short-url.git/internal/app/storages"
+)
+
+type clickRecorder struct {
+	clicks []analytics.Click
+	mu     sync.Mutex
+}
+
+func (r *clickRecorder) Record(click analytics.Click) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clicks = append(r.clicks, click)
+}
+
+func (r *clickRecorder) recorded() []analytics.Click {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.clicks)
+}
+
+func newTestClient(t *testing.T) pb.ShortenerClient {
+	t.Helper()
+
+	conf := &config.Cfg{FlagBaseURL: "http://localhost:8080", SecretKey: "secret"}
+	return newConfiguredClient(t, conf, accounts.NewMemoryStore(), &clickRecorder{})
+}
+
+func newConfiguredClient(
+	t *testing.T,
+	conf *config.Cfg,
+	users accounts.Store,
+	clicks analytics.Recorder,
+) pb.ShortenerClient {
+	t.Helper()
+
+	logger := zap.NewNop().Sugar()
+	store, err := storages.NewMemoryStorage(context.Background())
+	require.NoError(t, err)
+	deletions := deletion.NewQueue(store, deletion.Config{FlushInterval: 10 * time.Millisecond}, logger)
+	t.Cleanup(func() { _ = deletions.Close(context.Background()) })
+
+	server := NewServer(store, clicks, users, deletions, middlewares.NewRateLimiters(conf), conf, logger, nil)
+
+	listener := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return pb.NewShortenerClient(conn)
+}
+
+func TestShortenAndResolve(t *testing.T) {
+	clicks := &clickRecorder{}
+	conf := &config.Cfg{FlagBaseURL: "http://localhost:8080", SecretKey: "secret"}
+	client := newConfiguredClient(t, conf, accounts.NewMemoryStore(), clicks)
+	ctx := context.Background()
+
+	var header metadata.MD
+	resp, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://example.com"}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.False(t, resp.GetConflict())
+	assert.Contains(t, resp.GetResult(), "http://localhost:8080/")
+	assert.NotEmpty(t, header.Get(TokenHeader))
+
+	// переход без токена не создает нового пользователя
+	id := resp.GetResult()[len("http://localhost:8080/"):]
+	header = nil
+	referred := metadata.AppendToOutgoingContext(ctx, "referer", "https://referrer.com")
+	resolved, err := client.Resolve(referred, &pb.ResolveRequest{Id: id}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", resolved.GetOriginalUrl())
+	assert.Empty(t, header.Get(TokenHeader))
+
+	// переход учитывается в статистике, как редирект в HTTP API
+	recorded := clicks.recorded()
+	require.Len(t, recorded, 1)
+	assert.Equal(t, id, recorded[0].ShortURL)
+	assert.Equal(t, "https://referrer.com", recorded[0].Referrer)
+	assert.Contains(t, recorded[0].UserAgent, "grpc-go")
+	assert.Equal(t, analytics.HashIP("bufconn", "secret"), recorded[0].IPHash)
+
+	_, err = client.Resolve(ctx, &pb.ResolveRequest{Id: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Len(t, clicks.recorded(), 1)
+}
+
+func TestShortenErrors(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		req  *pb.ShortenRequest
+		name string
+		code codes.Code
+	}{
+		{name: "Empty url", req: &pb.ShortenRequest{}, code: codes.InvalidArgument},
+		{name: "Invalid alias", req: &pb.ShortenRequest{Url: "https://a.com", Alias: "a!"}, code: codes.InvalidArgument},
+		{
+			name: "Expiry in the past",
+			req: &pb.ShortenRequest{
+				Url:       "https://b.com",
+				ExpiresAt: timestamppb.New(time.Now().Add(-time.Hour)),
+			},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Shorten(ctx, tt.req)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+
+	_, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://c.com", Alias: "my-link"})
+	require.NoError(t, err)
+
+	_, err = client.Shorten(ctx, &pb.ShortenRequest{Url: "https://d.com", Alias: "my-link"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestShortenBatch(t *testing.T) {
+	client := newTestClient(t)
+
+	resp, err := client.ShortenBatch(context.Background(), &pb.ShortenBatchRequest{Items: []*pb.BatchItem{
+		{CorrelationId: "1", OriginalUrl: "https://one.com"},
+		{CorrelationId: "2", OriginalUrl: "https://two.com"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, resp.GetItems(), 2)
+	assert.Equal(t, "1", resp.GetItems()[0].GetCorrelationId())
+	assert.Contains(t, resp.GetItems()[0].GetShortUrl(), "http://localhost:8080/")
+
+	_, err = client.ShortenBatch(context.Background(), &pb.ShortenBatchRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	resp, err = client.ShortenBatch(context.Background(), &pb.ShortenBatchRequest{Items: []*pb.BatchItem{
+		{CorrelationId: "3", OriginalUrl: "https://three.com", Alias: "batch-alias"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/batch-alias", resp.GetItems()[0].GetShortUrl())
+
+	_, err = client.ShortenBatch(context.Background(), &pb.ShortenBatchRequest{Items: []*pb.BatchItem{
+		{CorrelationId: "4", OriginalUrl: "https://four.com", Alias: "batch-alias"},
+	}})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = client.ShortenBatch(context.Background(), &pb.ShortenBatchRequest{Items: []*pb.BatchItem{
+		{CorrelationId: "5", OriginalUrl: "https://five.com", Alias: "a!"},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestAPIKey(t *testing.T) {
+	users := accounts.NewMemoryStore()
+	conf := &config.Cfg{FlagBaseURL: "http://localhost:8080", SecretKey: "secret"}
+	client := newConfiguredClient(t, conf, users, &clickRecorder{})
+
+	user, err := accounts.Register(context.Background(), users, "key-owner", "password123", "")
+	require.NoError(t, err)
+	secret, _, err := accounts.CreateAPIKey(context.Background(), users, user.ID, "ci")
+	require.NoError(t, err)
+
+	for i, ctx := range []context.Context{
+		metadata.AppendToOutgoingContext(context.Background(), APIKeyHeader, secret),
+		metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+secret),
+	} {
+		var header metadata.MD
+		_, err = client.Shorten(ctx, &pb.ShortenRequest{Url: "https://key.com"}, grpc.Header(&header))
+		require.NoError(t, err)
+		assert.Empty(t, header.Get(TokenHeader))
+
+		list, err := client.GetUserURLs(ctx, &pb.GetUserURLsRequest{})
+		require.NoError(t, err)
+		assert.Len(t, list.GetUrls(), i+1)
+	}
+
+	revoked := metadata.AppendToOutgoingContext(context.Background(), APIKeyHeader, "sk_unknown")
+	_, err = client.Shorten(revoked, &pb.ShortenRequest{Url: "https://key.com"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestRateLimit(t *testing.T) {
+	conf := &config.Cfg{
+		FlagBaseURL:       "http://localhost:8080",
+		SecretKey:         "secret",
+		ShortenRateLimit:  1,
+		ShortenBurst:      1,
+		RedirectRateLimit: 1,
+		RedirectBurst:     1,
+	}
+	client := newConfiguredClient(t, conf, accounts.NewMemoryStore(), &clickRecorder{})
+
+	resp, err := client.Shorten(context.Background(), &pb.ShortenRequest{Url: "https://limited.com"})
+	require.NoError(t, err)
+
+	var header metadata.MD
+	_, err = client.ShortenBatch(context.Background(), &pb.ShortenBatchRequest{Items: []*pb.BatchItem{
+		{CorrelationId: "1", OriginalUrl: "https://other.com"},
+	}}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.NotEmpty(t, header.Get("retry-after"))
+
+	// переходы ограничиваются отдельно от создания ссылок
+	id := resp.GetResult()[len("http://localhost:8080/"):]
+	_, err = client.Resolve(context.Background(), &pb.ResolveRequest{Id: id})
+	require.NoError(t, err)
+	_, err = client.Resolve(context.Background(), &pb.ResolveRequest{Id: id})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestUserURLs(t *testing.T) {
+	client := newTestClient(t)
+
+	_, err := client.GetUserURLs(context.Background(), &pb.GetUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	var header metadata.MD
+	created, err := client.Shorten(context.Background(), &pb.ShortenRequest{Url: "https://user.com"}, grpc.Header(&header))
+	require.NoError(t, err)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), TokenHeader, header.Get(TokenHeader)[0])
+
+	list, err := client.GetUserURLs(ctx, &pb.GetUserURLsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetUrls(), 1)
+	assert.Equal(t, created.GetResult(), list.GetUrls()[0].GetShortUrl())
+	assert.Equal(t, "https://user.com", list.GetUrls()[0].GetOriginalUrl())
+
+	id := created.GetResult()[len("http://localhost:8080/"):]
+	// ссылки удаляются асинхронно через очередь удаления
+	_, err = client.DeleteUserURLs(ctx, &pb.DeleteUserURLsRequest{Ids: []string{id}})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		_, err = client.Resolve(ctx, &pb.ResolveRequest{Id: id})
+		return status.Code(err) == codes.FailedPrecondition
+	}, time.Second, 10*time.Millisecond)
+
+	bearer := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer invalid")
+	_, err = client.GetUserURLs(bearer, &pb.GetUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestPing(t *testing.T) {
+	client := newTestClient(t)
+
+	_, err := client.Ping(context.Background(), &pb.PingRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+type fullScheduler struct{}
+
+func (fullScheduler) Enqueue(string, []string) error { return deletion.ErrQueueFull }
+
+func (fullScheduler) Pending(string) []deletion.Pending { return nil }
+
+func TestDeleteUserURLsQueueFull(t *testing.T) {
+	store, err := storages.NewMemoryStorage(context.Background())
+	require.NoError(t, err)
+	conf := &config.Cfg{FlagBaseURL: "http://localhost:8080", SecretKey: "secret"}
+	server := NewShortenerServer(store, &clickRecorder{}, fullScheduler{}, conf, zap.NewNop().Sugar())
+
+	_, err = server.DeleteUserURLs(context.Background(), &pb.DeleteUserURLsRequest{Ids: []string{"abc123"}})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/accounts"
+	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/helpers"
+	"github.com/Erlast/short-url.git/internal/app/middlewares"
+)
+
+const refreshCookie = "refresh_token" // refreshCookie имя cookie с refresh токеном
+const refreshPath = "/api/auth"       // refreshPath путь, для которого браузер передает cookie с refresh токеном
+
+// credentialsRequest тело запроса регистрации и входа.
+type credentialsRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// refreshRequest тело запроса обновления и отзыва refresh токена.
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// authResponse ответ с токенами учетной записи.
+type authResponse struct {
+	UserID       string `json:"user_id"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// apiKeyRequest тело запроса создания API ключа.
+type apiKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// apiKeyResponse API ключ в ответе, сам ключ возвращается только при создании.
+type apiKeyResponse struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	Key        string     `json:"key,omitempty"`
+}
+
+// Register запрос на регистрацию учетной записи.
+//
+// Если запрос содержит токен анонимного пользователя, в том числе истекший, учетная запись получает
+// его идентификатор вместе с сохраненными им ссылками.
+func Register(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	store accounts.Store,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+) {
+	var bodyReq credentialsRequest
+	if err := json.NewDecoder(req.Body).Decode(&bodyReq); err != nil {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	var anonymousID string
+	if token, err := req.Cookie("token"); err == nil {
+		anonymousID = middlewares.GetAnonymousUserID(token.Value, conf)
+	} else if token := req.Header.Get("Authorization"); token != "" {
+		anonymousID = middlewares.GetAnonymousUserID(token, conf)
+	}
+
+	user, err := accounts.Register(req.Context(), store, bodyReq.Login, bodyReq.Password, anonymousID)
+	if err != nil {
+		switch {
+		case errors.Is(err, accounts.ErrInvalidLogin), errors.Is(err, accounts.ErrInvalidPassword):
+			http.Error(res, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, accounts.ErrLoginTaken), errors.Is(err, accounts.ErrUserExists):
+			http.Error(res, "Login is already taken", http.StatusConflict)
+		default:
+			logger.Errorf("failed to register user: %v", err)
+			http.Error(res, "", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeAuthResponse(req.Context(), res, store, conf, logger, user.ID, http.StatusCreated)
+}
+
+// Login запрос на вход в учетную запись по логину и паролю.
+func Login(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	store accounts.Store,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+) {
+	var bodyReq credentialsRequest
+	if err := json.NewDecoder(req.Body).Decode(&bodyReq); err != nil {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, err := accounts.Authenticate(req.Context(), store, bodyReq.Login, bodyReq.Password)
+	if err != nil {
+		if errors.Is(err, accounts.ErrInvalidCredentials) {
+			http.Error(res, "Invalid login or password", http.StatusUnauthorized)
+			return
+		}
+		logger.Errorf("failed to authenticate user: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeAuthResponse(req.Context(), res, store, conf, logger, user.ID, http.StatusOK)
+}
+
+// RefreshToken запрос на обмен refresh токена на новую пару токенов.
+//
+// Refresh токен передается в теле запроса или в cookie refresh_token.
+func RefreshToken(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	store accounts.Store,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+) {
+	token := refreshTokenFromRequest(req)
+	if token == "" {
+		http.Error(res, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	userID, next, err := accounts.RotateRefreshToken(req.Context(), store, token, conf.RefreshTokenTTL)
+	if err != nil {
+		if errors.Is(err, accounts.ErrInvalidRefreshToken) {
+			http.Error(res, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		logger.Errorf("failed to refresh token: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokens(res, conf, logger, authResponse{UserID: userID, RefreshToken: next}, http.StatusOK)
+}
+
+// Logout запрос на отзыв refresh токена и удаление cookie с токенами.
+func Logout(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	store accounts.Store,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+) {
+	if token := refreshTokenFromRequest(req); token != "" {
+		if err := accounts.RevokeRefreshToken(req.Context(), store, token); err != nil {
+			logger.Errorf("failed to revoke refresh token: %v", err)
+			http.Error(res, "", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.SetCookie(res, &http.Cookie{
+		Name: "token", Path: "/", MaxAge: -1, HttpOnly: true, Secure: conf.EnableHTTPS,
+	})
+	http.SetCookie(res, &http.Cookie{
+		Name: refreshCookie, Path: refreshPath, MaxAge: -1, HttpOnly: true, Secure: conf.EnableHTTPS,
+	})
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// writeAuthResponse выдача токенов учетной записи после регистрации или входа.
+func writeAuthResponse(
+	ctx context.Context,
+	res http.ResponseWriter,
+	store accounts.Store,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+	userID string,
+	status int,
+) {
+	refresh, err := accounts.IssueRefreshToken(ctx, store, userID, conf.RefreshTokenTTL)
+	if err != nil {
+		logger.Errorf("failed to issue refresh token: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokens(res, conf, logger, authResponse{UserID: userID, RefreshToken: refresh}, status)
+}
+
+// writeTokens подпись access токена, запись токенов в cookie, заголовок Authorization и тело ответа.
+func writeTokens(
+	res http.ResponseWriter,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+	tokens authResponse,
+	status int,
+) {
+	access, err := middlewares.BuildAccountJWTString(conf, tokens.UserID)
+	if err != nil {
+		logger.Errorf("failed to build token: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+	tokens.AccessToken = access
+
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		logger.Errorf(marshalErrorTmp, err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Authorization", access)
+	http.SetCookie(res, &http.Cookie{
+		Name: "token", Value: access, Path: "/", HttpOnly: true, Secure: conf.EnableHTTPS,
+	})
+	http.SetCookie(res, &http.Cookie{
+		Name:     refreshCookie,
+		Value:    tokens.RefreshToken,
+		Path:     refreshPath,
+		MaxAge:   int(conf.RefreshTokenTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   conf.EnableHTTPS,
+	})
+	setHeader(res, "application/json")
+
+	res.WriteHeader(status)
+	if _, err := res.Write(data); err != nil {
+		logger.Errorf("failed to write data: %v", err)
+	}
+}
+
+// refreshTokenFromRequest refresh токен из тела запроса или из cookie.
+func refreshTokenFromRequest(req *http.Request) string {
+	var bodyReq refreshRequest
+	if req.Body != http.NoBody && json.NewDecoder(req.Body).Decode(&bodyReq) == nil && bodyReq.RefreshToken != "" {
+		return bodyReq.RefreshToken
+	}
+
+	if cookie, err := req.Cookie(refreshCookie); err == nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+// CreateAPIKey запрос на создание API ключа учетной записи.
+//
+// Ключ возвращается в ответе один раз, хранится только его хэш.
+func CreateAPIKey(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	store accounts.Store,
+	logger *zap.SugaredLogger,
+) {
+	var bodyReq apiKeyRequest
+	if err := json.NewDecoder(req.Body).Decode(&bodyReq); err != nil {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := req.Context().Value(helpers.UserID).(string)
+	secret, key, err := accounts.CreateAPIKey(req.Context(), store, userID, bodyReq.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, accounts.ErrInvalidAPIKeyName):
+			http.Error(res, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, accounts.ErrUserNotFound):
+			http.Error(res, "API keys are available for registered users only", http.StatusForbidden)
+		default:
+			logger.Errorf("failed to create api key: %v", err)
+			http.Error(res, "", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	result := newAPIKeyResponse(*key)
+	result.Key = secret
+	writeJSON(res, logger, result, http.StatusCreated)
+}
+
+// ListAPIKeys запрос на получение API ключей пользователя.
+func ListAPIKeys(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	store accounts.Store,
+	logger *zap.SugaredLogger,
+) {
+	userID, _ := req.Context().Value(helpers.UserID).(string)
+	keys, err := store.ListAPIKeys(req.Context(), userID)
+	if err != nil {
+		logger.Errorf("failed to list api keys: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	if len(keys) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	result := make([]apiKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, newAPIKeyResponse(key))
+	}
+	writeJSON(res, logger, result, http.StatusOK)
+}
+
+// RevokeAPIKey запрос на отзыв API ключа пользователя.
+func RevokeAPIKey(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	store accounts.Store,
+	logger *zap.SugaredLogger,
+) {
+	userID, _ := req.Context().Value(helpers.UserID).(string)
+	if err := store.DeleteAPIKey(req.Context(), userID, chi.URLParam(req, "id")); err != nil {
+		if errors.Is(err, accounts.ErrAPIKeyNotFound) {
+			http.Error(res, "API key not found", http.StatusNotFound)
+			return
+		}
+		logger.Errorf("failed to revoke api key: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// newAPIKeyResponse API ключ для ответа без хэша.
+func newAPIKeyResponse(key accounts.APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Hint:       key.Hint,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
+
+// writeJSON запись ответа в формате JSON.
+func writeJSON(res http.ResponseWriter, logger *zap.SugaredLogger, result any, status int) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf(marshalErrorTmp, err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	setHeader(res, "application/json")
+	res.WriteHeader(status)
+	if _, err := res.Write(data); err != nil {
+		logger.Errorf("failed to write data: %v", err)
+	}
+}
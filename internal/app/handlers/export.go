@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/analytics"
+	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/storages"
+)
+
+const exportPageSize = 500 // exportPageSize количество ссылок, читаемых из хранилища за один запрос
+
+const exportWriteErrorTmp = "unable to write export: %w" // exportWriteErrorTmp шаблон ошибки записи выгрузки
+
+// Форматы выгрузки ссылок.
+const (
+	exportFormatCSV   = "csv"
+	exportFormatJSONL = "jsonl"
+	exportFormatJSON  = "json"
+)
+
+// exportColumns колонки CSV выгрузки.
+var exportColumns = []string{
+	"short_url", "original_url", "created_at", "expires_at", "is_deleted", "deleted_at", "clicks",
+}
+
+// ExportedURL ссылка пользователя в выгрузке.
+type ExportedURL struct {
+	// CreatedAt - момент создания, не известен для ссылок, созданных до его появления в хранилище
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Clicks - количество переходов, отсутствует если статистика переходов недоступна
+	Clicks      *int64 `json:"clicks,omitempty"`
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	IsDeleted   bool   `json:"is_deleted"`
+}
+
+// exportWriter запись выгрузки в одном из форматов.
+type exportWriter interface {
+	Write(link *ExportedURL) error
+	// Close запись окончания выгрузки
+	Close() error
+}
+
+// ExportUserURLs запрос на выгрузку всех ссылок пользователя в CSV, JSON Lines или JSON.
+//
+// Ссылки, включая удаленные и истекшие, читаются из хранилища постранично по курсору и передаются
+// клиенту по мере чтения. Если чтение прервалось после начала ответа, соединение разрывается,
+// чтобы клиент не принял неполную выгрузку за полную.
+func ExportUserURLs(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	storage storages.URLStorage,
+	clicks analytics.Store,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatJSON
+	}
+
+	contentType, ok := map[string]string{
+		exportFormatCSV:   "text/csv; charset=utf-8",
+		exportFormatJSONL: "application/x-ndjson",
+		exportFormatJSON:  "application/json",
+	}[format]
+	if !ok {
+		http.Error(res, "export format must be csv, jsonl or json", http.StatusBadRequest)
+		return
+	}
+
+	// Первая страница читается до начала ответа, чтобы ошибка хранилища вернулась статусом
+	page, cursor, err := storage.GetUserURLsPage(req.Context(), "", exportPageSize)
+	if err != nil {
+		logger.Errorf("failed to export user urls: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	setHeader(res, contentType)
+	res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="urls.%s"`, format))
+	res.WriteHeader(http.StatusOK)
+
+	writer, err := newExportWriter(res, format)
+	if err != nil {
+		abortExport(err, logger)
+	}
+
+	for {
+		if err := writeExportPage(req.Context(), writer, page, clicks, conf.FlagBaseURL, logger); err != nil {
+			abortExport(err, logger)
+		}
+		if cursor == "" {
+			break
+		}
+
+		page, cursor, err = storage.GetUserURLsPage(req.Context(), cursor, exportPageSize)
+		if err != nil {
+			abortExport(fmt.Errorf("failed to read user urls: %w", err), logger)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		abortExport(err, logger)
+	}
+}
+
+// abortExport разрыв соединения после начала ответа, клиент получает ошибку чтения вместо конца выгрузки.
+func abortExport(err error, logger *zap.SugaredLogger) {
+	logger.Errorf("export aborted: %v", err)
+	panic(http.ErrAbortHandler)
+}
+
+// writeExportPage запись страницы ссылок с количеством переходов по ним.
+func writeExportPage(
+	ctx context.Context,
+	writer exportWriter,
+	page []storages.ShortenURL,
+	clicks analytics.Store,
+	baseURL string,
+	logger *zap.SugaredLogger,
+) error {
+	var counts map[string]int64
+	if clicks != nil && len(page) > 0 {
+		shorts := make([]string, 0, len(page))
+		for i := range page {
+			shorts = append(shorts, page[i].ShortURL)
+		}
+
+		var err error
+		// Статистика переходов не обязательна, ссылки страницы выгружаются и без нее
+		if counts, err = clicks.CountClicks(ctx, shorts); err != nil {
+			logger.Warnf("failed to count clicks for export: %v", err)
+			counts = nil
+		}
+	}
+
+	for i := range page {
+		shortURL, err := url.JoinPath(baseURL, "/", page[i].ShortURL)
+		if err != nil {
+			return fmt.Errorf("unable to create path: %w", err)
+		}
+
+		link := ExportedURL{
+			CreatedAt:   page[i].CreatedAt,
+			ExpiresAt:   page[i].ExpiresAt,
+			DeletedAt:   page[i].DeletedAt,
+			ShortURL:    shortURL,
+			OriginalURL: page[i].OriginalURL,
+			IsDeleted:   page[i].IsDeleted,
+		}
+		if counts != nil {
+			count := counts[page[i].ShortURL]
+			link.Clicks = &count
+		}
+
+		if err := writer.Write(&link); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newExportWriter создание записи выгрузки и запись ее начала.
+func newExportWriter(w io.Writer, format string) (exportWriter, error) {
+	switch format {
+	case exportFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(exportColumns); err != nil {
+			return nil, fmt.Errorf(exportWriteErrorTmp, err)
+		}
+		return &csvExportWriter{writer: writer}, nil
+	case exportFormatJSONL:
+		return &jsonlExportWriter{enc: json.NewEncoder(w)}, nil
+	default:
+		if _, err := io.WriteString(w, "["); err != nil {
+			return nil, fmt.Errorf(exportWriteErrorTmp, err)
+		}
+		return &jsonExportWriter{w: w, enc: json.NewEncoder(w)}, nil
+	}
+}
+
+// csvExportWriter выгрузка в CSV со строкой заголовка, моменты в формате RFC 3339.
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+// Write запись строки CSV.
+func (e *csvExportWriter) Write(link *ExportedURL) error {
+	clicks := ""
+	if link.Clicks != nil {
+		clicks = strconv.FormatInt(*link.Clicks, 10)
+	}
+
+	err := e.writer.Write([]string{
+		link.ShortURL,
+		link.OriginalURL,
+		exportTime(link.CreatedAt),
+		exportTime(link.ExpiresAt),
+		strconv.FormatBool(link.IsDeleted),
+		exportTime(link.DeletedAt),
+		clicks,
+	})
+	if err != nil {
+		return fmt.Errorf(exportWriteErrorTmp, err)
+	}
+
+	return nil
+}
+
+// Close запись буферизованных строк CSV.
+func (e *csvExportWriter) Close() error {
+	e.writer.Flush()
+	if err := e.writer.Error(); err != nil {
+		return fmt.Errorf(exportWriteErrorTmp, err)
+	}
+
+	return nil
+}
+
+// jsonlExportWriter выгрузка в JSON Lines.
+type jsonlExportWriter struct {
+	enc *json.Encoder
+}
+
+// Write запись строки JSON Lines.
+func (e *jsonlExportWriter) Write(link *ExportedURL) error {
+	if err := e.enc.Encode(link); err != nil {
+		return fmt.Errorf(exportWriteErrorTmp, err)
+	}
+
+	return nil
+}
+
+// Close окончание выгрузки, JSON Lines не требует завершения.
+func (e *jsonlExportWriter) Close() error {
+	return nil
+}
+
+// jsonExportWriter выгрузка в виде JSON массива.
+type jsonExportWriter struct {
+	w     io.Writer
+	enc   *json.Encoder
+	count int
+}
+
+// Write запись элемента массива.
+func (e *jsonExportWriter) Write(link *ExportedURL) error {
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return fmt.Errorf(exportWriteErrorTmp, err)
+		}
+	}
+	e.count++
+
+	if err := e.enc.Encode(link); err != nil {
+		return fmt.Errorf(exportWriteErrorTmp, err)
+	}
+
+	return nil
+}
+
+// Close запись окончания массива.
+func (e *jsonExportWriter) Close() error {
+	if _, err := io.WriteString(e.w, "]"); err != nil {
+		return fmt.Errorf(exportWriteErrorTmp, err)
+	}
+
+	return nil
+}
+
+// exportTime момент в формате RFC 3339, пустая строка если момент не задан.
+func exportTime(at *time.Time) string {
+	if at == nil {
+		return ""
+	}
+	return at.UTC().Format(time.RFC3339)
+}
@@ -8,12 +8,15 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 
+	"github.com/Erlast/short-url.git/internal/app/analytics"
 	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/deletion"
 	"github.com/Erlast/short-url.git/internal/app/helpers"
 	"github.com/Erlast/short-url.git/internal/app/storages"
 )
@@ -23,8 +26,14 @@ const readBodyErrorTmp = "failed to read the request body: %v" // readBodyErrorT
 
 // BodyRequested тело запроса на формирования короткой ссылки.
 type BodyRequested struct {
+	// ExpiresAt - момент истечения срока действия ссылки
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 	// URL - url
 	URL string `json:"url"`
+	// Alias - пользовательский алиас короткой ссылки
+	Alias string `json:"alias,omitempty"`
+	// TTLSeconds - время жизни ссылки в секундах
+	TTLSeconds int64 `json:"ttl_seconds,omitempty"`
 }
 
 // BodyResponse тело ответа с короткой сслыкой.
@@ -43,8 +52,15 @@ func GetProbe(_ context.Context, res http.ResponseWriter) {
 	res.WriteHeader(http.StatusOK)
 }
 
-// GetHandler запрос получения оригинальной ссылки по сокращенному URL.
-func GetHandler(_ context.Context, res http.ResponseWriter, req *http.Request, storage storages.URLStorage) {
+// GetHandler запрос получения оригинальной ссылки по сокращенному URL, успешные переходы ставятся в очередь статистики.
+func GetHandler(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	storage storages.URLStorage,
+	clicks analytics.Recorder,
+	conf *config.Cfg,
+) {
 	id := chi.URLParam(req, "id")
 
 	// Получаем оригинальную ссылку из хранилища
@@ -52,7 +68,7 @@ func GetHandler(_ context.Context, res http.ResponseWriter, req *http.Request, s
 
 	if err != nil {
 		var isDeletedErr *helpers.ConflictError
-		if errors.As(err, &isDeletedErr) {
+		if errors.As(err, &isDeletedErr) || errors.Is(err, helpers.ErrExpired) {
 			res.WriteHeader(http.StatusGone)
 			return
 		}
@@ -60,6 +76,8 @@ func GetHandler(_ context.Context, res http.ResponseWriter, req *http.Request, s
 		return
 	}
 
+	clicks.Record(analytics.NewClick(req, id, conf.SecretKey))
+
 	http.Redirect(res, req, originalURL, http.StatusTemporaryRedirect)
 }
 
@@ -87,7 +105,7 @@ func PostHandler(
 
 	setHeader(res, "text/plain")
 
-	rndURL, err := generateURLAndSave(req.Context(), storage, string(u))
+	rndURL, err := generateURLAndSave(req.Context(), storage, string(u), storages.SaveOptions{})
 
 	if errors.Is(err, helpers.ErrConflict) {
 		res.WriteHeader(http.StatusConflict)
@@ -165,9 +183,31 @@ func PostShortenHandler(
 		return
 	}
 
+	expiresAt, err := helpers.ResolveExpiry(bodyReq.ExpiresAt, bodyReq.TTLSeconds, time.Now())
+
+	if err != nil {
+		http.Error(res, "Invalid expiry", http.StatusUnprocessableEntity)
+		return
+	}
+
 	setHeader(res, "application/json")
 
-	rndURL, err := generateURLAndSave(req.Context(), storage, bodyReq.URL)
+	rndURL, err := generateURLAndSave(
+		req.Context(),
+		storage,
+		bodyReq.URL,
+		storages.SaveOptions{Alias: bodyReq.Alias, ExpiresAt: expiresAt},
+	)
+
+	if errors.Is(err, helpers.ErrAliasInvalid) {
+		http.Error(res, "Invalid alias", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if errors.Is(err, helpers.ErrAliasExists) {
+		http.Error(res, "Alias already exists", http.StatusConflict)
+		return
+	}
 
 	if errors.Is(err, helpers.ErrConflict) {
 		res.WriteHeader(http.StatusConflict)
@@ -302,6 +342,11 @@ func BatchShortenHandler(
 			return
 		}
 
+		if errors.Is(err, helpers.ErrExpiryInvalid) {
+			http.Error(res, "Invalid expiry", http.StatusUnprocessableEntity)
+			return
+		}
+
 		logger.Errorf("failed to save body: %v", err)
 		http.Error(res, "", http.StatusInternalServerError)
 		return
@@ -364,12 +409,199 @@ func GetUserUrls(
 	}
 }
 
+// GetURLStats запрос на получение статистики переходов по короткой ссылке пользователя.
+func GetURLStats(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	storage storages.URLStorage,
+	clicks analytics.Store,
+	logger *zap.SugaredLogger,
+) {
+	id := chi.URLParam(req, "id")
+
+	// статистика доступна владельцу и пользователям, которым выдан доступ к ссылке
+	if _, err := storage.URLAccess(req.Context(), id); err != nil {
+		writeAccessError(res, err, logger)
+		return
+	}
+
+	stats, err := clicks.GetStats(req.Context(), id)
+
+	if err != nil {
+		logger.Errorf("failed to get stats: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		logger.Errorf(marshalErrorTmp, err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	setHeader(res, "application/json")
+
+	res.WriteHeader(http.StatusOK)
+	_, err = res.Write(data)
+	if err != nil {
+		logger.Errorf("failed to write data: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+}
+
+// shareRequest тело запроса на выдачу доступа или передачу владения ссылкой.
+type shareRequest struct {
+	UserID string          `json:"user_id"`
+	Access storages.Access `json:"access"`
+}
+
+// GetURLShares запрос на получение списка пользователей, которым выдан доступ к ссылке.
+func GetURLShares(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	storage storages.URLStorage,
+	logger *zap.SugaredLogger,
+) {
+	shares, err := storage.GetURLShares(req.Context(), chi.URLParam(req, "id"))
+
+	if err != nil {
+		writeAccessError(res, err, logger)
+		return
+	}
+
+	if len(shares) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	data, err := json.Marshal(shares)
+	if err != nil {
+		logger.Errorf(marshalErrorTmp, err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	setHeader(res, "application/json")
+
+	res.WriteHeader(http.StatusOK)
+	_, err = res.Write(data)
+	if err != nil {
+		logger.Errorf("failed to write data: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+}
+
+// ShareURL запрос на выдачу пользователю доступа read или manage к ссылке.
+func ShareURL(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	storage storages.URLStorage,
+	logger *zap.SugaredLogger,
+) {
+	bodyReq, ok := decodeShareRequest(res, req)
+	if !ok {
+		return
+	}
+
+	err := storage.ShareURL(req.Context(), chi.URLParam(req, "id"), bodyReq.UserID, bodyReq.Access)
+
+	if err != nil {
+		writeAccessError(res, err, logger)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeURLShare запрос на отзыв доступа пользователя к ссылке.
+func RevokeURLShare(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	storage storages.URLStorage,
+	logger *zap.SugaredLogger,
+) {
+	err := storage.RevokeURLShare(req.Context(), chi.URLParam(req, "id"), chi.URLParam(req, "userID"))
+
+	if err != nil {
+		writeAccessError(res, err, logger)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// TransferURL запрос на передачу владения ссылкой другому пользователю, доступен только владельцу ссылки.
+func TransferURL(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	storage storages.URLStorage,
+	logger *zap.SugaredLogger,
+) {
+	bodyReq, ok := decodeShareRequest(res, req)
+	if !ok {
+		return
+	}
+
+	err := storage.TransferURL(req.Context(), chi.URLParam(req, "id"), bodyReq.UserID)
+
+	if err != nil {
+		writeAccessError(res, err, logger)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// GetInternalStats запрос на получение количества сокращенных URL и пользователей сервиса.
+func GetInternalStats(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	storage storages.URLStorage,
+	logger *zap.SugaredLogger,
+) {
+	stats, err := storage.GetStats(req.Context())
+
+	if err != nil {
+		logger.Errorf("failed to get stats: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		logger.Errorf(marshalErrorTmp, err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	setHeader(res, "application/json")
+
+	res.WriteHeader(http.StatusOK)
+	_, err = res.Write(data)
+	if err != nil {
+		logger.Errorf("failed to write data: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+}
+
 // DeleteUserUrls запрос на мягкое удаление ссылок пользователя.
+//
+// Ссылки ставятся в очередь удаления, запрос завершается до их удаления из хранилища.
 func DeleteUserUrls(
 	_ context.Context,
 	res http.ResponseWriter,
 	req *http.Request,
-	storage storages.URLStorage,
+	deletions deletion.Scheduler,
 	logger *zap.SugaredLogger,
 ) {
 	if req.Body == http.NoBody {
@@ -387,10 +619,16 @@ func DeleteUserUrls(
 		return
 	}
 
-	err = storage.DeleteUserURLs(req.Context(), bodyReq, logger)
+	userID, _ := req.Context().Value(helpers.UserID).(string)
+	err = deletions.Enqueue(userID, bodyReq)
 
+	if errors.Is(err, deletion.ErrQueueFull) {
+		res.Header().Set("Retry-After", "1")
+		http.Error(res, "Deletion queue is full", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
-		logger.Errorf("failed to get delete URLs: %v", err)
+		logger.Errorf("failed to enqueue URLs for deletion: %v", err)
 		http.Error(res, "", http.StatusInternalServerError)
 		return
 	}
@@ -398,6 +636,156 @@ func DeleteUserUrls(
 	res.WriteHeader(http.StatusAccepted)
 }
 
+// GetPendingDeletions запрос на получение ссылок пользователя, ожидающих удаления.
+func GetPendingDeletions(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	deletions deletion.Scheduler,
+	logger *zap.SugaredLogger,
+) {
+	userID, _ := req.Context().Value(helpers.UserID).(string)
+	pending := deletions.Pending(userID)
+
+	if len(pending) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		logger.Errorf(marshalErrorTmp, err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	setHeader(res, "application/json")
+	res.WriteHeader(http.StatusOK)
+	if _, err := res.Write(data); err != nil {
+		logger.Errorf("failed to write data: %v", err)
+	}
+}
+
+// restoreConflictResponse тело ответа на восстановление ссылки, конфликтующей с действующей ссылкой.
+type restoreConflictResponse struct {
+	// ShortURL - восстанавливаемая ссылка
+	ShortURL string `json:"short_url"`
+	// Existing - действующая ссылка, мешающая восстановлению
+	Existing string `json:"existing_short_url"`
+	// Conflict - поле конфликта: original - оригинальный URL уже сокращен, short - короткая ссылка занята
+	Conflict string `json:"conflict"`
+}
+
+// GetDeletedUserURLs запрос на получение корзины пользователя - мягко удаленных ссылок с моментом удаления.
+func GetDeletedUserURLs(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	storage storages.URLStorage,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+) {
+	result, err := storage.GetDeletedURLs(req.Context(), conf.FlagBaseURL)
+
+	if err != nil {
+		logger.Errorf("failed to get deleted URLs: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	if len(result) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSON(res, logger, result, http.StatusOK)
+}
+
+// RestoreUserURLs запрос на восстановление мягко удаленных ссылок пользователя.
+//
+// Ссылки восстанавливаются все вместе или ни одна. Если ссылка конфликтует с действующей ссылкой,
+// возвращается 409 с описанием конфликта.
+func RestoreUserURLs(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	storage storages.URLStorage,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+) {
+	if req.Body == http.NoBody {
+		http.Error(res, "Empty Body!", http.StatusBadRequest)
+		return
+	}
+
+	var bodyReq []string
+
+	if err := json.NewDecoder(req.Body).Decode(&bodyReq); err != nil || len(bodyReq) == 0 {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err := storage.RestoreURLs(req.Context(), bodyReq)
+
+	var restoreErr *helpers.RestoreConflictError
+	switch {
+	case err == nil:
+		res.WriteHeader(http.StatusNoContent)
+	case errors.As(err, &restoreErr):
+		shortURL, joinErr := url.JoinPath(conf.FlagBaseURL, "/", restoreErr.ShortURL)
+		existing, existingErr := url.JoinPath(conf.FlagBaseURL, "/", restoreErr.Existing)
+		if joinErr != nil || existingErr != nil {
+			logger.Errorf("unable to create path: %v", errors.Join(joinErr, existingErr))
+			http.Error(res, "", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(res, logger, restoreConflictResponse{
+			ShortURL: shortURL,
+			Existing: existing,
+			Conflict: restoreErr.Field,
+		}, http.StatusConflict)
+	case errors.Is(err, helpers.ErrRestoreConflict):
+		http.Error(res, "Short URL conflicts with an active one", http.StatusConflict)
+	case errors.Is(err, helpers.ErrNotFound):
+		http.Error(res, "Not found", http.StatusNotFound)
+	default:
+		logger.Errorf("failed to restore URLs: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+	}
+}
+
+// decodeShareRequest чтение тела запроса на выдачу доступа, при ошибке ответ уже записан.
+func decodeShareRequest(res http.ResponseWriter, req *http.Request) (shareRequest, bool) {
+	var bodyReq shareRequest
+
+	if req.Body == http.NoBody {
+		http.Error(res, "Empty Body!", http.StatusBadRequest)
+		return bodyReq, false
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&bodyReq); err != nil || bodyReq.UserID == "" {
+		http.Error(res, "Invalid request", http.StatusBadRequest)
+		return bodyReq, false
+	}
+
+	return bodyReq, true
+}
+
+// writeAccessError ответ на ошибку проверки доступа к ссылке.
+func writeAccessError(res http.ResponseWriter, err error, logger *zap.SugaredLogger) {
+	switch {
+	case errors.Is(err, helpers.ErrNotFound):
+		http.Error(res, "Not found", http.StatusNotFound)
+	case errors.Is(err, helpers.ErrForbidden):
+		http.Error(res, "Forbidden", http.StatusForbidden)
+	case errors.Is(err, helpers.ErrShareInvalid):
+		http.Error(res, "Invalid share", http.StatusBadRequest)
+	default:
+		logger.Errorf("failed to access short URL: %v", err)
+		http.Error(res, "", http.StatusInternalServerError)
+	}
+}
+
 func setHeader(res http.ResponseWriter, value string) {
 	res.Header().Set("Content-Type", value)
 }
@@ -406,8 +794,15 @@ func generateURLAndSave(
 	ctx context.Context,
 	storage storages.URLStorage,
 	originalURL string,
+	opts storages.SaveOptions,
 ) (string, error) {
-	rndString, err := storage.SaveURL(ctx, originalURL)
+	var rndString string
+	var err error
+	if opts == (storages.SaveOptions{}) {
+		rndString, err = storage.SaveURL(ctx, originalURL)
+	} else {
+		rndString, err = storage.SaveURLWithOptions(ctx, originalURL, opts)
+	}
 
 	if err != nil {
 		var conflictErr *helpers.ConflictError
@@ -416,6 +811,11 @@ func generateURLAndSave(
 			return rndString, helpers.ErrConflict
 		}
 
+		var aliasErr *helpers.AliasError
+		if errors.As(err, &aliasErr) {
+			return "", aliasErr
+		}
+
 		return "", errors.New("failed to save URL")
 	}
 	return rndString, nil
@@ -3,26 +3,74 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Erlast/short-url.git/internal/app/accounts"
+	"github.com/Erlast/short-url.git/internal/app/analytics"
 	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/deletion"
 	"github.com/Erlast/short-url.git/internal/app/helpers"
+	"github.com/Erlast/short-url.git/internal/app/middlewares"
 	"github.com/Erlast/short-url.git/internal/app/storages"
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
+type clickRecorder struct {
+	clicks []analytics.Click
+}
+
+func (r *clickRecorder) Record(click analytics.Click) {
+	r.clicks = append(r.clicks, click)
+}
+
+func (r *clickRecorder) popByShortURL(shortURL string) []analytics.Click {
+	var result []analytics.Click
+	for _, click := range r.clicks {
+		if click.ShortURL == shortURL {
+			result = append(result, click)
+		}
+	}
+	r.clicks = nil
+	return result
+}
+
+type deletionScheduler struct {
+	err      error
+	pending  map[string][]deletion.Pending
+	requests []storages.DeleteRequest
+}
+
+func (d *deletionScheduler) Enqueue(userID string, shortURLs []string) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.requests = append(d.requests, storages.DeleteRequest{UserID: userID, ShortURLs: shortURLs})
+	return nil
+}
+
+func (d *deletionScheduler) Pending(userID string) []deletion.Pending {
+	return d.pending[userID]
+}
+
 func TestGetHandler(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	store := storages.NewMockURLStorage(ctrl)
+	clicks := &clickRecorder{}
+	conf := &config.Cfg{SecretKey: "secret"}
 
 	tests := []struct {
 		name           string
@@ -52,6 +100,13 @@ func TestGetHandler(t *testing.T) {
 			storageErr:     &helpers.ConflictError{},
 			expectedStatus: http.StatusGone,
 		},
+		{
+			name:           "Expired ID",
+			id:             "expired123",
+			storageResp:    "",
+			storageErr:     fmt.Errorf("short URL expired123: %w", helpers.ErrExpired),
+			expectedStatus: http.StatusGone,
+		},
 	}
 
 	for _, tt := range tests {
@@ -66,7 +121,7 @@ func TestGetHandler(t *testing.T) {
 			r := chi.NewRouter()
 
 			r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
-				GetHandler(context.Background(), w, r, store)
+				GetHandler(context.Background(), w, r, store, clicks, conf)
 			})
 
 			r.ServeHTTP(rr, req)
@@ -77,8 +132,13 @@ func TestGetHandler(t *testing.T) {
 				t.Fatal(err)
 			}
 			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			recorded := clicks.popByShortURL(tt.id)
 			if tt.expectedStatus == http.StatusTemporaryRedirect {
 				assert.Equal(t, tt.storageResp, rr.Header().Get("Location"))
+				assert.Len(t, recorded, 1)
+			} else {
+				assert.Empty(t, recorded)
 			}
 		})
 	}
@@ -188,6 +248,143 @@ func TestPostShortenHandler(t *testing.T) {
 	}
 }
 
+func TestPostShortenHandlerWithAlias(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := storages.NewMockURLStorage(ctrl)
+	conf := &config.Cfg{FlagBaseURL: "http://localhost:8080"}
+	logger := zap.NewNop().Sugar()
+
+	tests := []struct {
+		name           string
+		alias          string
+		storageResp    string
+		storageErr     error
+		expectedStatus int
+	}{
+		{
+			name:           "Free alias",
+			alias:          "q3-report",
+			storageResp:    "q3-report",
+			storageErr:     nil,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Taken alias",
+			alias:          "q3-report",
+			storageResp:    "",
+			storageErr:     &helpers.AliasError{Alias: "q3-report", Err: helpers.ErrAliasExists},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Invalid alias",
+			alias:          "q3 report",
+			storageResp:    "",
+			storageErr:     &helpers.AliasError{Alias: "q3 report", Err: helpers.ErrAliasInvalid},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(BodyRequested{URL: "https://example.com", Alias: tt.alias})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			store.EXPECT().
+				SaveURLWithOptions(gomock.Any(), "https://example.com", storages.SaveOptions{Alias: tt.alias}).
+				Return(tt.storageResp, tt.storageErr)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBuffer(reqBody))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+
+			PostShortenHandler(context.Background(), rr, req, store, conf, logger)
+
+			resp := rr.Result()
+			err = resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusCreated {
+				assert.JSONEq(t, `{"result":"http://localhost:8080/q3-report"}`, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestPostShortenHandlerWithExpiry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := storages.NewMockURLStorage(ctrl)
+	conf := &config.Cfg{FlagBaseURL: "http://localhost:8080"}
+	logger := zap.NewNop().Sugar()
+
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name           string
+		requestBody    BodyRequested
+		expectedStatus int
+	}{
+		{
+			name:           "TTL",
+			requestBody:    BodyRequested{URL: "https://example.com", TTLSeconds: 3600},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Expiry in the past",
+			requestBody:    BodyRequested{URL: "https://example.com", ExpiresAt: &past},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Negative TTL",
+			requestBody:    BodyRequested{URL: "https://example.com", TTLSeconds: -1},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(tt.requestBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.expectedStatus == http.StatusCreated {
+				store.EXPECT().
+					SaveURLWithOptions(gomock.Any(), tt.requestBody.URL, gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ string, opts storages.SaveOptions) (string, error) {
+						assert.NotNil(t, opts.ExpiresAt)
+						assert.WithinDuration(t, time.Now().Add(time.Hour), *opts.ExpiresAt, time.Minute)
+						return "abc123", nil
+					})
+			}
+
+			req, err := http.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBuffer(reqBody))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+
+			PostShortenHandler(context.Background(), rr, req, store, conf, logger)
+
+			resp := rr.Result()
+			err = resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
 func TestBatchShortenHandler(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -400,23 +597,148 @@ func TestGetUserUrls(t *testing.T) {
 	})
 }
 
-func TestDeleteUserUrls(t *testing.T) {
+func TestGetURLStats(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	// Создаем мок для URLStorage
 	store := storages.NewMockURLStorage(ctrl)
+	clicks := analytics.NewMemoryStore()
+	logger := zap.NewNop().Sugar()
+
+	err := clicks.SaveClicks(context.Background(), []analytics.Click{
+		{ShortURL: "abc123", IPHash: "visitor1", Timestamp: time.Date(2024, time.July, 1, 10, 0, 0, 0, time.UTC)},
+		{ShortURL: "abc123", IPHash: "visitor1", Timestamp: time.Date(2024, time.July, 1, 11, 0, 0, 0, time.UTC)},
+		{ShortURL: "abc123", IPHash: "visitor2", Timestamp: time.Date(2024, time.July, 2, 10, 0, 0, 0, time.UTC)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		id             string
+		storageResp    storages.Access
+		storageErr     error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Owner",
+			id:             "abc123",
+			storageResp:    storages.AccessOwner,
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"short_url":"abc123","total_clicks":3,"unique_visitors":2,
+				"daily":[{"date":"2024-07-01","clicks":2},{"date":"2024-07-02","clicks":1}]}`,
+		},
+		{
+			name:           "Shared",
+			id:             "abc123",
+			storageResp:    storages.AccessRead,
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"short_url":"abc123","total_clicks":3,"unique_visitors":2,
+				"daily":[{"date":"2024-07-01","clicks":2},{"date":"2024-07-02","clicks":1}]}`,
+		},
+		{
+			name:           "Another user",
+			id:             "abc123",
+			storageErr:     fmt.Errorf("short URL abc123: %w", helpers.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Not found",
+			id:             "notfound",
+			storageErr:     fmt.Errorf("short URL notfound: %w", helpers.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.EXPECT().URLAccess(gomock.Any(), tt.id).Return(tt.storageResp, tt.storageErr)
+
+			req, err := http.NewRequest(http.MethodGet, "/api/user/urls/"+tt.id+"/stats", http.NoBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+
+			r := chi.NewRouter()
+			r.Get("/api/user/urls/{id}/stats", func(w http.ResponseWriter, r *http.Request) {
+				r = r.WithContext(context.WithValue(r.Context(), helpers.UserID, "user1"))
+				GetURLStats(r.Context(), w, r, store, clicks, logger)
+			})
+			r.ServeHTTP(rr, req)
+
+			resp := rr.Result()
+			err = resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetInternalStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := storages.NewMockURLStorage(ctrl)
+	logger := zap.NewNop().Sugar()
+
+	tests := []struct {
+		storageResp    *storages.InternalStats
+		storageErr     error
+		name           string
+		expectedBody   string
+		expectedStatus int
+	}{
+		{
+			name:           "Success",
+			storageResp:    &storages.InternalStats{URLs: 10, Users: 3},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"urls":10,"users":3}`,
+		},
+		{
+			name:           "Storage error",
+			storageErr:     errors.New("db is down"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.EXPECT().GetStats(gomock.Any()).Return(tt.storageResp, tt.storageErr)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/internal/stats", http.NoBody)
+			rr := httptest.NewRecorder()
+
+			GetInternalStats(req.Context(), rr, req, store, logger)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeleteUserUrls(t *testing.T) {
 	logger := zap.NewExample().Sugar()
 
 	t.Run("success", func(t *testing.T) {
+		deletions := &deletionScheduler{}
 		urlsToDelete := []string{"short-url-1", "short-url-2"}
 		body, err := json.Marshal(urlsToDelete)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		store.EXPECT().DeleteUserURLs(gomock.Any(), urlsToDelete, logger).Return(nil)
-
 		req, err := http.NewRequest(http.MethodDelete, "/api/user/urls", bytes.NewBuffer(body))
 		if err != nil {
 			t.Fatal(err)
@@ -426,8 +748,8 @@ func TestDeleteUserUrls(t *testing.T) {
 
 		r := chi.NewRouter()
 		r.Delete("/api/user/urls", func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), helpers.UserID, 1)
-			DeleteUserUrls(ctx, w, r, store, logger)
+			r = r.WithContext(context.WithValue(r.Context(), helpers.UserID, "user1"))
+			DeleteUserUrls(r.Context(), w, r, deletions, logger)
 		})
 		r.ServeHTTP(rr, req)
 
@@ -438,6 +760,7 @@ func TestDeleteUserUrls(t *testing.T) {
 		}
 
 		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, []storages.DeleteRequest{{UserID: "user1", ShortURLs: urlsToDelete}}, deletions.requests)
 	})
 
 	t.Run("empty body", func(t *testing.T) {
@@ -448,12 +771,7 @@ func TestDeleteUserUrls(t *testing.T) {
 
 		rr := httptest.NewRecorder()
 
-		r := chi.NewRouter()
-		r.Delete("/api/user/urls", func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), helpers.UserID, 1)
-			DeleteUserUrls(ctx, w, r, store, logger)
-		})
-		r.ServeHTTP(rr, req)
+		DeleteUserUrls(req.Context(), rr, req, &deletionScheduler{}, logger)
 
 		resp := rr.Result()
 		err = resp.Body.Close()
@@ -474,7 +792,7 @@ func TestDeleteUserUrls(t *testing.T) {
 
 		rr := httptest.NewRecorder()
 
-		DeleteUserUrls(req.Context(), rr, req, store, logger)
+		DeleteUserUrls(req.Context(), rr, req, &deletionScheduler{}, logger)
 
 		resp := rr.Result()
 		err = resp.Body.Close()
@@ -485,30 +803,777 @@ func TestDeleteUserUrls(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
 	})
 
-	t.Run("delete error", func(t *testing.T) {
-		urlsToDelete := []string{"short-url-1", "short-url-2"}
-		body, err := json.Marshal(urlsToDelete)
+	t.Run("queue full", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodDelete, "/api/user/urls", bytes.NewBufferString(`["short-url-1"]`))
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		store.EXPECT().DeleteUserURLs(gomock.Any(), urlsToDelete, logger).Return(errors.New("delete failed"))
+		rr := httptest.NewRecorder()
 
-		req, err := http.NewRequest(http.MethodDelete, "/api/user/urls", bytes.NewBuffer(body))
+		DeleteUserUrls(req.Context(), rr, req, &deletionScheduler{err: deletion.ErrQueueFull}, logger)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+	})
+
+	t.Run("enqueue error", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodDelete, "/api/user/urls", bytes.NewBufferString(`["short-url-1"]`))
 		if err != nil {
 			t.Fatal(err)
 		}
 
 		rr := httptest.NewRecorder()
 
-		DeleteUserUrls(req.Context(), rr, req, store, logger)
+		DeleteUserUrls(req.Context(), rr, req, &deletionScheduler{err: deletion.ErrQueueClosed}, logger)
 
-		resp := rr.Result()
-		err = resp.Body.Close()
-		if err != nil {
-			t.Fatal(err)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestGetPendingDeletions(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	requestedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	deletions := &deletionScheduler{pending: map[string][]deletion.Pending{
+		"user1": {{ShortURL: "short-url-1", RequestedAt: requestedAt, Attempts: 2}},
+	}}
+
+	serve := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls/deletions", http.NoBody)
+		req = req.WithContext(context.WithValue(req.Context(), helpers.UserID, userID))
+		rr := httptest.NewRecorder()
+		GetPendingDeletions(req.Context(), rr, req, deletions, logger)
+		return rr
+	}
+
+	rr := serve("user1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t,
+		`[{"short_url":"short-url-1","requested_at":"2024-01-02T03:04:05Z","attempts":2}]`,
+		rr.Body.String())
+
+	assert.Equal(t, http.StatusNoContent, serve("user2").Code)
+}
+
+func TestGetDeletedUserURLs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := storages.NewMockURLStorage(ctrl)
+	conf := &config.Cfg{FlagBaseURL: "http://localhost:8080"}
+	logger := zap.NewNop().Sugar()
+	deletedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls/trash", http.NoBody)
+		rr := httptest.NewRecorder()
+		GetDeletedUserURLs(req.Context(), rr, req, store, conf, logger)
+		return rr
+	}
+
+	store.EXPECT().GetDeletedURLs(gomock.Any(), conf.FlagBaseURL).Return([]storages.DeletedURL{
+		{ShortURL: "http://localhost:8080/abc", OriginalURL: "https://example.com", DeletedAt: &deletedAt},
+	}, nil)
+	rr := serve()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t,
+		`[{"short_url":"http://localhost:8080/abc","original_url":"https://example.com",`+
+			`"deleted_at":"2024-01-02T03:04:05Z"}]`,
+		rr.Body.String())
+
+	store.EXPECT().GetDeletedURLs(gomock.Any(), conf.FlagBaseURL).Return(nil, nil)
+	assert.Equal(t, http.StatusNoContent, serve().Code)
+
+	store.EXPECT().GetDeletedURLs(gomock.Any(), conf.FlagBaseURL).Return(nil, errors.New("storage error"))
+	assert.Equal(t, http.StatusInternalServerError, serve().Code)
+}
+
+func TestRestoreUserURLs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := storages.NewMockURLStorage(ctrl)
+	conf := &config.Cfg{FlagBaseURL: "http://localhost:8080"}
+	logger := zap.NewNop().Sugar()
+
+	tests := []struct {
+		err          error
+		name         string
+		body         string
+		expectedBody string
+		expectedCode int
+		callStorage  bool
+	}{
+		{name: "Restored", body: `["abc","def"]`, callStorage: true, expectedCode: http.StatusNoContent},
+		{name: "Empty body", expectedCode: http.StatusBadRequest},
+		{name: "Empty list", body: `[]`, expectedCode: http.StatusBadRequest},
+		{name: "Invalid body", body: `{"abc"}`, expectedCode: http.StatusBadRequest},
+		{
+			name:         "Not found",
+			body:         `["abc","def"]`,
+			callStorage:  true,
+			err:          fmt.Errorf("short URL def: %w", helpers.ErrNotFound),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:        "Conflict",
+			body:        `["abc","def"]`,
+			callStorage: true,
+			err: &helpers.RestoreConflictError{
+				ShortURL: "def", Existing: "xyz", Field: helpers.RestoreConflictOriginal,
+			},
+			expectedCode: http.StatusConflict,
+			expectedBody: `{"short_url":"http://localhost:8080/def","existing_short_url":"http://localhost:8080/xyz",` +
+				`"conflict":"original"}`,
+		},
+		{
+			name:         "Concurrent conflict",
+			body:         `["abc","def"]`,
+			callStorage:  true,
+			err:          fmt.Errorf("short URL def: %w", helpers.ErrRestoreConflict),
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "Storage error",
+			body:         `["abc","def"]`,
+			callStorage:  true,
+			err:          errors.New("storage error"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.callStorage {
+				store.EXPECT().RestoreURLs(gomock.Any(), []string{"abc", "def"}).Return(tt.err)
+			}
+
+			body := io.Reader(http.NoBody)
+			if tt.body != "" {
+				body = bytes.NewBufferString(tt.body)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/user/urls/restore", body)
+			rr := httptest.NewRecorder()
+			RestoreUserURLs(req.Context(), rr, req, store, conf, logger)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestURLSharing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := storages.NewMockURLStorage(ctrl)
+	logger := zap.NewNop().Sugar()
+
+	r := chi.NewRouter()
+	r.Get("/api/user/urls/{id}/shares", func(w http.ResponseWriter, r *http.Request) {
+		GetURLShares(r.Context(), w, r, store, logger)
+	})
+	r.Post("/api/user/urls/{id}/shares", func(w http.ResponseWriter, r *http.Request) {
+		ShareURL(r.Context(), w, r, store, logger)
+	})
+	r.Delete("/api/user/urls/{id}/shares/{userID}", func(w http.ResponseWriter, r *http.Request) {
+		RevokeURLShare(r.Context(), w, r, store, logger)
+	})
+	r.Post("/api/user/urls/{id}/transfer", func(w http.ResponseWriter, r *http.Request) {
+		TransferURL(r.Context(), w, r, store, logger)
+	})
+
+	tests := []struct {
+		expect         func()
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedBody   string
+		expectedStatus int
+	}{
+		{
+			name:   "Shares",
+			method: http.MethodGet,
+			path:   "/api/user/urls/abc123/shares",
+			expect: func() {
+				store.EXPECT().GetURLShares(gomock.Any(), "abc123").
+					Return([]storages.Share{{UserID: "user2", Access: storages.AccessRead}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"user_id":"user2","access":"read"}]`,
+		},
+		{
+			name:   "No shares",
+			method: http.MethodGet,
+			path:   "/api/user/urls/abc123/shares",
+			expect: func() {
+				store.EXPECT().GetURLShares(gomock.Any(), "abc123").Return([]storages.Share{}, nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "Share",
+			method: http.MethodPost,
+			path:   "/api/user/urls/abc123/shares",
+			body:   `{"user_id":"user2","access":"manage"}`,
+			expect: func() {
+				store.EXPECT().ShareURL(gomock.Any(), "abc123", "user2", storages.AccessManage).Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "Share forbidden",
+			method: http.MethodPost,
+			path:   "/api/user/urls/abc123/shares",
+			body:   `{"user_id":"user2","access":"read"}`,
+			expect: func() {
+				store.EXPECT().ShareURL(gomock.Any(), "abc123", "user2", storages.AccessRead).
+					Return(fmt.Errorf("short URL abc123: %w", helpers.ErrForbidden))
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "Share invalid",
+			method: http.MethodPost,
+			path:   "/api/user/urls/abc123/shares",
+			body:   `{"user_id":"user2","access":"owner"}`,
+			expect: func() {
+				store.EXPECT().ShareURL(gomock.Any(), "abc123", "user2", storages.AccessOwner).
+					Return(fmt.Errorf("share abc123 with user2: %w", helpers.ErrShareInvalid))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Share without user",
+			method:         http.MethodPost,
+			path:           "/api/user/urls/abc123/shares",
+			body:           `{"access":"read"}`,
+			expect:         func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Revoke",
+			method: http.MethodDelete,
+			path:   "/api/user/urls/abc123/shares/user2",
+			expect: func() {
+				store.EXPECT().RevokeURLShare(gomock.Any(), "abc123", "user2").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "Transfer",
+			method: http.MethodPost,
+			path:   "/api/user/urls/abc123/transfer",
+			body:   `{"user_id":"user2"}`,
+			expect: func() {
+				store.EXPECT().TransferURL(gomock.Any(), "abc123", "user2").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "Transfer not found",
+			method: http.MethodPost,
+			path:   "/api/user/urls/abc123/transfer",
+			body:   `{"user_id":"user2"}`,
+			expect: func() {
+				store.EXPECT().TransferURL(gomock.Any(), "abc123", "user2").
+					Return(fmt.Errorf("short URL abc123: %w", helpers.ErrNotFound))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.expect()
+
+			var body io.Reader = http.NoBody
+			if tt.body != "" {
+				body = bytes.NewBufferString(tt.body)
+			}
+			req, err := http.NewRequest(tt.method, tt.path, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	conf := &config.Cfg{SecretKey: "secret", RefreshTokenTTL: time.Hour}
+	store := accounts.NewMemoryStore()
+	logger := zap.NewNop().Sugar()
+
+	r := chi.NewRouter()
+	r.Post("/api/auth/register", func(w http.ResponseWriter, r *http.Request) {
+		Register(r.Context(), w, r, store, conf, logger)
+	})
+	r.Post("/api/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		Login(r.Context(), w, r, store, conf, logger)
+	})
+	r.Post("/api/auth/refresh", func(w http.ResponseWriter, r *http.Request) {
+		RefreshToken(r.Context(), w, r, store, conf, logger)
+	})
+	r.Post("/api/auth/logout", func(w http.ResponseWriter, r *http.Request) {
+		Logout(r.Context(), w, r, store, conf, logger)
+	})
+
+	serve := func(path, body string, cookies ...*http.Cookie) (*httptest.ResponseRecorder, authResponse) {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
 		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
 
-		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		var resp authResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp
+	}
+
+	// регистрация с токеном анонимного пользователя переносит его идентификатор в учетную запись
+	anonymous, err := middlewares.BuildJWTString(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymousID := middlewares.GetAnonymousUserID(anonymous, conf)
+
+	rr, registered := serve("/api/auth/register", `{"login":"alice","password":"password1"}`,
+		&http.Cookie{Name: "token", Value: anonymous})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, anonymousID, registered.UserID)
+	assert.Equal(t, anonymousID, middlewares.GetUserID(registered.AccessToken, logger, conf))
+	assert.Equal(t, registered.AccessToken, rr.Header().Get("Authorization"))
+	assert.NotEmpty(t, registered.RefreshToken)
+
+	rr, _ = serve("/api/auth/register", `{"login":"alice","password":"password2"}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	rr, _ = serve("/api/auth/register", `{"login":"bob","password":"short"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr, _ = serve("/api/auth/login", `{"login":"alice","password":"wrong password"}`)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr, loggedIn := serve("/api/auth/login", `{"login":"alice","password":"password1"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, anonymousID, loggedIn.UserID)
+
+	// refresh токен передается в cookie и после обмена становится недействительным
+	var refreshCookie *http.Cookie
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "refresh_token" {
+			refreshCookie = cookie
+		}
+	}
+	if assert.NotNil(t, refreshCookie) {
+		rr, refreshed := serve("/api/auth/refresh", "", refreshCookie)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, anonymousID, refreshed.UserID)
+		assert.NotEqual(t, loggedIn.RefreshToken, refreshed.RefreshToken)
+
+		rr, _ = serve("/api/auth/refresh", "", refreshCookie)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	}
+
+	rr, _ = serve("/api/auth/logout", `{"refresh_token":"`+registered.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr, _ = serve("/api/auth/refresh", `{"refresh_token":"`+registered.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestAPIKeys(t *testing.T) {
+	store := accounts.NewMemoryStore()
+	logger := zap.NewNop().Sugar()
+
+	user, err := accounts.Register(context.Background(), store, "alice", "password1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.Get("/api/user/keys", func(w http.ResponseWriter, r *http.Request) {
+		ListAPIKeys(r.Context(), w, r, store, logger)
+	})
+	r.Post("/api/user/keys", func(w http.ResponseWriter, r *http.Request) {
+		CreateAPIKey(r.Context(), w, r, store, logger)
+	})
+	r.Delete("/api/user/keys/{id}", func(w http.ResponseWriter, r *http.Request) {
+		RevokeAPIKey(r.Context(), w, r, store, logger)
+	})
+
+	serve := func(method, path, body, userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), helpers.UserID, userID))
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(http.MethodGet, "/api/user/keys", "", user.ID)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	// ключи выдаются только учетным записям
+	rr = serve(http.MethodPost, "/api/user/keys", `{"name":"ci"}`, "anonymous")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = serve(http.MethodPost, "/api/user/keys", `{"name":"ci"}`, user.ID)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created apiKeyResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.Equal(t, "ci", created.Name)
+	assert.True(t, accounts.IsAPIKey(created.Key))
+	assert.NotContains(t, rr.Body.String(), "hash")
+
+	rr = serve(http.MethodGet, "/api/user/keys", "", user.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var listed []apiKeyResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	if assert.Len(t, listed, 1) {
+		assert.Equal(t, created.ID, listed[0].ID)
+		assert.Empty(t, listed[0].Key)
+	}
+
+	rr = serve(http.MethodDelete, "/api/user/keys/"+created.ID, "", "anonymous")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = serve(http.MethodDelete, "/api/user/keys/"+created.ID, "", user.ID)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	_, err = accounts.ResolveAPIKey(context.Background(), store, created.Key)
+	assert.ErrorIs(t, err, accounts.ErrInvalidAPIKey)
+}
+
+// importResponse отчет импорта.
+type importResponse struct {
+	Rows    []ImportResult `json:"rows"`
+	Summary ImportSummary  `json:"summary"`
+}
+
+// doImport выполнение запроса импорта от имени user1.
+func doImport(t *testing.T, store storages.URLStorage, contentType, body string) (*http.Response, importResponse) {
+	t.Helper()
+
+	conf := &config.Cfg{FlagBaseURL: "http://localhost:8080"}
+	req := httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(body))
+	if body == "" {
+		req.Body = http.NoBody
+	}
+	req.Header.Set("Content-Type", contentType)
+	req = req.WithContext(context.WithValue(req.Context(), helpers.UserID, "user1"))
+	w := httptest.NewRecorder()
+
+	ImportURLs(req.Context(), w, req, store, conf, zap.NewNop().Sugar())
+
+	res := w.Result()
+	defer func() { _ = res.Body.Close() }()
+
+	var report importResponse
+	if res.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+	}
+
+	return res, report
+}
+
+func TestImportURLs_CSV(t *testing.T) {
+	store, err := storages.NewMemoryStorage(context.Background())
+	require.NoError(t, err)
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	body := "\ufeffalias,original_url,expires_at\n" +
+		"docs,https://example.com/docs," + expiresAt + "\n" +
+		",https://example.com/plain,\n" +
+		"docs,https://example.com/other,\n" +
+		"bad/alias,https://example.com/bad,\n" +
+		",not a url,\n" +
+		",https://example.com/past,2001-01-01T00:00:00Z\n" +
+		",https://example.com/format,tomorrow\n" +
+		",https://example.com/extra,,x\n"
+
+	res, report := doImport(t, store, "text/csv", body)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+	assert.Equal(t, ImportSummary{Created: 2, Conflict: 1, Invalid: 5}, report.Summary)
+	require.Len(t, report.Rows, 8)
+	assert.Equal(t, ImportResult{
+		Row: 1, Status: ImportCreated, OriginalURL: "https://example.com/docs", ShortURL: "http://localhost:8080/docs",
+	}, report.Rows[0])
+	assert.Equal(t, ImportCreated, report.Rows[1].Status)
+	assert.NotEmpty(t, report.Rows[1].ShortURL)
+	assert.Equal(t, ImportResult{
+		Row: 3, Status: ImportConflict, OriginalURL: "https://example.com/other", Error: "alias already exists",
+	}, report.Rows[2])
+	for i, row := range report.Rows[3:] {
+		assert.Equal(t, i+4, row.Row)
+		assert.Equal(t, ImportInvalid, row.Status)
+		assert.NotEmpty(t, row.Error)
+	}
+
+	record, err := store.GetShortURL(context.Background(), "docs")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/docs", record.OriginalURL)
+	require.NotNil(t, record.ExpiresAt)
+}
+
+func TestImportURLs_JSONL(t *testing.T) {
+	store, err := storages.NewMemoryStorage(context.Background())
+	require.NoError(t, err)
+
+	body := `{"original_url":"https://example.com/1","alias":"first"}` + "\n\n" +
+		`{"original_url":` + "\n" +
+		`{"original_url":"https://example.com/2"}` + "\n"
+
+	res, report := doImport(t, store, "application/x-ndjson", body)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	assert.Equal(t, ImportSummary{Created: 2, Invalid: 1}, report.Summary)
+	require.Len(t, report.Rows, 3)
+	assert.Equal(t, "http://localhost:8080/first", report.Rows[0].ShortURL)
+	assert.Equal(t, ImportResult{Row: 2, Status: ImportInvalid, Error: "invalid json"}, report.Rows[1])
+	assert.Equal(t, 3, report.Rows[2].Row)
+}
+
+func TestImportURLs_Chunks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := storages.NewMockURLStorage(ctrl)
+
+	var body strings.Builder
+	for i := range importChunkSize + 1 {
+		fmt.Fprintf(&body, "https://example.com/%d\n", i)
+	}
+
+	load := func(_ context.Context, incoming []storages.Incoming, _ string) ([]storages.Output, error) {
+		outputs := make([]storages.Output, 0, len(incoming))
+		for _, v := range incoming {
+			outputs = append(outputs, storages.Output{CorrelationID: v.CorrelationID, ShortURL: "s" + v.CorrelationID})
+		}
+		return outputs, nil
+	}
+	gomock.InOrder(
+		store.EXPECT().LoadURLs(gomock.Any(), gomock.Len(importChunkSize), gomock.Any()).DoAndReturn(load),
+		store.EXPECT().LoadURLs(gomock.Any(), gomock.Len(1), gomock.Any()).DoAndReturn(load),
+	)
+
+	res, _ := doImport(t, store, "text/plain", body.String())
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+
+	res, report := doImport(t, store, "text/csv; charset=utf-8", body.String())
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, importChunkSize+1, report.Summary.Created)
+	assert.Equal(t, "s501", report.Rows[importChunkSize].ShortURL)
+}
+
+func TestImportURLs_ConflictFallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := storages.NewMockURLStorage(ctrl)
+
+	// Пакет отклонен целиком, результат каждой строки определяется сохранением по одной
+	store.EXPECT().LoadURLs(gomock.Any(), gomock.Len(2), gomock.Any()).
+		Return(nil, &helpers.ConflictError{ShortURL: "https://example.com/2", Err: helpers.ErrConflict})
+	store.EXPECT().SaveURLWithOptions(gomock.Any(), "https://example.com/1", storages.SaveOptions{}).Return("abc", nil)
+	store.EXPECT().SaveURLWithOptions(gomock.Any(), "https://example.com/2", storages.SaveOptions{}).
+		Return("", &helpers.ConflictError{ShortURL: "old", Err: helpers.ErrConflict})
+
+	res, report := doImport(t, store, "text/csv", "https://example.com/1\nhttps://example.com/2\n")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	assert.Equal(t, ImportSummary{Created: 1, Conflict: 1}, report.Summary)
+	assert.Equal(t, "http://localhost:8080/abc", report.Rows[0].ShortURL)
+	assert.Equal(t, ImportResult{
+		Row:         2,
+		Status:      ImportConflict,
+		OriginalURL: "https://example.com/2",
+		ShortURL:    "http://localhost:8080/old",
+		Error:       "original url already shortened",
+	}, report.Rows[1])
+}
+
+func TestImportURLs_Errors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := storages.NewMockURLStorage(ctrl)
+
+	res, _ := doImport(t, store, "text/csv", "")
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, _ = doImport(t, store, "text/csv", "original_url,title\nhttps://example.com\n")
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, _ = doImport(t, store, "application/x-ndjson", strings.Repeat("x", importMaxLineSize+1))
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// Ошибка хранилища до начала отчета
+	store.EXPECT().LoadURLs(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("storage error"))
+	res, _ = doImport(t, store, "text/csv", "https://example.com/1\n")
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+
+	// Ошибка хранилища после начала отчета прерывает импорт с причиной в итоге
+	var body strings.Builder
+	for i := range importChunkSize + 1 {
+		fmt.Fprintf(&body, "https://example.com/%d\n", i)
+	}
+	gomock.InOrder(
+		store.EXPECT().LoadURLs(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, incoming []storages.Incoming, _ string) ([]storages.Output, error) {
+				return make([]storages.Output, len(incoming)), nil
+			}),
+		store.EXPECT().LoadURLs(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("storage error")),
+	)
+	res, report := doImport(t, store, "text/csv", body.String())
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, report.Rows, importChunkSize)
+	assert.Equal(t, ImportSummary{Created: importChunkSize, Error: "import aborted"}, report.Summary)
+}
+
+// failingClicks хранилище переходов, не отвечающее на подсчет переходов.
+type failingClicks struct {
+	*analytics.MemoryStore
+}
+
+func (s *failingClicks) CountClicks(context.Context, []string) (map[string]int64, error) {
+	return nil, errors.New("clicks unavailable")
+}
+
+// doExport выполнение запроса выгрузки от имени user1.
+func doExport(t *testing.T, store storages.URLStorage, clicks analytics.Store, format string) (*http.Response, string) {
+	t.Helper()
+
+	conf := &config.Cfg{FlagBaseURL: "http://localhost:8080"}
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls/export?format="+format, http.NoBody)
+	req = req.WithContext(context.WithValue(req.Context(), helpers.UserID, "user1"))
+	w := httptest.NewRecorder()
+
+	ExportUserURLs(req.Context(), w, req, store, clicks, conf, zap.NewNop().Sugar())
+
+	res := w.Result()
+	defer func() { _ = res.Body.Close() }()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return res, string(body)
+}
+
+func TestExportUserURLs_Formats(t *testing.T) {
+	ctx := context.Background()
+	store, err := storages.NewMemoryStorage(ctx)
+	require.NoError(t, err)
+	user1 := context.WithValue(ctx, helpers.UserID, "user1")
+
+	live, err := store.SaveURL(user1, "https://example.com/live")
+	require.NoError(t, err)
+	deleted, err := store.SaveURL(user1, "https://example.com/deleted")
+	require.NoError(t, err)
+	_, err = store.SaveURL(context.WithValue(ctx, helpers.UserID, "user2"), "https://example.com/other")
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteURLs(ctx, []storages.DeleteRequest{{UserID: "user1", ShortURLs: []string{deleted}}}))
+
+	clicks := analytics.NewMemoryStore()
+	require.NoError(t, clicks.SaveClicks(ctx, []analytics.Click{
+		{ShortURL: live, IPHash: "a", Timestamp: time.Now()},
+		{ShortURL: live, IPHash: "b", Timestamp: time.Now()},
+	}))
+
+	res, body := doExport(t, store, clicks, "json")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="urls.json"`, res.Header.Get("Content-Disposition"))
+
+	var links []ExportedURL
+	require.NoError(t, json.Unmarshal([]byte(body), &links))
+	require.Len(t, links, 2)
+	assert.Equal(t, "http://localhost:8080/"+live, links[0].ShortURL)
+	assert.Equal(t, "https://example.com/live", links[0].OriginalURL)
+	assert.NotNil(t, links[0].CreatedAt)
+	assert.False(t, links[0].IsDeleted)
+	require.NotNil(t, links[0].Clicks)
+	assert.EqualValues(t, 2, *links[0].Clicks)
+	assert.Equal(t, "http://localhost:8080/"+deleted, links[1].ShortURL)
+	assert.True(t, links[1].IsDeleted)
+	assert.NotNil(t, links[1].DeletedAt)
+	require.NotNil(t, links[1].Clicks)
+	assert.Zero(t, *links[1].Clicks)
+
+	res, body = doExport(t, store, clicks, "jsonl")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/x-ndjson", res.Header.Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	require.Len(t, lines, 2)
+	var link ExportedURL
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &link))
+	assert.Equal(t, links[1], link)
+
+	res, body = doExport(t, store, clicks, "csv")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", res.Header.Get("Content-Type"))
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, exportColumns, records[0])
+	assert.Equal(t, []string{"http://localhost:8080/" + live, "https://example.com/live"}, records[1][:2])
+	assert.Equal(t, []string{"false", "", "2"}, records[1][4:])
+	assert.Equal(t, "true", records[2][4])
+	assert.NotEmpty(t, records[2][5])
+}
+
+func TestExportUserURLs_Pages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := storages.NewMockURLStorage(ctrl)
+
+	gomock.InOrder(
+		store.EXPECT().GetUserURLsPage(gomock.Any(), "", exportPageSize).
+			Return([]storages.ShortenURL{{ShortURL: "a", OriginalURL: "https://example.com/a"}}, "1", nil),
+		store.EXPECT().GetUserURLsPage(gomock.Any(), "1", exportPageSize).
+			Return([]storages.ShortenURL{{ShortURL: "b", OriginalURL: "https://example.com/b"}}, "", nil),
+	)
+
+	// Без статистики переходов ссылки выгружаются без количества переходов
+	res, body := doExport(t, store, &failingClicks{MemoryStore: analytics.NewMemoryStore()}, "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `[
+		{"short_url":"http://localhost:8080/a","original_url":"https://example.com/a","is_deleted":false},
+		{"short_url":"http://localhost:8080/b","original_url":"https://example.com/b","is_deleted":false}
+	]`, body)
+}
+
+func TestExportUserURLs_Errors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := storages.NewMockURLStorage(ctrl)
+	clicks := analytics.NewMemoryStore()
+
+	res, _ := doExport(t, store, clicks, "xml")
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// Ошибка хранилища до начала ответа
+	store.EXPECT().GetUserURLsPage(gomock.Any(), "", exportPageSize).Return(nil, "", errors.New("storage error"))
+	res, _ = doExport(t, store, clicks, "csv")
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+
+	// Ошибка хранилища после начала ответа разрывает соединение
+	gomock.InOrder(
+		store.EXPECT().GetUserURLsPage(gomock.Any(), "", exportPageSize).
+			Return([]storages.ShortenURL{{ShortURL: "a", OriginalURL: "https://example.com/a"}}, "1", nil),
+		store.EXPECT().GetUserURLsPage(gomock.Any(), "1", exportPageSize).Return(nil, "", errors.New("storage error")),
+	)
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		doExport(t, store, clicks, "jsonl")
 	})
 }
@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/helpers"
+	"github.com/Erlast/short-url.git/internal/app/storages"
+)
+
+const importChunkSize = 500           // importChunkSize количество строк импорта в одном пакете сохранения
+const importMaxLineSize = 1024 * 1024 // importMaxLineSize максимальная длина строки JSONL
+
+// Статусы строк импорта.
+const (
+	ImportCreated  = "created"  // ImportCreated ссылка создана
+	ImportConflict = "conflict" // ImportConflict URL уже сокращен или алиас занят
+	ImportInvalid  = "invalid"  // ImportInvalid строка не разобрана или содержит недопустимые значения
+)
+
+// Форматы тела запроса импорта.
+const (
+	importFormatCSV   = "csv"
+	importFormatJSONL = "jsonl"
+)
+
+// importColumns колонки CSV без строки заголовка.
+var importColumns = []string{"original_url", "alias", "expires_at"}
+
+// ImportRow строка импорта.
+type ImportRow struct {
+	// ExpiresAt - момент истечения срока действия ссылки в формате RFC 3339
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// OriginalURL - оригинальный URL
+	OriginalURL string `json:"original_url"`
+	// Alias - пользовательский алиас короткой ссылки
+	Alias string `json:"alias,omitempty"`
+}
+
+// ImportResult результат импорта строки.
+type ImportResult struct {
+	// Status - ImportCreated, ImportConflict или ImportInvalid
+	Status      string `json:"status"`
+	OriginalURL string `json:"original_url,omitempty"`
+	// ShortURL - созданная ссылка или ссылка, которой уже сокращен URL
+	ShortURL string `json:"short_url,omitempty"`
+	// Error - причина конфликта или ошибки
+	Error string `json:"error,omitempty"`
+	// Row - номер строки данных начиная с 1 без учета заголовка CSV и пустых строк
+	Row int `json:"row"`
+}
+
+// ImportSummary итог импорта.
+type ImportSummary struct {
+	// Error - причина прерывания импорта, строки после прерывания не обработаны
+	Error    string `json:"error,omitempty"`
+	Created  int    `json:"created"`
+	Conflict int    `json:"conflict"`
+	Invalid  int    `json:"invalid"`
+}
+
+// importRowError ошибка разбора строки, после которой чтение продолжается.
+type importRowError struct {
+	err error
+}
+
+// Error текст ошибки строки.
+func (e *importRowError) Error() string {
+	return e.err.Error()
+}
+
+// importReader построчное чтение тела запроса импорта.
+type importReader interface {
+	// Next следующая строка: io.EOF - строки закончились, *importRowError - строка не разобрана
+	Next() (ImportRow, error)
+}
+
+// importItem строка импорта, ожидающая сохранения.
+type importItem struct {
+	incoming storages.Incoming
+	result   ImportResult
+}
+
+// ImportURLs запрос на импорт ссылок из CSV или JSON Lines.
+//
+// Строки вида original_url[,alias][,expires_at] читаются из тела запроса потоком и сохраняются
+// пакетами через LoadURLs. Если пакет не сохранен из-за конфликта, его строки сохраняются по одной,
+// чтобы определить результат каждой. Отчет по строкам передается клиенту по мере сохранения пакетов.
+func ImportURLs(
+	_ context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	storage storages.URLStorage,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+) {
+	if req.Body == http.NoBody {
+		http.Error(res, "Empty String!", http.StatusBadRequest)
+		return
+	}
+
+	reader, err := newImportReader(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	report := &importReport{res: res, logger: logger}
+	chunk := make([]importItem, 0, importChunkSize)
+
+	for row := 1; ; row++ {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var rowErr *importRowError
+		switch {
+		case errors.As(err, &rowErr):
+			chunk = append(chunk, importItem{result: ImportResult{Row: row, Status: ImportInvalid, Error: err.Error()}})
+		case err != nil:
+			report.abort(http.StatusBadRequest, fmt.Errorf("unable to read import: %w", err))
+			return
+		default:
+			chunk = append(chunk, newImportItem(row, record, time.Now()))
+		}
+
+		if len(chunk) < importChunkSize {
+			continue
+		}
+		if err := saveImportChunk(req.Context(), storage, chunk, conf.FlagBaseURL); err != nil {
+			report.abort(http.StatusInternalServerError, err)
+			return
+		}
+		report.write(chunk)
+		chunk = chunk[:0]
+	}
+
+	if err := saveImportChunk(req.Context(), storage, chunk, conf.FlagBaseURL); err != nil {
+		report.abort(http.StatusInternalServerError, err)
+		return
+	}
+	report.write(chunk)
+	report.finish()
+}
+
+// newImportItem проверка строки импорта, недопустимая строка получает статус ImportInvalid.
+func newImportItem(row int, record ImportRow, now time.Time) importItem {
+	item := importItem{result: ImportResult{Row: row, OriginalURL: record.OriginalURL}}
+
+	invalid := func(reason string) importItem {
+		item.result.Status = ImportInvalid
+		item.result.Error = reason
+		return item
+	}
+
+	u, err := url.ParseRequestURI(record.OriginalURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return invalid("invalid original url")
+	}
+
+	if record.Alias != "" {
+		if err := helpers.ValidateAlias(record.Alias); err != nil {
+			return invalid("invalid alias")
+		}
+	}
+
+	expiresAt, err := helpers.ResolveExpiry(record.ExpiresAt, 0, now)
+	if err != nil {
+		return invalid("invalid expiry")
+	}
+
+	item.incoming = storages.Incoming{
+		ExpiresAt:     expiresAt,
+		CorrelationID: strconv.Itoa(row),
+		OriginalURL:   record.OriginalURL,
+		Alias:         record.Alias,
+	}
+
+	return item
+}
+
+// saveImportChunk сохранение допустимых строк пакета и заполнение их результатов.
+func saveImportChunk(ctx context.Context, storage storages.URLStorage, chunk []importItem, baseURL string) error {
+	pending := make([]*importItem, 0, len(chunk))
+	incoming := make([]storages.Incoming, 0, len(chunk))
+	for i := range chunk {
+		if chunk[i].result.Status == "" {
+			pending = append(pending, &chunk[i])
+			incoming = append(incoming, chunk[i].incoming)
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	outputs, err := storage.LoadURLs(ctx, incoming, baseURL)
+	if err == nil {
+		for i, item := range pending {
+			item.result.Status = ImportCreated
+			item.result.ShortURL = outputs[i].ShortURL
+		}
+		return nil
+	}
+
+	var conflictErr *helpers.ConflictError
+	if !errors.As(err, &conflictErr) && !errors.Is(err, helpers.ErrAliasExists) {
+		return fmt.Errorf("unable to save import chunk: %w", err)
+	}
+
+	// Пакет с конфликтом не сохранен, строки сохраняются по одной
+	for _, item := range pending {
+		if err := saveImportItem(ctx, storage, item, baseURL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveImportItem сохранение одной строки импорта.
+func saveImportItem(ctx context.Context, storage storages.URLStorage, item *importItem, baseURL string) error {
+	opts := storages.SaveOptions{ExpiresAt: item.incoming.ExpiresAt, Alias: item.incoming.Alias}
+	short, err := storage.SaveURLWithOptions(ctx, item.incoming.OriginalURL, opts)
+
+	var conflictErr *helpers.ConflictError
+	switch {
+	case err == nil:
+		item.result.Status = ImportCreated
+	case errors.As(err, &conflictErr):
+		item.result.Status = ImportConflict
+		item.result.Error = "original url already shortened"
+		short = conflictErr.ShortURL
+	case errors.Is(err, helpers.ErrAliasExists):
+		item.result.Status = ImportConflict
+		item.result.Error = "alias already exists"
+	case errors.Is(err, helpers.ErrAliasInvalid), errors.Is(err, helpers.ErrExpiryInvalid):
+		item.result.Status = ImportInvalid
+		item.result.Error = err.Error()
+	default:
+		return fmt.Errorf("unable to save import row %d: %w", item.result.Row, err)
+	}
+
+	if short != "" {
+		shortURL, err := url.JoinPath(baseURL, "/", short)
+		if err != nil {
+			return fmt.Errorf("unable to create path: %w", err)
+		}
+		item.result.ShortURL = shortURL
+	}
+
+	return nil
+}
+
+// importReport отчет импорта, передаваемый клиенту по частям в виде {"rows":[...],"summary":{...}}.
+type importReport struct {
+	res     http.ResponseWriter
+	logger  *zap.SugaredLogger
+	enc     *json.Encoder
+	summary ImportSummary
+	rows    int
+	failed  bool
+}
+
+// start запись заголовков и начала отчета при первой записи.
+func (r *importReport) start() {
+	if r.enc != nil {
+		return
+	}
+
+	setHeader(r.res, "application/json")
+	r.res.WriteHeader(http.StatusOK)
+	r.enc = json.NewEncoder(r.res)
+	r.writeRaw(`{"rows":[`)
+}
+
+// write запись результатов строк пакета.
+func (r *importReport) write(chunk []importItem) {
+	for i := range chunk {
+		result := chunk[i].result
+		switch result.Status {
+		case ImportCreated:
+			r.summary.Created++
+		case ImportConflict:
+			r.summary.Conflict++
+		default:
+			r.summary.Invalid++
+		}
+
+		r.start()
+		if r.rows > 0 {
+			r.writeRaw(",")
+		}
+		r.rows++
+		if err := r.enc.Encode(result); err != nil && !r.failed {
+			r.failed = true
+			r.logger.Errorf("failed to write import report: %v", err)
+		}
+	}
+}
+
+// finish запись итога и окончания отчета.
+func (r *importReport) finish() {
+	r.start()
+	r.writeRaw(`],"summary":`)
+	if err := r.enc.Encode(r.summary); err != nil && !r.failed {
+		r.failed = true
+		r.logger.Errorf("failed to write import report: %v", err)
+	}
+	r.writeRaw("}")
+}
+
+// abort прерывание импорта: до начала отчета клиент получает ошибку со статусом status,
+// после - итог с причиной прерывания.
+func (r *importReport) abort(status int, err error) {
+	r.logger.Errorf("import aborted: %v", err)
+
+	if r.enc == nil {
+		text := ""
+		if status < http.StatusInternalServerError {
+			text = err.Error()
+		}
+		http.Error(r.res, text, status)
+		return
+	}
+
+	r.summary.Error = "import aborted"
+	if status < http.StatusInternalServerError {
+		r.summary.Error = err.Error()
+	}
+	r.finish()
+}
+
+// writeRaw запись части отчета без кодирования.
+func (r *importReport) writeRaw(s string) {
+	if _, err := io.WriteString(r.res, s); err != nil && !r.failed {
+		r.failed = true
+		r.logger.Errorf("failed to write import report: %v", err)
+	}
+}
+
+// newImportReader выбор формата по параметру format или заголовку Content-Type.
+func newImportReader(req *http.Request) (importReader, error) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			format = importFormatCSV
+		case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+			format = importFormatJSONL
+		}
+	}
+
+	switch format {
+	case importFormatCSV:
+		return newCSVImportReader(req.Body), nil
+	case importFormatJSONL:
+		return newJSONLImportReader(req.Body), nil
+	default:
+		return nil, errors.New("import format must be csv or jsonl")
+	}
+}
+
+// csvImportReader чтение строк CSV.
+//
+// Если первая строка содержит колонку original_url, она считается заголовком и задает порядок
+// колонок, иначе колонки идут в порядке original_url, alias, expires_at.
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+	started bool
+}
+
+func newCSVImportReader(r io.Reader) *csvImportReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	reader.TrimLeadingSpace = true
+
+	return &csvImportReader{reader: reader, columns: columnIndexes(importColumns)}
+}
+
+// Next следующая строка CSV.
+func (r *csvImportReader) Next() (ImportRow, error) {
+	record, err := r.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return ImportRow{}, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return ImportRow{}, &importRowError{err: parseErr.Err}
+	}
+	if err != nil {
+		return ImportRow{}, fmt.Errorf("unable to read csv: %w", err)
+	}
+
+	if !r.started {
+		r.started = true
+		// Выгрузки других сервисов часто начинаются с BOM
+		record[0] = strings.TrimPrefix(record[0], "\ufeff")
+		if slices.ContainsFunc(record, func(name string) bool { return strings.TrimSpace(name) == importColumns[0] }) {
+			if err := r.readHeader(record); err != nil {
+				return ImportRow{}, err
+			}
+			return r.Next()
+		}
+	}
+
+	if len(record) > len(r.columns) {
+		return ImportRow{}, &importRowError{err: errors.New("too many fields")}
+	}
+
+	field := func(name string) string {
+		if i, ok := r.columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	row := ImportRow{OriginalURL: field("original_url"), Alias: field("alias")}
+	if value := field("expires_at"); value != "" {
+		expiresAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return ImportRow{}, &importRowError{err: errors.New("expires_at must be in RFC 3339 format")}
+		}
+		row.ExpiresAt = &expiresAt
+	}
+
+	return row, nil
+}
+
+// readHeader порядок колонок из строки заголовка.
+func (r *csvImportReader) readHeader(header []string) error {
+	names := make([]string, 0, len(header))
+	for _, name := range header {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(importColumns, name) {
+			return fmt.Errorf("unknown csv column %q", name)
+		}
+		names = append(names, name)
+	}
+
+	r.columns = columnIndexes(names)
+	if len(r.columns) != len(names) {
+		return errors.New("duplicate csv columns")
+	}
+
+	return nil
+}
+
+// columnIndexes номера колонок по именам.
+func columnIndexes(names []string) map[string]int {
+	columns := make(map[string]int, len(names))
+	for i, name := range names {
+		columns[name] = i
+	}
+	return columns
+}
+
+// jsonlImportReader чтение строк JSON Lines, пустые строки пропускаются.
+type jsonlImportReader struct {
+	scanner *bufio.Scanner
+}
+
+func newJSONLImportReader(r io.Reader) *jsonlImportReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), importMaxLineSize)
+
+	return &jsonlImportReader{scanner: scanner}
+}
+
+// Next следующая строка JSON Lines.
+func (r *jsonlImportReader) Next() (ImportRow, error) {
+	for r.scanner.Scan() {
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var row ImportRow
+		if err := json.Unmarshal(line, &row); err != nil {
+			return ImportRow{}, &importRowError{err: errors.New("invalid json")}
+		}
+		row.OriginalURL = strings.TrimSpace(row.OriginalURL)
+		row.Alias = strings.TrimSpace(row.Alias)
+
+		return row, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return ImportRow{}, fmt.Errorf("unable to read jsonl: %w", err)
+	}
+
+	return ImportRow{}, io.EOF
+}
@@ -2,5 +2,9 @@ package helpers
 
 type key int
 
-// UserID индетифиткатор пользователя.
-const UserID key = iota
+const (
+	// UserID индетифиткатор пользователя.
+	UserID key = iota
+	// APIKeyID идентификатор API ключа, которым аутентифицирован запрос.
+	APIKeyID
+)
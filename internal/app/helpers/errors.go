@@ -8,6 +8,30 @@ import (
 // ErrConflict ошибка конфликта записей.
 var ErrConflict = errors.New("status 409 conflict")
 
+// ErrAliasExists ошибка занятого пользовательского алиаса.
+var ErrAliasExists = errors.New("alias already exists")
+
+// ErrAliasInvalid ошибка недопустимого пользовательского алиаса.
+var ErrAliasInvalid = errors.New("alias is invalid")
+
+// ErrExpired ошибка истекшего срока действия короткой ссылки.
+var ErrExpired = errors.New("short url is expired")
+
+// ErrExpiryInvalid ошибка недопустимого срока действия короткой ссылки.
+var ErrExpiryInvalid = errors.New("expiry is invalid")
+
+// ErrNotFound ошибка отсутствия короткой ссылки в хранилище.
+var ErrNotFound = errors.New("short url not found")
+
+// ErrForbidden ошибка недостаточного уровня доступа к короткой ссылке.
+var ErrForbidden = errors.New("access to short url is forbidden")
+
+// ErrShareInvalid ошибка недопустимой выдачи доступа к короткой ссылке.
+var ErrShareInvalid = errors.New("share is invalid")
+
+// ErrRestoreConflict ошибка восстановления ссылки, конфликтующей с действующей ссылкой.
+var ErrRestoreConflict = errors.New("short url conflicts with an active one")
+
 // ErrIsDeleted оишбка удаления короткой ссылки.
 var ErrIsDeleted = "Short url is deleted"
 
@@ -26,3 +50,47 @@ func (ce *ConflictError) Error() string {
 func NewIsDeletedErr(err string) error {
 	return fmt.Errorf("%s: %s", err, ErrIsDeleted)
 }
+
+// AliasError структура ошибки пользовательского алиаса.
+type AliasError struct {
+	Err   error
+	Alias string
+}
+
+// Error форматирование вывода ошибки алиаса.
+func (ae *AliasError) Error() string {
+	return fmt.Sprintf("Alias Error. Alias: %s, Error: %v", ae.Alias, ae.Err)
+}
+
+// Unwrap возвращает причину ошибки алиаса.
+func (ae *AliasError) Unwrap() error {
+	return ae.Err
+}
+
+// Поля, по которым восстанавливаемая ссылка конфликтует с действующей.
+const (
+	// RestoreConflictOriginal оригинальный URL уже сокращен другой действующей ссылкой.
+	RestoreConflictOriginal = "original"
+	// RestoreConflictShort короткая ссылка занята другой действующей записью.
+	RestoreConflictShort = "short"
+)
+
+// RestoreConflictError структура ошибки восстановления мягко удаленной ссылки.
+type RestoreConflictError struct {
+	// ShortURL - восстанавливаемая ссылка
+	ShortURL string
+	// Existing - действующая ссылка, мешающая восстановлению
+	Existing string
+	// Field - RestoreConflictOriginal или RestoreConflictShort
+	Field string
+}
+
+// Error форматирование вывода ошибки восстановления.
+func (re *RestoreConflictError) Error() string {
+	return fmt.Sprintf("short url %s can not be restored: %s conflicts with %s", re.ShortURL, re.Field, re.Existing)
+}
+
+// Unwrap возвращает причину ошибки восстановления.
+func (re *RestoreConflictError) Unwrap() error {
+	return ErrRestoreConflict
+}
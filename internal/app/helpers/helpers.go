@@ -1,14 +1,26 @@
 package helpers
 
 import (
+	"fmt"
 	"math/rand"
+	"slices"
+	"time"
 )
 
 // LenString длина генерируемой случайной строки.
 const LenString = 7
 
+// AliasMinLen минимальная длина пользовательского алиаса.
+const AliasMinLen = 3
+
+// AliasMaxLen максимальная длина пользовательского алиаса.
+const AliasMaxLen = 64
+
 var charset = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
+// reservedAliases алиасы, совпадающие с маршрутами приложения.
+var reservedAliases = []string{"api", "metrics", "ping"}
+
 // RandomString функция генерации случайно строки длиной n.
 func RandomString(n int) string {
 	b := make([]byte, n)
@@ -17,3 +29,52 @@ func RandomString(n int) string {
 	}
 	return string(b)
 }
+
+// ValidateAlias проверка пользовательского алиаса на длину и допустимые символы
+//
+// Аргументы
+//   - alias: пользовательский алиас
+//
+// Возвращает
+//   - error: ошибка *AliasError с причиной ErrAliasInvalid, если алиас недопустим
+func ValidateAlias(alias string) error {
+	if len(alias) < AliasMinLen || len(alias) > AliasMaxLen || slices.Contains(reservedAliases, alias) {
+		return &AliasError{Alias: alias, Err: ErrAliasInvalid}
+	}
+
+	for _, c := range alias {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && !isDigit && c != '-' && c != '_' {
+			return &AliasError{Alias: alias, Err: ErrAliasInvalid}
+		}
+	}
+
+	return nil
+}
+
+// ResolveExpiry вычисление момента истечения срока действия ссылки
+//
+// Аргументы
+//   - expiresAt: абсолютный момент истечения, может быть nil
+//   - ttlSeconds: время жизни ссылки в секундах, 0 - не задано
+//   - now: текущее время
+//
+// Возвращает
+//   - *time.Time: момент истечения, nil - ссылка бессрочная
+//   - error: ошибка с причиной ErrExpiryInvalid, если параметры заданы некорректно
+func ResolveExpiry(expiresAt *time.Time, ttlSeconds int64, now time.Time) (*time.Time, error) {
+	switch {
+	case expiresAt != nil && ttlSeconds != 0:
+		return nil, fmt.Errorf("expires_at and ttl_seconds are mutually exclusive: %w", ErrExpiryInvalid)
+	case ttlSeconds < 0:
+		return nil, fmt.Errorf("ttl_seconds must be positive: %w", ErrExpiryInvalid)
+	case ttlSeconds > 0:
+		result := now.Add(time.Duration(ttlSeconds) * time.Second)
+		return &result, nil
+	case expiresAt != nil && !expiresAt.After(now):
+		return nil, fmt.Errorf("expires_at must be in the future: %w", ErrExpiryInvalid)
+	default:
+		return expiresAt, nil
+	}
+}
@@ -2,6 +2,14 @@ package helpers
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func ExampleRandomString() {
@@ -16,3 +24,104 @@ func ExampleRandomString() {
 	// 7
 	// t45dfsw
 }
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   string
+		isValid bool
+	}{
+		{name: "Valid alias", alias: "q3-report", isValid: true},
+		{name: "Underscore and digits", alias: "release_2024", isValid: true},
+		{name: "Too short", alias: "ab", isValid: false},
+		{name: "Too long", alias: strings.Repeat("a", AliasMaxLen+1), isValid: false},
+		{name: "Forbidden characters", alias: "q3/report", isValid: false},
+		{name: "Non ASCII", alias: "отчет", isValid: false},
+		{name: "Reserved route", alias: "ping", isValid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAlias(tt.alias)
+			if tt.isValid {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrAliasInvalid)
+		})
+	}
+}
+
+func TestResolveExpiry(t *testing.T) {
+	now := time.Date(2024, time.July, 1, 12, 0, 0, 0, time.UTC)
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+
+	t.Run("No expiry", func(t *testing.T) {
+		result, err := ResolveExpiry(nil, 0, now)
+		assert.NoError(t, err)
+		assert.Nil(t, result)
+	})
+
+	t.Run("Absolute expiry", func(t *testing.T) {
+		result, err := ResolveExpiry(&future, 0, now)
+		assert.NoError(t, err)
+		assert.Equal(t, future, *result)
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		result, err := ResolveExpiry(nil, 60, now)
+		assert.NoError(t, err)
+		assert.Equal(t, now.Add(time.Minute), *result)
+	})
+
+	t.Run("Expiry in the past", func(t *testing.T) {
+		_, err := ResolveExpiry(&past, 0, now)
+		assert.ErrorIs(t, err, ErrExpiryInvalid)
+	})
+
+	t.Run("Both fields", func(t *testing.T) {
+		_, err := ResolveExpiry(&future, 60, now)
+		assert.ErrorIs(t, err, ErrExpiryInvalid)
+	})
+}
+
+func TestForwardedIP(t *testing.T) {
+	proxies, err := ParseSubnets("10.0.0.0/8, 172.16.0.0/12")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		forwarded  string
+		expected   string
+	}{
+		{name: "Direct client", remoteAddr: "203.0.113.1:1234", expected: "203.0.113.1"},
+		{name: "Untrusted headers", remoteAddr: "203.0.113.1:1234", realIP: "198.51.100.1",
+			forwarded: "198.51.100.2", expected: "203.0.113.1"},
+		{name: "Trusted X-Real-IP", remoteAddr: "10.0.0.1:1234", realIP: "198.51.100.1", expected: "198.51.100.1"},
+		{name: "Trusted X-Forwarded-For", remoteAddr: "10.0.0.1:1234",
+			forwarded: "192.0.2.1, 198.51.100.2, 172.16.0.1", expected: "198.51.100.2"},
+		{name: "Only proxies", remoteAddr: "10.0.0.1:1234", forwarded: "172.16.0.1", expected: "172.16.0.1"},
+		{name: "Invalid header", remoteAddr: "10.0.0.1:1234", forwarded: "unknown", expected: "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			assert.Equal(t, tt.expected, ForwardedIP(req, proxies))
+		})
+	}
+
+	_, err = ParseSubnets("10.0.0.0/8,invalid")
+	assert.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package helpers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP получение IP адреса клиента из адреса соединения.
+//
+// Адрес клиента за доверенным прокси подставляется в адрес соединения middlewares.RealIPMiddleware.
+func ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+// ForwardedIP получение IP адреса клиента с учетом заголовков прокси
+//
+// Заголовки X-Real-IP и X-Forwarded-For учитываются, только если соединение установлено доверенным
+// прокси. Из X-Forwarded-For выбирается последний адрес, не принадлежащий доверенным прокси:
+// адреса левее него мог подставить сам клиент.
+//
+// Аргументы
+//   - req: http запрос
+//   - trustedProxies: подсети доверенных прокси
+//
+// Возвращает
+//   - string: IP адрес клиента
+func ForwardedIP(req *http.Request, trustedProxies []*net.IPNet) string {
+	ip := ClientIP(req)
+	if !containsIP(trustedProxies, ip) {
+		return ip
+	}
+
+	if realIP := strings.TrimSpace(req.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	hops := strings.Split(req.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(trustedProxies, hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// ParseSubnets разбор списка подсетей в формате CIDR, разделенных запятыми
+//
+// Аргументы
+//   - list: список подсетей, пустая строка - пустой список
+//
+// Возвращает
+//   - []*net.IPNet: подсети
+//   - error: ошибка разбора
+func ParseSubnets(list string) ([]*net.IPNet, error) {
+	var subnets []*net.IPNet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		_, subnet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet %q: %w", item, err)
+		}
+		subnets = append(subnets, subnet)
+	}
+
+	return subnets, nil
+}
+
+// containsIP проверка принадлежности адреса одной из подсетей.
+func containsIP(subnets []*net.IPNet, value string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,208 @@
+// Package metrics метрики приложения в формате Prometheus.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/Erlast/short-url.git/internal/app/analytics"
+	"github.com/Erlast/short-url.git/internal/app/deletion"
+	"github.com/Erlast/short-url.git/internal/app/storages"
+)
+
+const namespace = "shortener" // namespace префикс имен метрик приложения
+
+// Metrics метрики http запросов и операций хранилища.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	storageDuration *prometheus.HistogramVec
+}
+
+// New создание и регистрация метрик приложения
+//
+// Аргументы
+//   - registry: реестр, в котором регистрируются метрики и из которого они отдаются в Handler
+//
+// Возвращает
+//   - *Metrics: метрики приложения
+func New(registry *prometheus.Registry) *Metrics {
+	m := &Metrics{
+		registry: registry,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Количество обработанных http запросов.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Длительность обработки http запросов.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "operation_duration_seconds",
+			Help:      "Длительность операций хранилища ссылок.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "result"}),
+	}
+
+	registry.MustRegister(m.requests, m.requestDuration, m.storageDuration)
+
+	return m
+}
+
+// ObserveRequest учет обработанного http запроса.
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(method, route, code).Inc()
+	m.requestDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// ObserveOperation учет операции хранилища, результат операции - ok или error.
+func (m *Metrics) ObserveOperation(operation string, err error, duration time.Duration) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.storageDuration.WithLabelValues(operation, result).Observe(duration.Seconds())
+}
+
+// RegisterPool регистрация метрик пула соединений postgres.
+func (m *Metrics) RegisterPool(pool *pgxpool.Pool) error {
+	if err := m.registry.Register(newPoolCollector(pool)); err != nil {
+		return fmt.Errorf("unable to register pool collector: %w", err)
+	}
+
+	return nil
+}
+
+// CacheStatsSource источник счетчиков кэша коротких ссылок.
+type CacheStatsSource interface {
+	CacheStats() storages.CacheStats
+}
+
+// RegisterCache регистрация счетчиков попаданий и промахов кэша коротких ссылок.
+func (m *Metrics) RegisterCache(cache CacheStatsSource) error {
+	collectors := []prometheus.Collector{
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "hits_total",
+			Help:      "Количество попаданий в кэш коротких ссылок.",
+		}, func() float64 { return float64(cache.CacheStats().Hits) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "misses_total",
+			Help:      "Количество промахов кэша коротких ссылок.",
+		}, func() float64 { return float64(cache.CacheStats().Misses) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "entries",
+			Help:      "Количество записей в кэше коротких ссылок.",
+		}, func() float64 { return float64(cache.CacheStats().Size) }),
+	}
+
+	return m.register("cache", collectors)
+}
+
+// ClickQueueStatsSource источник метрик очереди переходов.
+type ClickQueueStatsSource interface {
+	Stats() analytics.QueueStats
+}
+
+// RegisterClickQueue регистрация метрик заполненности очереди переходов.
+func (m *Metrics) RegisterClickQueue(queue ClickQueueStatsSource) error {
+	const subsystem = "click_queue"
+
+	collectors := []prometheus.Collector{
+		newCounterFunc(subsystem, "enqueued_total", "Количество переходов, поставленных в очередь.",
+			func() uint64 { return queue.Stats().Enqueued }),
+		newCounterFunc(subsystem, "dropped_total", "Количество переходов, отброшенных при переполнении очереди.",
+			func() uint64 { return queue.Stats().Dropped }),
+		newCounterFunc(subsystem, "flushed_total", "Количество переходов, сохраненных в хранилище.",
+			func() uint64 { return queue.Stats().Flushed }),
+		newCounterFunc(subsystem, "failed_total", "Количество переходов, не сохраненных из-за ошибки хранилища.",
+			func() uint64 { return queue.Stats().Failed }),
+		newGaugeFunc(subsystem, "pending", "Количество переходов, ожидающих сохранения.",
+			func() int { return queue.Stats().Pending }),
+		newGaugeFunc(subsystem, "capacity", "Размер очереди переходов.",
+			func() int { return queue.Stats().Capacity }),
+	}
+
+	return m.register(subsystem, collectors)
+}
+
+// DeletionQueueStatsSource источник метрик очереди удаления.
+type DeletionQueueStatsSource interface {
+	Stats() deletion.Stats
+}
+
+// RegisterDeletionQueue регистрация метрик очереди удаления ссылок.
+func (m *Metrics) RegisterDeletionQueue(queue DeletionQueueStatsSource) error {
+	const subsystem = "deletion_queue"
+
+	collectors := []prometheus.Collector{
+		newCounterFunc(subsystem, "enqueued_total", "Количество ссылок, поставленных в очередь на удаление.",
+			func() uint64 { return queue.Stats().Enqueued }),
+		newCounterFunc(subsystem, "deleted_total", "Количество удаленных ссылок.",
+			func() uint64 { return queue.Stats().Deleted }),
+		newCounterFunc(subsystem, "retried_total", "Количество повторов удаления пакетов.",
+			func() uint64 { return queue.Stats().Retried }),
+		newCounterFunc(subsystem, "failed_total", "Количество ссылок, не удаленных после всех повторов.",
+			func() uint64 { return queue.Stats().Failed }),
+		newGaugeFunc(subsystem, "pending", "Количество ссылок, ожидающих удаления.",
+			func() int { return queue.Stats().Pending }),
+	}
+
+	return m.register(subsystem, collectors)
+}
+
+// register регистрация группы метрик, name - название группы в тексте ошибки.
+func (m *Metrics) register(name string, collectors []prometheus.Collector) error {
+	for _, collector := range collectors {
+		if err := m.registry.Register(collector); err != nil {
+			return fmt.Errorf("unable to register %s collector: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// newCounterFunc счетчик, значение которого читается при сборе метрик.
+func newCounterFunc(subsystem, name, help string, value func() uint64) prometheus.CounterFunc {
+	return prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, func() float64 { return float64(value()) })
+}
+
+// newGaugeFunc измеритель, значение которого читается при сборе метрик.
+func newGaugeFunc(subsystem, name, help string, value func() int) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, func() float64 { return float64(value()) })
+}
+
+// Handler http обработчик, отдающий метрики реестра.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
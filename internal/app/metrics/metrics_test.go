@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Erlast/short-url.git/internal/app/analytics"
+	"github.com/Erlast/short-url.git/internal/app/deletion"
+	"github.com/Erlast/short-url.git/internal/app/storages"
+)
+
+func TestObserveRequest(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+
+	m.ObserveRequest(http.MethodGet, "/{id}", http.StatusTemporaryRedirect, 10*time.Millisecond)
+	m.ObserveRequest(http.MethodGet, "/{id}", http.StatusTemporaryRedirect, 20*time.Millisecond)
+	m.ObserveRequest(http.MethodGet, "/{id}", http.StatusNotFound, time.Millisecond)
+
+	assert.InDelta(t, 2, testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, "/{id}", "307")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, "/{id}", "404")), 0)
+	assert.Equal(t, 2, testutil.CollectAndCount(m.requestDuration))
+}
+
+func TestObserveOperation(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+
+	m.ObserveOperation("get_by_id", nil, time.Millisecond)
+	m.ObserveOperation("get_by_id", errors.New("not found"), time.Millisecond)
+	m.ObserveOperation("save_url", nil, time.Millisecond)
+
+	assert.Equal(t, 3, testutil.CollectAndCount(m.storageDuration))
+}
+
+func TestHandler(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+	m.ObserveRequest(http.MethodPost, "/api/shorten", http.StatusCreated, time.Millisecond)
+	m.ObserveOperation("save_url", nil, time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.True(t, strings.Contains(body,
+		`shortener_http_requests_total{method="POST",route="/api/shorten",status="201"} 1`))
+	assert.True(t, strings.Contains(body,
+		`shortener_storage_operation_duration_seconds_count{operation="save_url",result="ok"} 1`))
+}
+
+type cacheStats struct {
+	stats storages.CacheStats
+}
+
+func (c *cacheStats) CacheStats() storages.CacheStats {
+	return c.stats
+}
+
+func TestRegisterCache(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := New(registry)
+	cache := &cacheStats{stats: storages.CacheStats{Hits: 95, Misses: 5, Size: 3}}
+
+	assert.NoError(t, m.RegisterCache(cache))
+	assert.Error(t, m.RegisterCache(cache))
+
+	expected := `
+# HELP shortener_cache_hits_total Количество попаданий в кэш коротких ссылок.
+# TYPE shortener_cache_hits_total counter
+shortener_cache_hits_total 95
+# HELP shortener_cache_misses_total Количество промахов кэша коротких ссылок.
+# TYPE shortener_cache_misses_total counter
+shortener_cache_misses_total 5
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"shortener_cache_hits_total", "shortener_cache_misses_total"))
+}
+
+type clickQueueStats struct {
+	stats analytics.QueueStats
+}
+
+func (s *clickQueueStats) Stats() analytics.QueueStats {
+	return s.stats
+}
+
+type deletionQueueStats struct {
+	stats deletion.Stats
+}
+
+func (s *deletionQueueStats) Stats() deletion.Stats {
+	return s.stats
+}
+
+func TestRegisterQueues(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := New(registry)
+	clicks := &clickQueueStats{stats: analytics.QueueStats{Enqueued: 10, Dropped: 2, Pending: 3, Capacity: 100}}
+	deletions := &deletionQueueStats{stats: deletion.Stats{Enqueued: 7, Retried: 1, Failed: 4, Pending: 2}}
+
+	assert.NoError(t, m.RegisterClickQueue(clicks))
+	assert.Error(t, m.RegisterClickQueue(clicks))
+	assert.NoError(t, m.RegisterDeletionQueue(deletions))
+
+	expected := `
+# HELP shortener_click_queue_dropped_total Количество переходов, отброшенных при переполнении очереди.
+# TYPE shortener_click_queue_dropped_total counter
+shortener_click_queue_dropped_total 2
+# HELP shortener_click_queue_pending Количество переходов, ожидающих сохранения.
+# TYPE shortener_click_queue_pending gauge
+shortener_click_queue_pending 3
+# HELP shortener_deletion_queue_failed_total Количество ссылок, не удаленных после всех повторов.
+# TYPE shortener_deletion_queue_failed_total counter
+shortener_deletion_queue_failed_total 4
+# HELP shortener_deletion_queue_pending Количество ссылок, ожидающих удаления.
+# TYPE shortener_deletion_queue_pending gauge
+shortener_deletion_queue_pending 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"shortener_click_queue_dropped_total", "shortener_click_queue_pending",
+		"shortener_deletion_queue_failed_total", "shortener_deletion_queue_pending"))
+}
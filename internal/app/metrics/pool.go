@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector сборщик состояния пула соединений postgres, значения читаются из pgxpool.Stat при каждом запросе метрик.
+type poolCollector struct {
+	pool        *pgxpool.Pool
+	connections *prometheus.Desc
+	maxConns    *prometheus.Desc
+	acquires    *prometheus.Desc
+	waitSeconds *prometheus.Desc
+}
+
+func newPoolCollector(pool *pgxpool.Pool) *poolCollector {
+	return &poolCollector{
+		pool: pool,
+		connections: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "db_pool", "connections"),
+			"Количество соединений пула по состоянию.",
+			[]string{"state"}, nil,
+		),
+		maxConns: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "db_pool", "max_connections"),
+			"Максимальный размер пула соединений.",
+			nil, nil,
+		),
+		acquires: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "db_pool", "acquires_total"),
+			"Количество полученных из пула соединений.",
+			nil, nil,
+		),
+		waitSeconds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "db_pool", "acquire_wait_seconds_total"),
+			"Суммарное время ожидания свободного соединения.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe описание метрик пула.
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.connections
+	ch <- c.maxConns
+	ch <- c.acquires
+	ch <- c.waitSeconds
+}
+
+// Collect снятие текущего состояния пула.
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+
+	ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(stat.AcquiredConns()), "acquired")
+	ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(stat.IdleConns()), "idle")
+	ch <- prometheus.MustNewConstMetric(
+		c.connections, prometheus.GaugeValue, float64(stat.ConstructingConns()), "constructing",
+	)
+	ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(stat.TotalConns()), "total")
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.waitSeconds, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
@@ -0,0 +1,74 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/accounts"
+	"github.com/Erlast/short-url.git/internal/app/helpers"
+)
+
+// APIKeyHeader заголовок с API ключом.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyMiddleware функция аутентификации запроса по API ключу.
+//
+// Ключ передается в заголовке X-API-Key или в заголовке Authorization в формате "Bearer <ключ>".
+// Запрос без ключа передается дальше без изменений, запрос с неизвестным или отозванным ключом
+// отклоняется. Идентификатор владельца ключа записывается в контекст, поэтому AuthMiddleware
+// не выдает такому запросу jwt токен.
+func APIKeyMiddleware(h http.Handler, logger *zap.SugaredLogger, store accounts.Store) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		secret := apiKeyFromRequest(req)
+		if secret == "" {
+			h.ServeHTTP(resp, req)
+			return
+		}
+
+		key, err := accounts.ResolveAPIKey(req.Context(), store, secret)
+		if err != nil {
+			if errors.Is(err, accounts.ErrInvalidAPIKey) {
+				http.Error(resp, accessDeniedErr, http.StatusUnauthorized)
+				return
+			}
+			logger.Errorf("failed to resolve api key: %v", err)
+			http.Error(resp, "", http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(req.Context(), helpers.UserID, key.UserID)
+		ctx = context.WithValue(ctx, helpers.APIKeyID, key.ID)
+
+		h.ServeHTTP(resp, req.WithContext(ctx))
+	})
+}
+
+// apiKeyFromRequest API ключ из заголовков запроса или пустая строка.
+func apiKeyFromRequest(req *http.Request) string {
+	if secret := req.Header.Get(APIKeyHeader); secret != "" {
+		return secret
+	}
+
+	return APIKeyFromBearer(req.Header.Get("Authorization"))
+}
+
+// APIKeyFromBearer API ключ из значения заголовка Authorization в формате "Bearer <ключ>" или пустая строка,
+// если заголовок содержит не API ключ, например jwt токен.
+func APIKeyFromBearer(authorization string) string {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if ok && accounts.IsAPIKey(token) {
+		return token
+	}
+
+	return ""
+}
+
+// authenticatedByAPIKey проверка, что запрос аутентифицирован APIKeyMiddleware.
+func authenticatedByAPIKey(req *http.Request) bool {
+	_, ok := req.Context().Value(helpers.APIKeyID).(string)
+	return ok
+}
@@ -16,30 +16,46 @@ import (
 )
 
 // Claims содержимое jwt токена.
+//
+// Account - токен выдан учетной записи, без него пользователь анонимный.
 type Claims struct {
 	jwt.RegisteredClaims
-	UserID string
+	UserID  string
+	Account bool `json:",omitempty"`
 }
 
 const tokenExp = time.Hour * 3          // tokenExp время жизни токена
 const accessDeniedErr = "Access denied" // accessDeniedErr шаблон ошибки Доступ запрещен
 
 // AuthMiddleware функция установки jwt токенов в заголовок http запроса и в cookie, если их нет.
+//
+// Запросы, аутентифицированные API ключом, передаются дальше без токенов.
 func AuthMiddleware(h http.Handler, logger *zap.SugaredLogger, cfg *config.Cfg) http.Handler {
 	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if authenticatedByAPIKey(req) {
+			h.ServeHTTP(resp, req)
+			return
+		}
+
 		token, err := req.Cookie("token")
 		if err != nil {
 			if errors.Is(err, http.ErrNoCookie) {
-				newToken, err := buildJWTString(cfg)
+				newToken, err := BuildJWTString(cfg)
 				if err != nil {
 					logger.Errorln("Failed to build token", err)
 					http.Error(resp, "", http.StatusInternalServerError)
 					return
 				}
 				resp.Header().Set("Authorization", newToken)
-				http.SetCookie(resp, &http.Cookie{Name: "token", Value: newToken})
-
-				userID := getUserID(newToken, logger, cfg)
+				http.SetCookie(resp, &http.Cookie{
+					Name:     "token",
+					Value:    newToken,
+					Path:     "/",
+					HttpOnly: true,
+					Secure:   cfg.EnableHTTPS,
+				})
+
+				userID := GetUserID(newToken, logger, cfg)
 				if userID == "" {
 					http.Error(resp, accessDeniedErr, http.StatusUnauthorized)
 					return
@@ -57,7 +73,7 @@ func AuthMiddleware(h http.Handler, logger *zap.SugaredLogger, cfg *config.Cfg)
 			return
 		}
 
-		userID := getUserID(token.Value, logger, cfg)
+		userID := GetUserID(token.Value, logger, cfg)
 		if userID == "" {
 			http.Error(resp, accessDeniedErr, http.StatusUnauthorized)
 			return
@@ -72,8 +88,15 @@ func AuthMiddleware(h http.Handler, logger *zap.SugaredLogger, cfg *config.Cfg)
 }
 
 // CheckAuthMiddleware функция проверки jwt токенов из заголовков http запроса.
+//
+// Запросы, аутентифицированные API ключом, токен не проверяют.
 func CheckAuthMiddleware(h http.Handler, logger *zap.SugaredLogger) http.Handler {
 	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if authenticatedByAPIKey(req) {
+			h.ServeHTTP(resp, req)
+			return
+		}
+
 		authorization := req.Header.Get("Authorization")
 		if authorization == "" {
 			http.Error(resp, accessDeniedErr, http.StatusUnauthorized)
@@ -95,13 +118,20 @@ func CheckAuthMiddleware(h http.Handler, logger *zap.SugaredLogger) http.Handler
 	})
 }
 
-func buildJWTString(cfg *config.Cfg) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
-		},
-		UserID: uuid.NewString(),
-	})
+// BuildJWTString функция создания подписанного jwt токена для нового пользователя.
+func BuildJWTString(cfg *config.Cfg) (string, error) {
+	return buildJWTString(cfg, Claims{UserID: uuid.NewString()})
+}
+
+// BuildAccountJWTString функция создания подписанного jwt токена для учетной записи.
+func BuildAccountJWTString(cfg *config.Cfg, userID string) (string, error) {
+	return buildJWTString(cfg, Claims{UserID: userID, Account: true})
+}
+
+// buildJWTString подпись jwt токена со сроком действия tokenExp.
+func buildJWTString(cfg *config.Cfg, claims Claims) (string, error) {
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(tokenExp))
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString([]byte(cfg.SecretKey))
 	if err != nil {
@@ -111,15 +141,11 @@ func buildJWTString(cfg *config.Cfg) (string, error) {
 	return tokenString, nil
 }
 
-func getUserID(tokenString string, logger *zap.SugaredLogger, cfg *config.Cfg) string {
+// GetUserID функция получения идентификатора пользователя из jwt токена.
+// Возвращает пустую строку, если токен невалиден.
+func GetUserID(tokenString string, logger *zap.SugaredLogger, cfg *config.Cfg) string {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims,
-		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-			}
-			return []byte(cfg.SecretKey), nil
-		})
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc(cfg))
 	if err != nil {
 		return ""
 	}
@@ -131,3 +157,29 @@ func getUserID(tokenString string, logger *zap.SugaredLogger, cfg *config.Cfg) s
 
 	return claims.UserID
 }
+
+// GetAnonymousUserID функция получения идентификатора анонимного пользователя из jwt токена.
+//
+// Срок действия токена не проверяется: анонимный пользователь не может продлить токен, а его ссылки
+// должны оставаться доступными для переноса в учетную запись. Проверяется только подпись.
+// Возвращает пустую строку, если подпись неверна или токен выдан учетной записи.
+func GetAnonymousUserID(tokenString string, cfg *config.Cfg) string {
+	claims := &Claims{}
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	token, err := parser.ParseWithClaims(tokenString, claims, keyFunc(cfg))
+	if err != nil || !token.Valid || claims.Account {
+		return ""
+	}
+
+	return claims.UserID
+}
+
+// keyFunc ключ проверки подписи jwt токена, принимаются только токены с подписью HMAC.
+func keyFunc(cfg *config.Cfg) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return []byte(cfg.SecretKey), nil
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
@@ -46,8 +47,13 @@ func (r *loggingResponseWriter) Header() http.Header {
 	return r.ResponseWriter.Header()
 }
 
-// WithLogging функция логгирования http запросов.
-func WithLogging(h http.Handler, logger *zap.SugaredLogger) http.Handler {
+// RequestObserver получатель сведений об обработанных http запросах, например метрик.
+type RequestObserver interface {
+	ObserveRequest(method, route string, status int, duration time.Duration)
+}
+
+// WithLogging функция логгирования http запросов, сведения о запросе также передаются наблюдателям.
+func WithLogging(h http.Handler, logger *zap.SugaredLogger, observers ...RequestObserver) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
@@ -70,5 +76,29 @@ func WithLogging(h http.Handler, logger *zap.SugaredLogger) http.Handler {
 			"duration", duration,
 			"size", responseData.size,
 		)
+
+		if len(observers) == 0 {
+			return
+		}
+
+		status := responseData.status
+		if status == emptyStatus {
+			status = http.StatusOK
+		}
+		route := routePattern(r)
+		for _, observer := range observers {
+			observer.ObserveRequest(r.Method, route, status, duration)
+		}
 	})
 }
+
+// routePattern шаблон маршрута chi, для запросов без подходящего маршрута возвращается unmatched.
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+
+	return "unmatched"
+}
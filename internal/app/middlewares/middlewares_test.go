@@ -3,16 +3,22 @@ package middlewares
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/Erlast/short-url.git/internal/app/accounts"
 	"github.com/Erlast/short-url.git/internal/app/config"
 	"github.com/Erlast/short-url.git/internal/app/helpers"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
@@ -175,6 +181,28 @@ func TestAuthMiddleware(t *testing.T) {
 		assert.NotEmpty(t, resp.Cookies())
 	})
 
+	t.Run("Secure cookie over HTTPS", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		middleware := AuthMiddleware(handler, logger, &config.Cfg{EnableHTTPS: true})
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		rr := httptest.NewRecorder()
+
+		middleware.ServeHTTP(rr, req)
+
+		resp := rr.Result()
+		err := resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cookies := resp.Cookies()
+		assert.Len(t, cookies, 1)
+		assert.True(t, cookies[0].Secure)
+		assert.True(t, cookies[0].HttpOnly)
+	})
+
 	t.Run("Invalid token", func(t *testing.T) {
 		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
@@ -190,3 +218,294 @@ func TestAuthMiddleware(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, resp.Code)
 	})
 }
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop().Sugar()
+	cfg := &config.Cfg{SecretKey: "secret"}
+	store := accounts.NewMemoryStore()
+
+	user, err := accounts.Register(ctx, store, "ci", "password1", "")
+	require.NoError(t, err)
+	secret, key, err := accounts.CreateAPIKey(ctx, store, user.ID, "ci")
+	require.NoError(t, err)
+
+	var gotUserID, gotKeyID any
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserID = r.Context().Value(helpers.UserID)
+		gotKeyID = r.Context().Value(helpers.APIKeyID)
+		w.WriteHeader(http.StatusOK)
+	})
+	middleware := APIKeyMiddleware(AuthMiddleware(CheckAuthMiddleware(handler, logger), logger, cfg), logger, store)
+
+	tests := []struct {
+		header     map[string]string
+		name       string
+		wantUserID any
+		wantKeyID  any
+		wantCode   int
+	}{
+		{
+			name:       "Bearer key",
+			header:     map[string]string{"Authorization": "Bearer " + secret},
+			wantCode:   http.StatusOK,
+			wantUserID: user.ID,
+			wantKeyID:  key.ID,
+		},
+		{
+			name:       "X-API-Key header",
+			header:     map[string]string{APIKeyHeader: secret},
+			wantCode:   http.StatusOK,
+			wantUserID: user.ID,
+			wantKeyID:  key.ID,
+		},
+		{
+			name:     "Unknown key",
+			header:   map[string]string{APIKeyHeader: secret + "x"},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "No key",
+			header:   map[string]string{},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUserID, gotKeyID = nil, nil
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+
+			middleware.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Equal(t, tt.wantUserID, gotUserID)
+			assert.Equal(t, tt.wantKeyID, gotKeyID)
+			// запросу с API ключом не выдается jwt токен
+			if tt.wantKeyID != nil {
+				assert.Empty(t, rr.Result().Cookies())
+				assert.Empty(t, rr.Header().Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	cfg := &config.Cfg{SecretKey: "secret"}
+	now := time.Now()
+	limiter := NewRateLimiter(60, 2)
+	limiter.now = func() time.Time { return now }
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	middleware := RateLimitMiddleware(handler, limiter, cfg)
+
+	account, err := BuildAccountJWTString(cfg, "account-user")
+	require.NoError(t, err)
+	anonymous, err := BuildJWTString(cfg)
+	require.NoError(t, err)
+
+	serve := func(ip, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", http.NoBody)
+		req.RemoteAddr = ip + ":1234"
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: "token", Value: token})
+			userID := GetUserID(token, zap.NewNop().Sugar(), cfg)
+			req = req.WithContext(context.WithValue(req.Context(), helpers.UserID, userID))
+		}
+		rr := httptest.NewRecorder()
+		middleware.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("10.0.0.1", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Reset"))
+
+	// анонимный пользователь ограничивается по IP адресу
+	assert.Equal(t, http.StatusOK, serve("10.0.0.1", anonymous).Code)
+	rr = serve("10.0.0.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+	assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+
+	assert.Equal(t, http.StatusOK, serve("10.0.0.2", "").Code)
+
+	// учетная запись ограничивается по идентификатору независимо от адреса
+	assert.Equal(t, http.StatusOK, serve("10.0.0.3", account).Code)
+	assert.Equal(t, http.StatusOK, serve("10.0.0.4", account).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.5", account).Code)
+
+	now = now.Add(time.Second)
+	assert.Equal(t, http.StatusOK, serve("10.0.0.1", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.1", "").Code)
+
+	// наполнившиеся корзины удаляются
+	now = now.Add(time.Minute)
+	serve("10.0.0.1", "")
+	assert.Len(t, limiter.buckets, 1)
+
+	// нулевой лимит отключает ограничение
+	assert.Nil(t, NewRateLimiter(0, 0))
+	disabled := RateLimitMiddleware(handler, nil, cfg)
+	for range 3 {
+		rr := httptest.NewRecorder()
+		disabled.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", http.NoBody))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestGetAnonymousUserID(t *testing.T) {
+	cfg := &config.Cfg{SecretKey: "secret"}
+
+	anonymous, err := BuildJWTString(cfg)
+	require.NoError(t, err)
+	assert.NotEmpty(t, GetAnonymousUserID(anonymous, cfg))
+
+	// истекший токен анонимного пользователя принимается, чтобы его ссылки можно было перенести
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour))},
+		UserID:           "expired-user",
+	}).SignedString([]byte(cfg.SecretKey))
+	require.NoError(t, err)
+	assert.Empty(t, GetUserID(expired, zap.NewNop().Sugar(), cfg))
+	assert.Equal(t, "expired-user", GetAnonymousUserID(expired, cfg))
+
+	account, err := BuildAccountJWTString(cfg, "account-user")
+	require.NoError(t, err)
+	assert.Equal(t, "account-user", GetUserID(account, zap.NewNop().Sugar(), cfg))
+	assert.Empty(t, GetAnonymousUserID(account, cfg))
+
+	assert.Empty(t, GetAnonymousUserID(anonymous, &config.Cfg{SecretKey: "other"}))
+	assert.Empty(t, GetAnonymousUserID("invalid_token", cfg))
+}
+
+func TestRealIPMiddleware(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+
+	var clientIP string
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP = helpers.ClientIP(r)
+	})
+
+	tests := []struct {
+		name       string
+		proxies    string
+		remoteAddr string
+		expected   string
+	}{
+		{name: "Trusted proxy", proxies: "10.0.0.0/8", remoteAddr: "10.0.0.1:1234", expected: "198.51.100.1"},
+		{name: "Untrusted client", proxies: "10.0.0.0/8", remoteAddr: "203.0.113.1:1234", expected: "203.0.113.1"},
+		{name: "No trusted proxies", proxies: "", remoteAddr: "10.0.0.1:1234", expected: "10.0.0.1"},
+		{name: "Invalid proxies", proxies: "invalid", remoteAddr: "10.0.0.1:1234", expected: "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Real-IP", "198.51.100.1")
+
+			RealIPMiddleware(nextHandler, logger, tt.proxies).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.expected, clientIP)
+		})
+	}
+}
+
+func TestTrustedSubnetMiddleware(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		subnet         string
+		remoteAddr     string
+		realIP         string
+		expectedStatus int
+	}{
+		{name: "IP in subnet", subnet: "192.168.1.0/24", remoteAddr: "192.168.1.15:1234",
+			expectedStatus: http.StatusOK},
+		{name: "IP outside subnet", subnet: "192.168.1.0/24", remoteAddr: "10.0.0.1:1234",
+			expectedStatus: http.StatusForbidden},
+		{name: "Forged X-Real-IP", subnet: "192.168.1.0/24", remoteAddr: "10.0.0.1:1234", realIP: "192.168.1.15",
+			expectedStatus: http.StatusForbidden},
+		{name: "Invalid address", subnet: "192.168.1.0/24", remoteAddr: "localhost",
+			expectedStatus: http.StatusForbidden},
+		{name: "Empty subnet", subnet: "", remoteAddr: "192.168.1.15:1234", expectedStatus: http.StatusForbidden},
+		{name: "Invalid subnet", subnet: "192.168.1.15", remoteAddr: "192.168.1.15:1234",
+			expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/internal/stats", http.NoBody)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			resp := httptest.NewRecorder()
+
+			TrustedSubnetMiddleware(nextHandler, logger, tt.subnet).ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+		})
+	}
+}
+
+type requestRecorder struct {
+	route  string
+	status int
+}
+
+func (r *requestRecorder) ObserveRequest(_, route string, status int, _ time.Duration) {
+	r.route = route
+	r.status = status
+}
+
+func TestWithLoggingObservers(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	observer := &requestRecorder{}
+
+	r := chi.NewRouter()
+	r.Use(func(h http.Handler) http.Handler { return WithLogging(h, logger, observer) })
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	r.Route("/api/user/urls", func(r chi.Router) {
+		r.Get("/{id}/stats", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("{}"))
+		})
+	})
+
+	tests := []struct {
+		path   string
+		route  string
+		status int
+	}{
+		{path: "/abc123", route: "/{id}", status: http.StatusTemporaryRedirect},
+		{path: "/api/user/urls/abc123/stats", route: "/api/user/urls/{id}/stats", status: http.StatusOK},
+		{path: "/api/unknown/path", route: "unmatched", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, http.NoBody)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.route, observer.route)
+			assert.Equal(t, tt.status, observer.status)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package middlewares
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/helpers"
+)
+
+// RateLimiter ограничение частоты запросов алгоритмом token bucket, отдельная корзина на каждый ключ.
+//
+// Корзина вмещает burst запросов и пополняется со скоростью perMinute запросов в минуту. Полные
+// корзины не отличаются от новых, поэтому периодически удаляются, чтобы память не росла с числом клиентов.
+type RateLimiter struct {
+	now       func() time.Time
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	rate      float64
+	burst     float64
+	mu        sync.Mutex
+}
+
+// bucket корзина токенов клиента.
+type bucket struct {
+	updated time.Time
+	tokens  float64
+}
+
+// rateDecision результат проверки запроса.
+type rateDecision struct {
+	retryAfter time.Duration
+	reset      time.Duration
+	remaining  int
+	allowed    bool
+}
+
+// NewRateLimiter инициализация ограничения частоты запросов
+//
+// Аргументы
+//   - perMinute: количество запросов в минуту, 0 отключает ограничение
+//   - burst: количество запросов, которые можно выполнить подряд
+//
+// Возвращает
+//   - *RateLimiter: ограничение частоты запросов, nil если ограничение отключено
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+
+	return &RateLimiter{
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+		rate:    float64(perMinute) / time.Minute.Seconds(),
+		burst:   float64(burst),
+	}
+}
+
+// RateLimiters ограничения частоты создания ссылок и переходов, общие для HTTP и gRPC API.
+type RateLimiters struct {
+	Shorten  *RateLimiter
+	Redirect *RateLimiter
+}
+
+// NewRateLimiters инициализация ограничений частоты запросов по настройкам приложения.
+//
+// Создание ссылок ограничивается строже переходов, лимиты считаются отдельно.
+func NewRateLimiters(cfg *config.Cfg) RateLimiters {
+	return RateLimiters{
+		Shorten:  NewRateLimiter(cfg.ShortenRateLimit, cfg.ShortenBurst),
+		Redirect: NewRateLimiter(cfg.RedirectRateLimit, cfg.RedirectBurst),
+	}
+}
+
+// Allow списание токена из корзины ключа
+//
+// Аргументы
+//   - key: ключ корзины, см. RateLimitKey
+//
+// Возвращает
+//   - bool: запрос разрешен
+//   - time.Duration: время до появления токена, если запрос отклонен
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	decision := l.allow(key)
+	return decision.allowed, decision.retryAfter
+}
+
+// allow списание токена из корзины ключа.
+func (l *RateLimiter) allow(key string) rateDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	decision := rateDecision{allowed: b.tokens >= 1}
+	if decision.allowed {
+		b.tokens--
+	} else {
+		decision.retryAfter = l.wait(1 - b.tokens)
+	}
+	decision.remaining = int(b.tokens)
+	decision.reset = l.wait(l.burst - b.tokens)
+
+	return decision
+}
+
+// sweep удаление корзин, которые успели наполниться, не чаще времени наполнения пустой корзины.
+func (l *RateLimiter) sweep(now time.Time) {
+	window := l.wait(l.burst)
+	if now.Sub(l.lastSweep) < window {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= window {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// wait время накопления заданного количества токенов.
+func (l *RateLimiter) wait(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// RateLimitMiddleware функция ограничения частоты запросов пользователя или IP адреса.
+//
+// Запросы, аутентифицированные API ключом или токеном учетной записи, ограничиваются по
+// идентификатору пользователя. Анонимный идентификатор можно получить без ограничений, поэтому
+// остальные запросы ограничиваются по IP адресу клиента. Ответ содержит заголовки RateLimit-Limit,
+// RateLimit-Remaining и RateLimit-Reset, при превышении лимита возвращается 429 с заголовком Retry-After.
+// Подключается после AuthMiddleware, nil limiter пропускает все запросы.
+func RateLimitMiddleware(h http.Handler, limiter *RateLimiter, cfg *config.Cfg) http.Handler {
+	if limiter == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		decision := limiter.allow(rateLimitKey(req, cfg))
+
+		header := resp.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(int(limiter.burst)))
+		header.Set("RateLimit-Remaining", strconv.Itoa(decision.remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.reset)))
+
+		if !decision.allowed {
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(decision.retryAfter)))
+			http.Error(resp, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		h.ServeHTTP(resp, req)
+	})
+}
+
+// rateLimitKey ключ корзины http запроса.
+func rateLimitKey(req *http.Request, cfg *config.Cfg) string {
+	userID, _ := req.Context().Value(helpers.UserID).(string)
+	token := ""
+	if cookie, err := req.Cookie("token"); err == nil {
+		token = cookie.Value
+	}
+
+	return RateLimitKey(userID, authenticatedByAPIKey(req), token, helpers.ClientIP(req), cfg)
+}
+
+// RateLimitKey ключ корзины запроса: пользователь с учетной записью или API ключом, иначе IP адрес
+//
+// Аргументы
+//   - userID: идентификатор пользователя запроса
+//   - byAPIKey: запрос аутентифицирован API ключом
+//   - token: jwt токен, переданный клиентом
+//   - ip: IP адрес клиента
+//   - cfg: конфигурация приложения
+//
+// Возвращает
+//   - string: ключ корзины
+func RateLimitKey(userID string, byAPIKey bool, token, ip string, cfg *config.Cfg) string {
+	if userID != "" && byAPIKey {
+		return "user:" + userID
+	}
+
+	if token != "" && userID != "" && GetAnonymousUserID(token, cfg) == "" {
+		return "user:" + userID
+	}
+
+	return "ip:" + ip
+}
+
+// ceilSeconds длительность в целых секундах с округлением вверх.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
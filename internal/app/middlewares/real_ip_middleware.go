@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/helpers"
+)
+
+// RealIPMiddleware функция подстановки адреса клиента за доверенным прокси в адрес соединения.
+//
+// Для соединений из доверенных подсетей в формате CIDR, перечисленных через запятую, адрес клиента
+// берется из заголовков X-Real-IP или X-Forwarded-For, для остальных заголовки игнорируются.
+// Если подсети не заданы или заданы некорректно, заголовкам не доверяет ни одно соединение.
+func RealIPMiddleware(h http.Handler, logger *zap.SugaredLogger, trustedProxies string) http.Handler {
+	proxies, err := helpers.ParseSubnets(trustedProxies)
+	if err != nil {
+		logger.Errorf("Failed to parse trusted proxies %q: %v", trustedProxies, err)
+		proxies = nil
+	}
+	if len(proxies) == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if ip := helpers.ForwardedIP(req, proxies); ip != helpers.ClientIP(req) {
+			_, port, _ := net.SplitHostPort(req.RemoteAddr)
+			req.RemoteAddr = net.JoinHostPort(ip, port)
+		}
+
+		h.ServeHTTP(resp, req)
+	})
+}
@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/helpers"
+)
+
+// TrustedSubnetMiddleware функция ограничения доступа по IP адресу клиента.
+//
+// Запрос пропускается, только если адрес входит в доверенную подсеть в формате CIDR. Адрес берется
+// из соединения: заголовки X-Real-IP и X-Forwarded-For учитываются только RealIPMiddleware
+// для соединений от доверенных прокси.
+// Если подсеть не задана или задана некорректно, доступ запрещен для всех запросов.
+func TrustedSubnetMiddleware(h http.Handler, logger *zap.SugaredLogger, trustedSubnet string) http.Handler {
+	var subnet *net.IPNet
+	if trustedSubnet != "" {
+		_, ipNet, err := net.ParseCIDR(trustedSubnet)
+		if err != nil {
+			logger.Errorf("Failed to parse trusted subnet %q: %v", trustedSubnet, err)
+		}
+		subnet = ipNet
+	}
+
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if subnet == nil {
+			http.Error(resp, "", http.StatusForbidden)
+			return
+		}
+
+		ip := net.ParseIP(helpers.ClientIP(req))
+		if ip == nil || !subnet.Contains(ip) {
+			http.Error(resp, "", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(resp, req)
+	})
+}
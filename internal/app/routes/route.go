@@ -7,59 +7,178 @@ import (
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 
+	"github.com/Erlast/short-url.git/internal/app/accounts"
+	"github.com/Erlast/short-url.git/internal/app/analytics"
 	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/deletion"
 	"github.com/Erlast/short-url.git/internal/app/handlers"
+	"github.com/Erlast/short-url.git/internal/app/metrics"
 	"github.com/Erlast/short-url.git/internal/app/middlewares"
 	"github.com/Erlast/short-url.git/internal/app/storages"
 )
 
 // NewRouter функция инициализации роутов.
-func NewRouter(ctx context.Context, store storages.URLStorage, conf *config.Cfg, logger *zap.SugaredLogger) *chi.Mux {
+func NewRouter(
+	ctx context.Context,
+	store storages.URLStorage,
+	clicks analytics.Store,
+	users accounts.Store,
+	deletions deletion.Scheduler,
+	recorder analytics.Recorder,
+	limiters middlewares.RateLimiters,
+	conf *config.Cfg,
+	logger *zap.SugaredLogger,
+	appMetrics *metrics.Metrics,
+) *chi.Mux {
 	r := chi.NewRouter()
 
+	// Адрес клиента за доверенным прокси подставляется до лимитов и статистики переходов
 	r.Use(func(h http.Handler) http.Handler {
-		return middlewares.AuthMiddleware(h, logger, conf)
+		return middlewares.RealIPMiddleware(h, logger, conf.TrustedProxies)
 	})
-	r.Use(func(h http.Handler) http.Handler {
-		return middlewares.WithLogging(h, logger)
-	})
-	r.Use(func(h http.Handler) http.Handler {
+
+	logging := func(h http.Handler) http.Handler {
+		return middlewares.WithLogging(h, logger, appMetrics)
+	}
+	gzip := func(h http.Handler) http.Handler {
 		return middlewares.GzipMiddleware(h, logger)
-	})
+	}
 
-	r.Get("/", func(res http.ResponseWriter, req *http.Request) {
-		handlers.GetProbe(ctx, res)
-	})
+	shortenLimit := func(h http.Handler) http.Handler {
+		return middlewares.RateLimitMiddleware(h, limiters.Shorten, conf)
+	}
+	redirectLimit := func(h http.Handler) http.Handler {
+		return middlewares.RateLimitMiddleware(h, limiters.Redirect, conf)
+	}
 
-	r.Get("/{id}", func(res http.ResponseWriter, req *http.Request) {
-		handlers.GetHandler(ctx, res, req, store)
+	// Учетные записи доступны без действующего токена: истекший токен анонимного пользователя
+	// не должен мешать регистрации с переносом его ссылок
+	r.Route("/api/auth", func(r chi.Router) {
+		r.Use(logging, gzip)
+		r.Post("/register", func(res http.ResponseWriter, req *http.Request) {
+			handlers.Register(ctx, res, req, users, conf, logger)
+		})
+		r.Post("/login", func(res http.ResponseWriter, req *http.Request) {
+			handlers.Login(ctx, res, req, users, conf, logger)
+		})
+		r.Post("/refresh", func(res http.ResponseWriter, req *http.Request) {
+			handlers.RefreshToken(ctx, res, req, users, conf, logger)
+		})
+		r.Post("/logout", func(res http.ResponseWriter, req *http.Request) {
+			handlers.Logout(ctx, res, req, users, conf, logger)
+		})
 	})
 
-	r.Post("/", func(res http.ResponseWriter, req *http.Request) {
-		handlers.PostHandler(ctx, res, req, store, conf, logger)
+	// Метрики доступны только из доверенной подсети и не требуют авторизации, чтобы сбор метрик
+	// не создавал анонимных пользователей
+	r.Group(func(r chi.Router) {
+		r.Use(logging, func(h http.Handler) http.Handler {
+			return middlewares.TrustedSubnetMiddleware(h, logger, conf.TrustedSubnet)
+		})
+		r.Method(http.MethodGet, "/metrics", appMetrics.Handler())
 	})
 
-	r.Post("/api/shorten", func(res http.ResponseWriter, req *http.Request) {
-		handlers.PostShortenHandler(ctx, res, req, store, conf, logger)
-	})
+	// Запросы учитываются в метриках до авторизации, чтобы отказы в доступе тоже попадали в статистику
+	r.Group(func(r chi.Router) {
+		r.Use(logging)
+		r.Use(func(h http.Handler) http.Handler {
+			return middlewares.APIKeyMiddleware(h, logger, users)
+		})
+		r.Use(func(h http.Handler) http.Handler {
+			return middlewares.AuthMiddleware(h, logger, conf)
+		})
+		r.Use(gzip)
 
-	r.Get("/ping", func(res http.ResponseWriter, req *http.Request) {
-		handlers.GetPingHandler(ctx, res, store, logger)
-	})
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			handlers.GetProbe(ctx, res)
+		})
 
-	r.Post("/api/shorten/batch", func(res http.ResponseWriter, req *http.Request) {
-		handlers.BatchShortenHandler(ctx, res, req, store, conf, logger)
-	})
+		r.With(redirectLimit).Get("/{id}", func(res http.ResponseWriter, req *http.Request) {
+			handlers.GetHandler(ctx, res, req, store, recorder, conf)
+		})
 
-	r.Route("/api/user/urls", func(r chi.Router) {
-		r.Use(func(h http.Handler) http.Handler { return middlewares.CheckAuthMiddleware(h, logger) })
-		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
-			handlers.GetUserUrls(ctx, res, req, store, conf, logger)
+		r.With(shortenLimit).Post("/", func(res http.ResponseWriter, req *http.Request) {
+			handlers.PostHandler(ctx, res, req, store, conf, logger)
+		})
+
+		r.With(shortenLimit).Post("/api/shorten", func(res http.ResponseWriter, req *http.Request) {
+			handlers.PostShortenHandler(ctx, res, req, store, conf, logger)
+		})
+
+		r.Get("/ping", func(res http.ResponseWriter, req *http.Request) {
+			handlers.GetPingHandler(req.Context(), res, store, logger)
+		})
+
+		r.With(shortenLimit).Post("/api/shorten/batch", func(res http.ResponseWriter, req *http.Request) {
+			handlers.BatchShortenHandler(ctx, res, req, store, conf, logger)
 		})
-	})
 
-	r.Delete("/api/user/urls", func(res http.ResponseWriter, req *http.Request) {
-		handlers.DeleteUserUrls(ctx, res, req, store, logger)
+		// Импорт переносит ссылки в хранилище пользователя, запрос считается одним созданием ссылки
+		r.With(shortenLimit, func(h http.Handler) http.Handler {
+			return middlewares.CheckAuthMiddleware(h, logger)
+		}).Post("/api/import", func(res http.ResponseWriter, req *http.Request) {
+			handlers.ImportURLs(ctx, res, req, store, conf, logger)
+		})
+
+		r.Route("/api/user/urls", func(r chi.Router) {
+			r.Use(func(h http.Handler) http.Handler { return middlewares.CheckAuthMiddleware(h, logger) })
+			r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+				handlers.GetUserUrls(ctx, res, req, store, conf, logger)
+			})
+			r.Get("/export", func(res http.ResponseWriter, req *http.Request) {
+				handlers.ExportUserURLs(ctx, res, req, store, clicks, conf, logger)
+			})
+			r.Get("/deletions", func(res http.ResponseWriter, req *http.Request) {
+				handlers.GetPendingDeletions(ctx, res, req, deletions, logger)
+			})
+			r.Get("/trash", func(res http.ResponseWriter, req *http.Request) {
+				handlers.GetDeletedUserURLs(ctx, res, req, store, conf, logger)
+			})
+			r.Post("/restore", func(res http.ResponseWriter, req *http.Request) {
+				handlers.RestoreUserURLs(ctx, res, req, store, conf, logger)
+			})
+			r.Get("/{id}/stats", func(res http.ResponseWriter, req *http.Request) {
+				handlers.GetURLStats(ctx, res, req, store, clicks, logger)
+			})
+			r.Get("/{id}/shares", func(res http.ResponseWriter, req *http.Request) {
+				handlers.GetURLShares(ctx, res, req, store, logger)
+			})
+			r.Post("/{id}/shares", func(res http.ResponseWriter, req *http.Request) {
+				handlers.ShareURL(ctx, res, req, store, logger)
+			})
+			r.Delete("/{id}/shares/{userID}", func(res http.ResponseWriter, req *http.Request) {
+				handlers.RevokeURLShare(ctx, res, req, store, logger)
+			})
+			r.Post("/{id}/transfer", func(res http.ResponseWriter, req *http.Request) {
+				handlers.TransferURL(ctx, res, req, store, logger)
+			})
+		})
+
+		r.Route("/api/user/keys", func(r chi.Router) {
+			r.Use(func(h http.Handler) http.Handler { return middlewares.CheckAuthMiddleware(h, logger) })
+			r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+				handlers.ListAPIKeys(ctx, res, req, users, logger)
+			})
+			r.Post("/", func(res http.ResponseWriter, req *http.Request) {
+				handlers.CreateAPIKey(ctx, res, req, users, logger)
+			})
+			r.Delete("/{id}", func(res http.ResponseWriter, req *http.Request) {
+				handlers.RevokeAPIKey(ctx, res, req, users, logger)
+			})
+		})
+
+		r.Route("/api/internal", func(r chi.Router) {
+			r.Use(func(h http.Handler) http.Handler {
+				return middlewares.TrustedSubnetMiddleware(h, logger, conf.TrustedSubnet)
+			})
+			r.Get("/stats", func(res http.ResponseWriter, req *http.Request) {
+				handlers.GetInternalStats(ctx, res, req, store, logger)
+			})
+		})
+
+		r.Delete("/api/user/urls", func(res http.ResponseWriter, req *http.Request) {
+			handlers.DeleteUserUrls(ctx, res, req, deletions, logger)
+		})
 	})
 
 	return r
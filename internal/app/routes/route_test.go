@@ -0,0 +1,77 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/accounts"
+	"github.com/Erlast/short-url.git/internal/app/analytics"
+	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/deletion"
+	"github.com/Erlast/short-url.git/internal/app/metrics"
+	"github.com/Erlast/short-url.git/internal/app/middlewares"
+	"github.com/Erlast/short-url.git/internal/app/storages"
+)
+
+func TestMetricsRoute(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop().Sugar()
+	conf := &config.Cfg{FlagBaseURL: "http://localhost:8080", SecretKey: "secret", TrustedSubnet: "10.0.0.0/8",
+		TrustedProxies: "172.16.0.1/32"}
+
+	store, err := storages.NewMemoryStorage(ctx)
+	assert.NoError(t, err)
+	clicks := analytics.NewMemoryStore()
+	deletions := deletion.NewQueue(store, deletion.Config{}, logger)
+	defer func() { assert.NoError(t, deletions.Close(ctx)) }()
+
+	r := NewRouter(ctx, store, clicks, accounts.NewMemoryStore(), deletions, nil, middlewares.NewRateLimiters(conf),
+		conf, logger, metrics.New(prometheus.NewRegistry()))
+
+	// Запрос с неизвестным API ключом отклоняется до авторизации и учитывается в метриках
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://ya.ru"}`))
+	req.Header.Set(middlewares.APIKeyHeader, "unknown")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		status     int
+	}{
+		{name: "Untrusted subnet", remoteAddr: "192.168.0.1:1234", status: http.StatusForbidden},
+		{name: "Forged X-Real-IP", remoteAddr: "192.168.0.1:1234", realIP: "10.0.0.1", status: http.StatusForbidden},
+		{name: "Untrusted behind proxy", remoteAddr: "172.16.0.1:1234", realIP: "192.168.0.1",
+			status: http.StatusForbidden},
+		{name: "Trusted behind proxy", remoteAddr: "172.16.0.1:1234", realIP: "10.0.0.1", status: http.StatusOK},
+		{name: "Trusted subnet", remoteAddr: "10.0.0.1:1234", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Empty(t, rr.Header().Values("Set-Cookie"))
+			if tt.status == http.StatusOK {
+				assert.Contains(t, rr.Body.String(),
+					`shortener_http_requests_total{method="POST",route="/api/shorten",status="401"} 1`)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Package schedule расписания периодических задач.
+//
+// Расписание задается интервалом или cron выражением из пяти полей: минута, час, день месяца,
+// месяц и день недели. В полях допускаются "*", списки через запятую, диапазоны "a-b" и шаг "/n",
+// день недели 0 и 7 - воскресенье. Если ограничены и день месяца, и день недели, достаточно
+// совпадения любого из них. Поддерживаются сокращения @yearly, @monthly, @weekly, @daily и @hourly.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule расписание запусков.
+type Schedule interface {
+	// Next момент следующего запуска строго после after, нулевое время - запусков больше нет.
+	Next(after time.Time) time.Time
+}
+
+// Interval расписание с постоянным интервалом между запусками.
+type Interval time.Duration
+
+// Next момент следующего запуска.
+func (i Interval) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(i))
+}
+
+// String интервал между запусками.
+func (i Interval) String() string {
+	return time.Duration(i).String()
+}
+
+// cronSearchLimit период, в котором ищется следующий запуск по cron выражению.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// Cron расписание по cron выражению, поле - множество допустимых значений в виде битовой маски.
+type Cron struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// anyDay - день месяца или день недели не ограничены, достаточно совпадения обоих полей
+	anyDay bool
+}
+
+// cronField границы значений поля cron выражения.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+// cronFields поля cron выражения по порядку.
+var cronFields = [5]cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+// cronMacros сокращения cron выражений.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron разбор cron выражения
+//
+// Аргументы
+//   - expr: cron выражение из пяти полей или сокращение
+//
+// Возвращает
+//   - *Cron: расписание
+//   - error: ошибка разбора
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have %d fields", expr, len(cronFields))
+	}
+
+	var masks [len(cronFields)]uint64
+	for i, part := range parts {
+		mask, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+		masks[i] = mask
+	}
+
+	// Воскресенье может быть задано как 0 или 7
+	dow := masks[4]
+	if dow&(1<<7) != 0 {
+		dow = dow&^(1<<7) | 1
+	}
+
+	return &Cron{
+		expr:   expr,
+		minute: masks[0],
+		hour:   masks[1],
+		dom:    masks[2],
+		month:  masks[3],
+		dow:    dow,
+		anyDay: parts[2] == "*" || parts[4] == "*",
+	}, nil
+}
+
+// parseCronField разбор поля cron выражения в битовую маску допустимых значений.
+func parseCronField(value string, field cronField) (uint64, error) {
+	var mask uint64
+	for _, item := range strings.Split(value, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			parsed, err := strconv.Atoi(stepPart)
+			if err != nil || parsed <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", field.name, stepPart)
+			}
+			step = parsed
+		}
+
+		low, high := field.min, field.max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+			if low, err = strconv.Atoi(lowPart); err != nil {
+				return 0, fmt.Errorf("invalid %s value %q", field.name, lowPart)
+			}
+			high = low
+			switch {
+			case isRange:
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return 0, fmt.Errorf("invalid %s value %q", field.name, highPart)
+				}
+			case hasStep:
+				// "a/n" - от a до конца диапазона поля
+				high = field.max
+			}
+		}
+
+		if low < field.min || high > field.max || low > high {
+			return 0, fmt.Errorf("%s %q out of range %d-%d", field.name, item, field.min, field.max)
+		}
+
+		for v := low; v <= high; v += step {
+			mask |= 1 << v
+		}
+	}
+
+	return mask, nil
+}
+
+// Next момент следующего запуска строго после after в часовом поясе after.
+func (c *Cron) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(cronSearchLimit)
+
+	for !t.After(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// dayMatches совпадение дня месяца и дня недели.
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDay {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// Parse расписание по cron выражению, если оно задано, иначе по интервалу
+//
+// Аргументы
+//   - cron: cron выражение, пустая строка - расписание по интервалу
+//   - interval: интервал между запусками
+//
+// Возвращает
+//   - Schedule: расписание
+//   - error: ошибка разбора или неположительный интервал
+func Parse(cron string, interval time.Duration) (Schedule, error) {
+	if cron != "" {
+		return ParseCron(cron)
+	}
+
+	if interval <= 0 {
+		return nil, fmt.Errorf("schedule interval must be positive, got %s", interval)
+	}
+
+	return Interval(interval), nil
+}
+
+// String исходное cron выражение.
+func (c *Cron) String() string {
+	return c.expr
+}
@@ -0,0 +1,97 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{name: "Empty", expr: ""},
+		{name: "Too few fields", expr: "0 3 * *"},
+		{name: "Too many fields", expr: "0 0 3 * * *"},
+		{name: "Minute out of range", expr: "60 * * * *"},
+		{name: "Day of month zero", expr: "0 0 0 * *"},
+		{name: "Reversed range", expr: "0 5-1 * * *"},
+		{name: "Zero step", expr: "*/0 * * * *"},
+		{name: "Not a number", expr: "0 x * * *"},
+		{name: "Unknown macro", expr: "@often"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCron_Next(t *testing.T) {
+	// Среда, 15 мая 2024
+	after := time.Date(2024, time.May, 15, 10, 30, 20, 0, time.UTC)
+
+	tests := []struct {
+		want time.Time
+		name string
+		expr string
+	}{
+		{name: "Every minute", expr: "* * * * *", want: time.Date(2024, time.May, 15, 10, 31, 0, 0, time.UTC)},
+		{name: "Daily", expr: "@daily", want: time.Date(2024, time.May, 16, 0, 0, 0, 0, time.UTC)},
+		{name: "Later today", expr: "45 10 * * *", want: time.Date(2024, time.May, 15, 10, 45, 0, 0, time.UTC)},
+		{name: "Step", expr: "*/20 * * * *", want: time.Date(2024, time.May, 15, 10, 40, 0, 0, time.UTC)},
+		{name: "List and range", expr: "0 1,8-9 * * *", want: time.Date(2024, time.May, 16, 1, 0, 0, 0, time.UTC)},
+		{name: "Sunday as 7", expr: "0 3 * * 7", want: time.Date(2024, time.May, 19, 3, 0, 0, 0, time.UTC)},
+		{name: "Weekdays", expr: "0 3 * * 1-5", want: time.Date(2024, time.May, 16, 3, 0, 0, 0, time.UTC)},
+		{name: "Next month", expr: "0 0 1 * *", want: time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "Next year", expr: "0 0 1 3 *", want: time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "Leap day", expr: "0 0 29 2 *", want: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// Ограничены оба поля: запуск в ближайшую субботу 18 мая, не дожидаясь 20 мая
+		{name: "Day of month or week", expr: "0 0 20 * 6", want: time.Date(2024, time.May, 18, 0, 0, 0, 0, time.UTC)},
+		{name: "Never", expr: "0 0 31 2 *", want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, cron.Next(after))
+		})
+	}
+}
+
+func TestCron_NextLocation(t *testing.T) {
+	cron, err := ParseCron("0 3 * * *")
+	require.NoError(t, err)
+
+	// 01:00 по времени UTC+3 - 22:00 UTC предыдущего дня, запуск в 03:00 в часовом поясе аргумента
+	after := time.Date(2024, time.May, 15, 1, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60))
+
+	assert.Equal(t, time.Date(2024, time.May, 15, 0, 0, 0, 0, time.UTC), cron.Next(after).UTC())
+	assert.Equal(t, time.Date(2024, time.May, 15, 3, 0, 0, 0, time.UTC), cron.Next(after.UTC()))
+}
+
+func TestParse(t *testing.T) {
+	interval, err := Parse("", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, Interval(time.Hour), interval)
+
+	after := time.Date(2024, time.May, 15, 10, 30, 0, 0, time.UTC)
+	assert.Equal(t, after.Add(time.Hour), interval.Next(after))
+
+	cron, err := Parse("@hourly", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.May, 15, 11, 0, 0, 0, time.UTC), cron.Next(after))
+
+	_, err = Parse("", 0)
+	assert.Error(t, err)
+
+	_, err = Parse("bad", time.Hour)
+	assert.Error(t, err)
+}
@@ -0,0 +1,252 @@
+// Package shortcode генерация коротких ссылок.
+//
+// Стратегии:
+//   - random - криптографически случайная строка заданной длины;
+//   - sequence - номер из последовательности хранилища в системе счисления алфавита;
+//   - snowflake - идентификатор из времени, номера узла и счетчика в системе счисления алфавита;
+//   - hash - ключевой хэш (HMAC-SHA256) оригинального URL.
+//
+// Стратегии sequence и snowflake не дают коллизий, поэтому хранилищу не нужно проверять занятость ссылки
+// до сохранения. Для sequence и snowflake длина - минимальная, код дополняется слева первым символом алфавита.
+package shortcode
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultAlphabet алфавит по умолчанию (base62).
+const DefaultAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// DefaultLength длина короткой ссылки по умолчанию.
+const DefaultLength = 7
+
+// MaxLength максимальная длина короткой ссылки.
+const MaxLength = 64
+
+// Стратегии генерации.
+const (
+	StrategyRandom    = "random"    // StrategyRandom криптографически случайная строка
+	StrategySequence  = "sequence"  // StrategySequence номер из последовательности хранилища
+	StrategySnowflake = "snowflake" // StrategySnowflake идентификатор в стиле Snowflake
+	StrategyHash      = "hash"      // StrategyHash ключевой хэш оригинального URL
+)
+
+// urlSafe символы, допустимые в алфавите.
+const urlSafe = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_"
+
+// Generator генератор коротких ссылок.
+type Generator interface {
+	// Generate формирует короткую ссылку для originalURL, attempt - номер попытки начиная с 0.
+	// Если ссылка занята, хранилище повторяет вызов с attempt + 1.
+	Generate(ctx context.Context, originalURL string, attempt int) (string, error)
+}
+
+// Sequence источник неповторяющихся номеров.
+type Sequence interface {
+	Next(ctx context.Context) (int64, error)
+}
+
+// SequenceFunc адаптер функции к интерфейсу Sequence.
+type SequenceFunc func(ctx context.Context) (int64, error)
+
+// Next следующий номер последовательности.
+func (f SequenceFunc) Next(ctx context.Context) (int64, error) {
+	return f(ctx)
+}
+
+// Config параметры генератора.
+type Config struct {
+	// Strategy - стратегия генерации, по умолчанию StrategyRandom
+	Strategy string
+	// Alphabet - символы короткой ссылки, по умолчанию DefaultAlphabet
+	Alphabet string
+	// Key - ключ хэша для StrategyHash
+	Key string
+	// Length - длина короткой ссылки, по умолчанию DefaultLength
+	Length int
+	// NodeID - номер узла для StrategySnowflake, от 0 до 1023
+	NodeID int64
+}
+
+// New создание генератора
+//
+// Аргументы
+//   - cfg: параметры генератора
+//   - seq: последовательность хранилища для StrategySequence
+//
+// Возвращает
+//   - Generator: генератор коротких ссылок
+//   - error: ошибка параметров
+func New(cfg Config, seq Sequence) (Generator, error) {
+	if cfg.Alphabet == "" {
+		cfg.Alphabet = DefaultAlphabet
+	}
+	if cfg.Length == 0 {
+		cfg.Length = DefaultLength
+	}
+	if err := Validate(cfg.Alphabet, cfg.Length); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Strategy {
+	case "", StrategyRandom:
+		return NewRandom(cfg.Alphabet, cfg.Length), nil
+	case StrategySequence:
+		if seq == nil {
+			return nil, errors.New("sequence strategy requires a storage sequence")
+		}
+		return NewSequence(cfg.Alphabet, cfg.Length, seq), nil
+	case StrategySnowflake:
+		return NewSnowflake(cfg.Alphabet, cfg.Length, cfg.NodeID)
+	case StrategyHash:
+		if cfg.Key == "" {
+			return nil, errors.New("hash strategy requires a key")
+		}
+		return NewHash(cfg.Alphabet, cfg.Length, cfg.Key), nil
+	default:
+		return nil, fmt.Errorf("unknown short code strategy %q", cfg.Strategy)
+	}
+}
+
+// Validate проверка алфавита и длины короткой ссылки.
+func Validate(alphabet string, length int) error {
+	if length < 1 || length > MaxLength {
+		return fmt.Errorf("short code length must be between 1 and %d", MaxLength)
+	}
+	if len(alphabet) < 2 {
+		return errors.New("short code alphabet must contain at least 2 characters")
+	}
+
+	for i := range len(alphabet) {
+		if !strings.ContainsRune(urlSafe, rune(alphabet[i])) {
+			return fmt.Errorf("short code alphabet contains unsupported character %q", alphabet[i])
+		}
+		if strings.IndexByte(alphabet[i+1:], alphabet[i]) >= 0 {
+			return fmt.Errorf("short code alphabet contains duplicate character %q", alphabet[i])
+		}
+	}
+
+	return nil
+}
+
+// Random генератор криптографически случайных коротких ссылок.
+type Random struct {
+	alphabet string
+	length   int
+}
+
+// NewRandom создание генератора случайных коротких ссылок.
+func NewRandom(alphabet string, length int) *Random {
+	return &Random{alphabet: alphabet, length: length}
+}
+
+// Generate случайная строка длины length, символы алфавита равновероятны.
+func (g *Random) Generate(_ context.Context, _ string, _ int) (string, error) {
+	// Байты не меньше limit отбрасываются, чтобы не смещать распределение символов
+	limit := 256 - 256%len(g.alphabet)
+	result := make([]byte, 0, g.length)
+	buf := make([]byte, g.length)
+
+	for len(result) < g.length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("unable to read random bytes: %w", err)
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(result) < g.length {
+				result = append(result, g.alphabet[int(b)%len(g.alphabet)])
+			}
+		}
+	}
+
+	return string(result), nil
+}
+
+// SequenceGenerator генератор коротких ссылок из номеров последовательности.
+//
+// Ссылки последовательны и поэтому предсказуемы.
+type SequenceGenerator struct {
+	seq      Sequence
+	alphabet string
+	length   int
+}
+
+// NewSequence создание генератора коротких ссылок из номеров последовательности.
+func NewSequence(alphabet string, length int, seq Sequence) *SequenceGenerator {
+	return &SequenceGenerator{seq: seq, alphabet: alphabet, length: length}
+}
+
+// Generate следующий номер последовательности в системе счисления алфавита.
+func (g *SequenceGenerator) Generate(ctx context.Context, _ string, _ int) (string, error) {
+	n, err := g.seq.Next(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to get next sequence value: %w", err)
+	}
+	if n < 0 {
+		return "", fmt.Errorf("negative sequence value %d", n)
+	}
+
+	return Encode(uint64(n), g.alphabet, g.length), nil
+}
+
+// Hash генератор коротких ссылок из ключевого хэша оригинального URL.
+//
+// Один и тот же URL получает одну и ту же ссылку, при коллизии номер попытки добавляется к хэшируемым данным.
+type Hash struct {
+	alphabet string
+	key      []byte
+	length   int
+}
+
+// NewHash создание генератора коротких ссылок из ключевого хэша.
+func NewHash(alphabet string, length int, key string) *Hash {
+	return &Hash{alphabet: alphabet, key: []byte(key), length: length}
+}
+
+// Generate первые length символов HMAC-SHA256 оригинального URL в системе счисления алфавита.
+func (g *Hash) Generate(_ context.Context, originalURL string, attempt int) (string, error) {
+	mac := hmac.New(sha256.New, g.key)
+	_, _ = mac.Write([]byte(originalURL))
+	if attempt > 0 {
+		_, _ = mac.Write([]byte{0})
+		_, _ = mac.Write([]byte(strconv.Itoa(attempt)))
+	}
+
+	n := new(big.Int).SetBytes(mac.Sum(nil))
+	base := big.NewInt(int64(len(g.alphabet)))
+	digit := new(big.Int)
+	result := make([]byte, g.length)
+	for i := range result {
+		n.DivMod(n, base, digit)
+		result[i] = g.alphabet[digit.Int64()]
+	}
+
+	return string(result), nil
+}
+
+// Encode запись числа в системе счисления алфавита, результат дополняется слева до minLength.
+func Encode(n uint64, alphabet string, minLength int) string {
+	base := uint64(len(alphabet))
+	buf := make([]byte, 0, MaxLength)
+
+	for n > 0 {
+		buf = append(buf, alphabet[n%base])
+		n /= base
+	}
+	for len(buf) < minLength {
+		buf = append(buf, alphabet[0])
+	}
+
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+
+	return string(buf)
+}
@@ -0,0 +1,150 @@
+package shortcode
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	seq := SequenceFunc(func(context.Context) (int64, error) { return 1, nil })
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "Defaults", cfg: Config{}},
+		{name: "Sequence", cfg: Config{Strategy: StrategySequence}},
+		{name: "Snowflake", cfg: Config{Strategy: StrategySnowflake, NodeID: 1023}},
+		{name: "Hash", cfg: Config{Strategy: StrategyHash, Key: "secret"}},
+		{name: "Hash without key", cfg: Config{Strategy: StrategyHash}, wantErr: true},
+		{name: "Unknown strategy", cfg: Config{Strategy: "uuid"}, wantErr: true},
+		{name: "Snowflake node out of range", cfg: Config{Strategy: StrategySnowflake, NodeID: 1024}, wantErr: true},
+		{name: "Too long", cfg: Config{Length: MaxLength + 1}, wantErr: true},
+		{name: "Single character alphabet", cfg: Config{Alphabet: "a"}, wantErr: true},
+		{name: "Duplicate characters", cfg: Config{Alphabet: "abca"}, wantErr: true},
+		{name: "Unsafe characters", cfg: Config{Alphabet: "ab?"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator, err := New(tt.cfg, seq)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			code, err := generator.Generate(context.Background(), "https://example.com", 0)
+			require.NoError(t, err)
+			assert.GreaterOrEqual(t, len(code), DefaultLength)
+		})
+	}
+
+	_, err := New(Config{Strategy: StrategySequence}, nil)
+	assert.Error(t, err)
+}
+
+func TestRandom(t *testing.T) {
+	generator := NewRandom("ab", 32)
+
+	seen := make(map[string]struct{})
+	for range 100 {
+		code, err := generator.Generate(context.Background(), "", 0)
+		require.NoError(t, err)
+		assert.Len(t, code, 32)
+		assert.Empty(t, strings.Trim(code, "ab"))
+		seen[code] = struct{}{}
+	}
+	assert.Len(t, seen, 100)
+}
+
+func TestSequence(t *testing.T) {
+	var n int64
+	generator := NewSequence(DefaultAlphabet, 4, SequenceFunc(func(context.Context) (int64, error) {
+		n++
+		return n, nil
+	}))
+
+	var codes []string
+	for range 3 {
+		code, err := generator.Generate(context.Background(), "", 0)
+		require.NoError(t, err)
+		codes = append(codes, code)
+	}
+	assert.Equal(t, []string{"0001", "0002", "0003"}, codes)
+
+	n = 62*62*62*62 - 1
+	code, err := generator.Generate(context.Background(), "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "10000", code, "codes grow beyond minimal length")
+}
+
+func TestSnowflake(t *testing.T) {
+	generator, err := NewSnowflake(DefaultAlphabet, DefaultLength, 7)
+	require.NoError(t, err)
+
+	frozen := snowflakeEpoch.Add(time.Hour)
+	generator.now = func() time.Time { return frozen }
+
+	var mu sync.Mutex
+	seen := make(map[string]struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// больше, чем счетчик вмещает за одну миллисекунду
+			for range 2 * snowflakeMaxSeq {
+				code, err := generator.Generate(context.Background(), "", 0)
+				assert.NoError(t, err)
+				mu.Lock()
+				seen[code] = struct{}{}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, seen, 8*snowflakeMaxSeq)
+
+	other, err := NewSnowflake(DefaultAlphabet, DefaultLength, 8)
+	require.NoError(t, err)
+	other.now = generator.now
+	code, err := other.Generate(context.Background(), "", 0)
+	require.NoError(t, err)
+	assert.NotContains(t, seen, code, "nodes do not collide")
+}
+
+func TestHash(t *testing.T) {
+	generator := NewHash(DefaultAlphabet, 8, "secret")
+	ctx := context.Background()
+
+	first, err := generator.Generate(ctx, "https://example.com", 0)
+	require.NoError(t, err)
+	again, err := generator.Generate(ctx, "https://example.com", 0)
+	require.NoError(t, err)
+	retry, err := generator.Generate(ctx, "https://example.com", 1)
+	require.NoError(t, err)
+	other, err := NewHash(DefaultAlphabet, 8, "other").Generate(ctx, "https://example.com", 0)
+	require.NoError(t, err)
+
+	assert.Len(t, first, 8)
+	assert.Equal(t, first, again)
+	assert.NotEqual(t, first, retry)
+	assert.NotEqual(t, first, other)
+}
+
+func ExampleEncode() {
+	fmt.Println(Encode(61, DefaultAlphabet, 3))
+	fmt.Println(Encode(62, DefaultAlphabet, 1))
+	// Output:
+	// 00z
+	// 10
+}
@@ -0,0 +1,77 @@
+package shortcode
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	snowflakeNodeBits = 10                                   // snowflakeNodeBits разрядов номера узла
+	snowflakeSeqBits  = 12                                   // snowflakeSeqBits разрядов счетчика в пределах миллисекунды
+	snowflakeMaxNode  = 1<<snowflakeNodeBits - 1             // snowflakeMaxNode максимальный номер узла
+	snowflakeMaxSeq   = 1<<snowflakeSeqBits - 1              // snowflakeMaxSeq максимальное значение счетчика
+	snowflakeTimeBits = snowflakeNodeBits + snowflakeSeqBits // snowflakeTimeBits сдвиг времени в идентификаторе
+)
+
+// snowflakeEpoch начало отсчета времени идентификаторов.
+var snowflakeEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Snowflake генератор коротких ссылок из идентификаторов в стиле Snowflake.
+//
+// Идентификатор - миллисекунды от snowflakeEpoch, номер узла и счетчик в пределах миллисекунды.
+// Узлы с разными номерами не дают коллизий без обращения к хранилищу.
+type Snowflake struct {
+	now      func() time.Time
+	alphabet string
+	length   int
+	node     int64
+	last     int64
+	seq      int64
+	mu       sync.Mutex
+}
+
+// NewSnowflake создание генератора коротких ссылок из идентификаторов в стиле Snowflake
+//
+// Аргументы
+//   - alphabet: символы короткой ссылки
+//   - length: минимальная длина короткой ссылки
+//   - node: номер узла, от 0 до 1023
+//
+// Возвращает
+//   - *Snowflake: генератор
+//   - error: ошибка, если номер узла вне диапазона
+func NewSnowflake(alphabet string, length int, node int64) (*Snowflake, error) {
+	if node < 0 || node > snowflakeMaxNode {
+		return nil, fmt.Errorf("snowflake node id must be between 0 and %d", snowflakeMaxNode)
+	}
+
+	return &Snowflake{now: time.Now, alphabet: alphabet, length: length, node: node}, nil
+}
+
+// Generate следующий идентификатор в системе счисления алфавита.
+func (g *Snowflake) Generate(_ context.Context, _ string, _ int) (string, error) {
+	return Encode(uint64(g.next()), g.alphabet, g.length), nil
+}
+
+// next следующий идентификатор, при исчерпании счетчика используется следующая миллисекунда.
+func (g *Snowflake) next() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := g.now().Sub(snowflakeEpoch).Milliseconds()
+	// При переводе часов назад время идентификаторов не уменьшается
+	if ms <= g.last {
+		g.seq++
+		if g.seq > snowflakeMaxSeq {
+			g.last++
+			g.seq = 0
+		}
+	} else {
+		g.last = ms
+		g.seq = 0
+	}
+
+	return g.last<<snowflakeTimeBits | g.node<<snowflakeSeqBits | g.seq
+}
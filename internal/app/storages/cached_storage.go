@@ -0,0 +1,342 @@
+package storages
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Erlast/short-url.git/internal/app/helpers"
+)
+
+// CacheStats счетчики кэша коротких ссылок.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// CachedStorage декоратор хранилища с LRU кэшем соответствий короткая ссылка - оригинальный URL.
+//
+// Кэшируются только действующие ссылки, запись живет не дольше ttl и не дольше срока действия ссылки.
+// Остальные методы хранилища вызываются без изменений.
+//
+// Для ссылок, которые читаются из хранилища при промахе, хранится поколение: удаление ссылки из кэша
+// увеличивает его, и прочитанная до удаления запись не попадает в кэш.
+type CachedStorage struct {
+	URLStorage
+	entries  map[string]*list.Element
+	reads    map[string]*cacheRead
+	order    *list.List
+	ttl      time.Duration
+	capacity int
+	hits     atomic.Uint64
+	misses   atomic.Uint64
+	mu       sync.Mutex
+}
+
+// cacheEntry запись кэша.
+type cacheEntry struct {
+	expiresAt   time.Time
+	shortURL    string
+	originalURL string
+}
+
+// cacheRead чтения ссылки из хранилища, выполняющиеся при промахе кэша.
+type cacheRead struct {
+	generation uint64
+	readers    int
+}
+
+// NewCachedStorage оборачивает хранилище кэшем
+//
+// Аргументы
+//   - next: оборачиваемое хранилище
+//   - capacity: максимальное количество записей кэша
+//   - ttl: время жизни записи кэша
+//
+// Возвращает
+//   - *CachedStorage: хранилище с кэшем
+func NewCachedStorage(next URLStorage, capacity int, ttl time.Duration) *CachedStorage {
+	return &CachedStorage{
+		URLStorage: next,
+		entries:    make(map[string]*list.Element, capacity),
+		reads:      map[string]*cacheRead{},
+		order:      list.New(),
+		ttl:        ttl,
+		capacity:   capacity,
+	}
+}
+
+// GetByID получение оригинального URL по короткой ссылке
+//
+// При промахе запись читается через GetShortURL, чтобы узнать срок действия ссылки.
+// Удаленные и истекшие ссылки возвращают те же ошибки, что и хранилища, и не кэшируются.
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//
+// Возвращает
+//   - string: оригинальный URL
+//   - error: ошибка выполнения
+func (s *CachedStorage) GetByID(ctx context.Context, id string) (string, error) {
+	now := time.Now()
+
+	if originalURL, ok := s.get(id, now); ok {
+		s.hits.Add(1)
+		return originalURL, nil
+	}
+	s.misses.Add(1)
+
+	generation := s.acquire(id)
+	defer s.release(id)
+
+	record, err := s.URLStorage.GetShortURL(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to get short URL: %w", err)
+	}
+
+	if record.IsDeleted {
+		return "", &helpers.ConflictError{
+			Err: helpers.NewIsDeletedErr("short url is deleted"),
+		}
+	}
+	if record.IsExpired(now) {
+		return "", fmt.Errorf("short URL %s: %w", id, helpers.ErrExpired)
+	}
+
+	expiresAt := now.Add(s.ttl)
+	if record.ExpiresAt != nil && record.ExpiresAt.Before(expiresAt) {
+		expiresAt = *record.ExpiresAt
+	}
+	s.set(id, record.OriginalURL, expiresAt, generation)
+
+	return record.OriginalURL, nil
+}
+
+// SaveURLWithOptions сохраняет оригинальный URL с дополнительными параметрами, алиас удаляется из кэша.
+func (s *CachedStorage) SaveURLWithOptions(
+	ctx context.Context,
+	originalURL string,
+	opts SaveOptions,
+) (string, error) {
+	if opts.Alias != "" {
+		s.remove(opts.Alias)
+	}
+
+	shortURL, err := s.URLStorage.SaveURLWithOptions(ctx, originalURL, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to save URL: %w", err)
+	}
+
+	return shortURL, nil
+}
+
+// LoadURLs сохраняет список оригинальных URL, алиасы удаляются из кэша.
+func (s *CachedStorage) LoadURLs(ctx context.Context, incoming []Incoming, baseURL string) ([]Output, error) {
+	for _, v := range incoming {
+		if v.Alias != "" {
+			s.remove(v.Alias)
+		}
+	}
+
+	outputs, err := s.URLStorage.LoadURLs(ctx, incoming, baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load URLs: %w", err)
+	}
+
+	return outputs, nil
+}
+
+// DeleteUserURLs удаляет спислок URL по переданному списку, ссылки удаляются из кэша.
+func (s *CachedStorage) DeleteUserURLs(ctx context.Context, listDeleted []string, logger *zap.SugaredLogger) error {
+	// Записи удаляются после обращения к хранилищу, чтобы параллельное чтение не вернуло ссылку в кэш
+	err := s.URLStorage.DeleteUserURLs(ctx, listDeleted, logger)
+	for _, id := range listDeleted {
+		s.remove(id)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to delete user URLs: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteURLs мягко удаляет ссылки нескольких пользователей, ссылки удаляются из кэша.
+func (s *CachedStorage) DeleteURLs(ctx context.Context, requests []DeleteRequest) error {
+	err := s.URLStorage.DeleteURLs(ctx, requests)
+	for _, req := range requests {
+		for _, id := range req.ShortURLs {
+			s.remove(id)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to delete URLs: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteHard удаляет URL которые были мягко удалены не позже момента deletedBefore,
+// а также URL, срок действия которых истек не позже этого момента.
+//
+// Хранилище не сообщает, какие ссылки удалены, поэтому кэш очищается полностью.
+func (s *CachedStorage) DeleteHard(ctx context.Context, deletedBefore time.Time) (int, error) {
+	removed, err := s.URLStorage.DeleteHard(ctx, deletedBefore)
+	s.purge()
+
+	if err != nil {
+		return removed, fmt.Errorf("failed to delete records: %w", err)
+	}
+
+	return removed, nil
+}
+
+// CheckPing проверка соединения с хранилищем, если оборачиваемое хранилище ее поддерживает.
+func (s *CachedStorage) CheckPing(ctx context.Context) error {
+	storagePinger, ok := s.URLStorage.(pinger)
+	if !ok {
+		return errors.New("storage doesn't support ping")
+	}
+
+	if err := storagePinger.CheckPing(ctx); err != nil {
+		return fmt.Errorf("failed to ping storage: %w", err)
+	}
+
+	return nil
+}
+
+// Close закрытие оборачиваемого хранилища.
+func (s *CachedStorage) Close() error {
+	if closer, ok := s.URLStorage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return fmt.Errorf("failed to close storage: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// CacheStats текущие значения счетчиков кэша.
+func (s *CachedStorage) CacheStats() CacheStats {
+	s.mu.Lock()
+	size := s.order.Len()
+	s.mu.Unlock()
+
+	return CacheStats{Hits: s.hits.Load(), Misses: s.misses.Load(), Size: size}
+}
+
+// get получение действующей записи кэша, запись становится самой свежей.
+func (s *CachedStorage) get(id string, now time.Time) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[id]
+	if !ok {
+		return "", false
+	}
+
+	entry, _ := element.Value.(*cacheEntry)
+	if !now.Before(entry.expiresAt) {
+		s.order.Remove(element)
+		delete(s.entries, id)
+		return "", false
+	}
+
+	s.order.MoveToFront(element)
+
+	return entry.originalURL, true
+}
+
+// acquire начало чтения ссылки из хранилища, возвращает текущее поколение ссылки.
+func (s *CachedStorage) acquire(id string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	read, ok := s.reads[id]
+	if !ok {
+		read = &cacheRead{}
+		s.reads[id] = read
+	}
+	read.readers++
+
+	return read.generation
+}
+
+// release окончание чтения ссылки из хранилища.
+func (s *CachedStorage) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if read, ok := s.reads[id]; ok {
+		read.readers--
+		if read.readers == 0 {
+			delete(s.reads, id)
+		}
+	}
+}
+
+// set добавление записи в кэш, при переполнении вытесняется самая давняя запись.
+//
+// Запись не добавляется, если с начала чтения generation ссылка была удалена из кэша.
+func (s *CachedStorage) set(id, originalURL string, expiresAt time.Time, generation uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if read, ok := s.reads[id]; ok && read.generation != generation {
+		return
+	}
+
+	if element, ok := s.entries[id]; ok {
+		entry, _ := element.Value.(*cacheEntry)
+		entry.originalURL = originalURL
+		entry.expiresAt = expiresAt
+		s.order.MoveToFront(element)
+		return
+	}
+
+	s.entries[id] = s.order.PushFront(&cacheEntry{shortURL: id, originalURL: originalURL, expiresAt: expiresAt})
+
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		entry, _ := oldest.Value.(*cacheEntry)
+		s.order.Remove(oldest)
+		delete(s.entries, entry.shortURL)
+	}
+}
+
+// remove удаление записи из кэша, выполняющиеся чтения ссылки не попадут в кэш.
+func (s *CachedStorage) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[id]; ok {
+		s.order.Remove(element)
+		delete(s.entries, id)
+	}
+	if read, ok := s.reads[id]; ok {
+		read.generation++
+	}
+}
+
+// purge очистка кэша, выполняющиеся чтения не попадут в кэш.
+func (s *CachedStorage) purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, read := range s.reads {
+		read.generation++
+	}
+
+	s.entries = make(map[string]*list.Element, s.capacity)
+	s.order.Init()
+}
@@ -2,11 +2,12 @@ package storages
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -17,26 +18,77 @@ const perm600 = 0o600                          // perm600 код доступа
 const perm777 = 0o777                          // perm777 код доступа к файлу (полный доступ)
 const errMsg = "error saving batch infile: %w" // errMsg шаблон ошибки сохранения списка ссылок в файл
 
+const defaultSyncInterval = time.Second // defaultSyncInterval период fsync журнала по умолчанию
+
+// FileStorageConfig параметры файлового хранилища.
+type FileStorageConfig struct {
+	// SyncPolicy - политика сброса журнала на диск, по умолчанию SyncInterval
+	SyncPolicy SyncPolicy
+	// SyncInterval - период fsync журнала для политики SyncInterval
+	SyncInterval time.Duration
+	// CompactInterval - период компактизации журнала, 0 - только при запуске
+	CompactInterval time.Duration
+}
+
 // FileStorage хранилище данных в файле.
+//
+// Файл - журнал событий в формате JSON lines: создание ссылки, мягкое удаление и восстановление ссылок
+// пользователя и удаление мягко удаленных и истекших ссылок. Каждое изменение дописывается в конец журнала
+// одной строкой, при запуске журнал воспроизводится в памяти. Компактизация заменяет журнал событиями
+// создания живых записей.
 type FileStorage struct {
 	*MemoryStorage
 	logger      *zap.SugaredLogger
+	journal     *journal
+	done        chan struct{}
 	fileStorage string
+	config      FileStorageConfig
+	wg          sync.WaitGroup
+	mu          sync.Mutex // mu изменения хранилища и запись журнала выполняются последовательно
 }
 
-// NewFileStorage инициализация файлового хранилища.
-func NewFileStorage(_ context.Context, fileStorage string, logger *zap.SugaredLogger) (*FileStorage, error) {
-	storage, err := loadStorageFromFile(
-		&FileStorage{
-			&MemoryStorage{
-				urls: map[string]ShortenURL{},
-			},
-			logger,
-			fileStorage},
-		logger)
-	if err != nil {
-		return nil, errors.New("unable to load storage")
+// NewFileStorage инициализация файлового хранилища
+//
+// Журнал воспроизводится в памяти, файл в прежнем формате (JSON массив) и журнал с удаленными
+// записями компактизируются сразу.
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - fileStorage: путь к файлу журнала
+//   - cfg: параметры хранилища, нулевые значения заменяются значениями по умолчанию
+//   - logger: логгер
+//
+// Возвращает
+//   - *FileStorage: файловое хранилище
+//   - error: ошибка выполнения
+func NewFileStorage(
+	_ context.Context,
+	fileStorage string,
+	cfg FileStorageConfig,
+	logger *zap.SugaredLogger,
+) (*FileStorage, error) {
+	if cfg.SyncPolicy == "" {
+		cfg.SyncPolicy = SyncInterval
+	}
+	if cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = defaultSyncInterval
 	}
+
+	storage := &FileStorage{
+		MemoryStorage: newMemoryStorage(),
+		logger:        logger,
+		fileStorage:   fileStorage,
+		config:        cfg,
+		done:          make(chan struct{}),
+	}
+
+	if err := storage.load(); err != nil {
+		return nil, fmt.Errorf("unable to load storage: %w", err)
+	}
+
+	storage.wg.Add(1)
+	go storage.maintain()
+
 	return storage, nil
 }
 
@@ -50,21 +102,24 @@ func NewFileStorage(_ context.Context, fileStorage string, logger *zap.SugaredLo
 //   - string: сокращенный URL
 //   - error: ошибка выполнения
 func (s *FileStorage) SaveURL(ctx context.Context, originalURL string) (string, error) {
-	shortURL, err := s.MemoryStorage.SaveURL(ctx, originalURL)
-	if err != nil {
-		return "", errors.New("unable to save storage")
-	}
+	return s.SaveURLWithOptions(ctx, originalURL, SaveOptions{})
+}
 
-	urls := make([]ShortenURL, 0, len(s.MemoryStorage.urls))
-	for _, value := range s.MemoryStorage.urls {
-		urls = append(urls, ShortenURL{ctx.Value(helpers.UserID), value.OriginalURL, value.ShortURL, value.ID, false})
-	}
-	err = saveToFileStorage(s, &urls)
-	if err != nil {
-		return "", errors.New("unable to save storage")
-	}
+// SaveURLWithOptions сохраняет оригинальный URL с дополнительными параметрами
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - originalURL: оригинальный URL
+//   - opts: дополнительные параметры сохранения
+//
+// Возвращает
+//   - string: сокращенный URL
+//   - error: ошибка выполнения, *helpers.AliasError если алиас недопустим или занят
+func (s *FileStorage) SaveURLWithOptions(ctx context.Context, originalURL string, opts SaveOptions) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return shortURL, nil
+	return s.save(ctx, originalURL, opts)
 }
 
 // LoadURLs сохраняет спислок оригинальных URL
@@ -82,29 +137,10 @@ func (s *FileStorage) LoadURLs(
 	incoming []Incoming,
 	baseURL string,
 ) ([]Output, error) {
-	err := s.load(s.fileStorage, s.logger)
-	if err != nil {
-		return nil, errors.New("unable to load storage")
-	}
-
-	outputs, err := s.MemoryStorage.LoadURLs(ctx, incoming, baseURL)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if err != nil {
-		return nil, fmt.Errorf(errMsg, err)
-	}
-	var urls = make([]ShortenURL, 0, len(s.MemoryStorage.urls))
-	for _, value := range s.MemoryStorage.urls {
-		lenItems := len(urls) + 1
-		urls = append(urls, ShortenURL{
-			ctx.Value(helpers.UserID),
-			value.OriginalURL,
-			value.ShortURL,
-			lenItems,
-			value.IsDeleted,
-		})
-	}
-
-	err = s.save(&urls)
+	outputs, err := s.MemoryStorage.loadURLs(ctx, incoming, baseURL, s.save)
 	if err != nil {
 		return nil, fmt.Errorf(errMsg, err)
 	}
@@ -126,140 +162,420 @@ func (s *FileStorage) DeleteUserURLs(
 	listDeleted []string,
 	logger *zap.SugaredLogger,
 ) error {
-	err := s.MemoryStorage.DeleteUserURLs(ctx, listDeleted, logger)
-	if err != nil {
-		return errors.New("unable to delete users")
-	}
-	var urls = make([]ShortenURL, 0, len(s.MemoryStorage.urls))
-	for _, value := range s.MemoryStorage.urls {
-		lenItems := len(urls) + 1
-		urls = append(urls, ShortenURL{
-			ctx.Value(helpers.UserID),
-			value.OriginalURL,
-			value.ShortURL,
-			lenItems,
-			value.IsDeleted,
-		})
-	}
-	err = s.save(&urls)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID := ctx.Value(helpers.UserID)
+	now := time.Now().UTC()
+	s.MemoryStorage.deleteUserURLs(userID, listDeleted, now, logger)
+
+	err := s.journal.append(journalEvent{Op: journalDelete, UserID: userID, ShortURLs: listDeleted, At: now})
 	if err != nil {
 		return fmt.Errorf(errMsg, err)
 	}
 	return nil
 }
 
-// DeleteHard удаляет URL которые ранее были мягко удалены
+// DeleteURLs мягко удаляет ссылки нескольких пользователей, каждый запрос записывается в журнал
 //
 // Аргументы
 //   - ctx: контектс выполнения
+//   - requests[]: запросы пользователей на удаление
 //
 // Возвращает
 //   - error: ошибка выполнения
-func (s *FileStorage) DeleteHard(ctx context.Context) error {
-	err := s.MemoryStorage.DeleteHard(ctx)
-	if err != nil {
-		return errors.New("unable to delete hard")
-	}
-	var urls = make([]ShortenURL, 0, len(s.MemoryStorage.urls))
-	for _, value := range s.MemoryStorage.urls {
-		lenItems := len(urls) + 1
-		urls = append(urls, ShortenURL{
-			ctx.Value(helpers.UserID),
-			value.OriginalURL,
-			value.ShortURL,
-			lenItems,
-			value.IsDeleted,
-		})
-	}
-	err = s.save(&urls)
-	if err != nil {
-		return fmt.Errorf(errMsg, err)
+func (s *FileStorage) DeleteURLs(_ context.Context, requests []DeleteRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, req := range requests {
+		s.MemoryStorage.deleteUserURLs(req.UserID, req.ShortURLs, now, nil)
+
+		err := s.journal.append(journalEvent{Op: journalDelete, UserID: req.UserID, ShortURLs: req.ShortURLs, At: now})
+		if err != nil {
+			return fmt.Errorf(errMsg, err)
+		}
 	}
 	return nil
 }
 
-func saveToFileStorage(s *FileStorage, url *[]ShortenURL) error {
-	if err := s.save(url); err != nil {
+// RestoreURLs восстановление мягко удаленных ссылок, которыми управляет пользователь
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - shortURLs[]: короткие ссылки
+//
+// Возвращает
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка не удалена, истекла или недоступна пользователю
+func (s *FileStorage) RestoreURLs(ctx context.Context, shortURLs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID := ctx.Value(helpers.UserID)
+	now := time.Now()
+	if err := s.MemoryStorage.restoreURLs(userID, shortURLs, now); err != nil {
 		return err
 	}
 
+	err := s.journal.append(journalEvent{Op: journalRestore, UserID: userID, ShortURLs: shortURLs, At: now})
+	if err != nil {
+		return fmt.Errorf("unable to save storage: %w", err)
+	}
 	return nil
 }
 
-func loadStorageFromFile(storage *FileStorage, logger *zap.SugaredLogger) (*FileStorage, error) {
-	fname := storage.fileStorage
+// DeleteHard удаляет URL которые были мягко удалены не позже момента deletedBefore,
+// а также URL, срок действия которых истек не позже этого момента
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - deletedBefore: граница срока хранения мягко удаленных и истекших URL
+//
+// Возвращает
+//   - int: количество удаленных URL
+//   - error: ошибка выполнения
+func (s *FileStorage) DeleteHard(_ context.Context, deletedBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if err := storage.load(fname, logger); err != nil {
-		return &FileStorage{}, err
-	}
+	now := time.Now()
+	removed := s.MemoryStorage.deleteHard(deletedBefore)
 
-	return storage, nil
+	if err := s.journal.append(journalEvent{Op: journalHardDelete, At: now, Before: &deletedBefore}); err != nil {
+		return removed, fmt.Errorf(errMsg, err)
+	}
+	return removed, nil
 }
 
-func (s *FileStorage) save(urls *[]ShortenURL) error {
-	data, err := json.MarshalIndent(urls, "", "   ")
-	if err != nil {
-		return errors.New("marshal indent error")
+// Close останавливает обслуживание журнала, сбрасывает его на диск и закрывает файл.
+func (s *FileStorage) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+		close(s.done)
 	}
+	s.wg.Wait()
 
-	err = os.WriteFile(s.fileStorage, data, perm600)
-	if err != nil {
-		return fmt.Errorf("unable to read file: %w", err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.journal.close(); err != nil {
+		return fmt.Errorf("unable to flush storage: %w", err)
 	}
+
 	return nil
 }
 
-func (s *FileStorage) load(fname string, logger *zap.SugaredLogger) error {
-	err := createFileIfNotExists(fname, s, logger)
+// TransferURL передача владения короткой ссылкой другому пользователю
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//   - userID: новый владелец
+//
+// Возвращает
+//   - error: ошибка выполнения
+func (s *FileStorage) TransferURL(ctx context.Context, id string, userID string) error {
+	return s.record(journalEvent{
+		Op: journalTransfer, UserID: ctx.Value(helpers.UserID), ShortURLs: []string{id}, Target: userID,
+	})
+}
 
+// ShareURL выдача пользователю доступа к короткой ссылке
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//   - userID: пользователь, получающий доступ
+//   - access: уровень доступа
+//
+// Возвращает
+//   - error: ошибка выполнения
+func (s *FileStorage) ShareURL(ctx context.Context, id string, userID string, access Access) error {
+	return s.record(journalEvent{
+		Op: journalShare, UserID: ctx.Value(helpers.UserID), ShortURLs: []string{id}, Target: userID, Access: access,
+	})
+}
+
+// RevokeURLShare отзыв доступа пользователя к короткой ссылке
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//   - userID: пользователь, у которого отзывается доступ
+//
+// Возвращает
+//   - error: ошибка выполнения
+func (s *FileStorage) RevokeURLShare(ctx context.Context, id string, userID string) error {
+	return s.record(journalEvent{
+		Op: journalRevoke, UserID: ctx.Value(helpers.UserID), ShortURLs: []string{id}, Target: userID,
+	})
+}
+
+// Compact заменяет журнал событиями, воссоздающими текущее состояние хранилища.
+func (s *FileStorage) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.compact()
+}
+
+// save сохраняет ссылку в памяти и дописывает событие создания в журнал, вызывается под s.mu.
+func (s *FileStorage) save(ctx context.Context, originalURL string, opts SaveOptions) (string, error) {
+	shortURL, err := s.MemoryStorage.SaveURLWithOptions(ctx, originalURL, opts)
 	if err != nil {
+		return "", fmt.Errorf("unable to save storage: %w", err)
+	}
+
+	record, ok := s.MemoryStorage.get(shortURL)
+	if !ok {
+		return "", errors.New("unable to save storage")
+	}
+
+	if err := s.journal.append(journalEvent{Op: journalCreate, Record: &record, At: time.Now()}); err != nil {
+		return "", fmt.Errorf("unable to save storage: %w", err)
+	}
+
+	return shortURL, nil
+}
+
+// record применение события управления доступом к хранилищу и запись его в журнал.
+func (s *FileStorage) record(event journalEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.applyACL(&event); err != nil {
 		return err
 	}
 
-	data, err := os.ReadFile(fname)
-	if err != nil {
-		return fmt.Errorf("unable to read file: %w", err)
+	event.At = time.Now()
+	if err := s.journal.append(event); err != nil {
+		return fmt.Errorf("unable to save storage: %w", err)
+	}
+
+	return nil
+}
+
+// applyACL применение события передачи владения, выдачи или отзыва доступа.
+func (s *FileStorage) applyACL(event *journalEvent) error {
+	if len(event.ShortURLs) != 1 {
+		return errors.New("access event must contain one short url")
+	}
+	id := event.ShortURLs[0]
+
+	switch event.Op {
+	case journalTransfer:
+		return s.MemoryStorage.transferURL(event.UserID, id, event.Target)
+	case journalShare:
+		return s.MemoryStorage.shareURL(event.UserID, id, event.Target, event.Access)
+	case journalRevoke:
+		return s.MemoryStorage.revokeURLShare(event.UserID, id, event.Target)
+	default:
+		return fmt.Errorf("unknown access event %q", event.Op)
+	}
+}
+
+// snapshot события, воссоздающие текущее состояние хранилища: создание записей, выдача доступа
+// и мягкое удаление от имени владельца.
+//
+// Доступ выдается только к не удаленной ссылке, поэтому удаленные записи с доступами создаются
+// действующими и удаляются после выдачи доступа, иначе доступ к ним терялся бы при компактизации.
+func (s *FileStorage) snapshot() []journalEvent {
+	records := s.MemoryStorage.records()
+	shares := s.MemoryStorage.shares()
+
+	events := make([]journalEvent, 0, len(records)+len(shares))
+	var deleted []journalEvent
+	for i := range records {
+		record := records[i]
+		if record.IsDeleted && len(shares[record.ShortURL]) > 0 {
+			var at time.Time
+			if record.DeletedAt != nil {
+				at = *record.DeletedAt
+			}
+			deleted = append(deleted, journalEvent{
+				Op:        journalDelete,
+				UserID:    record.UserID,
+				ShortURLs: []string{record.ShortURL},
+				At:        at,
+			})
+			record.IsDeleted, record.DeletedAt = false, nil
+		}
+		events = append(events, journalEvent{Op: journalCreate, Record: &record})
+	}
+	for i := range records {
+		for userID, access := range shares[records[i].ShortURL] {
+			events = append(events, journalEvent{
+				Op:        journalShare,
+				UserID:    records[i].UserID,
+				ShortURLs: []string{records[i].ShortURL},
+				Target:    userID,
+				Access:    access,
+			})
+		}
 	}
-	var urls []ShortenURL
-	err = json.Unmarshal(data, &urls)
+
+	return append(events, deleted...)
+}
+
+// compact перезапись журнала и открытие нового файла на дозапись, вызывается под s.mu.
+//
+// При ошибке записи снимка прежний журнал остается на месте и продолжает использоваться.
+func (s *FileStorage) compact() error {
+	events := s.snapshot()
+
+	if err := writeSnapshot(s.fileStorage, events); err != nil {
+		return err
+	}
+
+	j, err := openJournal(s.fileStorage, s.config.SyncPolicy, len(events))
 	if err != nil {
-		return errors.New("unable to unmarshal")
+		return err
 	}
 
-	for _, v := range urls {
-		s.MemoryStorage.urls[v.ShortURL] = v
+	if s.journal != nil {
+		if err := s.journal.close(); err != nil {
+			s.logger.Errorf("unable to close compacted journal: %v", err)
+		}
 	}
+	s.journal = j
 
 	return nil
 }
 
-func createFileIfNotExists(fname string, s *FileStorage, logger *zap.SugaredLogger) error {
-	_, err := os.Stat(filepath.Dir(fname))
+// load воспроизведение журнала в памяти и открытие его на дозапись
+//
+// Поврежденный файл не мешает запуску: восстанавливаются все читаемые записи, сам файл переименовывается
+// для последующего разбора, а вместо него записывается журнал восстановленных записей. Прерванная
+// последняя запись, например при сбое узла, повреждением не считается и отбрасывается.
+func (s *FileStorage) load() error {
+	if err := createDirIfNotExists(s.fileStorage); err != nil {
+		return err
+	}
 
-	if os.IsNotExist(err) {
-		err := os.MkdirAll(filepath.Dir(fname), perm777)
+	report, err := readJournal(s.fileStorage, s.apply)
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			return errors.New("can't create directory")
+	if report.invalid > 0 {
+		quarantine := fmt.Sprintf("%s.corrupt-%s", s.fileStorage, time.Now().Format("20060102T150405.000000000"))
+		if err := os.Rename(s.fileStorage, quarantine); err != nil {
+			return fmt.Errorf("unable to quarantine corrupted storage: %w", err)
 		}
+		s.logger.Errorw("file storage is corrupted, valid records recovered",
+			"file", s.fileStorage,
+			"quarantine", quarantine,
+			"recovered_events", report.events,
+			"invalid_entries", report.invalid,
+			"records", len(s.MemoryStorage.records()),
+		)
+		return s.compact()
 	}
 
-	_, err = os.Stat(fname)
-	if os.IsNotExist(err) {
-		file, err := os.OpenFile(fname, os.O_CREATE|os.O_RDONLY, perm777)
-		if err != nil {
-			return errors.New("can't create file path")
+	if report.torn > 0 {
+		if err := truncateJournal(s.fileStorage, report.torn); err != nil {
+			return err
 		}
-		defer func(file *os.File) {
-			err := file.Close()
+		s.logger.Warnw("file storage ends with an incomplete record, it is discarded",
+			"file", s.fileStorage,
+			"discarded_bytes", report.torn,
+		)
+	}
+
+	if report.legacy || report.events > len(s.snapshot()) {
+		return s.compact()
+	}
+
+	s.journal, err = openJournal(s.fileStorage, s.config.SyncPolicy, report.events)
+	return err
+}
+
+// apply применение события журнала к хранилищу в памяти, false - событие повреждено.
+func (s *FileStorage) apply(event *journalEvent) bool {
+	switch event.Op {
+	case journalCreate:
+		if event.Record == nil || event.Record.ShortURL == "" {
+			return false
+		}
+		s.MemoryStorage.put(*event.Record)
+	case journalDelete:
+		s.MemoryStorage.deleteUserURLs(event.UserID, event.ShortURLs, event.At, nil)
+	case journalRestore:
+		// Восстановление записано после успешного выполнения и при воспроизведении выполнится так же
+		_ = s.MemoryStorage.restoreURLs(event.UserID, event.ShortURLs, event.At)
+	case journalHardDelete:
+		// События до появления срока хранения удаляли все мягко удаленные записи
+		before := event.At
+		if event.Before != nil {
+			before = *event.Before
+		}
+		s.MemoryStorage.deleteHard(before)
+	case journalTransfer, journalShare, journalRevoke:
+		if len(event.ShortURLs) != 1 {
+			return false
+		}
+		// Событие записано после успешного выполнения, при воспроизведении в том же порядке оно выполнится так же
+		_ = s.applyACL(event)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// maintain периодический fsync журнала и его компактизация до вызова Close.
+func (s *FileStorage) maintain() {
+	defer s.wg.Done()
+
+	var syncTick, compactTick <-chan time.Time
+
+	if s.config.SyncPolicy == SyncInterval {
+		ticker := time.NewTicker(s.config.SyncInterval)
+		defer ticker.Stop()
+		syncTick = ticker.C
+	}
+	if s.config.CompactInterval > 0 {
+		ticker := time.NewTicker(s.config.CompactInterval)
+		defer ticker.Stop()
+		compactTick = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-syncTick:
+			s.mu.Lock()
+			err := s.journal.sync()
+			s.mu.Unlock()
+			if err != nil {
+				s.logger.Errorf("unable to sync journal: %v", err)
+			}
+		case <-compactTick:
+			s.mu.Lock()
+			var err error
+			if s.journal.events > len(s.snapshot()) {
+				err = s.compact()
+			}
+			s.mu.Unlock()
 			if err != nil {
-				logger.Error("unable to close file: ", err)
+				s.logger.Errorf("unable to compact journal: %v", err)
 			}
-		}(file)
+		}
+	}
+}
 
-		var urls []ShortenURL
-		if err := s.save(&urls); err != nil {
-			return err
+func createDirIfNotExists(fname string) error {
+	_, err := os.Stat(filepath.Dir(fname))
+
+	if os.IsNotExist(err) {
+		err := os.MkdirAll(filepath.Dir(fname), perm777)
+
+		if err != nil {
+			return errors.New("can't create directory")
 		}
 	}
 
@@ -0,0 +1,201 @@
+package storages
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// OperationObserver получатель длительности выполнения операций хранилища.
+type OperationObserver interface {
+	ObserveOperation(operation string, err error, duration time.Duration)
+}
+
+// pinger хранилище с проверкой соединения, декораторы передают проверку оборачиваемому хранилищу.
+type pinger interface {
+	CheckPing(ctx context.Context) error
+}
+
+// InstrumentedStorage декоратор хранилища, замеряющий время выполнения операций.
+//
+// Ошибки хранилища возвращаются без изменений, поэтому проверки errors.Is и errors.As продолжают работать.
+type InstrumentedStorage struct {
+	next     URLStorage
+	observer OperationObserver
+}
+
+// NewInstrumentedStorage оборачивает хранилище для замера времени выполнения операций.
+func NewInstrumentedStorage(next URLStorage, observer OperationObserver) *InstrumentedStorage {
+	return &InstrumentedStorage{next: next, observer: observer}
+}
+
+// SaveURL сохраняет оригинальный URL.
+func (s *InstrumentedStorage) SaveURL(ctx context.Context, originalURL string) (string, error) {
+	start := time.Now()
+	shortURL, err := s.next.SaveURL(ctx, originalURL)
+	return shortURL, s.observe("save_url", start, err)
+}
+
+// SaveURLWithOptions сохраняет оригинальный URL с дополнительными параметрами.
+func (s *InstrumentedStorage) SaveURLWithOptions(
+	ctx context.Context,
+	originalURL string,
+	opts SaveOptions,
+) (string, error) {
+	start := time.Now()
+	shortURL, err := s.next.SaveURLWithOptions(ctx, originalURL, opts)
+	return shortURL, s.observe("save_url_with_options", start, err)
+}
+
+// GetByID получение оригинального URL по короткой ссылке.
+func (s *InstrumentedStorage) GetByID(ctx context.Context, id string) (string, error) {
+	start := time.Now()
+	originalURL, err := s.next.GetByID(ctx, id)
+	return originalURL, s.observe("get_by_id", start, err)
+}
+
+// GetShortURL получение записи о короткой ссылке независимо от ее состояния.
+func (s *InstrumentedStorage) GetShortURL(ctx context.Context, id string) (*ShortenURL, error) {
+	start := time.Now()
+	shortURL, err := s.next.GetShortURL(ctx, id)
+	return shortURL, s.observe("get_short_url", start, err)
+}
+
+// IsExists проверка существования URL.
+func (s *InstrumentedStorage) IsExists(ctx context.Context, key string) bool {
+	start := time.Now()
+	exists := s.next.IsExists(ctx, key)
+	_ = s.observe("is_exists", start, nil)
+	return exists
+}
+
+// LoadURLs сохраняет список оригинальных URL.
+func (s *InstrumentedStorage) LoadURLs(ctx context.Context, incoming []Incoming, baseURL string) ([]Output, error) {
+	start := time.Now()
+	result, err := s.next.LoadURLs(ctx, incoming, baseURL)
+	return result, s.observe("load_urls", start, err)
+}
+
+// GetUserURLs получение списка оригинальных URL пользователя.
+func (s *InstrumentedStorage) GetUserURLs(ctx context.Context, baseURL string) ([]UserURLs, error) {
+	start := time.Now()
+	result, err := s.next.GetUserURLs(ctx, baseURL)
+	return result, s.observe("get_user_urls", start, err)
+}
+
+// GetUserURLsPage постраничное получение всех ссылок пользователя.
+func (s *InstrumentedStorage) GetUserURLsPage(
+	ctx context.Context,
+	cursor string,
+	limit int,
+) ([]ShortenURL, string, error) {
+	start := time.Now()
+	result, next, err := s.next.GetUserURLsPage(ctx, cursor, limit)
+	return result, next, s.observe("get_user_urls_page", start, err)
+}
+
+// DeleteUserURLs удаляет список URL пользователя.
+func (s *InstrumentedStorage) DeleteUserURLs(
+	ctx context.Context,
+	listDeleted []string,
+	logger *zap.SugaredLogger,
+) error {
+	start := time.Now()
+	return s.observe("delete_user_urls", start, s.next.DeleteUserURLs(ctx, listDeleted, logger))
+}
+
+// DeleteURLs мягко удаляет ссылки нескольких пользователей.
+func (s *InstrumentedStorage) DeleteURLs(ctx context.Context, requests []DeleteRequest) error {
+	start := time.Now()
+	return s.observe("delete_urls", start, s.next.DeleteURLs(ctx, requests))
+}
+
+// GetDeletedURLs получение списка мягко удаленных ссылок пользователя.
+func (s *InstrumentedStorage) GetDeletedURLs(ctx context.Context, baseURL string) ([]DeletedURL, error) {
+	start := time.Now()
+	result, err := s.next.GetDeletedURLs(ctx, baseURL)
+	return result, s.observe("get_deleted_urls", start, err)
+}
+
+// RestoreURLs восстановление мягко удаленных ссылок пользователя.
+func (s *InstrumentedStorage) RestoreURLs(ctx context.Context, shortURLs []string) error {
+	start := time.Now()
+	return s.observe("restore_urls", start, s.next.RestoreURLs(ctx, shortURLs))
+}
+
+// DeleteHard удаляет URL которые были мягко удалены не позже момента deletedBefore,
+// а также URL, срок действия которых истек не позже этого момента.
+func (s *InstrumentedStorage) DeleteHard(ctx context.Context, deletedBefore time.Time) (int, error) {
+	start := time.Now()
+	removed, err := s.next.DeleteHard(ctx, deletedBefore)
+	return removed, s.observe("delete_hard", start, err)
+}
+
+// GetStats подсчет количества URL и пользователей.
+func (s *InstrumentedStorage) GetStats(ctx context.Context) (*InternalStats, error) {
+	start := time.Now()
+	stats, err := s.next.GetStats(ctx)
+	return stats, s.observe("get_stats", start, err)
+}
+
+// URLAccess уровень доступа пользователя к короткой ссылке.
+func (s *InstrumentedStorage) URLAccess(ctx context.Context, id string) (Access, error) {
+	start := time.Now()
+	access, err := s.next.URLAccess(ctx, id)
+	return access, s.observe("url_access", start, err)
+}
+
+// TransferURL передача владения короткой ссылкой другому пользователю.
+func (s *InstrumentedStorage) TransferURL(ctx context.Context, id string, userID string) error {
+	start := time.Now()
+	return s.observe("transfer_url", start, s.next.TransferURL(ctx, id, userID))
+}
+
+// ShareURL выдача пользователю доступа к короткой ссылке.
+func (s *InstrumentedStorage) ShareURL(ctx context.Context, id string, userID string, access Access) error {
+	start := time.Now()
+	return s.observe("share_url", start, s.next.ShareURL(ctx, id, userID, access))
+}
+
+// RevokeURLShare отзыв доступа пользователя к короткой ссылке.
+func (s *InstrumentedStorage) RevokeURLShare(ctx context.Context, id string, userID string) error {
+	start := time.Now()
+	return s.observe("revoke_url_share", start, s.next.RevokeURLShare(ctx, id, userID))
+}
+
+// GetURLShares список доступов к короткой ссылке.
+func (s *InstrumentedStorage) GetURLShares(ctx context.Context, id string) ([]Share, error) {
+	start := time.Now()
+	shares, err := s.next.GetURLShares(ctx, id)
+	return shares, s.observe("get_url_shares", start, err)
+}
+
+// CheckPing проверка соединения с хранилищем, если оборачиваемое хранилище ее поддерживает.
+func (s *InstrumentedStorage) CheckPing(ctx context.Context) error {
+	storagePinger, ok := s.next.(pinger)
+	if !ok {
+		return errors.New("storage doesn't support ping")
+	}
+
+	start := time.Now()
+	return s.observe("check_ping", start, storagePinger.CheckPing(ctx))
+}
+
+// Close закрытие оборачиваемого хранилища.
+func (s *InstrumentedStorage) Close() error {
+	if closer, ok := s.next.(io.Closer); ok {
+		start := time.Now()
+		return s.observe("close", start, closer.Close())
+	}
+
+	return nil
+}
+
+// observe передает длительность операции наблюдателю и возвращает ошибку без изменений.
+func (s *InstrumentedStorage) observe(operation string, start time.Time, err error) error {
+	s.observer.ObserveOperation(operation, err, time.Since(start))
+	return err
+}
@@ -0,0 +1,274 @@
+package storages
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Erlast/short-url.git/internal/app/fileutil"
+)
+
+// SyncPolicy политика сброса журнала файлового хранилища на диск.
+type SyncPolicy string
+
+const (
+	// SyncAlways fsync после каждого события, события не теряются при сбое узла.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval fsync раз в интервал, при сбое узла теряются события последнего интервала.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever сброс на диск выполняет операционная система.
+	SyncNever SyncPolicy = "never"
+)
+
+// journalOp тип события журнала.
+type journalOp string
+
+const (
+	journalCreate     journalOp = "create"      // journalCreate создание ссылки
+	journalDelete     journalOp = "delete"      // journalDelete мягкое удаление ссылок пользователя
+	journalHardDelete journalOp = "hard_delete" // journalHardDelete удаление мягко удаленных и истекших ссылок
+	journalTransfer   journalOp = "transfer"    // journalTransfer передача владения ссылкой
+	journalShare      journalOp = "share"       // journalShare выдача доступа к ссылке
+	journalRevoke     journalOp = "revoke"      // journalRevoke отзыв доступа к ссылке
+	journalRestore    journalOp = "restore"     // journalRestore восстановление мягко удаленных ссылок
+)
+
+// journalEvent событие журнала, одна строка JSON.
+//
+// UserID - пользователь, выполнивший операцию, Target - новый владелец или пользователь, получающий
+// или теряющий доступ.
+type journalEvent struct {
+	At        time.Time   `json:"at"`
+	Record    *ShortenURL `json:"record,omitempty"`
+	Before    *time.Time  `json:"before,omitempty"`
+	UserID    any         `json:"user_id,omitempty"`
+	Op        journalOp   `json:"op"`
+	Target    string      `json:"target,omitempty"`
+	Access    Access      `json:"access,omitempty"`
+	ShortURLs []string    `json:"short_urls,omitempty"`
+}
+
+// journal журнал событий файлового хранилища, открытый на дозапись.
+type journal struct {
+	file   *os.File
+	policy SyncPolicy
+	events int
+	dirty  bool
+}
+
+// openJournal открытие журнала на дозапись, файл создается при отсутствии.
+func openJournal(name string, policy SyncPolicy, events int) (*journal, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, perm600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open journal: %w", err)
+	}
+
+	return &journal{file: file, policy: policy, events: events}, nil
+}
+
+// append дозапись события в журнал.
+func (j *journal) append(event journalEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to marshal journal event: %w", err)
+	}
+
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("unable to write journal: %w", err)
+	}
+	j.events++
+	j.dirty = true
+
+	if j.policy == SyncAlways {
+		return j.sync()
+	}
+
+	return nil
+}
+
+// sync сброс записанных событий на диск.
+func (j *journal) sync() error {
+	if !j.dirty {
+		return nil
+	}
+
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("unable to sync journal: %w", err)
+	}
+	j.dirty = false
+
+	return nil
+}
+
+// close сброс событий на диск и закрытие журнала.
+func (j *journal) close() error {
+	syncErr := j.sync()
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("unable to close journal: %w", err)
+	}
+
+	return syncErr
+}
+
+// journalReport результат чтения журнала.
+type journalReport struct {
+	events  int  // events количество примененных событий
+	invalid int  // invalid количество поврежденных строк, для прежнего формата - поврежденный хвост файла
+	torn    int  // torn длина в байтах незавершенной последней строки
+	legacy  bool // legacy файл в прежнем формате
+}
+
+// readJournal чтение журнала с передачей событий в apply
+//
+// Файл в прежнем формате (JSON массив записей) читается как набор событий создания.
+// Поврежденные строки пропускаются и учитываются в отчете, из поврежденного JSON массива
+// читаются записи до места повреждения. Событие и перевод строки дописываются одной записью,
+// поэтому последняя строка без перевода строки - прерванная запись: она не применяется
+// и учитывается в отчете отдельно от поврежденных строк.
+//
+// Аргументы
+//   - name: имя файла журнала
+//   - apply: обработчик события, false - событие не может быть применено
+//
+// Возвращает
+//   - journalReport: результат чтения
+//   - error: ошибка открытия файла
+func readJournal(name string, apply func(event *journalEvent) bool) (journalReport, error) {
+	var report journalReport
+
+	file, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return report, nil
+		}
+		return report, fmt.Errorf("unable to open journal: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	reader := bufio.NewReader(file)
+
+	report.legacy, err = isLegacyFormat(reader)
+	if err != nil {
+		report.invalid++
+		return report, nil
+	}
+
+	if report.legacy {
+		readLegacy(reader, apply, &report)
+		return report, nil
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(bytes.TrimSpace(line)) > 0 {
+			report.torn = len(line)
+			return report, nil
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var event journalEvent
+			if json.Unmarshal(line, &event) != nil || !apply(&event) {
+				report.invalid++
+			} else {
+				report.events++
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return report, nil
+		}
+		if err != nil {
+			report.invalid++
+			return report, nil
+		}
+	}
+}
+
+// truncateJournal отбрасывание последних torn байт журнала с прерванной записью.
+func truncateJournal(name string, torn int) error {
+	file, err := os.OpenFile(name, os.O_WRONLY, perm600)
+	if err != nil {
+		return fmt.Errorf("unable to open journal: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to stat journal: %w", err)
+	}
+	if err := file.Truncate(info.Size() - int64(torn)); err != nil {
+		return fmt.Errorf("unable to truncate journal: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("unable to sync journal: %w", err)
+	}
+
+	return nil
+}
+
+// readLegacy чтение записей JSON массива до конца или до первого повреждения.
+func readLegacy(reader io.Reader, apply func(event *journalEvent) bool, report *journalReport) {
+	decoder := json.NewDecoder(reader)
+
+	// null - пустой файл хранилища прежнего формата
+	if token, err := decoder.Token(); err != nil || token == nil {
+		if err != nil {
+			report.invalid++
+		}
+		return
+	}
+
+	for decoder.More() {
+		var record ShortenURL
+		if err := decoder.Decode(&record); err != nil {
+			report.invalid++
+			return
+		}
+		if apply(&journalEvent{Op: journalCreate, Record: &record}) {
+			report.events++
+		} else {
+			report.invalid++
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		report.invalid++
+	}
+}
+
+// isLegacyFormat проверка, что файл содержит JSON массив или null.
+func isLegacyFormat(reader *bufio.Reader) (bool, error) {
+	for {
+		b, err := reader.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("unable to read journal: %w", err)
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		if err := reader.UnreadByte(); err != nil {
+			return false, fmt.Errorf("unable to read journal: %w", err)
+		}
+		return b == '[' || b == 'n', nil
+	}
+}
+
+// writeSnapshot запись журнала, состоящего из событий, воссоздающих текущее состояние хранилища.
+func writeSnapshot(name string, events []journalEvent) error {
+	return fileutil.WriteFileAtomic(name, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		for i := range events {
+			if err := encoder.Encode(&events[i]); err != nil {
+				return fmt.Errorf("unable to write snapshot: %w", err)
+			}
+		}
+		return nil
+	})
+}
@@ -4,24 +4,51 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/Erlast/short-url.git/internal/app/helpers"
+	"github.com/Erlast/short-url.git/internal/app/shortcode"
 )
 
-// MemoryStorage харнилище памяти.
+const memoryShards = 32 // memoryShards количество сегментов хранилища в памяти
+
+// MemoryStorage харнилище памяти, безопасное для конкурентного использования.
+//
+// Записи распределены по сегментам по хэшу короткой ссылки, у каждого сегмента своя блокировка,
+// поэтому запросы к разным ссылкам не ждут друг друга.
 type MemoryStorage struct {
-	urls map[string]ShortenURL
+	codes  shortcode.Generator
+	shards [memoryShards]*memoryShard
+	seq    atomic.Int64
+}
+
+// memoryShard сегмент хранилища в памяти.
+type memoryShard struct {
+	urls   map[string]ShortenURL
+	shares map[string]map[string]Access // shares доступ к ссылкам сегмента: короткая ссылка - пользователь - доступ
+	mu     sync.RWMutex
 }
 
 // NewMemoryStorage инициализация хранилища в памяти.
 func NewMemoryStorage(_ context.Context) (*MemoryStorage, error) {
-	store := &MemoryStorage{urls: map[string]ShortenURL{}}
-	return store, nil
+	return newMemoryStorage(), nil
+}
+
+func newMemoryStorage() *MemoryStorage {
+	store := &MemoryStorage{codes: shortcode.NewRandom(shortcode.DefaultAlphabet, shortcode.DefaultLength)}
+	for i := range store.shards {
+		store.shards[i] = &memoryShard{urls: map[string]ShortenURL{}, shares: map[string]map[string]Access{}}
+	}
+	return store
 }
 
 // SaveURL сохраняет оригинальный URL
@@ -34,20 +61,52 @@ func NewMemoryStorage(_ context.Context) (*MemoryStorage, error) {
 //   - string: сокращенный URL
 //   - error: ошибка выполнения
 func (s *MemoryStorage) SaveURL(ctx context.Context, originalURL string) (string, error) {
-	var shortURL string
-	for range 3 {
-		rndString := helpers.RandomString(helpers.LenString)
+	return s.SaveURLWithOptions(ctx, originalURL, SaveOptions{})
+}
 
-		if !s.IsExists(ctx, rndString) {
-			shortURL = rndString
-			continue
+// SaveURLWithOptions сохраняет оригинальный URL с дополнительными параметрами
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - originalURL: оригинальный URL
+//   - opts: дополнительные параметры сохранения
+//
+// Возвращает
+//   - string: сокращенный URL
+//   - error: ошибка выполнения, *helpers.AliasError если алиас недопустим или занят
+func (s *MemoryStorage) SaveURLWithOptions(ctx context.Context, originalURL string, opts SaveOptions) (string, error) {
+	now := time.Now().UTC()
+	record := ShortenURL{
+		UserID:      ctx.Value(helpers.UserID),
+		ExpiresAt:   opts.ExpiresAt,
+		CreatedAt:   &now,
+		OriginalURL: originalURL,
+		IsDeleted:   false,
+	}
+
+	if opts.Alias != "" {
+		if err := helpers.ValidateAlias(opts.Alias); err != nil {
+			return "", err
+		}
+		record.ShortURL = opts.Alias
+		if !s.insert(record) {
+			return "", &helpers.AliasError{Alias: opts.Alias, Err: helpers.ErrAliasExists}
 		}
-		return "", errors.New("failed to generate short url")
+		return record.ShortURL, nil
 	}
-	uuid := len(s.urls) + 1
-	s.urls[shortURL] = ShortenURL{ctx.Value(helpers.UserID), originalURL, shortURL, uuid, false}
 
-	return shortURL, nil
+	for attempt := range 3 {
+		shortURL, err := s.codes.Generate(ctx, originalURL, attempt)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate short url: %w", err)
+		}
+		record.ShortURL = shortURL
+		if s.insert(record) {
+			return record.ShortURL, nil
+		}
+	}
+
+	return "", errors.New("failed to generate short url")
 }
 
 // GetByID получение оригинального URL по короткой ссылке
@@ -60,7 +119,7 @@ func (s *MemoryStorage) SaveURL(ctx context.Context, originalURL string) (string
 //   - string: оригинальный URL
 //   - error: ошибка выполнения
 func (s *MemoryStorage) GetByID(_ context.Context, id string) (string, error) {
-	result, ok := s.urls[id]
+	result, ok := s.get(id)
 
 	if !ok {
 		return "", fmt.Errorf("short URL %s was not found", id)
@@ -72,9 +131,32 @@ func (s *MemoryStorage) GetByID(_ context.Context, id string) (string, error) {
 		}
 	}
 
+	if result.IsExpired(time.Now()) {
+		return "", fmt.Errorf("short URL %s: %w", id, helpers.ErrExpired)
+	}
+
 	return result.OriginalURL, nil
 }
 
+// GetShortURL получение записи о короткой ссылке независимо от ее состояния
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//
+// Возвращает
+//   - *ShortenURL: запись о короткой ссылке
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка не найдена
+func (s *MemoryStorage) GetShortURL(_ context.Context, id string) (*ShortenURL, error) {
+	result, ok := s.get(id)
+
+	if !ok {
+		return nil, fmt.Errorf("short URL %s: %w", id, helpers.ErrNotFound)
+	}
+
+	return &result, nil
+}
+
 // LoadURLs сохраняет список оригинальных URL
 //
 // Аргументы
@@ -90,10 +172,50 @@ func (s *MemoryStorage) LoadURLs(
 	incoming []Incoming,
 	baseURL string,
 ) ([]Output, error) {
-	outputs := make([]Output, 0, len(incoming))
+	return s.loadURLs(ctx, incoming, baseURL, s.SaveURLWithOptions)
+}
+
+// saveFunc функция сохранения одной ссылки.
+type saveFunc func(ctx context.Context, originalURL string, opts SaveOptions) (string, error)
+
+// loadURLs сохраняет список оригинальных URL, каждая ссылка сохраняется через save.
+//
+// Сроки действия и алиасы проверяются до сохранения, чтобы ошибка в них не оставляла пакет
+// сохраненным частично.
+func (s *MemoryStorage) loadURLs(
+	ctx context.Context,
+	incoming []Incoming,
+	baseURL string,
+	save saveFunc,
+) ([]Output, error) {
+	options := make([]SaveOptions, 0, len(incoming))
+	aliases := make(map[string]struct{})
+	now := time.Now()
 
 	for _, v := range incoming {
-		short, err := s.SaveURL(ctx, v.OriginalURL)
+		expiresAt, err := helpers.ResolveExpiry(v.ExpiresAt, v.TTLSeconds, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiry for %s: %w", v.CorrelationID, err)
+		}
+
+		if v.Alias != "" {
+			if err := helpers.ValidateAlias(v.Alias); err != nil {
+				return nil, err
+			}
+			_, taken := aliases[v.Alias]
+			if _, ok := s.get(v.Alias); ok || taken {
+				return nil, &helpers.AliasError{Alias: v.Alias, Err: helpers.ErrAliasExists}
+			}
+			aliases[v.Alias] = struct{}{}
+		}
+
+		options = append(options, SaveOptions{ExpiresAt: expiresAt, Alias: v.Alias})
+	}
+
+	outputs := make([]Output, 0, len(incoming))
+
+	for i, v := range incoming {
+		short, err := save(ctx, v.OriginalURL, options[i])
 		if err != nil {
 			return nil, fmt.Errorf("save batch error: %w", err)
 		}
@@ -122,7 +244,7 @@ func (s *MemoryStorage) LoadURLs(
 // Возвращает
 //   - bool: true - сслыка существует, false - ссылка не существует
 func (s *MemoryStorage) IsExists(_ context.Context, key string) bool {
-	_, ok := s.urls[key]
+	_, ok := s.get(key)
 	return ok
 }
 
@@ -137,15 +259,27 @@ func (s *MemoryStorage) IsExists(_ context.Context, key string) bool {
 //   - error: ошибка выполнения
 func (s *MemoryStorage) GetUserURLs(ctx context.Context, baseURL string) ([]UserURLs, error) {
 	var result []UserURLs
+	userID := ctx.Value(helpers.UserID)
 
-	for _, v := range s.urls {
-		if v.UserID == ctx.Value(helpers.UserID) && !v.IsDeleted {
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		for _, v := range shard.urls {
+			access := shard.access(&v, userID)
+			if v.IsDeleted || access == "" {
+				continue
+			}
 			shortURL, err := url.JoinPath(baseURL, "/", v.ShortURL)
 			if err != nil {
+				shard.mu.RUnlock()
 				return nil, fmt.Errorf("error getFullShortURL from two parts %w", err)
 			}
-			result = append(result, UserURLs{ShortURL: shortURL, OriginalURL: v.OriginalURL})
+			userURL := UserURLs{ShortURL: shortURL, OriginalURL: v.OriginalURL}
+			if access != AccessOwner {
+				userURL.Access = access
+			}
+			result = append(result, userURL)
 		}
+		shard.mu.RUnlock()
 	}
 
 	if len(result) == 0 {
@@ -155,6 +289,75 @@ func (s *MemoryStorage) GetUserURLs(ctx context.Context, baseURL string) ([]User
 	return result, nil
 }
 
+// GetUserURLsPage постраничное получение всех ссылок пользователя, включая удаленные и истекшие
+//
+// Ссылки упорядочены по идентификатору записи, курсор - идентификатор последней ссылки предыдущей страницы.
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - cursor: курсор, возвращенный предыдущим вызовом, пустая строка - первая страница
+//   - limit: максимальное количество ссылок на странице
+//
+// Возвращает
+//   - []ShortenURL: ссылки страницы
+//   - string: курсор следующей страницы, пустая строка если страница последняя
+//   - error: ошибка выполнения
+func (s *MemoryStorage) GetUserURLsPage(ctx context.Context, cursor string, limit int) ([]ShortenURL, string, error) {
+	after, err := parseIDCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("invalid page size %d", limit)
+	}
+	userID := ctx.Value(helpers.UserID)
+
+	var result []ShortenURL
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		for _, v := range shard.urls {
+			if v.ID > after && v.UserID == userID {
+				result = append(result, v)
+			}
+		}
+		shard.mu.RUnlock()
+	}
+
+	slices.SortFunc(result, func(a, b ShortenURL) int {
+		return a.ID - b.ID
+	})
+	if len(result) <= limit {
+		return result, "", nil
+	}
+
+	result = result[:limit]
+	return result, strconv.Itoa(result[limit-1].ID), nil
+}
+
+// GetStats подсчет количества не удаленных URL и пользователей, которым они принадлежат
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//
+// Возвращает
+//   - *InternalStats: статистика сервиса
+//   - error: ошибка выполнения
+func (s *MemoryStorage) GetStats(_ context.Context) (*InternalStats, error) {
+	users := make(map[any]struct{})
+	stats := &InternalStats{}
+
+	for _, v := range s.records() {
+		if v.IsDeleted {
+			continue
+		}
+		stats.URLs++
+		users[v.UserID] = struct{}{}
+	}
+	stats.Users = len(users)
+
+	return stats, nil
+}
+
 // DeleteUserURLs удаляет спислок URL по переданному списку
 //
 // Аргументы
@@ -169,48 +372,519 @@ func (s *MemoryStorage) DeleteUserURLs(
 	listDeleted []string,
 	logger *zap.SugaredLogger,
 ) error {
-	var wg sync.WaitGroup
+	s.deleteUserURLs(ctx.Value(helpers.UserID), listDeleted, time.Now().UTC(), logger)
+
+	return nil
+}
+
+// DeleteURLs мягко удаляет ссылки нескольких пользователей
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - requests[]: запросы пользователей на удаление
+//
+// Возвращает
+//   - error: ошибка выполнения
+func (s *MemoryStorage) DeleteURLs(_ context.Context, requests []DeleteRequest) error {
+	now := time.Now().UTC()
+	for _, req := range requests {
+		s.deleteUserURLs(req.UserID, req.ShortURLs, now, nil)
+	}
+
+	return nil
+}
+
+// deleteUserURLs мягко удаляет в момент at ссылки, которыми управляет пользователь userID,
+// ненайденные ссылки пишутся в logger, если он задан. Нулевой at - момент удаления не известен.
+func (s *MemoryStorage) deleteUserURLs(userID any, listDeleted []string, at time.Time, logger *zap.SugaredLogger) {
 	for _, v := range listDeleted {
-		v := v
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			result, ok := s.urls[v]
-			if !ok {
-				logger.Errorf("short URL %s was not found", v)
-				return
+		shard := s.shard(v)
+
+		shard.mu.Lock()
+		result, ok := shard.urls[v]
+		if ok && !result.IsDeleted && shard.access(&result, userID).CanManage() {
+			result.IsDeleted = true
+			result.DeletedAt = nil
+			if !at.IsZero() {
+				result.DeletedAt = &at
 			}
-			if result.UserID == ctx.Value(helpers.UserID) {
-				result.IsDeleted = true
-				s.urls[v] = result
+			shard.urls[v] = result
+		}
+		shard.mu.Unlock()
+
+		if !ok && logger != nil {
+			logger.Errorf("short URL %s was not found", v)
+		}
+	}
+}
+
+// GetDeletedURLs получение списка мягко удаленных ссылок, которыми управляет пользователь, кроме истекших
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - baseURL: базовый URL приложения
+//
+// Возвращает
+//   - []DeletedURL: удаленные ссылки, последние удаленные первыми
+//   - error: ошибка выполнения
+func (s *MemoryStorage) GetDeletedURLs(ctx context.Context, baseURL string) ([]DeletedURL, error) {
+	var result []DeletedURL
+	userID := ctx.Value(helpers.UserID)
+	now := time.Now()
+
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		for _, v := range shard.urls {
+			access := shard.access(&v, userID)
+			if !v.IsDeleted || v.IsExpired(now) || !access.CanManage() {
+				continue
 			}
-		}()
+			shortURL, err := url.JoinPath(baseURL, "/", v.ShortURL)
+			if err != nil {
+				shard.mu.RUnlock()
+				return nil, fmt.Errorf("error getFullShortURL from two parts %w", err)
+			}
+			deleted := DeletedURL{DeletedAt: v.DeletedAt, ShortURL: shortURL, OriginalURL: v.OriginalURL}
+			if access != AccessOwner {
+				deleted.Access = access
+			}
+			result = append(result, deleted)
+		}
+		shard.mu.RUnlock()
+	}
+
+	sortDeletedURLs(result)
+
+	return result, nil
+}
+
+// RestoreURLs восстановление мягко удаленных ссылок, которыми управляет пользователь
+//
+// Ссылки восстанавливаются, только если все они найдены в корзине пользователя. Хранилище в памяти
+// не требует уникальности оригинальных URL, а короткая ссылка остается занятой удаленной записью,
+// поэтому конфликтов при восстановлении не бывает.
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - shortURLs[]: короткие ссылки
+//
+// Возвращает
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка не удалена, истекла или недоступна пользователю
+func (s *MemoryStorage) RestoreURLs(ctx context.Context, shortURLs []string) error {
+	return s.restoreURLs(ctx.Value(helpers.UserID), shortURLs, time.Now())
+}
+
+// restoreURLs восстановление в момент at ссылок от имени пользователя userID.
+//
+// Сегменты всех ссылок блокируются на время проверки и восстановления, поэтому ссылки
+// восстанавливаются либо все, либо ни одна.
+func (s *MemoryStorage) restoreURLs(userID any, shortURLs []string, at time.Time) error {
+	unlock := s.lockShards(shortURLs)
+	defer unlock()
+
+	records := make([]ShortenURL, 0, len(shortURLs))
+	for _, id := range shortURLs {
+		record, err := s.shard(id).restorable(id, userID, at)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+
+	for i, id := range shortURLs {
+		records[i].IsDeleted = false
+		records[i].DeletedAt = nil
+		s.shard(id).urls[id] = records[i]
 	}
-	wg.Wait()
 
 	return nil
 }
 
-// DeleteHard удаляет URL которые ранее были мягко удалены
+// DeleteHard удаляет URL которые были мягко удалены не позже момента deletedBefore,
+// а также URL, срок действия которых истек не позже этого момента
 //
 // Аргументы
 //   - ctx: контектс выполнения
+//   - deletedBefore: граница срока хранения мягко удаленных и истекших URL
 //
 // Возвращает
+//   - int: количество удаленных URL
 //   - error: ошибка выполнения
-func (s *MemoryStorage) DeleteHard(_ context.Context) error {
-	var result []ShortenURL
+func (s *MemoryStorage) DeleteHard(_ context.Context, deletedBefore time.Time) (int, error) {
+	return s.deleteHard(deletedBefore), nil
+}
 
-	for _, v := range s.urls {
-		if !v.IsDeleted {
-			result = append(result, v)
+// deleteHard удаляет записи, мягко удаленные не позже момента before, и записи, срок действия
+// которых истек к этому моменту. Записи без времени удаления считаются удаленными давно.
+func (s *MemoryStorage) deleteHard(before time.Time) int {
+	removed := 0
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		for key, v := range shard.urls {
+			purge := v.IsDeleted && (v.DeletedAt == nil || !v.DeletedAt.After(before))
+			if purge || v.IsExpired(before) {
+				delete(shard.urls, key)
+				delete(shard.shares, key)
+				removed++
+			}
+		}
+		shard.mu.Unlock()
+	}
+
+	return removed
+}
+
+// codeSequence последовательность для генератора коротких ссылок - счетчик идентификаторов записей.
+//
+// Номер, выданный генератору, меньше идентификатора сохраненной с ним записи, поэтому после
+// восстановления хранилища из файла номера не повторяются.
+func (s *MemoryStorage) codeSequence() shortcode.Sequence {
+	return shortcode.SequenceFunc(func(context.Context) (int64, error) {
+		return s.seq.Add(1), nil
+	})
+}
+
+// setCodeGenerator замена генератора коротких ссылок, вызывается до использования хранилища.
+func (s *MemoryStorage) setCodeGenerator(codes shortcode.Generator) {
+	s.codes = codes
+}
+
+// URLAccess уровень доступа пользователя к короткой ссылке
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//
+// Возвращает
+//   - Access: уровень доступа
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка не найдена, удалена или недоступна пользователю
+func (s *MemoryStorage) URLAccess(ctx context.Context, id string) (Access, error) {
+	shard := s.shard(id)
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	_, access, err := shard.accessible(id, ctx.Value(helpers.UserID))
+	return access, err
+}
+
+// TransferURL передача владения короткой ссылкой другому пользователю
+//
+// Передать ссылку может только ее владелец, доступ нового владельца к ссылке, выданный ранее, удаляется.
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//   - userID: новый владелец
+//
+// Возвращает
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка недоступна,
+//     helpers.ErrForbidden если пользователь не владелец ссылки
+func (s *MemoryStorage) TransferURL(ctx context.Context, id string, userID string) error {
+	return s.transferURL(ctx.Value(helpers.UserID), id, userID)
+}
+
+// ShareURL выдача пользователю доступа к короткой ссылке
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//   - userID: пользователь, получающий доступ
+//   - access: уровень доступа AccessRead или AccessManage
+//
+// Возвращает
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка недоступна,
+//     helpers.ErrForbidden если у пользователя нет права на управление ссылкой,
+//     helpers.ErrShareInvalid если доступ выдается владельцу ссылки
+func (s *MemoryStorage) ShareURL(ctx context.Context, id string, userID string, access Access) error {
+	return s.shareURL(ctx.Value(helpers.UserID), id, userID, access)
+}
+
+// RevokeURLShare отзыв доступа пользователя к короткой ссылке, пользователь может отказаться от своего доступа сам
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//   - userID: пользователь, у которого отзывается доступ
+//
+// Возвращает
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка недоступна,
+//     helpers.ErrForbidden если у пользователя нет права на управление ссылкой
+func (s *MemoryStorage) RevokeURLShare(ctx context.Context, id string, userID string) error {
+	return s.revokeURLShare(ctx.Value(helpers.UserID), id, userID)
+}
+
+// GetURLShares список доступов к короткой ссылке
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//
+// Возвращает
+//   - []Share: доступы пользователей, упорядоченные по пользователю
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка недоступна,
+//     helpers.ErrForbidden если у пользователя нет права на управление ссылкой
+func (s *MemoryStorage) GetURLShares(ctx context.Context, id string) ([]Share, error) {
+	shard := s.shard(id)
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	if _, err := shard.manageable(id, ctx.Value(helpers.UserID)); err != nil {
+		return nil, err
+	}
+
+	result := make([]Share, 0, len(shard.shares[id]))
+	for userID, access := range shard.shares[id] {
+		result = append(result, Share{UserID: userID, Access: access})
+	}
+	slices.SortFunc(result, func(a, b Share) int { return strings.Compare(a.UserID, b.UserID) })
+
+	return result, nil
+}
+
+// transferURL передача владения ссылкой от имени пользователя actor, передать ссылку может только владелец.
+func (s *MemoryStorage) transferURL(actor any, id string, userID string) error {
+	shard := s.shard(id)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	record, access, err := shard.accessible(id, actor)
+	if err != nil {
+		return err
+	}
+	if access != AccessOwner {
+		return fmt.Errorf("short URL %s: %w", id, helpers.ErrForbidden)
+	}
+
+	record.UserID = userID
+	shard.urls[id] = record
+	delete(shard.shares[id], userID)
+
+	return nil
+}
+
+// shareURL выдача доступа к ссылке от имени пользователя actor.
+func (s *MemoryStorage) shareURL(actor any, id string, userID string, access Access) error {
+	shard := s.shard(id)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	record, err := shard.manageable(id, actor)
+	if err != nil {
+		return err
+	}
+	if record.UserID == userID || (access != AccessRead && access != AccessManage) {
+		return fmt.Errorf("share %s with %s: %w", id, userID, helpers.ErrShareInvalid)
+	}
+
+	if shard.shares[id] == nil {
+		shard.shares[id] = map[string]Access{}
+	}
+	shard.shares[id][userID] = access
+
+	return nil
+}
+
+// revokeURLShare отзыв доступа к ссылке от имени пользователя actor.
+func (s *MemoryStorage) revokeURLShare(actor any, id string, userID string) error {
+	shard := s.shard(id)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if actor != userID {
+		if _, err := shard.manageable(id, actor); err != nil {
+			return err
 		}
+	} else if _, _, err := shard.accessible(id, actor); err != nil {
+		return err
 	}
 
-	s.urls = make(map[string]ShortenURL)
-	for _, v := range result {
-		s.urls[strconv.Itoa(v.ID)] = v
+	delete(shard.shares[id], userID)
+	if len(shard.shares[id]) == 0 {
+		delete(shard.shares, id)
 	}
 
 	return nil
 }
+
+// shares снимок доступов к ссылкам: короткая ссылка - пользователь - доступ.
+func (s *MemoryStorage) shares() map[string]map[string]Access {
+	result := make(map[string]map[string]Access)
+
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		for id, users := range shard.shares {
+			result[id] = make(map[string]Access, len(users))
+			for userID, access := range users {
+				result[id][userID] = access
+			}
+		}
+		shard.mu.RUnlock()
+	}
+
+	return result
+}
+
+// access уровень доступа пользователя к записи сегмента, пусто - доступа нет, вызывается под shard.mu.
+func (shard *memoryShard) access(record *ShortenURL, userID any) Access {
+	if record.UserID == userID {
+		return AccessOwner
+	}
+
+	id, _ := userID.(string)
+	return shard.shares[record.ShortURL][id]
+}
+
+// accessible не удаленная запись, доступная пользователю, вызывается под shard.mu.
+func (shard *memoryShard) accessible(id string, userID any) (ShortenURL, Access, error) {
+	record, ok := shard.urls[id]
+	if !ok || record.IsDeleted {
+		return ShortenURL{}, "", fmt.Errorf("short URL %s: %w", id, helpers.ErrNotFound)
+	}
+
+	access := shard.access(&record, userID)
+	if access == "" {
+		return ShortenURL{}, "", fmt.Errorf("short URL %s: %w", id, helpers.ErrNotFound)
+	}
+
+	return record, access, nil
+}
+
+// manageable не удаленная запись, которой пользователь может управлять, вызывается под shard.mu.
+func (shard *memoryShard) manageable(id string, userID any) (ShortenURL, error) {
+	record, access, err := shard.accessible(id, userID)
+	if err != nil {
+		return ShortenURL{}, err
+	}
+	if !access.CanManage() {
+		return ShortenURL{}, fmt.Errorf("short URL %s: %w", id, helpers.ErrForbidden)
+	}
+
+	return record, nil
+}
+
+// restorable мягко удаленная запись, срок действия которой не истек к моменту at и которой
+// пользователь может управлять, вызывается под shard.mu.
+func (shard *memoryShard) restorable(id string, userID any, at time.Time) (ShortenURL, error) {
+	record, ok := shard.urls[id]
+	if !ok || !record.IsDeleted || record.IsExpired(at) || !shard.access(&record, userID).CanManage() {
+		return ShortenURL{}, fmt.Errorf("short URL %s: %w", id, helpers.ErrNotFound)
+	}
+
+	return record, nil
+}
+
+// sortDeletedURLs упорядочивание удаленных ссылок: последние удаленные первыми,
+// ссылки с неизвестным моментом удаления в конце.
+func sortDeletedURLs(urls []DeletedURL) {
+	slices.SortFunc(urls, func(a, b DeletedURL) int {
+		switch {
+		case a.DeletedAt != nil && b.DeletedAt != nil && !a.DeletedAt.Equal(*b.DeletedAt):
+			return b.DeletedAt.Compare(*a.DeletedAt)
+		case a.DeletedAt != nil && b.DeletedAt == nil:
+			return -1
+		case a.DeletedAt == nil && b.DeletedAt != nil:
+			return 1
+		default:
+			return strings.Compare(a.ShortURL, b.ShortURL)
+		}
+	})
+}
+
+// shard сегмент, в котором хранится короткая ссылка.
+func (s *MemoryStorage) shard(key string) *memoryShard {
+	return s.shards[shardIndex(key)]
+}
+
+// lockShards блокировка на запись сегментов коротких ссылок keys в порядке номеров сегментов,
+// чтобы одновременные вызовы не приводили к взаимной блокировке. Возвращает функцию снятия блокировок.
+func (s *MemoryStorage) lockShards(keys []string) func() {
+	var locked [memoryShards]bool
+	for _, key := range keys {
+		locked[shardIndex(key)] = true
+	}
+
+	for i := range s.shards {
+		if locked[i] {
+			s.shards[i].mu.Lock()
+		}
+	}
+
+	return func() {
+		for i := range s.shards {
+			if locked[i] {
+				s.shards[i].mu.Unlock()
+			}
+		}
+	}
+}
+
+// shardIndex номер сегмента короткой ссылки.
+func shardIndex(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32() % memoryShards
+}
+
+// get получение записи по короткой ссылке.
+func (s *MemoryStorage) get(key string) (ShortenURL, bool) {
+	shard := s.shard(key)
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	result, ok := shard.urls[key]
+	return result, ok
+}
+
+// insert атомарно добавляет запись, если короткая ссылка свободна, идентификатор записи назначается хранилищем.
+func (s *MemoryStorage) insert(record ShortenURL) bool {
+	shard := s.shard(record.ShortURL)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if _, ok := shard.urls[record.ShortURL]; ok {
+		return false
+	}
+
+	record.ID = int(s.seq.Add(1))
+	shard.urls[record.ShortURL] = record
+
+	return true
+}
+
+// put добавляет или заменяет запись как есть, используется при восстановлении хранилища из журнала.
+func (s *MemoryStorage) put(record ShortenURL) {
+	shard := s.shard(record.ShortURL)
+
+	shard.mu.Lock()
+	shard.urls[record.ShortURL] = record
+	shard.mu.Unlock()
+
+	for {
+		current := s.seq.Load()
+		if int64(record.ID) <= current || s.seq.CompareAndSwap(current, int64(record.ID)) {
+			return
+		}
+	}
+}
+
+// records снимок всех записей хранилища.
+func (s *MemoryStorage) records() []ShortenURL {
+	var result []ShortenURL
+
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		for _, v := range shard.urls {
+			result = append(result, v)
+		}
+		shard.mu.RUnlock()
+	}
+
+	return result
+}
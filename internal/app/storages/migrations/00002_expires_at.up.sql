@@ -0,0 +1,6 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ NULL;
+CREATE INDEX IF NOT EXISTS idx_expires_at ON short_urls(expires_at) WHERE expires_at IS NOT NULL;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,13 @@
+BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS clicks(
+        id BIGSERIAL PRIMARY KEY,
+        short VARCHAR(255) NOT NULL,
+        clicked_at TIMESTAMPTZ NOT NULL,
+        referrer TEXT NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        ip_hash VARCHAR(64) NOT NULL
+    );
+CREATE INDEX idx_clicks_short ON clicks(short, clicked_at);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN TRANSACTION;
+
+DROP SEQUENCE IF EXISTS short_code_seq;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN TRANSACTION;
+
+CREATE SEQUENCE IF NOT EXISTS short_code_seq AS BIGINT START WITH 1;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN TRANSACTION;
+
+DROP TABLE IF EXISTS url_shares;
+
+COMMIT;
\ No newline at end of file
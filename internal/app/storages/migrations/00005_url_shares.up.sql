@@ -0,0 +1,11 @@
+BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS url_shares(
+        url_id INTEGER NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+        user_id VARCHAR(255) NOT NULL,
+        access VARCHAR(16) NOT NULL,
+        PRIMARY KEY (url_id, user_id)
+    );
+CREATE INDEX IF NOT EXISTS idx_url_shares_user ON url_shares(user_id);
+
+COMMIT;
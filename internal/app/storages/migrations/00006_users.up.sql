@@ -0,0 +1,18 @@
+BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS users(
+        id VARCHAR(255) PRIMARY KEY,
+        login VARCHAR(255) NOT NULL,
+        password_hash VARCHAR(255) NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+CREATE UNIQUE INDEX idx_unique_login ON users(login);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens(
+        token_hash VARCHAR(64) PRIMARY KEY,
+        user_id VARCHAR(255) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        expires_at TIMESTAMPTZ NOT NULL
+    );
+CREATE INDEX idx_refresh_tokens_user ON refresh_tokens(user_id);
+
+COMMIT;
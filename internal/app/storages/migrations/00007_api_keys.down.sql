@@ -0,0 +1,5 @@
+BEGIN TRANSACTION;
+
+DROP TABLE IF EXISTS api_keys;
+
+COMMIT;
\ No newline at end of file
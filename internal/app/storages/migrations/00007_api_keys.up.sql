@@ -0,0 +1,15 @@
+BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS api_keys(
+        id VARCHAR(36) PRIMARY KEY,
+        user_id VARCHAR(255) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        name VARCHAR(255) NOT NULL,
+        hint VARCHAR(16) NOT NULL,
+        key_hash VARCHAR(64) NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        last_used_at TIMESTAMPTZ NULL
+    );
+CREATE UNIQUE INDEX idx_unique_api_key_hash ON api_keys(key_hash);
+CREATE INDEX idx_api_keys_user ON api_keys(user_id);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,6 @@
+BEGIN TRANSACTION;
+
+DROP INDEX IF EXISTS idx_deleted_user;
+ALTER TABLE short_urls DROP COLUMN IF EXISTS deleted_at;
+
+COMMIT;
\ No newline at end of file
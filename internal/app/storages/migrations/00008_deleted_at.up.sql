@@ -0,0 +1,6 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ NULL;
+CREATE INDEX IF NOT EXISTS idx_deleted_user ON short_urls(user_id, deleted_at) WHERE is_deleted = TRUE;
+
+COMMIT;
\ No newline at end of file
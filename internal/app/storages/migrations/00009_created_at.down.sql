@@ -0,0 +1,6 @@
+BEGIN TRANSACTION;
+
+DROP INDEX IF EXISTS idx_user_id;
+ALTER TABLE short_urls DROP COLUMN IF EXISTS created_at;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,7 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NULL;
+ALTER TABLE short_urls ALTER COLUMN created_at SET DEFAULT now();
+CREATE INDEX IF NOT EXISTS idx_user_id ON short_urls(user_id, id);
+
+COMMIT;
\ No newline at end of file
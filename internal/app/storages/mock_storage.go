@@ -7,6 +7,7 @@ package storages
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	zap "go.uber.org/zap"
@@ -36,17 +37,32 @@ func (m *MockURLStorage) EXPECT() *MockURLStorageMockRecorder {
 }
 
 // DeleteHard mocks base method.
-func (m *MockURLStorage) DeleteHard(ctx context.Context) error {
+func (m *MockURLStorage) DeleteHard(ctx context.Context, deletedBefore time.Time) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteHard", ctx)
+	ret := m.ctrl.Call(m, "DeleteHard", ctx, deletedBefore)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteHard indicates an expected call of DeleteHard.
+func (mr *MockURLStorageMockRecorder) DeleteHard(ctx, deletedBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteHard", reflect.TypeOf((*MockURLStorage)(nil).DeleteHard), ctx, deletedBefore)
+}
+
+// DeleteURLs mocks base method.
+func (m *MockURLStorage) DeleteURLs(ctx context.Context, requests []DeleteRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteURLs", ctx, requests)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// DeleteHard indicates an expected call of DeleteHard.
-func (mr *MockURLStorageMockRecorder) DeleteHard(ctx interface{}) *gomock.Call {
+// DeleteURLs indicates an expected call of DeleteURLs.
+func (mr *MockURLStorageMockRecorder) DeleteURLs(ctx, requests interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteHard", reflect.TypeOf((*MockURLStorage)(nil).DeleteHard), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteURLs", reflect.TypeOf((*MockURLStorage)(nil).DeleteURLs), ctx, requests)
 }
 
 // DeleteUserURLs mocks base method.
@@ -78,6 +94,66 @@ func (mr *MockURLStorageMockRecorder) GetByID(ctx, id interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockURLStorage)(nil).GetByID), ctx, id)
 }
 
+// GetDeletedURLs mocks base method.
+func (m *MockURLStorage) GetDeletedURLs(ctx context.Context, baseURL string) ([]DeletedURL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeletedURLs", ctx, baseURL)
+	ret0, _ := ret[0].([]DeletedURL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeletedURLs indicates an expected call of GetDeletedURLs.
+func (mr *MockURLStorageMockRecorder) GetDeletedURLs(ctx, baseURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeletedURLs", reflect.TypeOf((*MockURLStorage)(nil).GetDeletedURLs), ctx, baseURL)
+}
+
+// GetShortURL mocks base method.
+func (m *MockURLStorage) GetShortURL(ctx context.Context, id string) (*ShortenURL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetShortURL", ctx, id)
+	ret0, _ := ret[0].(*ShortenURL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetShortURL indicates an expected call of GetShortURL.
+func (mr *MockURLStorageMockRecorder) GetShortURL(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetShortURL", reflect.TypeOf((*MockURLStorage)(nil).GetShortURL), ctx, id)
+}
+
+// GetStats mocks base method.
+func (m *MockURLStorage) GetStats(ctx context.Context) (*InternalStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStats", ctx)
+	ret0, _ := ret[0].(*InternalStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStats indicates an expected call of GetStats.
+func (mr *MockURLStorageMockRecorder) GetStats(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStats", reflect.TypeOf((*MockURLStorage)(nil).GetStats), ctx)
+}
+
+// GetURLShares mocks base method.
+func (m *MockURLStorage) GetURLShares(ctx context.Context, id string) ([]Share, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetURLShares", ctx, id)
+	ret0, _ := ret[0].([]Share)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetURLShares indicates an expected call of GetURLShares.
+func (mr *MockURLStorageMockRecorder) GetURLShares(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetURLShares", reflect.TypeOf((*MockURLStorage)(nil).GetURLShares), ctx, id)
+}
+
 // GetUserURLs mocks base method.
 func (m *MockURLStorage) GetUserURLs(ctx context.Context, baseURL string) ([]UserURLs, error) {
 	m.ctrl.T.Helper()
@@ -93,6 +169,22 @@ func (mr *MockURLStorageMockRecorder) GetUserURLs(ctx, baseURL interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserURLs", reflect.TypeOf((*MockURLStorage)(nil).GetUserURLs), ctx, baseURL)
 }
 
+// GetUserURLsPage mocks base method.
+func (m *MockURLStorage) GetUserURLsPage(ctx context.Context, cursor string, limit int) ([]ShortenURL, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserURLsPage", ctx, cursor, limit)
+	ret0, _ := ret[0].([]ShortenURL)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetUserURLsPage indicates an expected call of GetUserURLsPage.
+func (mr *MockURLStorageMockRecorder) GetUserURLsPage(ctx, cursor, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserURLsPage", reflect.TypeOf((*MockURLStorage)(nil).GetUserURLsPage), ctx, cursor, limit)
+}
+
 // IsExists mocks base method.
 func (m *MockURLStorage) IsExists(ctx context.Context, key string) bool {
 	m.ctrl.T.Helper()
@@ -122,6 +214,34 @@ func (mr *MockURLStorageMockRecorder) LoadURLs(arg0, arg1, arg2 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadURLs", reflect.TypeOf((*MockURLStorage)(nil).LoadURLs), arg0, arg1, arg2)
 }
 
+// RestoreURLs mocks base method.
+func (m *MockURLStorage) RestoreURLs(ctx context.Context, shortURLs []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreURLs", ctx, shortURLs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreURLs indicates an expected call of RestoreURLs.
+func (mr *MockURLStorageMockRecorder) RestoreURLs(ctx, shortURLs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreURLs", reflect.TypeOf((*MockURLStorage)(nil).RestoreURLs), ctx, shortURLs)
+}
+
+// RevokeURLShare mocks base method.
+func (m *MockURLStorage) RevokeURLShare(ctx context.Context, id, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeURLShare", ctx, id, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeURLShare indicates an expected call of RevokeURLShare.
+func (mr *MockURLStorageMockRecorder) RevokeURLShare(ctx, id, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeURLShare", reflect.TypeOf((*MockURLStorage)(nil).RevokeURLShare), ctx, id, userID)
+}
+
 // SaveURL mocks base method.
 func (m *MockURLStorage) SaveURL(ctx context.Context, originalURL string) (string, error) {
 	m.ctrl.T.Helper()
@@ -136,3 +256,61 @@ func (mr *MockURLStorageMockRecorder) SaveURL(ctx, originalURL interface{}) *gom
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveURL", reflect.TypeOf((*MockURLStorage)(nil).SaveURL), ctx, originalURL)
 }
+
+// SaveURLWithOptions mocks base method.
+func (m *MockURLStorage) SaveURLWithOptions(ctx context.Context, originalURL string, opts SaveOptions) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveURLWithOptions", ctx, originalURL, opts)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveURLWithOptions indicates an expected call of SaveURLWithOptions.
+func (mr *MockURLStorageMockRecorder) SaveURLWithOptions(ctx, originalURL, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveURLWithOptions", reflect.TypeOf((*MockURLStorage)(nil).SaveURLWithOptions), ctx, originalURL, opts)
+}
+
+// ShareURL mocks base method.
+func (m *MockURLStorage) ShareURL(ctx context.Context, id, userID string, access Access) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ShareURL", ctx, id, userID, access)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ShareURL indicates an expected call of ShareURL.
+func (mr *MockURLStorageMockRecorder) ShareURL(ctx, id, userID, access interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ShareURL", reflect.TypeOf((*MockURLStorage)(nil).ShareURL), ctx, id, userID, access)
+}
+
+// TransferURL mocks base method.
+func (m *MockURLStorage) TransferURL(ctx context.Context, id, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransferURL", ctx, id, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TransferURL indicates an expected call of TransferURL.
+func (mr *MockURLStorageMockRecorder) TransferURL(ctx, id, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferURL", reflect.TypeOf((*MockURLStorage)(nil).TransferURL), ctx, id, userID)
+}
+
+// URLAccess mocks base method.
+func (m *MockURLStorage) URLAccess(ctx context.Context, id string) (Access, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "URLAccess", ctx, id)
+	ret0, _ := ret[0].(Access)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// URLAccess indicates an expected call of URLAccess.
+func (mr *MockURLStorageMockRecorder) URLAccess(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "URLAccess", reflect.TypeOf((*MockURLStorage)(nil).URLAccess), ctx, id)
+}
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -18,11 +20,21 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/Erlast/short-url.git/internal/app/helpers"
+	"github.com/Erlast/short-url.git/internal/app/shortcode"
 )
 
+const uniqueShortIndex = "idx_unique_short" // uniqueShortIndex индекс уникальности коротких ссылок
+
+// deleteShareQuery удаление доступа пользователя к ссылке.
+const deleteShareQuery = "DELETE FROM url_shares WHERE url_id = $1 AND user_id = $2"
+
+// errShortTaken сгенерированная короткая ссылка занята.
+var errShortTaken = errors.New("short url is taken")
+
 // PgStorage хранилище БД postgres.
 type PgStorage struct {
-	Conn *pgxpool.Pool
+	Conn  *pgxpool.Pool
+	codes shortcode.Generator
 }
 
 //go:embed migrations/*.sql
@@ -39,7 +51,10 @@ func NewPgStorage(ctx context.Context, dsn string) (*PgStorage, error) {
 		return nil, fmt.Errorf("unable to connect database: %w", err)
 	}
 
-	return &PgStorage{Conn: conn}, nil
+	return &PgStorage{
+		Conn:  conn,
+		codes: shortcode.NewRandom(shortcode.DefaultAlphabet, shortcode.DefaultLength),
+	}, nil
 }
 
 // SaveURL сохраняет оригинальный URL
@@ -52,42 +67,125 @@ func NewPgStorage(ctx context.Context, dsn string) (*PgStorage, error) {
 //   - string: сокращенный URL
 //   - error: ошибка выполнения
 func (pgs *PgStorage) SaveURL(ctx context.Context, originalURL string) (string, error) {
-	var shortURL string
-	for range 3 {
-		rndString := helpers.RandomString(helpers.LenString)
+	return pgs.SaveURLWithOptions(ctx, originalURL, SaveOptions{})
+}
 
-		if !pgs.IsExists(ctx, rndString) {
-			shortURL = rndString
-			continue
+// SaveURLWithOptions сохраняет оригинальный URL с дополнительными параметрами
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - originalURL: оригинальный URL
+//   - opts: дополнительные параметры сохранения
+//
+// Возвращает
+//   - string: сокращенный URL
+//   - error: ошибка выполнения, *helpers.AliasError если алиас недопустим или занят
+func (pgs *PgStorage) SaveURLWithOptions(ctx context.Context, originalURL string, opts SaveOptions) (string, error) {
+	if opts.Alias != "" {
+		if err := helpers.ValidateAlias(opts.Alias); err != nil {
+			return "", err
 		}
-		return "", errors.New("failed to generate short url")
+		return pgs.insertURL(ctx, opts.Alias, originalURL, opts)
 	}
-	sqlString := "INSERT INTO short_urls(short, original, user_id, is_deleted) VALUES ($1, $2, $3, $4)"
-	_, err := pgs.Conn.Exec(ctx, sqlString, shortURL, originalURL, ctx.Value(helpers.UserID), false)
 
-	if err != nil {
+	// Занятость ссылки не проверяется заранее, при коллизии генерируется следующая
+	for attempt := range 3 {
+		shortURL, err := pgs.codes.Generate(ctx, originalURL, attempt)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate short url: %w", err)
+		}
+
+		shortURL, err = pgs.insertURL(ctx, shortURL, originalURL, opts)
+		if !errors.Is(err, errShortTaken) {
+			return shortURL, err
+		}
+	}
+
+	return "", errors.New("failed to generate short url")
+}
+
+// insertURL сохранение ссылки, errShortTaken если короткая ссылка занята.
+//
+// Истекшая ссылка продолжает занимать оригинальный URL в уникальном индексе, поэтому при конфликте
+// с ней истекшая запись помечается удаленной и сохранение повторяется.
+func (pgs *PgStorage) insertURL(ctx context.Context, shortURL, originalURL string, opts SaveOptions) (string, error) {
+	sqlString := "INSERT INTO short_urls(short, original, user_id, is_deleted, expires_at) VALUES ($1, $2, $3, $4, $5)"
+
+	for attempt := 0; ; attempt++ {
+		_, err := pgs.Conn.Exec(ctx, sqlString, shortURL, originalURL, ctx.Value(helpers.UserID), false, opts.ExpiresAt)
+		if err == nil {
+			return shortURL, nil
+		}
+
 		var pgsErr *pgconn.PgError
-		if errors.As(err, &pgsErr) && pgsErr.Code == pgerrcode.UniqueViolation {
-			var existingShortURL string
-			err = pgs.Conn.QueryRow(ctx, `
-                SELECT short FROM short_urls WHERE original = $1
-            `, originalURL).Scan(&existingShortURL)
+		if !errors.As(err, &pgsErr) || pgsErr.Code != pgerrcode.UniqueViolation {
+			return "", fmt.Errorf("unable to save url: %w", err)
+		}
 
-			if err != nil {
-				return "", fmt.Errorf("falied to get short url: %w", err)
+		if pgsErr.ConstraintName == uniqueShortIndex {
+			if opts.Alias != "" {
+				return "", &helpers.AliasError{Alias: opts.Alias, Err: helpers.ErrAliasExists}
 			}
-			return "", &helpers.ConflictError{
-				ShortURL: existingShortURL,
-				Err:      err,
+			return "", errShortTaken
+		}
+
+		if attempt == 0 {
+			released, releaseErr := releaseExpired(ctx, pgs.Conn, []string{originalURL})
+			if releaseErr != nil {
+				return "", releaseErr
+			}
+			if released > 0 {
+				continue
 			}
 		}
-		return "", fmt.Errorf("unable to save url: %w", err)
+
+		var existingShortURL string
+		err = pgs.Conn.QueryRow(ctx, `
+                SELECT short FROM short_urls
+                WHERE original = $1 AND is_deleted = false AND (expires_at IS NULL OR expires_at > now())
+            `, originalURL).Scan(&existingShortURL)
+
+		if err != nil {
+			return "", fmt.Errorf("falied to get short url: %w", err)
+		}
+		return "", &helpers.ConflictError{
+			ShortURL: existingShortURL,
+			Err:      err,
+		}
+	}
+}
+
+// releaseExpired пометка удаленными истекших ссылок на оригинальные URL, чтобы URL можно было сократить заново.
+//
+// Истекшие ссылки не попадают в корзину и не восстанавливаются, а удаляются окончательно по сроку действия,
+// поэтому пометка не меняет срок их хранения.
+//
+// Аргументы
+//   - ctx: контекст выполнения
+//   - conn: пул соединений или транзакция
+//   - originals: оригинальные URL
+//
+// Возвращает
+//   - int64: количество освобожденных записей
+//   - error: ошибка выполнения
+func releaseExpired(ctx context.Context, conn pgExecutor, originals []string) (int64, error) {
+	tag, err := conn.Exec(ctx,
+		`UPDATE short_urls SET is_deleted=true, deleted_at=now()
+		WHERE original = ANY($1) AND is_deleted=false AND expires_at <= now()`,
+		originals,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("unable to release expired urls: %w", err)
 	}
-	return shortURL, nil
+
+	return tag.RowsAffected(), nil
 }
 
 // GetByID получение оригинального URL по короткой ссылке
 //
+// Уникальность короткой ссылки обеспечивается только среди не удаленных записей, поэтому ссылку,
+// заново занятую после удаления, могут держать несколько записей: действующая выбирается первой.
+//
 // Аргументы
 //   - ctx: контектс выполнения
 //   - id: короткая ссылка
@@ -98,9 +196,15 @@ func (pgs *PgStorage) SaveURL(ctx context.Context, originalURL string) (string,
 func (pgs *PgStorage) GetByID(ctx context.Context, id string) (string, error) {
 	var originalURL string
 	var isDeleted bool
-	err := pgs.Conn.QueryRow(ctx, "SELECT original, is_deleted FROM short_urls WHERE short = $1", id).Scan(
+	var expiresAt *time.Time
+	err := pgs.Conn.QueryRow(
+		ctx,
+		"SELECT original, is_deleted, expires_at FROM short_urls WHERE short = $1 ORDER BY is_deleted LIMIT 1",
+		id,
+	).Scan(
 		&originalURL,
 		&isDeleted,
+		&expiresAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -113,9 +217,44 @@ func (pgs *PgStorage) GetByID(ctx context.Context, id string) (string, error) {
 			Err: helpers.NewIsDeletedErr("short url is deleted"),
 		}
 	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", fmt.Errorf("short URL %s: %w", id, helpers.ErrExpired)
+	}
 	return originalURL, nil
 }
 
+// GetShortURL получение записи о короткой ссылке независимо от ее состояния
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//
+// Возвращает
+//   - *ShortenURL: запись о короткой ссылке
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка не найдена
+func (pgs *PgStorage) GetShortURL(ctx context.Context, id string) (*ShortenURL, error) {
+	var result ShortenURL
+	var userID string
+	err := pgs.Conn.QueryRow(
+		ctx,
+		`SELECT id, short, original, user_id, is_deleted, expires_at, deleted_at, created_at FROM short_urls
+			WHERE short = $1 ORDER BY is_deleted LIMIT 1`,
+		id,
+	).Scan(
+		&result.ID, &result.ShortURL, &result.OriginalURL, &userID,
+		&result.IsDeleted, &result.ExpiresAt, &result.DeletedAt, &result.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("short URL %s: %w", id, helpers.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get query: %w", err)
+	}
+	result.UserID = userID
+
+	return &result, nil
+}
+
 // IsExists проверка существования URL
 //
 // Аргументы
@@ -125,12 +264,16 @@ func (pgs *PgStorage) GetByID(ctx context.Context, id string) (string, error) {
 // Возвращает
 //   - bool: true - сслыка существует, false - ссылка не существует
 func (pgs *PgStorage) IsExists(ctx context.Context, key string) bool {
-	var count int
-	err := pgs.Conn.QueryRow(ctx, "SELECT count(original) FROM short_urls WHERE short = $1", key).Scan(&count)
+	var exists bool
+	err := pgs.Conn.QueryRow(
+		ctx,
+		"SELECT true FROM short_urls WHERE short = $1 ORDER BY is_deleted LIMIT 1",
+		key,
+	).Scan(&exists)
 	if err != nil {
 		_ = fmt.Errorf("failed to get query: %w", err)
 	}
-	return count != 0
+	return exists
 }
 
 // CheckPing проверка соединения с хранилищем
@@ -169,62 +312,99 @@ func (pgs *PgStorage) LoadURLs(
 		return nil, errors.New("no incoming URLs found")
 	}
 
-	result := make([]Output, 0, length)
-
-	batch := &pgx.Batch{}
-	stmt := "INSERT INTO short_urls(short, original, user_id) VALUES (@short,@original,@user_id) returning (short)"
-
+	expires := make([]*time.Time, 0, length)
+	now := time.Now()
 	for _, item := range incoming {
-		var shortURL string
-		for range 3 {
-			rndString := helpers.RandomString(helpers.LenString)
+		expiresAt, err := helpers.ResolveExpiry(item.ExpiresAt, item.TTLSeconds, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiry for %s: %w", item.CorrelationID, err)
+		}
+		if item.Alias != "" {
+			if err := helpers.ValidateAlias(item.Alias); err != nil {
+				return nil, err
+			}
+		}
+		expires = append(expires, expiresAt)
+	}
 
-			if !pgs.IsExists(ctx, rndString) {
-				shortURL = rndString
+	// При коллизии короткой ссылки транзакция откатывается и пакет сохраняется с новыми ссылками
+	for attempt := range 3 {
+		shorts := make([]string, 0, length)
+		for _, item := range incoming {
+			if item.Alias != "" {
+				shorts = append(shorts, item.Alias)
 				continue
 			}
-			return nil, errors.New("failed to generate short url")
+			shortURL, err := pgs.codes.Generate(ctx, item.OriginalURL, attempt)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate short url: %w", err)
+			}
+			shorts = append(shorts, shortURL)
 		}
 
-		args := pgx.NamedArgs{"short": shortURL, "original": item.OriginalURL, "user_id": ctx.Value(helpers.UserID)}
-		batch.Queue(stmt, args)
+		result, err := pgs.insertBatch(ctx, incoming, shorts, expires, baseURL)
+		if !errors.Is(err, errShortTaken) {
+			return result, err
+		}
 	}
 
-	tx, err := pgs.Conn.Begin(ctx)
+	return nil, errors.New("failed to generate short url")
+}
 
+// insertBatch сохранение пакета ссылок в одной транзакции, errShortTaken если сгенерированная короткая
+// ссылка занята, *helpers.AliasError если занят алиас.
+func (pgs *PgStorage) insertBatch(
+	ctx context.Context,
+	incoming []Incoming,
+	shorts []string,
+	expires []*time.Time,
+	baseURL string,
+) ([]Output, error) {
+	batch := &pgx.Batch{}
+	stmt := `INSERT INTO short_urls(short, original, user_id, expires_at)
+		VALUES (@short,@original,@user_id,@expires_at) returning (short)`
+
+	for i, item := range incoming {
+		batch.Queue(stmt, pgx.NamedArgs{
+			"short":      shorts[i],
+			"original":   item.OriginalURL,
+			"user_id":    ctx.Value(helpers.UserID),
+			"expires_at": expires[i],
+		})
+	}
+
+	tx, err := pgs.Conn.Begin(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer func() { _ = tx.Rollback(ctx) }()
 
-	defer func() {
-		if e := tx.Rollback(ctx); e != nil {
-			err = fmt.Errorf("failed to rollback the transaction: %w", e)
-			return
-		}
-	}()
+	// Истекшие ссылки освобождают оригинальные URL до вставки, иначе пакет упрется в уникальный индекс
+	originals := make([]string, 0, len(incoming))
+	for _, item := range incoming {
+		originals = append(originals, item.OriginalURL)
+	}
+	if _, err := releaseExpired(ctx, tx, originals); err != nil {
+		return nil, err
+	}
 
 	results := tx.SendBatch(ctx, batch)
 
-	defer func() {
-		if e := results.Close(); e != nil {
-			err = fmt.Errorf("closing batch results error: %w", e)
-			return
-		}
-
-		if e := tx.Commit(ctx); e != nil {
-			err = fmt.Errorf("unable to commit: %w", e)
-			return
-		}
-	}()
-
+	result := make([]Output, 0, len(incoming))
 	for _, item := range incoming {
 		var short string
 
-		err = results.QueryRow().Scan(&short)
+		if err := results.QueryRow().Scan(&short); err != nil {
+			_ = results.Close()
 
-		if err != nil {
 			var pgErr *pgconn.PgError
 			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+				if pgErr.ConstraintName == uniqueShortIndex && item.Alias != "" {
+					return nil, &helpers.AliasError{Alias: item.Alias, Err: helpers.ErrAliasExists}
+				}
+				if pgErr.ConstraintName == uniqueShortIndex {
+					return nil, errShortTaken
+				}
 				return nil, &helpers.ConflictError{
 					ShortURL: item.OriginalURL,
 					Err:      err,
@@ -236,11 +416,19 @@ func (pgs *PgStorage) LoadURLs(
 
 		str, err := url.JoinPath(baseURL, "/", short)
 		if err != nil {
+			_ = results.Close()
 			return nil, fmt.Errorf("unable to create path: %w", err)
 		}
 		result = append(result, Output{ShortURL: str, CorrelationID: item.CorrelationID})
 	}
 
+	if err := results.Close(); err != nil {
+		return nil, fmt.Errorf("closing batch results error: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("unable to commit: %w", err)
+	}
+
 	return result, nil
 }
 
@@ -256,7 +444,11 @@ func (pgs *PgStorage) LoadURLs(
 func (pgs *PgStorage) GetUserURLs(ctx context.Context, baseURL string) ([]UserURLs, error) {
 	var result []UserURLs
 
-	sqlSring := "SELECT short, original FROM short_urls WHERE user_id = $1 and is_deleted=false"
+	// доступ заполняется только для ссылок, выданных пользователю другими пользователями
+	sqlSring := `SELECT u.short, u.original, CASE WHEN u.user_id = $1 THEN '' ELSE s.access END
+		FROM short_urls u
+		LEFT JOIN url_shares s ON s.url_id = u.id AND s.user_id = $1
+		WHERE (u.user_id = $1 OR s.user_id IS NOT NULL) AND u.is_deleted=false`
 	rows, err := pgs.Conn.Query(ctx, sqlSring, ctx.Value(helpers.UserID))
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch user URLs: %w", err)
@@ -267,6 +459,7 @@ func (pgs *PgStorage) GetUserURLs(ctx context.Context, baseURL string) ([]UserUR
 		if err = rows.Scan(
 			&userURL.ShortURL,
 			&userURL.OriginalURL,
+			&userURL.Access,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
@@ -280,6 +473,82 @@ func (pgs *PgStorage) GetUserURLs(ctx context.Context, baseURL string) ([]UserUR
 	return result, nil
 }
 
+// GetUserURLsPage постраничное получение всех ссылок пользователя, включая удаленные и истекшие
+//
+// Ссылки упорядочены по идентификатору записи, курсор - идентификатор последней ссылки предыдущей страницы.
+// Момент создания не известен для ссылок, сохраненных до его появления в таблице.
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - cursor: курсор, возвращенный предыдущим вызовом, пустая строка - первая страница
+//   - limit: максимальное количество ссылок на странице
+//
+// Возвращает
+//   - []ShortenURL: ссылки страницы
+//   - string: курсор следующей страницы, пустая строка если страница последняя
+//   - error: ошибка выполнения
+func (pgs *PgStorage) GetUserURLsPage(ctx context.Context, cursor string, limit int) ([]ShortenURL, string, error) {
+	after, err := parseIDCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("invalid page size %d", limit)
+	}
+	userID := ctx.Value(helpers.UserID)
+
+	// лишняя запись показывает, что страница не последняя
+	rows, err := pgs.Conn.Query(ctx,
+		`SELECT id, short, original, is_deleted, expires_at, deleted_at, created_at FROM short_urls
+			WHERE user_id = $1 AND id > $2 ORDER BY id LIMIT $3`,
+		userID, after, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch user URLs: %w", err)
+	}
+	defer rows.Close()
+
+	var result []ShortenURL
+	for rows.Next() {
+		record := ShortenURL{UserID: userID}
+		if err := rows.Scan(
+			&record.ID, &record.ShortURL, &record.OriginalURL,
+			&record.IsDeleted, &record.ExpiresAt, &record.DeletedAt, &record.CreatedAt,
+		); err != nil {
+			return nil, "", fmt.Errorf("failed to scan row: %w", err)
+		}
+		result = append(result, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to fetch user URLs: %w", err)
+	}
+
+	if len(result) <= limit {
+		return result, "", nil
+	}
+
+	result = result[:limit]
+	return result, strconv.Itoa(result[limit-1].ID), nil
+}
+
+// GetStats подсчет количества не удаленных URL и пользователей, которым они принадлежат
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//
+// Возвращает
+//   - *InternalStats: статистика сервиса
+//   - error: ошибка выполнения
+func (pgs *PgStorage) GetStats(ctx context.Context) (*InternalStats, error) {
+	stats := &InternalStats{}
+
+	sqlString := "SELECT COUNT(*), COUNT(DISTINCT user_id) FROM short_urls WHERE is_deleted=false"
+	if err := pgs.Conn.QueryRow(ctx, sqlString).Scan(&stats.URLs, &stats.Users); err != nil {
+		return nil, fmt.Errorf("failed to count stats: %w", err)
+	}
+
+	return stats, nil
+}
+
 // DeleteUserURLs удаляет спислок URL по переданному списку
 //
 // Аргументы
@@ -297,7 +566,10 @@ func (pgs *PgStorage) DeleteUserURLs(
 	batch := &pgx.Batch{}
 	for _, shortURL := range listDeleted {
 		batch.Queue(
-			"UPDATE short_urls set is_deleted=true WHERE short = $1 and user_id=$2",
+			`UPDATE short_urls u set is_deleted=true, deleted_at=now()
+				WHERE u.short = $1 and u.is_deleted=false and (u.user_id=$2
+				OR EXISTS (SELECT 1 FROM url_shares s
+					WHERE s.url_id = u.id AND s.user_id = $2 AND s.access = 'manage'))`,
 			shortURL,
 			ctx.Value(helpers.UserID),
 		)
@@ -332,22 +604,358 @@ func (pgs *PgStorage) DeleteUserURLs(
 	return nil
 }
 
-// DeleteHard удаляет URL которые ранее были мягко удалены
+// DeleteURLs мягко удаляет ссылки нескольких пользователей одним запросом
 //
 // Аргументы
 //   - ctx: контектс выполнения
+//   - requests[]: запросы пользователей на удаление
 //
 // Возвращает
 //   - error: ошибка выполнения
-func (pgs *PgStorage) DeleteHard(ctx context.Context) error {
-	query := `DELETE FROM short_urls WHERE is_deleted=true`
-	_, err := pgs.Conn.Exec(ctx, query)
+func (pgs *PgStorage) DeleteURLs(ctx context.Context, requests []DeleteRequest) error {
+	var shorts, users []string
+	for _, req := range requests {
+		for _, shortURL := range req.ShortURLs {
+			shorts = append(shorts, shortURL)
+			users = append(users, req.UserID)
+		}
+	}
+	if len(shorts) == 0 {
+		return nil
+	}
+
+	_, err := pgs.Conn.Exec(ctx,
+		`UPDATE short_urls u SET is_deleted=true, deleted_at=now()
+			FROM unnest($1::text[], $2::text[]) AS d(short, user_id)
+			WHERE u.short = d.short AND u.is_deleted=false AND (u.user_id = d.user_id
+				OR EXISTS (SELECT 1 FROM url_shares s
+					WHERE s.url_id = u.id AND s.user_id = d.user_id AND s.access = 'manage'))`,
+		shorts, users,
+	)
 	if err != nil {
-		return fmt.Errorf("ошибка при удалении мягко удалённых записей: %w", err)
+		return fmt.Errorf("failed to delete URLs: %w", err)
 	}
+
 	return nil
 }
 
+// GetDeletedURLs получение списка мягко удаленных ссылок, которыми управляет пользователь, кроме истекших
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - baseURL: базовый URL приложения
+//
+// Возвращает
+//   - []DeletedURL: удаленные ссылки, последние удаленные первыми
+//   - error: ошибка выполнения
+func (pgs *PgStorage) GetDeletedURLs(ctx context.Context, baseURL string) ([]DeletedURL, error) {
+	var result []DeletedURL
+
+	query := `SELECT u.short, u.original, u.deleted_at, CASE WHEN u.user_id = $1 THEN '' ELSE s.access END
+		FROM short_urls u
+		LEFT JOIN url_shares s ON s.url_id = u.id AND s.user_id = $1
+		WHERE (u.user_id = $1 OR s.access = 'manage') AND u.is_deleted=true
+			AND (u.expires_at IS NULL OR u.expires_at > now())
+		ORDER BY u.deleted_at DESC NULLS LAST, u.short`
+	rows, err := pgs.Conn.Query(ctx, query, ctx.Value(helpers.UserID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch deleted URLs: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var deleted DeletedURL
+		if err := rows.Scan(&deleted.ShortURL, &deleted.OriginalURL, &deleted.DeletedAt, &deleted.Access); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		shortURL, err := url.JoinPath(baseURL, "/", deleted.ShortURL)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create path: %w", err)
+		}
+		deleted.ShortURL = shortURL
+		result = append(result, deleted)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch deleted URLs: %w", err)
+	}
+
+	return result, nil
+}
+
+// RestoreURLs восстановление мягко удаленных ссылок, которыми управляет пользователь
+//
+// Ссылки восстанавливаются в одной транзакции, только если все они найдены в корзине пользователя
+// и ни одна не нарушает уникальность действующих коротких ссылок и оригинальных URL. Если короткая
+// ссылка удалялась несколько раз, восстанавливается последняя удаленная запись.
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - shortURLs[]: короткие ссылки
+//
+// Возвращает
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка не удалена, истекла или недоступна пользователю,
+//     *helpers.RestoreConflictError если ссылка конфликтует с действующей
+func (pgs *PgStorage) RestoreURLs(ctx context.Context, shortURLs []string) error {
+	if len(shortURLs) == 0 {
+		return nil
+	}
+
+	tx, err := pgs.Conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(ctx,
+		`SELECT u.id, u.short, u.original FROM short_urls u
+			WHERE u.short = ANY($1) AND u.is_deleted=true AND (u.expires_at IS NULL OR u.expires_at > now())
+				AND (u.user_id = $2
+				OR EXISTS (SELECT 1 FROM url_shares s
+					WHERE s.url_id = u.id AND s.user_id = $2 AND s.access = 'manage'))
+			ORDER BY u.short, u.deleted_at DESC NULLS LAST, u.id DESC
+			FOR UPDATE OF u`,
+		shortURLs, fmt.Sprint(ctx.Value(helpers.UserID)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to fetch deleted URLs: %w", err)
+	}
+
+	type restored struct {
+		original string
+		id       int64
+	}
+	candidates := make(map[string]restored, len(shortURLs))
+	for rows.Next() {
+		var (
+			item  restored
+			short string
+		)
+		if err := rows.Scan(&item.id, &short, &item.original); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		if _, ok := candidates[short]; !ok {
+			candidates[short] = item
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to fetch deleted URLs: %w", err)
+	}
+
+	for _, short := range shortURLs {
+		if _, ok := candidates[short]; !ok {
+			return fmt.Errorf("short URL %s: %w", short, helpers.ErrNotFound)
+		}
+	}
+
+	for _, short := range shortURLs {
+		item, ok := candidates[short]
+		if !ok {
+			continue
+		}
+		delete(candidates, short)
+
+		// Конфликт проверяется заранее, чтобы сообщить, с какой действующей ссылкой он возник
+		var (
+			existing string
+			sameCode bool
+		)
+		err := tx.QueryRow(ctx,
+			`SELECT short, short = $1 FROM short_urls WHERE is_deleted=false AND (short = $1 OR original = $2)
+				ORDER BY short = $1 DESC LIMIT 1`,
+			short, item.original,
+		).Scan(&existing, &sameCode)
+		switch {
+		case err == nil:
+			field := helpers.RestoreConflictOriginal
+			if sameCode {
+				field = helpers.RestoreConflictShort
+			}
+			return &helpers.RestoreConflictError{ShortURL: short, Existing: existing, Field: field}
+		case !errors.Is(err, pgx.ErrNoRows):
+			return fmt.Errorf("failed to check restore conflicts: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE short_urls SET is_deleted=false, deleted_at=NULL WHERE id = $1", item.id)
+		if err != nil {
+			var pgsErr *pgconn.PgError
+			if errors.As(err, &pgsErr) && pgsErr.Code == pgerrcode.UniqueViolation {
+				return fmt.Errorf("short URL %s: %w", short, helpers.ErrRestoreConflict)
+			}
+			return fmt.Errorf("failed to restore short url: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteHard удаляет URL которые были мягко удалены не позже момента deletedBefore,
+// а также URL, срок действия которых истек не позже этого момента
+//
+// Переходы по короткой ссылке удаляются в том же запросе, если ссылку не занимает другая запись.
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - deletedBefore: граница срока хранения мягко удаленных и истекших URL
+//
+// Возвращает
+//   - int: количество удаленных URL
+//   - error: ошибка выполнения
+func (pgs *PgStorage) DeleteHard(ctx context.Context, deletedBefore time.Time) (int, error) {
+	query := `WITH removed AS (
+			DELETE FROM short_urls
+			WHERE (is_deleted=true AND (deleted_at IS NULL OR deleted_at <= $1)) OR expires_at <= $1
+			RETURNING id, short
+		), purged AS (
+			DELETE FROM clicks c USING removed r
+			WHERE c.short = r.short AND NOT EXISTS (
+				SELECT 1 FROM short_urls u WHERE u.short = r.short AND u.id NOT IN (SELECT id FROM removed)
+			)
+		)
+		SELECT count(*) FROM removed`
+
+	var removed int
+	if err := pgs.Conn.QueryRow(ctx, query, deletedBefore).Scan(&removed); err != nil {
+		return 0, fmt.Errorf("ошибка при удалении мягко удалённых записей: %w", err)
+	}
+	return removed, nil
+}
+
+// URLAccess уровень доступа пользователя к короткой ссылке
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//
+// Возвращает
+//   - Access: уровень доступа
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка не найдена, удалена или недоступна пользователю
+func (pgs *PgStorage) URLAccess(ctx context.Context, id string) (Access, error) {
+	_, access, err := pgs.access(ctx, pgs.Conn, id, "")
+	return access, err
+}
+
+// TransferURL передача владения короткой ссылкой другому пользователю
+//
+// Передать ссылку может только ее владелец, доступа manage для этого недостаточно.
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//   - userID: новый владелец
+//
+// Возвращает
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка недоступна,
+//     helpers.ErrForbidden если пользователь не владелец ссылки
+func (pgs *PgStorage) TransferURL(ctx context.Context, id string, userID string) error {
+	return pgs.manage(ctx, id, false, func(tx pgx.Tx, urlID int64, owner string) error {
+		if owner != fmt.Sprint(ctx.Value(helpers.UserID)) {
+			return fmt.Errorf("short URL %s: %w", id, helpers.ErrForbidden)
+		}
+		if _, err := tx.Exec(ctx, "UPDATE short_urls SET user_id = $2 WHERE id = $1", urlID, userID); err != nil {
+			return fmt.Errorf("failed to transfer short url: %w", err)
+		}
+		if _, err := tx.Exec(ctx, deleteShareQuery, urlID, userID); err != nil {
+			return fmt.Errorf("failed to transfer short url: %w", err)
+		}
+		return nil
+	})
+}
+
+// ShareURL выдача пользователю доступа к короткой ссылке
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//   - userID: пользователь, получающий доступ
+//   - access: уровень доступа AccessRead или AccessManage
+//
+// Возвращает
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка недоступна,
+//     helpers.ErrForbidden если у пользователя нет права на управление ссылкой,
+//     helpers.ErrShareInvalid если доступ выдается владельцу ссылки
+func (pgs *PgStorage) ShareURL(ctx context.Context, id string, userID string, access Access) error {
+	if access != AccessRead && access != AccessManage {
+		return fmt.Errorf("share %s with %s: %w", id, userID, helpers.ErrShareInvalid)
+	}
+
+	return pgs.manage(ctx, id, false, func(tx pgx.Tx, urlID int64, owner string) error {
+		if owner == userID {
+			return fmt.Errorf("share %s with %s: %w", id, userID, helpers.ErrShareInvalid)
+		}
+		query := `INSERT INTO url_shares (url_id, user_id, access) VALUES ($1, $2, $3)
+			ON CONFLICT (url_id, user_id) DO UPDATE SET access = EXCLUDED.access`
+		if _, err := tx.Exec(ctx, query, urlID, userID, string(access)); err != nil {
+			return fmt.Errorf("failed to share short url: %w", err)
+		}
+		return nil
+	})
+}
+
+// RevokeURLShare отзыв доступа пользователя к короткой ссылке, пользователь может отказаться от своего доступа сам
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//   - userID: пользователь, у которого отзывается доступ
+//
+// Возвращает
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка недоступна,
+//     helpers.ErrForbidden если у пользователя нет права на управление ссылкой
+func (pgs *PgStorage) RevokeURLShare(ctx context.Context, id string, userID string) error {
+	self := fmt.Sprint(ctx.Value(helpers.UserID)) == userID
+	return pgs.manage(ctx, id, self, func(tx pgx.Tx, urlID int64, _ string) error {
+		if _, err := tx.Exec(ctx, deleteShareQuery, urlID, userID); err != nil {
+			return fmt.Errorf("failed to revoke share: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetURLShares список доступов к короткой ссылке
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//
+// Возвращает
+//   - []Share: доступы пользователей, упорядоченные по пользователю
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка недоступна,
+//     helpers.ErrForbidden если у пользователя нет права на управление ссылкой
+func (pgs *PgStorage) GetURLShares(ctx context.Context, id string) ([]Share, error) {
+	urlID, access, err := pgs.access(ctx, pgs.Conn, id, "")
+	if err != nil {
+		return nil, err
+	}
+	if !access.CanManage() {
+		return nil, fmt.Errorf("short URL %s: %w", id, helpers.ErrForbidden)
+	}
+
+	rows, err := pgs.Conn.Query(ctx, "SELECT user_id, access FROM url_shares WHERE url_id = $1 ORDER BY user_id", urlID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch shares: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]Share, 0)
+	for rows.Next() {
+		var share Share
+		if err := rows.Scan(&share.UserID, &share.Access); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		result = append(result, share)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch shares: %w", err)
+	}
+
+	return result, nil
+}
+
 // Close закрытие соединения с хранилищем.
 func (pgs *PgStorage) Close() error {
 	if pgs.Conn == nil {
@@ -392,3 +1000,117 @@ func runMigrations(dsn string) error {
 	}
 	return nil
 }
+
+// pgQuerier запрос одной строки в пуле соединений или в транзакции.
+type pgQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// pgExecutor выполнение запроса без результата в пуле соединений или в транзакции.
+type pgExecutor interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// access идентификатор ссылки и уровень доступа к ней текущего пользователя
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - q: пул соединений или транзакция
+//   - id: короткая ссылка
+//   - lock: блокировка строки ссылки, например FOR UPDATE
+//
+// Возвращает
+//   - int64: идентификатор ссылки
+//   - Access: уровень доступа
+//   - error: ошибка выполнения, helpers.ErrNotFound если ссылка не найдена, удалена или недоступна пользователю
+func (pgs *PgStorage) access(ctx context.Context, q pgQuerier, id string, lock string) (int64, Access, error) {
+	var (
+		urlID int64
+		owner string
+		level string
+	)
+	userID := fmt.Sprint(ctx.Value(helpers.UserID))
+
+	query := `SELECT u.id, u.user_id, COALESCE(s.access, '') FROM short_urls u
+		LEFT JOIN url_shares s ON s.url_id = u.id AND s.user_id = $2
+		WHERE u.short = $1 AND u.is_deleted = false ` + lock
+	err := q.QueryRow(ctx, query, id, userID).Scan(&urlID, &owner, &level)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, "", fmt.Errorf("short URL %s: %w", id, helpers.ErrNotFound)
+		}
+		return 0, "", fmt.Errorf("failed to get access: %w", err)
+	}
+
+	switch {
+	case owner == userID:
+		return urlID, AccessOwner, nil
+	case level == "":
+		return 0, "", fmt.Errorf("short URL %s: %w", id, helpers.ErrNotFound)
+	default:
+		return urlID, Access(level), nil
+	}
+}
+
+// manage изменение ссылки в транзакции после проверки права текущего пользователя на управление ею
+//
+// Пользователь без права на управление может только отозвать свой доступ, для этого передается revokeSelf.
+//
+// Аргументы
+//   - ctx: контектс выполнения
+//   - id: короткая ссылка
+//   - revokeSelf: пользователь отзывает свой доступ
+//   - apply: изменение, получает идентификатор и владельца ссылки
+//
+// Возвращает
+//   - error: ошибка выполнения
+func (pgs *PgStorage) manage(
+	ctx context.Context,
+	id string,
+	revokeSelf bool,
+	apply func(tx pgx.Tx, urlID int64, owner string) error,
+) error {
+	tx, err := pgs.Conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	urlID, access, err := pgs.access(ctx, tx, id, "FOR UPDATE OF u")
+	if err != nil {
+		return err
+	}
+	if !access.CanManage() && !revokeSelf {
+		return fmt.Errorf("short URL %s: %w", id, helpers.ErrForbidden)
+	}
+
+	var owner string
+	if err := tx.QueryRow(ctx, "SELECT user_id FROM short_urls WHERE id = $1", urlID).Scan(&owner); err != nil {
+		return fmt.Errorf("failed to get owner: %w", err)
+	}
+	if err := apply(tx, urlID, owner); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit: %w", err)
+	}
+
+	return nil
+}
+
+// codeSequence последовательность для генератора коротких ссылок - sequence БД short_code_seq.
+func (pgs *PgStorage) codeSequence() shortcode.Sequence {
+	return shortcode.SequenceFunc(func(ctx context.Context) (int64, error) {
+		var n int64
+		if err := pgs.Conn.QueryRow(ctx, "SELECT nextval('short_code_seq')").Scan(&n); err != nil {
+			return 0, fmt.Errorf("failed to get next code: %w", err)
+		}
+		return n, nil
+	})
+}
+
+// setCodeGenerator замена генератора коротких ссылок, вызывается до использования хранилища.
+func (pgs *PgStorage) setCodeGenerator(codes shortcode.Generator) {
+	pgs.codes = codes
+}
@@ -2,10 +2,15 @@ package storages
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/Erlast/short-url.git/internal/app/config"
+	"github.com/Erlast/short-url.git/internal/app/shortcode"
 )
 
 // Output структура ответа при массовом сохранении ссылок.
@@ -16,43 +21,196 @@ type Output struct {
 
 // Incoming структура тела запроса при массовом сохранении ссылок.
 type Incoming struct {
-	CorrelationID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	Alias         string     `json:"alias,omitempty"`
+	TTLSeconds    int64      `json:"ttl_seconds,omitempty"`
 }
 
 // ShortenURL структура ссылки.
 type ShortenURL struct {
-	UserID      any    `json:"user_id"`
-	OriginalURL string `json:"original_url"`
-	ShortURL    string `json:"short_url"`
-	ID          int    `json:"uuid"`
-	IsDeleted   bool   `json:"is_deleted"`
+	UserID      any        `json:"user_id"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	OriginalURL string     `json:"original_url"`
+	ShortURL    string     `json:"short_url"`
+	ID          int        `json:"uuid"`
+	IsDeleted   bool       `json:"is_deleted"`
+}
+
+// IsExpired проверка истечения срока действия ссылки на момент now.
+func (u *ShortenURL) IsExpired(now time.Time) bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(now)
 }
 
 // UserURLs структура пользловательской ссылки.
 type UserURLs struct {
 	OriginalURL string `json:"original_url"`
 	ShortURL    string `json:"short_url"`
+	// Access - уровень доступа к чужой ссылке, пусто для собственных ссылок пользователя
+	Access Access `json:"access,omitempty"`
+}
+
+// DeletedURL мягко удаленная ссылка пользователя.
+type DeletedURL struct {
+	// DeletedAt - момент удаления, не известен для ссылок, удаленных до появления корзины
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	OriginalURL string     `json:"original_url"`
+	ShortURL    string     `json:"short_url"`
+	// Access - уровень доступа к чужой ссылке, пусто для собственных ссылок пользователя
+	Access Access `json:"access,omitempty"`
+}
+
+// Access уровень доступа пользователя к короткой ссылке.
+type Access string
+
+const (
+	// AccessOwner владелец ссылки.
+	AccessOwner Access = "owner"
+	// AccessManage управление чужой ссылкой: удаление, передача владения, выдача и отзыв доступа.
+	AccessManage Access = "manage"
+	// AccessRead просмотр чужой ссылки и статистики переходов по ней.
+	AccessRead Access = "read"
+)
+
+// CanManage проверка права на управление ссылкой.
+func (a Access) CanManage() bool {
+	return a == AccessOwner || a == AccessManage
+}
+
+// Share доступ пользователя к чужой короткой ссылке.
+type Share struct {
+	UserID string `json:"user_id"`
+	Access Access `json:"access"`
+}
+
+// InternalStats статистика сервиса для внутреннего использования.
+type InternalStats struct {
+	// URLs - количество сокращенных URL
+	URLs int `json:"urls"`
+	// Users - количество пользователей, сокративших хотя бы один URL
+	Users int `json:"users"`
+}
+
+// SaveOptions дополнительные параметры сохранения ссылки.
+type SaveOptions struct {
+	// ExpiresAt - момент истечения срока действия ссылки, nil - ссылка бессрочная
+	ExpiresAt *time.Time
+	// Alias - пользовательский алиас, используется вместо случайной короткой ссылки
+	Alias string
+}
+
+// DeleteRequest запрос пользователя на мягкое удаление ссылок.
+type DeleteRequest struct {
+	UserID    string
+	ShortURLs []string
 }
 
 // URLStorage интерфейс хранилища.
 type URLStorage interface {
 	SaveURL(ctx context.Context, originalURL string) (string, error)
+	SaveURLWithOptions(ctx context.Context, originalURL string, opts SaveOptions) (string, error)
 	GetByID(ctx context.Context, id string) (string, error)
+	GetShortURL(ctx context.Context, id string) (*ShortenURL, error)
 	IsExists(ctx context.Context, key string) bool
 	LoadURLs(context.Context, []Incoming, string) ([]Output, error)
 	GetUserURLs(ctx context.Context, baseURL string) ([]UserURLs, error)
+	GetUserURLsPage(ctx context.Context, cursor string, limit int) ([]ShortenURL, string, error)
 	DeleteUserURLs(ctx context.Context, listDeleted []string, logger *zap.SugaredLogger) error
-	DeleteHard(ctx context.Context) error
+	DeleteURLs(ctx context.Context, requests []DeleteRequest) error
+	GetDeletedURLs(ctx context.Context, baseURL string) ([]DeletedURL, error)
+	RestoreURLs(ctx context.Context, shortURLs []string) error
+	DeleteHard(ctx context.Context, deletedBefore time.Time) (int, error)
+	GetStats(ctx context.Context) (*InternalStats, error)
+	URLAccess(ctx context.Context, id string) (Access, error)
+	TransferURL(ctx context.Context, id string, userID string) error
+	ShareURL(ctx context.Context, id string, userID string, access Access) error
+	RevokeURLShare(ctx context.Context, id string, userID string) error
+	GetURLShares(ctx context.Context, id string) ([]Share, error)
+}
+
+// parseIDCursor разбор курсора постраничной выборки по идентификатору записи, пустой курсор - начало выборки.
+func parseIDCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.Atoi(cursor)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+
+	return id, nil
 }
 
 // NewStorage инициализация хранилища в зависимости от настроек приложения.
+//
+// Приоритет: postgres (DATABASE_DSN), redis (REDIS_ADDR), файл (FILE_STORAGE_PATH), память.
+// Короткие ссылки хранилище формирует генератором, выбранным параметрами SHORT_CODE_*.
 func NewStorage(ctx context.Context, cfg *config.Cfg, logger *zap.SugaredLogger) (URLStorage, error) {
+	store, err := newBackend(ctx, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := configureCodes(store, cfg); err != nil {
+		if closer, ok := store.(io.Closer); ok {
+			_ = closer.Close()
+		}
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// codeGenerating хранилище, генерирующее короткие ссылки.
+type codeGenerating interface {
+	codeSequence() shortcode.Sequence
+	setCodeGenerator(codes shortcode.Generator)
+}
+
+// configureCodes установка генератора коротких ссылок по настройкам приложения.
+func configureCodes(store URLStorage, cfg *config.Cfg) error {
+	backend, ok := store.(codeGenerating)
+	if !ok {
+		return nil
+	}
+
+	key := cfg.CodeKey
+	if key == "" {
+		key = cfg.SecretKey
+	}
+
+	codes, err := shortcode.New(shortcode.Config{
+		Strategy: cfg.CodeStrategy,
+		Alphabet: cfg.CodeAlphabet,
+		Length:   cfg.CodeLength,
+		Key:      key,
+		NodeID:   cfg.CodeNodeID,
+	}, backend.codeSequence())
+	if err != nil {
+		return fmt.Errorf("invalid short code generator: %w", err)
+	}
+	backend.setCodeGenerator(codes)
+
+	return nil
+}
+
+// newBackend создание хранилища, выбранного настройками приложения.
+func newBackend(ctx context.Context, cfg *config.Cfg, logger *zap.SugaredLogger) (URLStorage, error) {
 	switch {
 	case cfg.DatabaseDSN != "":
 		return NewPgStorage(ctx, cfg.DatabaseDSN)
+	case cfg.RedisAddr != "":
+		return NewRedisStorage(ctx, cfg.RedisAddr)
 	case cfg.FileStorage != "":
-		return NewFileStorage(ctx, cfg.FileStorage, logger)
+		return NewFileStorage(ctx, cfg.FileStorage, FileStorageConfig{
+			SyncPolicy:      SyncPolicy(cfg.FileSync),
+			SyncInterval:    cfg.FileSyncInterval,
+			CompactInterval: cfg.FileCompactInterval,
+		}, logger)
 	default:
 		return NewMemoryStorage(ctx)
 	}
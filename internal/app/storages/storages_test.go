@@ -2,11 +2,21 @@ package storages
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Erlast/short-url.git/internal/app/config"
 	"github.com/Erlast/short-url.git/internal/app/helpers"
+	"github.com/Erlast/short-url.git/internal/app/shortcode"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
@@ -25,6 +35,51 @@ func TestMemoryStorage_SaveURL(t *testing.T) {
 	assert.Equal(t, originalURL, retrievedURL)
 }
 
+func TestMemoryStorage_SaveURLWithAlias(t *testing.T) {
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	storage, _ := NewMemoryStorage(ctx)
+
+	shortURL, err := storage.SaveURLWithOptions(ctx, "https://example.com", SaveOptions{Alias: "q3-report"})
+	assert.NoError(t, err)
+	assert.Equal(t, "q3-report", shortURL)
+
+	retrievedURL, err := storage.GetByID(ctx, "q3-report")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", retrievedURL)
+
+	_, err = storage.SaveURLWithOptions(ctx, "https://example2.com", SaveOptions{Alias: "q3-report"})
+	assert.ErrorIs(t, err, helpers.ErrAliasExists)
+
+	_, err = storage.SaveURLWithOptions(ctx, "https://example3.com", SaveOptions{Alias: "q3/report"})
+	assert.ErrorIs(t, err, helpers.ErrAliasInvalid)
+}
+
+func TestMemoryStorage_Expiry(t *testing.T) {
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	storage, _ := NewMemoryStorage(ctx)
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	expired, err := storage.SaveURLWithOptions(ctx, "https://example1.com", SaveOptions{ExpiresAt: &past})
+	assert.NoError(t, err)
+	active, err := storage.SaveURLWithOptions(ctx, "https://example2.com", SaveOptions{ExpiresAt: &future})
+	assert.NoError(t, err)
+
+	_, err = storage.GetByID(ctx, expired)
+	assert.ErrorIs(t, err, helpers.ErrExpired)
+
+	retrievedURL, err := storage.GetByID(ctx, active)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example2.com", retrievedURL)
+
+	_, err = storage.DeleteHard(ctx, time.Now())
+	assert.NoError(t, err)
+
+	assert.False(t, storage.IsExists(ctx, expired))
+	assert.True(t, storage.IsExists(ctx, active))
+}
+
 func TestMemoryStorage_GetByID(t *testing.T) {
 	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
 	storage, _ := NewMemoryStorage(ctx)
@@ -107,6 +162,32 @@ func TestMemoryStorage_DeleteUserURLs(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestMemoryStorage_GetStats(t *testing.T) {
+	ctx1 := context.WithValue(context.Background(), helpers.UserID, "user1")
+	ctx2 := context.WithValue(context.Background(), helpers.UserID, "user2")
+	storage, _ := NewMemoryStorage(ctx1)
+
+	logger := zap.NewNop().Sugar()
+
+	shortURL, err := storage.SaveURL(ctx1, "https://example1.com")
+	assert.NoError(t, err)
+	_, err = storage.SaveURL(ctx1, "https://example2.com")
+	assert.NoError(t, err)
+	_, err = storage.SaveURL(ctx2, "https://example3.com")
+	assert.NoError(t, err)
+
+	stats, err := storage.GetStats(ctx1)
+	assert.NoError(t, err)
+	assert.Equal(t, &InternalStats{URLs: 3, Users: 2}, stats)
+
+	err = storage.DeleteUserURLs(ctx1, []string{shortURL}, logger)
+	assert.NoError(t, err)
+
+	stats, err = storage.GetStats(ctx1)
+	assert.NoError(t, err)
+	assert.Equal(t, &InternalStats{URLs: 2, Users: 2}, stats)
+}
+
 func TestMemoryStorage_DeleteHard(t *testing.T) {
 	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
 	storage, _ := NewMemoryStorage(ctx)
@@ -119,7 +200,7 @@ func TestMemoryStorage_DeleteHard(t *testing.T) {
 		return
 	}
 
-	err = storage.DeleteHard(ctx)
+	_, err = storage.DeleteHard(ctx, time.Now())
 	assert.NoError(t, err)
 
 	_, err = storage.GetByID(ctx, shortURL1)
@@ -134,10 +215,11 @@ func setupTestFileStorage(t *testing.T) (*FileStorage, func()) {
 	logger, _ := zap.NewDevelopment()
 	filePath := "test_storage.json"
 
-	storage, err := NewFileStorage(context.Background(), filePath, logger.Sugar())
+	storage, err := NewFileStorage(context.Background(), filePath, FileStorageConfig{}, logger.Sugar())
 	assert.NoError(t, err)
 
 	return storage, func() {
+		_ = storage.Close()
 		_ = os.Remove(filePath)
 	}
 }
@@ -193,7 +275,7 @@ func TestFileStorage_DeleteHard(t *testing.T) {
 		return
 	}
 
-	err = storage.DeleteHard(ctx)
+	_, err = storage.DeleteHard(ctx, time.Now())
 	assert.NoError(t, err)
 
 	_, err = storage.GetByID(ctx, shortURL1)
@@ -207,7 +289,7 @@ func TestFileStorage_Persistence(t *testing.T) {
 	filePath := "test_storage.json"
 	logger, _ := zap.NewDevelopment()
 
-	storage, err := NewFileStorage(context.Background(), filePath, logger.Sugar())
+	storage, err := NewFileStorage(context.Background(), filePath, FileStorageConfig{}, logger.Sugar())
 	assert.NoError(t, err)
 
 	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
@@ -215,7 +297,7 @@ func TestFileStorage_Persistence(t *testing.T) {
 	shortURL, err := storage.SaveURL(ctx, originalURL)
 	assert.NoError(t, err)
 
-	storage, err = NewFileStorage(context.Background(), filePath, logger.Sugar())
+	storage, err = NewFileStorage(context.Background(), filePath, FileStorageConfig{}, logger.Sugar())
 	assert.NoError(t, err)
 
 	retrievedURL, err := storage.GetByID(ctx, shortURL)
@@ -224,3 +306,1684 @@ func TestFileStorage_Persistence(t *testing.T) {
 
 	_ = os.Remove(filePath)
 }
+
+type operationRecorder struct {
+	errs map[string]error
+}
+
+func (r *operationRecorder) ObserveOperation(operation string, err error, _ time.Duration) {
+	r.errs[operation] = err
+}
+
+func TestInstrumentedStorage(t *testing.T) {
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	memory, _ := NewMemoryStorage(ctx)
+	observer := &operationRecorder{errs: map[string]error{}}
+	storage := NewInstrumentedStorage(memory, observer)
+
+	shortURL, err := storage.SaveURL(ctx, "https://example.com")
+	assert.NoError(t, err)
+
+	originalURL, err := storage.GetByID(ctx, shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", originalURL)
+
+	_, err = storage.GetShortURL(ctx, "missing")
+	assert.ErrorIs(t, err, helpers.ErrNotFound)
+
+	assert.Error(t, storage.CheckPing(ctx))
+	assert.NoError(t, storage.Close())
+
+	assert.Contains(t, observer.errs, "save_url")
+	assert.NoError(t, observer.errs["get_by_id"])
+	assert.ErrorIs(t, observer.errs["get_short_url"], helpers.ErrNotFound)
+	assert.NotContains(t, observer.errs, "check_ping")
+}
+
+// newTestPgStorage хранилище postgres на базе TEST_DATABASE_DSN, тест пропускается без базы данных.
+func newTestPgStorage(t *testing.T) *PgStorage {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	storage, err := NewPgStorage(context.Background(), dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = storage.Close() })
+
+	_, err = storage.Conn.Exec(context.Background(), "TRUNCATE short_urls, url_shares, clicks RESTART IDENTITY CASCADE")
+	require.NoError(t, err)
+
+	return storage
+}
+
+func TestPgStorage_ShortReusedAfterDelete(t *testing.T) {
+	storage := newTestPgStorage(t)
+	owner := context.WithValue(context.Background(), helpers.UserID, "owner")
+
+	_, err := storage.SaveURLWithOptions(owner, "https://example.com/reused", SaveOptions{Alias: "reused"})
+	require.NoError(t, err)
+	require.NoError(t, storage.DeleteURLs(context.Background(), []DeleteRequest{
+		{UserID: "owner", ShortURLs: []string{"reused"}},
+	}))
+
+	// удаленная запись не мешает занять короткую ссылку заново
+	_, err = storage.SaveURLWithOptions(owner, "https://example.com/reused", SaveOptions{Alias: "reused"})
+	require.NoError(t, err)
+
+	// переход ведет на действующую запись, а не на удаленную, сохраненную раньше нее
+	originalURL, err := storage.GetByID(owner, "reused")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/reused", originalURL)
+	assert.True(t, storage.IsExists(owner, "reused"))
+
+	record, err := storage.GetShortURL(owner, "reused")
+	require.NoError(t, err)
+	assert.False(t, record.IsDeleted)
+}
+
+func TestPgStorage_ReshortenExpired(t *testing.T) {
+	storage := newTestPgStorage(t)
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+
+	expiresAt := time.Now().Add(-time.Minute)
+	expired, err := storage.SaveURLWithOptions(ctx, "https://expired.com", SaveOptions{ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+
+	// истекшая ссылка не занимает оригинальный URL
+	shortURL, err := storage.SaveURL(ctx, "https://expired.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, expired, shortURL)
+
+	originalURL, err := storage.GetByID(ctx, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, "https://expired.com", originalURL)
+
+	result, err := storage.LoadURLs(ctx, []Incoming{{CorrelationID: "1", OriginalURL: "https://batch.com"}},
+		"http://localhost:8080")
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+
+	_, err = storage.SaveURL(ctx, "https://expired.com")
+	var conflictErr *helpers.ConflictError
+	require.ErrorAs(t, err, &conflictErr)
+	assert.Equal(t, shortURL, conflictErr.ShortURL)
+
+	testReleasedExpired(t, storage, expired, expiresAt)
+}
+
+// testReleasedExpired истекшая ссылка, освободившая оригинальный URL, не попадает в корзину
+// и хранится до окончания срока хранения, считая от момента истечения.
+func testReleasedExpired(t *testing.T, storage URLStorage, expired string, expiresAt time.Time) {
+	t.Helper()
+
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	deleted, err := storage.GetDeletedURLs(ctx, "http://localhost:8080")
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+	assert.ErrorIs(t, storage.RestoreURLs(ctx, []string{expired}), helpers.ErrNotFound)
+
+	removed, err := storage.DeleteHard(ctx, expiresAt.Add(-time.Second))
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+	assert.True(t, storage.IsExists(ctx, expired))
+
+	removed, err = storage.DeleteHard(ctx, expiresAt)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.False(t, storage.IsExists(ctx, expired))
+}
+
+func TestPgStorage_DeleteHardClicks(t *testing.T) {
+	storage := newTestPgStorage(t)
+	ctx := context.WithValue(context.Background(), helpers.UserID, "owner")
+
+	for _, alias := range []string{"purged", "reused"} {
+		_, err := storage.SaveURLWithOptions(ctx, "https://example.com/"+alias, SaveOptions{Alias: alias})
+		require.NoError(t, err)
+		_, err = storage.Conn.Exec(ctx,
+			"INSERT INTO clicks(short, clicked_at, ip_hash) VALUES ($1, now(), 'hash')", alias)
+		require.NoError(t, err)
+	}
+	require.NoError(t, storage.DeleteURLs(ctx, []DeleteRequest{
+		{UserID: "owner", ShortURLs: []string{"purged", "reused"}},
+	}))
+
+	// короткую ссылку заняла новая запись, переходы по ней не удаляются
+	_, err := storage.SaveURLWithOptions(ctx, "https://example.com/reused", SaveOptions{Alias: "reused"})
+	require.NoError(t, err)
+
+	removed, err := storage.DeleteHard(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	count := func(short string) int {
+		var result int
+		err := storage.Conn.QueryRow(ctx, "SELECT count(*) FROM clicks WHERE short = $1", short).Scan(&result)
+		require.NoError(t, err)
+		return result
+	}
+	assert.Zero(t, count("purged"))
+	assert.Equal(t, 1, count("reused"))
+}
+
+func newTestRedisStorage(t *testing.T) (*RedisStorage, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	storage, err := NewRedisStorage(context.Background(), server.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = storage.Close() })
+
+	return storage, server
+}
+
+func TestRedisStorage_SaveURL(t *testing.T) {
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	storage, _ := newTestRedisStorage(t)
+
+	shortURL, err := storage.SaveURL(ctx, "https://example.com")
+	require.NoError(t, err)
+	assert.Len(t, shortURL, helpers.LenString)
+	assert.True(t, storage.IsExists(ctx, shortURL))
+
+	originalURL, err := storage.GetByID(ctx, shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", originalURL)
+
+	_, err = storage.SaveURL(ctx, "https://example.com")
+	var conflictErr *helpers.ConflictError
+	require.ErrorAs(t, err, &conflictErr)
+	assert.Equal(t, shortURL, conflictErr.ShortURL)
+
+	_, err = storage.GetByID(ctx, "missing")
+	assert.ErrorIs(t, err, helpers.ErrNotFound)
+}
+
+func TestRedisStorage_SaveURLWithOptions(t *testing.T) {
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	storage, _ := newTestRedisStorage(t)
+
+	shortURL, err := storage.SaveURLWithOptions(ctx, "https://example.com", SaveOptions{Alias: "my-link"})
+	require.NoError(t, err)
+	assert.Equal(t, "my-link", shortURL)
+
+	_, err = storage.SaveURLWithOptions(ctx, "https://other.com", SaveOptions{Alias: "my-link"})
+	assert.ErrorIs(t, err, helpers.ErrAliasExists)
+
+	_, err = storage.SaveURLWithOptions(ctx, "https://other.com", SaveOptions{Alias: "api"})
+	assert.ErrorIs(t, err, helpers.ErrAliasInvalid)
+
+	expiresAt := time.Now().Add(-time.Minute)
+	expired, err := storage.SaveURLWithOptions(ctx, "https://expired.com", SaveOptions{ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+
+	_, err = storage.GetByID(ctx, expired)
+	assert.ErrorIs(t, err, helpers.ErrExpired)
+
+	record, err := storage.GetShortURL(ctx, expired)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", record.UserID)
+	assert.WithinDuration(t, expiresAt, *record.ExpiresAt, time.Microsecond)
+}
+
+func TestRedisStorage_LoadURLs(t *testing.T) {
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	storage, _ := newTestRedisStorage(t)
+
+	result, err := storage.LoadURLs(ctx, []Incoming{
+		{CorrelationID: "1", OriginalURL: "https://example1.com"},
+		{CorrelationID: "2", OriginalURL: "https://example2.com"},
+	}, "http://localhost:8080")
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	assert.Equal(t, "1", result[0].CorrelationID)
+
+	_, err = storage.LoadURLs(ctx, []Incoming{
+		{CorrelationID: "3", OriginalURL: "https://example3.com"},
+		{CorrelationID: "4", OriginalURL: "https://example1.com"},
+	}, "http://localhost:8080")
+	var conflictErr *helpers.ConflictError
+	assert.ErrorAs(t, err, &conflictErr)
+
+	// при конфликте пакет не сохраняется целиком
+	stats, err := storage.GetStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &InternalStats{URLs: 2, Users: 1}, stats)
+}
+
+func TestRedisStorage_DeleteUserURLs(t *testing.T) {
+	ctx1 := context.WithValue(context.Background(), helpers.UserID, "user1")
+	ctx2 := context.WithValue(context.Background(), helpers.UserID, "user2")
+	storage, server := newTestRedisStorage(t)
+	logger := zap.NewNop().Sugar()
+
+	shortURL1, err := storage.SaveURL(ctx1, "https://example1.com")
+	require.NoError(t, err)
+	shortURL2, err := storage.SaveURL(ctx2, "https://example2.com")
+	require.NoError(t, err)
+
+	err = storage.DeleteUserURLs(ctx1, []string{shortURL1, shortURL2}, logger)
+	require.NoError(t, err)
+
+	_, err = storage.GetByID(ctx1, shortURL1)
+	var conflictErr *helpers.ConflictError
+	assert.ErrorAs(t, err, &conflictErr)
+
+	// чужая ссылка не удаляется
+	_, err = storage.GetByID(ctx1, shortURL2)
+	assert.NoError(t, err)
+
+	userURLs, err := storage.GetUserURLs(ctx1, "http://localhost:8080")
+	assert.NoError(t, err)
+	assert.Nil(t, userURLs)
+
+	stats, err := storage.GetStats(ctx1)
+	require.NoError(t, err)
+	assert.Equal(t, &InternalStats{URLs: 1, Users: 1}, stats)
+
+	// после удаления оригинальный URL можно сократить повторно
+	_, err = storage.SaveURL(ctx1, "https://example1.com")
+	assert.NoError(t, err)
+
+	assert.True(t, server.Exists(redisPrefix+"url:"+shortURL1))
+	_, err = storage.DeleteHard(ctx1, time.Now())
+	require.NoError(t, err)
+	assert.False(t, server.Exists(redisPrefix+"url:"+shortURL1))
+	assert.False(t, storage.IsExists(ctx1, shortURL1))
+}
+
+func TestRedisStorage_DeleteHardExpired(t *testing.T) {
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	storage, _ := newTestRedisStorage(t)
+
+	expiresAt := time.Now().Add(-time.Minute)
+	expired, err := storage.SaveURLWithOptions(ctx, "https://expired.com", SaveOptions{ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+
+	activeExpiry := time.Now().Add(time.Hour)
+	active, err := storage.SaveURLWithOptions(ctx, "https://active.com", SaveOptions{ExpiresAt: &activeExpiry})
+	require.NoError(t, err)
+
+	_, err = storage.DeleteHard(ctx, time.Now())
+	require.NoError(t, err)
+
+	assert.False(t, storage.IsExists(ctx, expired))
+	assert.True(t, storage.IsExists(ctx, active))
+
+	userURLs, err := storage.GetUserURLs(ctx, "http://localhost:8080")
+	require.NoError(t, err)
+	assert.Equal(t, []UserURLs{{ShortURL: "http://localhost:8080/" + active, OriginalURL: "https://active.com"}}, userURLs)
+}
+
+func TestRedisStorage_ReshortenExpired(t *testing.T) {
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	storage, _ := newTestRedisStorage(t)
+
+	expiresAt := time.Now().Add(-time.Minute)
+	expired, err := storage.SaveURLWithOptions(ctx, "https://expired.com", SaveOptions{ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+
+	// истекшая ссылка не занимает оригинальный URL и переносится в корзину
+	shortURL, err := storage.SaveURL(ctx, "https://expired.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, expired, shortURL)
+
+	originalURL, err := storage.GetByID(ctx, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, "https://expired.com", originalURL)
+
+	record, err := storage.GetShortURL(ctx, expired)
+	require.NoError(t, err)
+	assert.True(t, record.IsDeleted)
+
+	_, err = storage.SaveURL(ctx, "https://expired.com")
+	var conflictErr *helpers.ConflictError
+	require.ErrorAs(t, err, &conflictErr)
+	assert.Equal(t, shortURL, conflictErr.ShortURL)
+
+	stats, err := storage.GetStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &InternalStats{URLs: 1, Users: 1}, stats)
+
+	testReleasedExpired(t, storage, expired, expiresAt)
+}
+
+func TestRedisStorage_CheckPing(t *testing.T) {
+	storage, server := newTestRedisStorage(t)
+
+	assert.NoError(t, storage.CheckPing(context.Background()))
+
+	server.Close()
+	assert.Error(t, storage.CheckPing(context.Background()))
+}
+
+func TestCachedStorage_GetByID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	next := NewMockURLStorage(ctrl)
+	storage := NewCachedStorage(next, 2, time.Minute)
+
+	next.EXPECT().GetShortURL(gomock.Any(), "abc").
+		Return(&ShortenURL{ShortURL: "abc", OriginalURL: "https://abc.com"}, nil).Times(1)
+
+	for range 3 {
+		originalURL, err := storage.GetByID(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, "https://abc.com", originalURL)
+	}
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 1, Size: 1}, storage.CacheStats())
+
+	next.EXPECT().GetShortURL(gomock.Any(), "missing").
+		Return(nil, fmt.Errorf("short URL missing: %w", helpers.ErrNotFound)).Times(2)
+	next.EXPECT().GetShortURL(gomock.Any(), "deleted").
+		Return(&ShortenURL{ShortURL: "deleted", IsDeleted: true}, nil).Times(2)
+
+	for range 2 {
+		_, err := storage.GetByID(ctx, "missing")
+		assert.ErrorIs(t, err, helpers.ErrNotFound)
+
+		_, err = storage.GetByID(ctx, "deleted")
+		var conflictErr *helpers.ConflictError
+		assert.ErrorAs(t, err, &conflictErr)
+	}
+	assert.Equal(t, 1, storage.CacheStats().Size)
+}
+
+func TestCachedStorage_Eviction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	next := NewMockURLStorage(ctrl)
+	storage := NewCachedStorage(next, 2, time.Minute)
+
+	for _, id := range []string{"a", "b", "c"} {
+		next.EXPECT().GetShortURL(gomock.Any(), id).
+			Return(&ShortenURL{ShortURL: id, OriginalURL: "https://" + id + ".com"}, nil).Times(1)
+	}
+
+	_, _ = storage.GetByID(ctx, "a")
+	_, _ = storage.GetByID(ctx, "b")
+	// a становится самой свежей записью, при добавлении c вытесняется b
+	_, _ = storage.GetByID(ctx, "a")
+	_, _ = storage.GetByID(ctx, "c")
+
+	next.EXPECT().GetShortURL(gomock.Any(), "b").
+		Return(&ShortenURL{ShortURL: "b", OriginalURL: "https://b.com"}, nil).Times(1)
+
+	_, _ = storage.GetByID(ctx, "a")
+	_, _ = storage.GetByID(ctx, "b")
+
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 4, Size: 2}, storage.CacheStats())
+}
+
+func TestCachedStorage_Expiry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	next := NewMockURLStorage(ctrl)
+	storage := NewCachedStorage(next, 10, time.Millisecond)
+
+	expiresAt := time.Now().Add(time.Minute)
+	next.EXPECT().GetShortURL(gomock.Any(), "ttl").
+		Return(&ShortenURL{ShortURL: "ttl", OriginalURL: "https://ttl.com"}, nil).Times(2)
+	next.EXPECT().GetShortURL(gomock.Any(), "link").
+		Return(&ShortenURL{ShortURL: "link", OriginalURL: "https://link.com", ExpiresAt: &expiresAt}, nil).Times(1)
+
+	_, err := storage.GetByID(ctx, "ttl")
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	_, err = storage.GetByID(ctx, "ttl")
+	require.NoError(t, err)
+
+	// срок действия ссылки ограничивает время жизни записи кэша
+	storage = NewCachedStorage(next, 10, time.Hour)
+	_, err = storage.GetByID(ctx, "link")
+	require.NoError(t, err)
+
+	_, ok := storage.get("link", expiresAt.Add(-time.Second))
+	assert.True(t, ok)
+	_, ok = storage.get("link", expiresAt)
+	assert.False(t, ok)
+}
+
+func TestCachedStorage_Invalidation(t *testing.T) {
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	memory, _ := NewMemoryStorage(ctx)
+	storage := NewCachedStorage(memory, 10, time.Minute)
+	logger := zap.NewNop().Sugar()
+
+	shortURL1, err := storage.SaveURL(ctx, "https://example1.com")
+	require.NoError(t, err)
+	shortURL2, err := storage.SaveURL(ctx, "https://example2.com")
+	require.NoError(t, err)
+
+	_, err = storage.GetByID(ctx, shortURL1)
+	require.NoError(t, err)
+	_, err = storage.GetByID(ctx, shortURL2)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.DeleteUserURLs(ctx, []string{shortURL1}, logger))
+
+	_, err = storage.GetByID(ctx, shortURL1)
+	var conflictErr *helpers.ConflictError
+	assert.ErrorAs(t, err, &conflictErr)
+
+	// пакетное удаление также удаляет ссылки из кэша
+	shortURL3, err := storage.SaveURL(ctx, "https://example3.com")
+	require.NoError(t, err)
+	_, err = storage.GetByID(ctx, shortURL3)
+	require.NoError(t, err)
+	require.NoError(t, storage.DeleteURLs(ctx, []DeleteRequest{{UserID: "user1", ShortURLs: []string{shortURL3}}}))
+	_, err = storage.GetByID(ctx, shortURL3)
+	assert.ErrorAs(t, err, &conflictErr)
+
+	_, err = storage.DeleteHard(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, storage.CacheStats().Size)
+
+	_, err = storage.GetByID(ctx, shortURL1)
+	assert.ErrorIs(t, err, helpers.ErrNotFound)
+	_, err = storage.GetByID(ctx, shortURL2)
+	assert.NoError(t, err)
+}
+
+// pausedStorage хранилище, приостанавливающее чтение записи до сигнала теста.
+type pausedStorage struct {
+	URLStorage
+	read   chan struct{}
+	resume chan struct{}
+}
+
+func (s *pausedStorage) GetShortURL(ctx context.Context, id string) (*ShortenURL, error) {
+	record, err := s.URLStorage.GetShortURL(ctx, id)
+	s.read <- struct{}{}
+	<-s.resume
+	return record, err
+}
+
+func TestCachedStorage_InvalidationDuringRead(t *testing.T) {
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	memory, _ := NewMemoryStorage(ctx)
+	logger := zap.NewNop().Sugar()
+
+	tests := []struct {
+		del  func(storage *CachedStorage, shortURL string) error
+		name string
+	}{
+		{
+			name: "DeleteUserURLs",
+			del: func(storage *CachedStorage, shortURL string) error {
+				return storage.DeleteUserURLs(ctx, []string{shortURL}, logger)
+			},
+		},
+		{
+			name: "DeleteURLs",
+			del: func(storage *CachedStorage, shortURL string) error {
+				return storage.DeleteURLs(ctx, []DeleteRequest{{UserID: "user1", ShortURLs: []string{shortURL}}})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paused := &pausedStorage{URLStorage: memory, read: make(chan struct{}), resume: make(chan struct{})}
+			storage := NewCachedStorage(paused, 10, time.Minute)
+
+			shortURL, err := memory.SaveURL(ctx, "https://"+tt.name+".example.com")
+			require.NoError(t, err)
+
+			// чтение получает действующую запись, удаление завершается до записи в кэш
+			done := make(chan error)
+			go func() {
+				_, err := storage.GetByID(ctx, shortURL)
+				done <- err
+			}()
+			<-paused.read
+			require.NoError(t, tt.del(storage, shortURL))
+			close(paused.resume)
+			require.NoError(t, <-done)
+
+			assert.Equal(t, 0, storage.CacheStats().Size)
+
+			go func() { <-paused.read }()
+			_, err = storage.GetByID(ctx, shortURL)
+			var conflictErr *helpers.ConflictError
+			assert.ErrorAs(t, err, &conflictErr)
+		})
+	}
+}
+
+func TestMemoryStorage_ConcurrentAccess(t *testing.T) {
+	const workers = 16
+	const perWorker = 50
+
+	storage, _ := NewMemoryStorage(context.Background())
+	logger := zap.NewNop().Sugar()
+
+	var mu sync.Mutex
+	saved := make(map[string]string)
+	deleted := make(map[string]bool)
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			userID := fmt.Sprintf("user%d", w)
+			ctx := context.WithValue(context.Background(), helpers.UserID, userID)
+			var own []string
+
+			for i := range perWorker {
+				originalURL := fmt.Sprintf("https://example.com/%d/%d", w, i)
+				shortURL, err := storage.SaveURL(ctx, originalURL)
+				if !assert.NoError(t, err) {
+					return
+				}
+				own = append(own, shortURL)
+
+				mu.Lock()
+				saved[shortURL] = originalURL
+				mu.Unlock()
+
+				got, err := storage.GetByID(ctx, shortURL)
+				assert.NoError(t, err)
+				assert.Equal(t, originalURL, got)
+
+				_, err = storage.LoadURLs(ctx, []Incoming{
+					{CorrelationID: "1", OriginalURL: originalURL + "/batch"},
+				}, "http://localhost:8080")
+				assert.NoError(t, err)
+
+				// параллельное чтение чужих ссылок и списков
+				_, _ = storage.GetUserURLs(ctx, "http://localhost:8080")
+				_, _ = storage.GetStats(ctx)
+			}
+
+			half := own[:len(own)/2]
+			assert.NoError(t, storage.DeleteUserURLs(ctx, half, logger))
+
+			mu.Lock()
+			for _, shortURL := range half {
+				deleted[shortURL] = true
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, saved, workers*perWorker)
+
+	ctx := context.Background()
+	ids := make(map[int]bool)
+	for shortURL, originalURL := range saved {
+		record, err := storage.GetShortURL(ctx, shortURL)
+		require.NoError(t, err)
+		assert.Equal(t, originalURL, record.OriginalURL)
+		assert.Equal(t, deleted[shortURL], record.IsDeleted)
+		assert.False(t, ids[record.ID], "duplicate record id %d", record.ID)
+		ids[record.ID] = true
+	}
+
+	stats, err := storage.GetStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, workers*perWorker*2-len(deleted), stats.URLs)
+	assert.Equal(t, workers, stats.Users)
+}
+
+func TestMemoryStorage_ConcurrentDeleteHard(t *testing.T) {
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	storage, _ := NewMemoryStorage(ctx)
+	logger := zap.NewNop().Sugar()
+
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 50 {
+				shortURL, err := storage.SaveURL(ctx, fmt.Sprintf("https://example.com/%d/%d", w, i))
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.NoError(t, storage.DeleteUserURLs(ctx, []string{shortURL}, logger))
+				_, err = storage.DeleteHard(ctx, time.Now())
+				assert.NoError(t, err)
+				_, _ = storage.GetByID(ctx, shortURL)
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, err := storage.DeleteHard(ctx, time.Now())
+	require.NoError(t, err)
+	stats, err := storage.GetStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.URLs)
+}
+
+func TestFileStorage_ConcurrentAccess(t *testing.T) {
+	fileName := t.TempDir() + "/storage.json"
+	logger := zap.NewNop().Sugar()
+	storage, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := context.WithValue(context.Background(), helpers.UserID, fmt.Sprintf("user%d", w))
+			for i := range 10 {
+				shortURL, err := storage.SaveURL(ctx, fmt.Sprintf("https://example.com/%d/%d", w, i))
+				if !assert.NoError(t, err) {
+					return
+				}
+				_, err = storage.GetByID(ctx, shortURL)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	reloaded, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+	stats, err := reloaded.GetStats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &InternalStats{URLs: 80, Users: 8}, stats)
+
+	// после загрузки из файла новые записи получают неповторяющиеся идентификаторы
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user0")
+	shortURL, err := reloaded.SaveURL(ctx, "https://example.com/new")
+	require.NoError(t, err)
+	record, err := reloaded.GetShortURL(ctx, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, 81, record.ID)
+}
+
+func countLines(t *testing.T, fileName string) int {
+	t.Helper()
+	data, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+	return strings.Count(string(data), "\n")
+}
+
+func TestFileStorage_JournalReplay(t *testing.T) {
+	fileName := t.TempDir() + "/storage.json"
+	logger := zap.NewNop().Sugar()
+	storage, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{SyncPolicy: SyncAlways}, logger)
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	kept, err := storage.SaveURL(ctx, "https://example.com/kept")
+	require.NoError(t, err)
+	deleted, err := storage.SaveURL(ctx, "https://example.com/deleted")
+	require.NoError(t, err)
+	removed, err := storage.SaveURL(ctx, "https://example.com/removed")
+	require.NoError(t, err)
+
+	require.NoError(t, storage.DeleteUserURLs(ctx, []string{removed}, logger))
+	_, err = storage.DeleteHard(ctx, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, storage.DeleteUserURLs(ctx, []string{deleted}, logger))
+
+	// чужой пользователь не может удалить ссылку и при воспроизведении журнала
+	other := context.WithValue(context.Background(), helpers.UserID, "user2")
+	require.NoError(t, storage.DeleteUserURLs(other, []string{kept}, logger))
+	require.NoError(t, storage.Close())
+
+	assert.Equal(t, 7, countLines(t, fileName))
+
+	reloaded, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+	defer func() { _ = reloaded.Close() }()
+
+	originalURL, err := reloaded.GetByID(ctx, kept)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/kept", originalURL)
+
+	record, err := reloaded.GetShortURL(ctx, deleted)
+	require.NoError(t, err)
+	assert.True(t, record.IsDeleted)
+
+	assert.False(t, reloaded.IsExists(ctx, removed))
+
+	// журнал с удаленными записями компактизирован при загрузке
+	assert.Equal(t, 2, countLines(t, fileName))
+}
+
+func TestFileStorage_LegacyFormat(t *testing.T) {
+	fileName := t.TempDir() + "/storage.json"
+	legacy := `[
+   {"user_id": "user1", "original_url": "https://example.com", "short_url": "abc", "uuid": 5, "is_deleted": false}
+]`
+	require.NoError(t, os.WriteFile(fileName, []byte(legacy), 0o600))
+
+	storage, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	defer func() { _ = storage.Close() }()
+
+	originalURL, err := storage.GetByID(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", originalURL)
+
+	data, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), `{"at":`), "legacy file is rewritten as a journal")
+	assert.Equal(t, 1, countLines(t, fileName))
+
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	shortURL, err := storage.SaveURL(ctx, "https://example.com/new")
+	require.NoError(t, err)
+	record, err := storage.GetShortURL(ctx, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, 6, record.ID)
+}
+
+func TestFileStorage_Compact(t *testing.T) {
+	dir := t.TempDir()
+	fileName := dir + "/storage.json"
+	logger := zap.NewNop().Sugar()
+	storage, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{SyncPolicy: SyncNever}, logger)
+	require.NoError(t, err)
+	defer func() { _ = storage.Close() }()
+
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	for i := range 5 {
+		shortURL, err := storage.SaveURL(ctx, fmt.Sprintf("https://example.com/%d", i))
+		require.NoError(t, err)
+		require.NoError(t, storage.DeleteUserURLs(ctx, []string{shortURL}, logger))
+	}
+	kept, err := storage.SaveURL(ctx, "https://example.com/kept")
+	require.NoError(t, err)
+	_, err = storage.DeleteHard(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 12, countLines(t, fileName))
+
+	require.NoError(t, storage.Compact())
+	assert.Equal(t, 1, countLines(t, fileName))
+
+	// после компактизации запись продолжается в новый файл
+	_, err = storage.SaveURL(ctx, "https://example.com/after")
+	require.NoError(t, err)
+	assert.Equal(t, 2, countLines(t, fileName))
+
+	// временный файл снимка не остается в каталоге
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	reloaded, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+	defer func() { _ = reloaded.Close() }()
+	assert.True(t, reloaded.IsExists(ctx, kept))
+	stats, err := reloaded.GetStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.URLs)
+}
+
+func TestFileStorage_Recovery(t *testing.T) {
+	event := func(short string, id int) string {
+		return fmt.Sprintf(`{"at":"0001-01-01T00:00:00Z","op":"create","record":`+
+			`{"user_id":"user1","original_url":"https://example.com/%s","short_url":"%s","uuid":%d,"is_deleted":false}}`,
+			short, short, id)
+	}
+
+	tests := []struct {
+		name      string
+		content   string
+		recovered []string
+		lost      []string
+		torn      bool
+	}{
+		{
+			name:      "Torn last line",
+			content:   event("a", 1) + "\n" + event("b", 2) + "\n" + event("c", 3)[:40],
+			recovered: []string{"a", "b"},
+			lost:      []string{"c"},
+			torn:      true,
+		},
+		{
+			name:      "Last line without newline",
+			content:   event("a", 1) + "\n" + event("b", 2),
+			recovered: []string{"a"},
+			lost:      []string{"b"},
+			torn:      true,
+		},
+		{
+			name:      "Garbage before torn last line",
+			content:   event("a", 1) + "\ngarbage\n" + event("b", 2) + "\n" + event("c", 3)[:40],
+			recovered: []string{"a", "b"},
+			lost:      []string{"c"},
+		},
+		{
+			name:      "Garbage in the middle",
+			content:   event("a", 1) + "\n\x00\x00garbage\n{}\n" + event("b", 2) + "\n",
+			recovered: []string{"a", "b"},
+		},
+		{
+			name: "Truncated legacy array",
+			content: `[{"user_id":"user1","original_url":"https://example.com/a","short_url":"a","uuid":1},` +
+				`{"user_id":"user1","original_url":"https://example.com/b","short_url":"b","uuid":2},` +
+				`{"user_id":"user1","original_url":"https://exa`,
+			recovered: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fileName := dir + "/storage.json"
+			require.NoError(t, os.WriteFile(fileName, []byte(tt.content), 0o600))
+
+			storage, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, zap.NewNop().Sugar())
+			require.NoError(t, err)
+
+			ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+			for _, short := range tt.recovered {
+				originalURL, err := storage.GetByID(ctx, short)
+				require.NoError(t, err)
+				assert.Equal(t, "https://example.com/"+short, originalURL)
+			}
+			for _, short := range tt.lost {
+				assert.False(t, storage.IsExists(ctx, short))
+			}
+
+			// новые записи после восстановления не склеиваются с поврежденной строкой
+			shortURL, err := storage.SaveURL(ctx, "https://example.com/new")
+			require.NoError(t, err)
+			require.NoError(t, storage.Close())
+
+			quarantined, err := filepath.Glob(fileName + ".corrupt-*")
+			require.NoError(t, err)
+			if tt.torn {
+				// прерванная последняя запись отбрасывается без переименования файла
+				assert.Empty(t, quarantined)
+				data, err := os.ReadFile(fileName)
+				require.NoError(t, err)
+				assert.True(t, strings.HasPrefix(string(data), tt.content[:strings.LastIndex(tt.content, "\n")+1]))
+				assert.Equal(t, len(tt.recovered)+1, countLines(t, fileName))
+			} else {
+				require.Len(t, quarantined, 1)
+				data, err := os.ReadFile(quarantined[0])
+				require.NoError(t, err)
+				assert.Equal(t, tt.content, string(data))
+			}
+
+			reloaded, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, zap.NewNop().Sugar())
+			require.NoError(t, err)
+			defer func() { _ = reloaded.Close() }()
+			assert.True(t, reloaded.IsExists(ctx, shortURL))
+			stats, err := reloaded.GetStats(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.recovered)+1, stats.URLs)
+
+			recovered, err := filepath.Glob(fileName + ".corrupt-*")
+			require.NoError(t, err)
+			assert.Equal(t, quarantined, recovered, "recovered journal is valid")
+		})
+	}
+}
+
+func TestFileStorage_LegacyEmptyFile(t *testing.T) {
+	dir := t.TempDir()
+	fileName := dir + "/storage.json"
+	require.NoError(t, os.WriteFile(fileName, []byte("null"), 0o600))
+
+	storage, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	require.NoError(t, storage.Close())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "empty legacy file is not quarantined")
+	assert.Equal(t, 0, countLines(t, fileName))
+}
+
+func TestFileStorage_SyncPolicies(t *testing.T) {
+	tests := []struct {
+		config FileStorageConfig
+		name   string
+	}{
+		{name: "always", config: FileStorageConfig{SyncPolicy: SyncAlways}},
+		{name: "interval", config: FileStorageConfig{SyncPolicy: SyncInterval, SyncInterval: time.Millisecond}},
+		{name: "never", config: FileStorageConfig{SyncPolicy: SyncNever}},
+		{name: "periodic compaction", config: FileStorageConfig{CompactInterval: time.Millisecond}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := t.TempDir() + "/storage.json"
+			logger := zap.NewNop().Sugar()
+			storage, err := NewFileStorage(context.Background(), fileName, tt.config, logger)
+			require.NoError(t, err)
+
+			ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+			shortURL, err := storage.SaveURL(ctx, "https://example.com")
+			require.NoError(t, err)
+			require.NoError(t, storage.DeleteUserURLs(ctx, []string{shortURL}, logger))
+			time.Sleep(10 * time.Millisecond)
+			require.NoError(t, storage.Close())
+			require.NoError(t, storage.Close())
+
+			reloaded, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+			require.NoError(t, err)
+			defer func() { _ = reloaded.Close() }()
+			record, err := reloaded.GetShortURL(ctx, shortURL)
+			require.NoError(t, err)
+			assert.True(t, record.IsDeleted)
+		})
+	}
+}
+
+func TestNewStorage_CodeStrategies(t *testing.T) {
+	cfg := &config.Cfg{
+		SecretKey:    "secret",
+		CodeStrategy: shortcode.StrategySequence,
+		CodeAlphabet: shortcode.DefaultAlphabet,
+		CodeLength:   shortcode.DefaultLength,
+	}
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+
+	store, err := NewStorage(context.Background(), cfg, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	first, err := store.SaveURL(ctx, "https://example.com/1")
+	require.NoError(t, err)
+	second, err := store.SaveURL(ctx, "https://example.com/2")
+	require.NoError(t, err)
+	assert.Equal(t, "0000001", first)
+	assert.Equal(t, "0000003", second, "code numbers share the record id counter")
+
+	cfg.CodeStrategy = shortcode.StrategyHash
+	store, err = NewStorage(context.Background(), cfg, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	first, err = store.SaveURL(ctx, "https://example.com")
+	require.NoError(t, err)
+	expected, err := shortcode.NewHash(shortcode.DefaultAlphabet, shortcode.DefaultLength, "secret").
+		Generate(ctx, "https://example.com", 0)
+	require.NoError(t, err)
+	assert.Equal(t, expected, first)
+
+	// повторное сокращение того же URL получает следующий код попытки
+	second, err = store.SaveURL(ctx, "https://example.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	cfg.CodeAlphabet = "a"
+	_, err = NewStorage(context.Background(), cfg, zap.NewNop().Sugar())
+	assert.Error(t, err)
+}
+
+func TestFileStorage_SequenceCodesAfterRestart(t *testing.T) {
+	cfg := &config.Cfg{
+		FileStorage:  t.TempDir() + "/storage.json",
+		SecretKey:    "secret",
+		CodeStrategy: shortcode.StrategySequence,
+		CodeAlphabet: shortcode.DefaultAlphabet,
+		CodeLength:   shortcode.DefaultLength,
+	}
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+
+	store, err := NewStorage(context.Background(), cfg, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	first, err := store.SaveURL(ctx, "https://example.com/1")
+	require.NoError(t, err)
+	require.NoError(t, store.(*FileStorage).Close())
+
+	store, err = NewStorage(context.Background(), cfg, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	defer func() { _ = store.(*FileStorage).Close() }()
+	second, err := store.SaveURL(ctx, "https://example.com/2")
+	require.NoError(t, err)
+	assert.Equal(t, "0000001", first)
+	assert.Equal(t, "0000003", second)
+}
+
+func TestRedisStorage_SequenceCodes(t *testing.T) {
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	storage, _ := newTestRedisStorage(t)
+	require.NoError(t, configureCodes(storage, &config.Cfg{
+		CodeStrategy: shortcode.StrategySequence,
+		CodeAlphabet: shortcode.DefaultAlphabet,
+		CodeLength:   4,
+	}))
+
+	// код 0001 занят алиасом, сохранение переходит к следующему номеру
+	_, err := storage.SaveURLWithOptions(ctx, "https://example.com/alias", SaveOptions{Alias: "0001"})
+	require.NoError(t, err)
+
+	shortURL, err := storage.SaveURL(ctx, "https://example.com/1")
+	require.NoError(t, err)
+	assert.Equal(t, "0002", shortURL)
+
+	outputs, err := storage.LoadURLs(ctx, []Incoming{
+		{CorrelationID: "1", OriginalURL: "https://example.com/2"},
+		{CorrelationID: "2", OriginalURL: "https://example.com/3"},
+	}, "http://localhost")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost/0003", outputs[0].ShortURL)
+	assert.Equal(t, "http://localhost/0004", outputs[1].ShortURL)
+}
+
+// testURLSharing общая проверка передачи владения и выдачи доступа для хранилищ.
+// testLoadURLsAlias пакет с алиасами сохраняется целиком, при занятом алиасе не сохраняется ничего.
+func testLoadURLsAlias(t *testing.T, storage URLStorage) {
+	t.Helper()
+
+	ctx := context.WithValue(context.Background(), helpers.UserID, "user1")
+	outputs, err := storage.LoadURLs(ctx, []Incoming{
+		{CorrelationID: "1", OriginalURL: "https://example.com/alias-1", Alias: "batch-alias"},
+		{CorrelationID: "2", OriginalURL: "https://example.com/alias-2"},
+	}, "http://localhost")
+	require.NoError(t, err)
+	require.Len(t, outputs, 2)
+	assert.Equal(t, Output{CorrelationID: "1", ShortURL: "http://localhost/batch-alias"}, outputs[0])
+
+	_, err = storage.LoadURLs(ctx, []Incoming{
+		{CorrelationID: "3", OriginalURL: "https://example.com/alias-3"},
+		{CorrelationID: "4", OriginalURL: "https://example.com/alias-4", Alias: "batch-alias"},
+	}, "http://localhost")
+	assert.ErrorIs(t, err, helpers.ErrAliasExists)
+
+	_, err = storage.LoadURLs(ctx, []Incoming{
+		{CorrelationID: "5", OriginalURL: "https://example.com/alias-5", Alias: "twin-alias"},
+		{CorrelationID: "6", OriginalURL: "https://example.com/alias-6", Alias: "twin-alias"},
+	}, "http://localhost")
+	assert.ErrorIs(t, err, helpers.ErrAliasExists)
+
+	_, err = storage.LoadURLs(ctx, []Incoming{
+		{CorrelationID: "7", OriginalURL: "https://example.com/alias-7", Alias: "bad/alias"},
+	}, "http://localhost")
+	assert.ErrorIs(t, err, helpers.ErrAliasInvalid)
+
+	userURLs, err := storage.GetUserURLs(ctx, "http://localhost")
+	require.NoError(t, err)
+	assert.Len(t, userURLs, 2)
+	assert.False(t, storage.IsExists(ctx, "twin-alias"))
+}
+
+func TestMemoryStorage_LoadURLsAlias(t *testing.T) {
+	storage, err := NewMemoryStorage(context.Background())
+	require.NoError(t, err)
+
+	testLoadURLsAlias(t, storage)
+}
+
+func TestFileStorage_LoadURLsAlias(t *testing.T) {
+	storage, err := NewFileStorage(context.Background(), t.TempDir()+"/storage.json", FileStorageConfig{},
+		zap.NewNop().Sugar())
+	require.NoError(t, err)
+	defer func() { _ = storage.Close() }()
+
+	testLoadURLsAlias(t, storage)
+}
+
+func TestRedisStorage_LoadURLsAlias(t *testing.T) {
+	storage, _ := newTestRedisStorage(t)
+
+	testLoadURLsAlias(t, storage)
+}
+
+func testURLSharing(t *testing.T, storage URLStorage) {
+	t.Helper()
+
+	logger := zap.NewNop().Sugar()
+	owner := context.WithValue(context.Background(), helpers.UserID, "owner")
+	reader := context.WithValue(context.Background(), helpers.UserID, "reader")
+	manager := context.WithValue(context.Background(), helpers.UserID, "manager")
+	stranger := context.WithValue(context.Background(), helpers.UserID, "stranger")
+
+	shortURL, err := storage.SaveURL(owner, "https://example.com/shared")
+	require.NoError(t, err)
+
+	access, err := storage.URLAccess(owner, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, AccessOwner, access)
+	_, err = storage.URLAccess(stranger, shortURL)
+	assert.ErrorIs(t, err, helpers.ErrNotFound)
+
+	require.NoError(t, storage.ShareURL(owner, shortURL, "reader", AccessRead))
+	require.NoError(t, storage.ShareURL(owner, shortURL, "manager", AccessManage))
+	assert.ErrorIs(t, storage.ShareURL(owner, shortURL, "owner", AccessRead), helpers.ErrShareInvalid)
+	assert.ErrorIs(t, storage.ShareURL(owner, shortURL, "reader", AccessOwner), helpers.ErrShareInvalid)
+	assert.ErrorIs(t, storage.ShareURL(stranger, shortURL, "stranger", AccessManage), helpers.ErrNotFound)
+	assert.ErrorIs(t, storage.ShareURL(reader, shortURL, "stranger", AccessRead), helpers.ErrForbidden)
+	assert.ErrorIs(t, storage.TransferURL(reader, shortURL, "reader"), helpers.ErrForbidden)
+
+	shares, err := storage.GetURLShares(manager, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, []Share{{UserID: "manager", Access: AccessManage}, {UserID: "reader", Access: AccessRead}}, shares)
+	_, err = storage.GetURLShares(reader, shortURL)
+	assert.ErrorIs(t, err, helpers.ErrForbidden)
+
+	userURLs, err := storage.GetUserURLs(reader, "http://localhost")
+	require.NoError(t, err)
+	require.Len(t, userURLs, 1)
+	assert.Equal(t, AccessRead, userURLs[0].Access)
+	assert.Equal(t, "https://example.com/shared", userURLs[0].OriginalURL)
+
+	// доступ read не позволяет удалить ссылку
+	require.NoError(t, storage.DeleteUserURLs(reader, []string{shortURL}, logger))
+	_, err = storage.GetByID(owner, shortURL)
+	require.NoError(t, err)
+
+	// пользователь может отказаться от своего доступа сам
+	require.NoError(t, storage.RevokeURLShare(reader, shortURL, "reader"))
+	_, err = storage.URLAccess(reader, shortURL)
+	assert.ErrorIs(t, err, helpers.ErrNotFound)
+
+	// доступ manage не позволяет передать ссылку, передает ее только владелец
+	assert.ErrorIs(t, storage.TransferURL(manager, shortURL, "manager"), helpers.ErrForbidden)
+	access, err = storage.URLAccess(owner, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, AccessOwner, access)
+
+	// новый владелец теряет прежний доступ manage, прежний владелец - доступ к ссылке
+	require.NoError(t, storage.TransferURL(owner, shortURL, "manager"))
+	access, err = storage.URLAccess(manager, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, AccessOwner, access)
+	_, err = storage.URLAccess(owner, shortURL)
+	assert.ErrorIs(t, err, helpers.ErrNotFound)
+	shares, err = storage.GetURLShares(manager, shortURL)
+	require.NoError(t, err)
+	assert.Empty(t, shares)
+
+	userURLs, err = storage.GetUserURLs(manager, "http://localhost")
+	require.NoError(t, err)
+	require.Len(t, userURLs, 1)
+	assert.Empty(t, userURLs[0].Access)
+
+	// доступ manage позволяет удалить ссылку
+	require.NoError(t, storage.ShareURL(manager, shortURL, "owner", AccessManage))
+	require.NoError(t, storage.DeleteUserURLs(owner, []string{shortURL}, logger))
+	_, err = storage.GetByID(manager, shortURL)
+	var conflictErr *helpers.ConflictError
+	assert.ErrorAs(t, err, &conflictErr)
+	_, err = storage.URLAccess(manager, shortURL)
+	assert.ErrorIs(t, err, helpers.ErrNotFound)
+}
+
+func TestMemoryStorage_Sharing(t *testing.T) {
+	storage, err := NewMemoryStorage(context.Background())
+	require.NoError(t, err)
+
+	testURLSharing(t, storage)
+}
+
+func TestFileStorage_Sharing(t *testing.T) {
+	fileName := t.TempDir() + "/storage.json"
+	logger := zap.NewNop().Sugar()
+	storage, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+	defer func() { _ = storage.Close() }()
+
+	testURLSharing(t, storage)
+}
+
+func TestFileStorage_SharingReplay(t *testing.T) {
+	fileName := t.TempDir() + "/storage.json"
+	logger := zap.NewNop().Sugar()
+	storage, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+
+	owner := context.WithValue(context.Background(), helpers.UserID, "owner")
+	shortURL, err := storage.SaveURL(owner, "https://example.com/shared")
+	require.NoError(t, err)
+	require.NoError(t, storage.ShareURL(owner, shortURL, "reader", AccessRead))
+	require.NoError(t, storage.ShareURL(owner, shortURL, "manager", AccessManage))
+	require.NoError(t, storage.TransferURL(owner, shortURL, "heir"))
+	heir := context.WithValue(context.Background(), helpers.UserID, "heir")
+	require.NoError(t, storage.RevokeURLShare(heir, shortURL, "reader"))
+	require.NoError(t, storage.Close())
+
+	// после воспроизведения журнала и после компактизации состояние доступов одинаково
+	for range 2 {
+		reloaded, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+		require.NoError(t, err)
+
+		shares, err := reloaded.GetURLShares(heir, shortURL)
+		require.NoError(t, err)
+		assert.Equal(t, []Share{{UserID: "manager", Access: AccessManage}}, shares)
+		_, err = reloaded.URLAccess(owner, shortURL)
+		assert.ErrorIs(t, err, helpers.ErrNotFound)
+
+		require.NoError(t, reloaded.Compact())
+		require.NoError(t, reloaded.Close())
+	}
+}
+
+func TestRedisStorage_Sharing(t *testing.T) {
+	storage, server := newTestRedisStorage(t)
+
+	testURLSharing(t, storage)
+
+	// жесткое удаление очищает доступы
+	_, err := storage.DeleteHard(context.Background(), time.Now())
+	require.NoError(t, err)
+	for _, key := range server.Keys() {
+		assert.False(t, strings.HasPrefix(key, redisPrefix+"shares:"), key)
+		assert.False(t, strings.HasPrefix(key, redisPrefix+"shared:"), key)
+	}
+}
+
+// testDeleteURLs проверка пакетного удаления ссылок нескольких пользователей.
+func testDeleteURLs(t *testing.T, storage URLStorage) (deleted, kept []string) {
+	t.Helper()
+
+	ctx1 := context.WithValue(context.Background(), helpers.UserID, "user1")
+	ctx2 := context.WithValue(context.Background(), helpers.UserID, "user2")
+
+	first, err := storage.SaveURL(ctx1, "https://example.com/first")
+	require.NoError(t, err)
+	second, err := storage.SaveURL(ctx2, "https://example.com/second")
+	require.NoError(t, err)
+	foreign, err := storage.SaveURL(ctx2, "https://example.com/foreign")
+	require.NoError(t, err)
+
+	require.NoError(t, storage.DeleteURLs(context.Background(), []DeleteRequest{
+		{UserID: "user1", ShortURLs: []string{first, foreign}},
+		{UserID: "user2", ShortURLs: []string{second}},
+		{UserID: "user2"},
+	}))
+	require.NoError(t, storage.DeleteURLs(context.Background(), nil))
+
+	var conflictErr *helpers.ConflictError
+	for _, shortURL := range []string{first, second} {
+		_, err = storage.GetByID(ctx1, shortURL)
+		assert.ErrorAs(t, err, &conflictErr)
+	}
+
+	// чужая ссылка не удаляется
+	_, err = storage.GetByID(ctx2, foreign)
+	assert.NoError(t, err)
+
+	return []string{first, second}, []string{foreign}
+}
+
+func TestMemoryStorage_DeleteURLs(t *testing.T) {
+	storage, err := NewMemoryStorage(context.Background())
+	require.NoError(t, err)
+
+	testDeleteURLs(t, storage)
+}
+
+func TestFileStorage_DeleteURLs(t *testing.T) {
+	fileName := t.TempDir() + "/storage.json"
+	logger := zap.NewNop().Sugar()
+	storage, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+
+	deleted, kept := testDeleteURLs(t, storage)
+	require.NoError(t, storage.Close())
+
+	reloaded, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+	defer func() { _ = reloaded.Close() }()
+
+	ctx := context.Background()
+	for _, shortURL := range deleted {
+		record, err := reloaded.GetShortURL(ctx, shortURL)
+		require.NoError(t, err)
+		assert.True(t, record.IsDeleted)
+	}
+	for _, shortURL := range kept {
+		record, err := reloaded.GetShortURL(ctx, shortURL)
+		require.NoError(t, err)
+		assert.False(t, record.IsDeleted)
+	}
+}
+
+func TestRedisStorage_DeleteURLs(t *testing.T) {
+	storage, _ := newTestRedisStorage(t)
+
+	testDeleteURLs(t, storage)
+
+	stats, err := storage.GetStats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &InternalStats{URLs: 1, Users: 1}, stats)
+}
+
+// testTrash проверка корзины и восстановления мягко удаленных ссылок, возвращает ссылку, оставшуюся
+// в корзине владельца с доступом read у пользователя reader.
+func testTrash(t *testing.T, storage URLStorage) string {
+	t.Helper()
+
+	owner := context.WithValue(context.Background(), helpers.UserID, "owner")
+	reader := context.WithValue(context.Background(), helpers.UserID, "reader")
+	manager := context.WithValue(context.Background(), helpers.UserID, "manager")
+
+	first, err := storage.SaveURL(owner, "https://example.com/trash-first")
+	require.NoError(t, err)
+	second, err := storage.SaveURL(owner, "https://example.com/trash-second")
+	require.NoError(t, err)
+	require.NoError(t, storage.ShareURL(owner, first, "reader", AccessRead))
+	require.NoError(t, storage.ShareURL(owner, second, "manager", AccessManage))
+
+	deleted, err := storage.GetDeletedURLs(owner, "http://localhost")
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	require.NoError(t, storage.DeleteURLs(context.Background(), []DeleteRequest{
+		{UserID: "owner", ShortURLs: []string{first, second}},
+	}))
+
+	deleted, err = storage.GetDeletedURLs(owner, "http://localhost")
+	require.NoError(t, err)
+	require.Len(t, deleted, 2)
+	shortURLs := make([]string, 0, len(deleted))
+	for _, v := range deleted {
+		shortURLs = append(shortURLs, v.ShortURL)
+		require.NotNil(t, v.DeletedAt)
+		assert.WithinDuration(t, time.Now(), *v.DeletedAt, time.Minute)
+		assert.Empty(t, v.Access)
+	}
+	assert.ElementsMatch(t, []string{"http://localhost/" + first, "http://localhost/" + second}, shortURLs)
+
+	// в корзине пользователя видны чужие ссылки с доступом manage
+	deleted, err = storage.GetDeletedURLs(manager, "http://localhost")
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "http://localhost/"+second, deleted[0].ShortURL)
+	assert.Equal(t, "https://example.com/trash-second", deleted[0].OriginalURL)
+	assert.Equal(t, AccessManage, deleted[0].Access)
+	deleted, err = storage.GetDeletedURLs(reader, "http://localhost")
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	// доступ read не позволяет восстановить ссылку, ссылки восстанавливаются все вместе или ни одна
+	assert.ErrorIs(t, storage.RestoreURLs(reader, []string{first}), helpers.ErrNotFound)
+	assert.ErrorIs(t, storage.RestoreURLs(owner, []string{second, "missing"}), helpers.ErrNotFound)
+	_, err = storage.GetByID(owner, second)
+	var conflictErr *helpers.ConflictError
+	assert.ErrorAs(t, err, &conflictErr)
+
+	require.NoError(t, storage.RestoreURLs(manager, []string{second, second}))
+	originalURL, err := storage.GetByID(owner, second)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/trash-second", originalURL)
+	access, err := storage.URLAccess(manager, second)
+	require.NoError(t, err)
+	assert.Equal(t, AccessManage, access)
+	assert.ErrorIs(t, storage.RestoreURLs(owner, []string{second}), helpers.ErrNotFound)
+
+	// истекшая ссылка не показывается в корзине и не восстанавливается
+	expiresAt := time.Now().Add(-time.Minute)
+	expired, err := storage.SaveURLWithOptions(owner, "https://example.com/trash-expired",
+		SaveOptions{ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+	require.NoError(t, storage.DeleteURLs(context.Background(), []DeleteRequest{
+		{UserID: "owner", ShortURLs: []string{expired}},
+	}))
+	assert.ErrorIs(t, storage.RestoreURLs(owner, []string{expired}), helpers.ErrNotFound)
+
+	deleted, err = storage.GetDeletedURLs(owner, "http://localhost")
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "http://localhost/"+first, deleted[0].ShortURL)
+
+	stats, err := storage.GetStats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &InternalStats{URLs: 1, Users: 1}, stats)
+
+	return first
+}
+
+func TestMemoryStorage_Trash(t *testing.T) {
+	storage, err := NewMemoryStorage(context.Background())
+	require.NoError(t, err)
+
+	testTrash(t, storage)
+}
+
+// testDeleteHardRetention жесткое удаление не затрагивает ссылки, удаленные позже границы срока хранения.
+func testDeleteHardRetention(t *testing.T, storage URLStorage) string {
+	t.Helper()
+
+	owner := context.WithValue(context.Background(), helpers.UserID, "owner")
+	old, err := storage.SaveURL(owner, "https://example.com/retention-old")
+	require.NoError(t, err)
+	recent, err := storage.SaveURL(owner, "https://example.com/retention-recent")
+	require.NoError(t, err)
+	live, err := storage.SaveURL(owner, "https://example.com/retention-live")
+	require.NoError(t, err)
+
+	// истекшие ссылки хранятся столько же, сколько удаленные, считая от момента истечения
+	expiredOldAt := time.Now()
+	expiredOld, err := storage.SaveURLWithOptions(owner, "https://example.com/retention-expired-old",
+		SaveOptions{ExpiresAt: &expiredOldAt})
+	require.NoError(t, err)
+	require.NoError(t, storage.DeleteURLs(context.Background(), []DeleteRequest{
+		{UserID: "owner", ShortURLs: []string{old}},
+	}))
+	time.Sleep(2 * time.Millisecond)
+	deletedBefore := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	expiredRecentAt := time.Now()
+	expiredRecent, err := storage.SaveURLWithOptions(owner, "https://example.com/retention-expired-recent",
+		SaveOptions{ExpiresAt: &expiredRecentAt})
+	require.NoError(t, err)
+	require.NoError(t, storage.DeleteURLs(context.Background(), []DeleteRequest{
+		{UserID: "owner", ShortURLs: []string{recent}},
+	}))
+
+	removed, err := storage.DeleteHard(context.Background(), deletedBefore.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+
+	removed, err = storage.DeleteHard(context.Background(), deletedBefore)
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	assert.False(t, storage.IsExists(owner, expiredOld))
+	assert.True(t, storage.IsExists(owner, expiredRecent))
+	_, err = storage.GetByID(owner, expiredRecent)
+	assert.ErrorIs(t, err, helpers.ErrExpired)
+
+	deleted, err := storage.GetDeletedURLs(owner, "http://localhost")
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "http://localhost/"+recent, deleted[0].ShortURL)
+	assert.False(t, storage.IsExists(owner, old))
+	assert.True(t, storage.IsExists(owner, live))
+
+	return recent
+}
+
+func TestMemoryStorage_DeleteHardRetention(t *testing.T) {
+	storage, err := NewMemoryStorage(context.Background())
+	require.NoError(t, err)
+
+	testDeleteHardRetention(t, storage)
+}
+
+func TestFileStorage_DeleteHardRetention(t *testing.T) {
+	fileName := t.TempDir() + "/storage.json"
+	logger := zap.NewNop().Sugar()
+	storage, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+
+	recent := testDeleteHardRetention(t, storage)
+	require.NoError(t, storage.Close())
+
+	// при воспроизведении журнала используется граница срока хранения из события
+	reloaded, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+	defer func() { _ = reloaded.Close() }()
+
+	owner := context.WithValue(context.Background(), helpers.UserID, "owner")
+	deleted, err := reloaded.GetDeletedURLs(owner, "http://localhost")
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "http://localhost/"+recent, deleted[0].ShortURL)
+}
+
+func TestRedisStorage_DeleteHardRetention(t *testing.T) {
+	storage, _ := newTestRedisStorage(t)
+
+	testDeleteHardRetention(t, storage)
+}
+
+func TestFileStorage_Trash(t *testing.T) {
+	fileName := t.TempDir() + "/storage.json"
+	logger := zap.NewNop().Sugar()
+	storage, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+
+	first := testTrash(t, storage)
+	owner := context.WithValue(context.Background(), helpers.UserID, "owner")
+	deleted, err := storage.GetDeletedURLs(owner, "http://localhost")
+	require.NoError(t, err)
+	require.NoError(t, storage.Close())
+
+	// момент удаления и доступы к удаленной ссылке сохраняются при воспроизведении журнала и компактизации
+	for range 2 {
+		reloaded, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+		require.NoError(t, err)
+
+		reloadedDeleted, err := reloaded.GetDeletedURLs(owner, "http://localhost")
+		require.NoError(t, err)
+		require.Len(t, reloadedDeleted, 1)
+		assert.True(t, deleted[0].DeletedAt.Equal(*reloadedDeleted[0].DeletedAt))
+
+		require.NoError(t, reloaded.Compact())
+		require.NoError(t, reloaded.Close())
+	}
+
+	reloaded, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+	defer func() { _ = reloaded.Close() }()
+
+	require.NoError(t, reloaded.RestoreURLs(owner, []string{first}))
+	reader := context.WithValue(context.Background(), helpers.UserID, "reader")
+	access, err := reloaded.URLAccess(reader, first)
+	require.NoError(t, err)
+	assert.Equal(t, AccessRead, access)
+}
+
+func TestRedisStorage_Trash(t *testing.T) {
+	storage, _ := newTestRedisStorage(t)
+
+	first := testTrash(t, storage)
+
+	// оригинальный URL удаленной ссылки сокращен заново, восстановление конфликтует с новой ссылкой
+	owner := context.WithValue(context.Background(), helpers.UserID, "owner")
+	again, err := storage.SaveURL(owner, "https://example.com/trash-first")
+	require.NoError(t, err)
+
+	var restoreErr *helpers.RestoreConflictError
+	require.ErrorAs(t, storage.RestoreURLs(owner, []string{first}), &restoreErr)
+	assert.Equal(t, helpers.RestoreConflictError{
+		ShortURL: first,
+		Existing: again,
+		Field:    helpers.RestoreConflictOriginal,
+	}, *restoreErr)
+
+	// восстанавливаемые ссылки конфликтуют и между собой
+	require.NoError(t, storage.DeleteURLs(context.Background(), []DeleteRequest{
+		{UserID: "owner", ShortURLs: []string{again}},
+	}))
+	require.ErrorAs(t, storage.RestoreURLs(owner, []string{again, first}), &restoreErr)
+	assert.Equal(t, first, restoreErr.ShortURL)
+	assert.Equal(t, again, restoreErr.Existing)
+	assert.ErrorIs(t, restoreErr, helpers.ErrRestoreConflict)
+
+	_, err = storage.GetByID(owner, again)
+	var conflictErr *helpers.ConflictError
+	assert.ErrorAs(t, err, &conflictErr)
+
+	// жесткое удаление очищает корзину
+	_, err = storage.DeleteHard(context.Background(), time.Now())
+	require.NoError(t, err)
+	deleted, err := storage.GetDeletedURLs(owner, "http://localhost")
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+}
+
+func testUserURLsPage(t *testing.T, storage URLStorage) {
+	t.Helper()
+
+	owner := context.WithValue(context.Background(), helpers.UserID, "owner")
+	other := context.WithValue(context.Background(), helpers.UserID, "other")
+
+	var want []string
+	for i := range 5 {
+		short, err := storage.SaveURL(owner, fmt.Sprintf("https://example.com/page-%d", i))
+		require.NoError(t, err)
+		want = append(want, short)
+	}
+	_, err := storage.SaveURL(other, "https://example.com/page-other")
+	require.NoError(t, err)
+	require.NoError(t, storage.DeleteURLs(context.Background(), []DeleteRequest{
+		{UserID: "owner", ShortURLs: []string{want[1]}},
+	}))
+
+	var got []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, len(want)+2, "обход ссылок не завершается")
+
+		page, next, err := storage.GetUserURLsPage(owner, cursor, 2)
+		require.NoError(t, err)
+		for _, record := range page {
+			got = append(got, record.ShortURL)
+			assert.Equal(t, "owner", record.UserID)
+			assert.NotNil(t, record.CreatedAt)
+			assert.Equal(t, record.ShortURL == want[1], record.IsDeleted)
+			assert.Equal(t, record.ShortURL == want[1], record.DeletedAt != nil)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	assert.ElementsMatch(t, want, got)
+
+	_, _, err = storage.GetUserURLsPage(owner, "bad", 2)
+	assert.Error(t, err)
+}
+
+func TestMemoryStorage_UserURLsPage(t *testing.T) {
+	storage, err := NewMemoryStorage(context.Background())
+	require.NoError(t, err)
+
+	testUserURLsPage(t, storage)
+}
+
+func TestFileStorage_UserURLsPage(t *testing.T) {
+	fileName := t.TempDir() + "/storage.json"
+	logger := zap.NewNop().Sugar()
+	storage, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+
+	testUserURLsPage(t, storage)
+	require.NoError(t, storage.Close())
+
+	// момент создания сохраняется в журнале
+	reloaded, err := NewFileStorage(context.Background(), fileName, FileStorageConfig{}, logger)
+	require.NoError(t, err)
+	defer func() { _ = reloaded.Close() }()
+
+	owner := context.WithValue(context.Background(), helpers.UserID, "owner")
+	page, next, err := reloaded.GetUserURLsPage(owner, "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	require.Len(t, page, 5)
+	for _, record := range page {
+		assert.NotNil(t, record.CreatedAt)
+	}
+}
+
+func TestRedisStorage_UserURLsPage(t *testing.T) {
+	storage, _ := newTestRedisStorage(t)
+
+	testUserURLsPage(t, storage)
+}